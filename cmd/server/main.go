@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
-	"os"
 
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/config"
+	"hackathon-go/internal/queue"
 	"hackathon-go/internal/storage"
 	"hackathon-go/pkg/handler"
 
@@ -11,19 +15,63 @@ import (
 )
 
 func main() {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+
+	options := comparison.DefaultOptions()
+	if cfg.OptionsFile != "" {
+		options, err = comparison.LoadOptions(cfg.OptionsFile)
+		if err != nil {
+			log.Fatalf("failed to load comparison options: %v", err)
+		}
 	}
-	redisClient, err := storage.NewRedisClient(redisAddr)
+
+	blobs, err := blob.NewDirStore(cfg.BlobDir)
 	if err != nil {
-		log.Fatalf("failed to connect to redis: %v", err)
+		log.Fatalf("failed to open blob store: %v", err)
 	}
 
-	uploadHandler := &handler.UploadHandler{Redis: redisClient}
-	resultsHandler := &handler.ResultsHandler{Redis: redisClient}
-	jobsHandler := &handler.JobsHandler{Redis: redisClient}
-	wsHandler := &handler.WebSocketHandler{}
+	// Running jobs are abandoned once their task would have been delivered again
+	go storage.RunSweeper(store, blobs, cfg.SweepInterval, cfg.Queue.VisibilityTimeout)
+
+	jobQueue, err := queue.New(cfg.Queue)
+	if err != nil {
+		log.Fatalf("failed to open job queue: %v", err)
+	}
+
+	uploadHandler := &handler.UploadHandler{
+		Store:              store,
+		Blobs:              blobs,
+		Queue:              jobQueue,
+		Options:            options,
+		StreamingThreshold: cfg.StreamingThreshold,
+		SpillDir:           cfg.SpillDir,
+		Retention:          cfg.Retention,
+	}
+	resultsHandler := &handler.ResultsHandler{Store: store, Blobs: blobs}
+	jobsHandler := &handler.JobsHandler{Store: store, Blobs: blobs, Retention: cfg.Retention}
+	ignoreRulesHandler := &handler.IgnoreRulesHandler{Store: store}
+	storageHandler := &handler.StorageHandler{Store: store}
+	queueHandler := &handler.QueueHandler{Queue: jobQueue}
+	wsHandler := &handler.WebSocketHandler{Store: store}
+
+	// Comparisons run on in-process workers, and on any cmd/worker process
+	for i := 0; i < cfg.Workers; i++ {
+		worker := &queue.Worker{
+			Queue:       jobQueue,
+			Handle:      uploadHandler.RunJob,
+			Failed:      uploadHandler.JobFailed,
+			Heartbeat:   uploadHandler.JobHeartbeat,
+			ExtendEvery: cfg.Queue.VisibilityTimeout / 3,
+		}
+		go worker.Run(context.Background())
+	}
 
 	router := gin.Default()
 	
@@ -43,9 +91,25 @@ func main() {
 	router.POST("/upload", uploadHandler.HandleUpload)
 	router.GET("/results/:job_id", resultsHandler.HandleGetResult)
 	router.GET("/results/:job_id/export", resultsHandler.HandleExportResult)
+	router.GET("/results/:job_id/facets", resultsHandler.HandleGetFacets)
+	router.GET("/results/:job_id/summary", resultsHandler.HandleGetSummary)
+	router.GET("/results/:job_id/corrected", resultsHandler.HandleGetCorrected)
+	router.GET("/results/:job_id/three-way", resultsHandler.HandleGetThreeWay)
 	router.GET("/jobs", jobsHandler.HandleGetJobs)
 	router.GET("/jobs/:job_id/status", jobsHandler.HandleGetJobStatus)
+	router.GET("/jobs/:job_id/source", jobsHandler.HandleGetJobSource)
+	router.PUT("/jobs/:job_id/retention", jobsHandler.HandleSetJobRetention)
+	router.DELETE("/jobs/:job_id", jobsHandler.HandleDeleteJob)
+	router.GET("/jobs/:job_id/diff/:other", jobsHandler.HandleGetJobDiff)
 	router.GET("/ws/:job_id", wsHandler.HandleWebSocket)
+	router.GET("/storage/stats", storageHandler.HandleGetStats)
+	router.GET("/queue/stats", queueHandler.HandleGetStats)
+	router.GET("/queue/dead-letters", queueHandler.HandleGetDeadLetters)
+	router.GET("/ignore-rules", ignoreRulesHandler.HandleListIgnoreRules)
+	router.POST("/ignore-rules", ignoreRulesHandler.HandleCreateIgnoreRule)
+	router.GET("/ignore-rules/:rule_id", ignoreRulesHandler.HandleGetIgnoreRule)
+	router.PUT("/ignore-rules/:rule_id", ignoreRulesHandler.HandleUpdateIgnoreRule)
+	router.DELETE("/ignore-rules/:rule_id", ignoreRulesHandler.HandleDeleteIgnoreRule)
 
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("failed to run server: %v", err)
@@ -0,0 +1,85 @@
+// Command worker runs the comparisons queued by the API servers. It reads the same
+// environment as the server for storage, uploads, retention and the queue, so workers and
+// servers can be scaled independently.
+//
+// Usage:
+//
+//	WORKERS=4 go run ./cmd/worker
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/config"
+	"hackathon-go/internal/queue"
+	"hackathon-go/internal/storage"
+	"hackathon-go/pkg/handler"
+)
+
+func main() {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Queue.Backend == queue.BackendMemory {
+		log.Fatalf("the memory queue can't be shared with the server, run its workers in-process with WORKERS")
+	}
+	switch cfg.Storage.Backend {
+	case storage.BackendMemory, storage.BackendFS:
+		log.Fatalf("the %s storage backend can't be shared with the server, use redis or run its workers in-process with WORKERS", cfg.Storage.Backend)
+	}
+	if cfg.Workers <= 0 {
+		log.Fatalf("invalid WORKERS: %d, a worker process needs at least one", cfg.Workers)
+	}
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	blobs, err := blob.NewDirStore(cfg.BlobDir)
+	if err != nil {
+		log.Fatalf("failed to open blob store: %v", err)
+	}
+	jobQueue, err := queue.New(cfg.Queue)
+	if err != nil {
+		log.Fatalf("failed to open job queue: %v", err)
+	}
+
+	// Only the fields used to run jobs are needed
+	jobs := &handler.UploadHandler{
+		Store:     store,
+		Blobs:     blobs,
+		Queue:     jobQueue,
+		SpillDir:  cfg.SpillDir,
+		Retention: cfg.Retention,
+	}
+
+	// On SIGINT or SIGTERM, workers finish their current job and exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		worker := &queue.Worker{
+			Queue:       jobQueue,
+			Handle:      jobs.RunJob,
+			Failed:      jobs.JobFailed,
+			Heartbeat:   jobs.JobHeartbeat,
+			ExtendEvery: cfg.Queue.VisibilityTimeout / 3,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.Run(ctx)
+		}()
+	}
+	log.Printf("running %d workers", cfg.Workers)
+	wg.Wait()
+	log.Printf("workers stopped")
+}
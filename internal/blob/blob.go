@@ -0,0 +1,139 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned when no blob has the requested hash.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps files by content hash, the hex SHA-256 of their bytes. Storing the same
+// bytes twice keeps a single copy.
+type Store interface {
+	Put(r io.Reader) (hash string, size int64, err error)
+	Open(hash string) (io.ReadCloser, error)
+	Delete(hash string) error
+	List() ([]Info, error)
+}
+
+// Info describes a stored blob.
+type Info struct {
+	Hash     string
+	Size     int64
+	StoredAt time.Time // Last time the blob was put
+}
+
+// DirStore is a Store keeping each blob in a file of a local directory, under a
+// subdirectory named after the first two characters of its hash.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a DirStore in dir, created if needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	if dir == "" {
+		return nil, errors.New("the blob store needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// validHash reports whether hash is a hex SHA-256, so it can't escape the directory.
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Put stores the bytes of r and returns their hash and size. The bytes are hashed while
+// written to a temporary file, which then becomes the blob.
+func (s *DirStore) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	path := s.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		// Already stored: the put still counts as a use for List
+		now := time.Now()
+		return hash, size, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+// Open returns a reader of a blob.
+func (s *DirStore) Open(hash string) (io.ReadCloser, error) {
+	if !validHash(hash) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes a blob. Removing a missing blob is not an error.
+func (s *DirStore) Delete(hash string) error {
+	if !validHash(hash) {
+		return nil
+	}
+	if err := os.Remove(s.path(hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns every stored blob.
+func (s *DirStore) List() ([]Info, error) {
+	var blobs []Info
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !validHash(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, Info{Hash: d.Name(), Size: info.Size(), StoredAt: info.ModTime()})
+		return nil
+	})
+	return blobs, err
+}
@@ -0,0 +1,135 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *DirStore {
+	t.Helper()
+	s, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPutAndOpen(t *testing.T) {
+	s := newTestStore(t)
+	tests := []string{"", "id,nome\n1,Arroz\n", strings.Repeat("x", 1<<20)}
+	for _, content := range tests {
+		sum := sha256.Sum256([]byte(content))
+		want := hex.EncodeToString(sum[:])
+
+		hash, size, err := s.Put(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != want || size != int64(len(content)) {
+			t.Errorf("Put = %s, %d, want %s, %d", hash, size, want, len(content))
+		}
+
+		r, err := s.Open(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != content {
+			t.Errorf("Open(%s) read %d bytes, %v, want %d bytes", hash, len(data), err, len(content))
+		}
+	}
+}
+
+func TestPutTwiceKeepsOneCopy(t *testing.T) {
+	s := newTestStore(t)
+	hash, _, err := s.Put(strings.NewReader("same"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(s.path(hash), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	again, _, err := s.Put(strings.NewReader("same"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != hash {
+		t.Fatalf("second Put = %s, want %s", again, hash)
+	}
+
+	blobs, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 {
+		t.Fatalf("List = %+v, want one blob", blobs)
+	}
+	if time.Since(blobs[0].StoredAt) > time.Minute {
+		t.Errorf("StoredAt = %v, want the time of the second Put", blobs[0].StoredAt)
+	}
+}
+
+func TestListSkipsTemporaryFiles(t *testing.T) {
+	s := newTestStore(t)
+	hash, _, err := s.Put(strings.NewReader("kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A put interrupted before its rename
+	if err := os.WriteFile(filepath.Join(s.dir, ".tmp-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || blobs[0].Hash != hash || blobs[0].Size != 4 {
+		t.Errorf("List = %+v, want only %s", blobs, hash)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := newTestStore(t)
+	hash, _, err := s.Put(strings.NewReader("gone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(hash); err != ErrNotFound {
+		t.Errorf("Open of a deleted blob: %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(hash); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestInvalidHashes(t *testing.T) {
+	s := newTestStore(t)
+	tests := []string{"", "abc", "../../etc/passwd", strings.Repeat("z", 64), strings.Repeat("a", 63) + "/"}
+	for _, hash := range tests {
+		if _, err := s.Open(hash); err != ErrNotFound {
+			t.Errorf("Open(%q): %v, want ErrNotFound", hash, err)
+		}
+		if err := s.Delete(hash); err != nil {
+			t.Errorf("Delete(%q): %v", hash, err)
+		}
+	}
+}
+
+func TestNewDirStoreNeedsADirectory(t *testing.T) {
+	if _, err := NewDirStore(""); err == nil {
+		t.Error("NewDirStore accepted an empty directory")
+	}
+}
@@ -0,0 +1,49 @@
+package comparison
+
+import (
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/rules"
+)
+
+// ruleChecker evaluates the business rules of the options on individual records.
+type ruleChecker []*rules.Compiled
+
+// newRuleChecker compiles the rules of opts. Invalid rules are skipped; they are rejected
+// when the options are validated.
+func newRuleChecker(opts Options) ruleChecker {
+	var checker ruleChecker
+	for _, rule := range opts.Rules {
+		if compiled, err := rules.Compile(rule); err == nil {
+			checker = append(checker, compiled)
+		}
+	}
+	return checker
+}
+
+// check appends a rule_violation discrepancy to errors for every rule the record fails.
+func (rc ruleChecker) check(errors []models.ErrorDetail, p models.Product, side string) []models.ErrorDetail {
+	for _, rule := range rc {
+		if !rule.AppliesTo(side) || rule.Holds(&p) {
+			continue
+		}
+		record := p
+		// The violating record is always embedded, whether or not opts.Records is set
+		errDetail := models.ErrorDetail{
+			Type:       "rule_violation",
+			APIID:      p.ID,
+			Nome:       p.Nome,
+			Categoria:  p.Categoria,
+			Fornecedor: p.Fornecedor,
+			Rule:       rule.Name,
+			Side:       side,
+		}
+		if side == rules.SideCSV {
+			errDetail.CSVLine = p.CSVLine
+			errDetail.CSVRecord = &record
+		} else {
+			errDetail.APIRecord = &record
+		}
+		errors = append(errors, errDetail)
+	}
+	return errors
+}
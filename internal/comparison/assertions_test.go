@@ -0,0 +1,53 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/rules"
+)
+
+func TestRuleViolations(t *testing.T) {
+	api := []models.Product{{ID: 1, Preco: 0, Estoque: 5}, {ID: 2, Preco: 100, Estoque: 5}}
+	csv := []models.Product{{ID: 1, Preco: 0, Estoque: 5, CSVLine: 2}, {ID: 2, Preco: 100, Estoque: -1, CSVLine: 3}}
+	opts := DefaultOptions()
+	opts.Rules = []rules.Rule{
+		{Name: "positive_price", Expr: "preco > 0"},
+		{Name: "stock_not_negative", Expr: "estoque >= 0", Sides: []string{rules.SideCSV}},
+	}
+
+	result := CompareProducts(api, csv, opts)
+	type violation struct {
+		id         int
+		rule, side string
+	}
+	var got []violation
+	for _, e := range result.Errors {
+		if e.Type != "rule_violation" {
+			continue
+		}
+		got = append(got, violation{e.APIID, e.Rule, e.Side})
+		if (e.Side == rules.SideAPI) != (e.APIRecord != nil) || (e.Side == rules.SideCSV) != (e.CSVRecord != nil) {
+			t.Errorf("violation %+v doesn't carry the record of its side", e)
+		}
+		if e.Side == rules.SideCSV && e.CSVLine == 0 {
+			t.Errorf("csv violation %+v has no line", e)
+		}
+	}
+	want := []violation{
+		{1, "positive_price", rules.SideAPI},
+		{1, "positive_price", rules.SideCSV},
+		{2, "stock_not_negative", rules.SideCSV},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("violations = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if result.Summary.RuleViolations != 3 || result.Summary.ByRule["positive_price"] != 2 {
+		t.Errorf("summary violations = %d, by rule %v", result.Summary.RuleViolations, result.Summary.ByRule)
+	}
+}
@@ -0,0 +1,99 @@
+package comparison
+
+import "hackathon-go/internal/models"
+
+// groupKey identifies the categoria and fornecedor groups a product is counted in.
+type groupKey struct {
+	categoria  string
+	fornecedor string
+}
+
+// Breakdown counts discrepancies per product categoria and per fornecedor.
+// It is used for the summary of a comparison and for facets over a filtered subset.
+type Breakdown struct {
+	ByCategoria  map[string]models.GroupBreakdown `json:"by_categoria"`
+	ByFornecedor map[string]models.GroupBreakdown `json:"by_fornecedor"`
+}
+
+// NewBreakdown returns an empty Breakdown.
+func NewBreakdown() Breakdown {
+	return Breakdown{
+		ByCategoria:  make(map[string]models.GroupBreakdown),
+		ByFornecedor: make(map[string]models.GroupBreakdown),
+	}
+}
+
+// BreakdownErrors groups a list of discrepancies, e.g. a filtered subset of a result.
+func BreakdownErrors(errors []models.ErrorDetail) Breakdown {
+	b := NewBreakdown()
+	for _, e := range errors {
+		b.AddError(e)
+	}
+	return b
+}
+
+// AddError counts a discrepancy in the groups of its product.
+func (b Breakdown) AddError(e models.ErrorDetail) {
+	update := func(groups map[string]models.GroupBreakdown, name string) {
+		g := groups[name]
+		// Rule violations and consistency findings are about records, not a comparison outcome
+		if e.Type == "rule_violation" || e.Type == "consistency" {
+			if !e.Suppressed {
+				if e.Type == "consistency" {
+					g.Consistency++
+				} else {
+					g.RuleViolations++
+				}
+			}
+			groups[name] = g
+			return
+		}
+		g.Total++
+		if e.Suppressed {
+			g.Suppressed++
+			groups[name] = g
+			return
+		}
+		switch e.Type {
+		case "mismatch":
+			g.Mismatched++
+		case "near_match":
+			g.NearMatched++
+		case "id_changed":
+			g.IDChanged++
+		case "missing_in_api":
+			g.MissingInAPI++
+		case "missing_in_csv":
+			g.MissingInCSV++
+		}
+		for fieldName, detail := range e.Fields {
+			if detail.Near || detail.SuppressedBy != "" {
+				continue
+			}
+			if g.Fields == nil {
+				g.Fields = make(map[string]int)
+			}
+			g.Fields[fieldName]++
+		}
+		groups[name] = g
+	}
+	update(b.ByCategoria, e.Categoria)
+	update(b.ByFornecedor, e.Fornecedor)
+}
+
+// addMatched counts n matching products in the given groups.
+func (b Breakdown) addMatched(key groupKey, n int) {
+	update := func(groups map[string]models.GroupBreakdown, name string) {
+		g := groups[name]
+		g.Total += n
+		g.Matched += n
+		groups[name] = g
+	}
+	update(b.ByCategoria, key.categoria)
+	update(b.ByFornecedor, key.fornecedor)
+}
+
+// summaryBreakdown returns a Breakdown writing into the summary's group maps.
+func summaryBreakdown(summary *models.Summary) Breakdown {
+	return Breakdown{ByCategoria: summary.ByCategoria, ByFornecedor: summary.ByFornecedor}
+}
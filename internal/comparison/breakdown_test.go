@@ -0,0 +1,65 @@
+package comparison
+
+import (
+	"reflect"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestBreakdownErrors(t *testing.T) {
+	errors := []models.ErrorDetail{
+		{Type: "mismatch", Categoria: "A", Fornecedor: "X", Fields: map[string]models.MismatchDetail{
+			"preco": {},
+			"nome":  {Near: true},
+		}},
+		{Type: "near_match", Categoria: "A", Fornecedor: "Y", Fields: map[string]models.MismatchDetail{"nome": {Near: true}}},
+		{Type: "missing_in_api", Categoria: "B", Fornecedor: "X"},
+		{Type: "missing_in_csv", Categoria: "B", Fornecedor: "Y", Suppressed: true},
+		{Type: "rule_violation", Categoria: "A", Fornecedor: "X"},
+		{Type: "consistency", Categoria: "A", Fornecedor: "X"},
+		{Type: "consistency", Categoria: "A", Fornecedor: "X", Suppressed: true},
+	}
+
+	got := BreakdownErrors(errors)
+	want := Breakdown{
+		ByCategoria: map[string]models.GroupBreakdown{
+			"A": {Total: 2, Mismatched: 1, NearMatched: 1, RuleViolations: 1, Consistency: 1, Fields: map[string]int{"preco": 1}},
+			"B": {Total: 2, MissingInAPI: 1, Suppressed: 1},
+		},
+		ByFornecedor: map[string]models.GroupBreakdown{
+			"X": {Total: 2, Mismatched: 1, MissingInAPI: 1, RuleViolations: 1, Consistency: 1, Fields: map[string]int{"preco": 1}},
+			"Y": {Total: 2, NearMatched: 1, Suppressed: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("breakdown = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestSummaryBreakdownCountsEveryProduct(t *testing.T) {
+	api := []models.Product{
+		{ID: 1, Categoria: "A", Fornecedor: "X", Preco: 100},
+		{ID: 2, Categoria: "A", Fornecedor: "X", Preco: 100},
+		{ID: 3, Categoria: "B", Fornecedor: "X", Preco: 100},
+	}
+	csv := []models.Product{
+		{ID: 1, Categoria: "A", Fornecedor: "X", Preco: 100, CSVLine: 2},
+		{ID: 2, Categoria: "Moved", Fornecedor: "X", Preco: 100, CSVLine: 3},
+		{ID: 4, Categoria: "C", Fornecedor: "Z", Preco: 100, CSVLine: 4},
+	}
+
+	summary := CompareProducts(api, csv, DefaultOptions()).Summary
+	want := map[string]models.GroupBreakdown{
+		// ID 2 is grouped under its API categoria
+		"A": {Total: 2, Matched: 1, Mismatched: 1, Fields: map[string]int{"categoria": 1}},
+		"B": {Total: 1, MissingInCSV: 1},
+		"C": {Total: 1, MissingInAPI: 1},
+	}
+	if !reflect.DeepEqual(summary.ByCategoria, want) {
+		t.Errorf("by categoria = %+v\nwant %+v", summary.ByCategoria, want)
+	}
+	if x := summary.ByFornecedor["X"]; x.Total != 3 || x.Matched != 1 {
+		t.Errorf("fornecedor X = %+v, want 3 products, 1 matched", x)
+	}
+}
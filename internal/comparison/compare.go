@@ -1,137 +1,395 @@
 package comparison
 
 import (
+	"encoding/json"
 	"hackathon-go/internal/models"
+	"hackathon-go/internal/rules"
 	"sync"
+	"time"
 )
 
 // CompareProducts takes two slices of products (from the API and a CSV) and compares them concurrently.
-func CompareProducts(apiProducts, csvProducts []models.Product) models.ComparisonResult {
-	apiMap := make(map[int]models.Product, len(apiProducts))
-	for _, p := range apiProducts {
-		apiMap[p.ID] = p
-	}
-
-	csvMap := make(map[int]models.Product, len(csvProducts))
-	for _, p := range csvProducts {
-		csvMap[p.ID] = p
-	}
+// Field comparisons follow the rules given in opts.
+//
+// Both inputs are indexed by ID once, then split into contiguous shards processed by a
+// bounded pool of workers (opts.Workers, defaulting to the number of CPUs). Each worker
+// only does map lookups and appends to its own buffer, so the cost stays linear in the
+// number of rows with no per-row goroutines or channels.
+func CompareProducts(apiProducts, csvProducts []models.Product, opts Options) models.ComparisonResult {
+	apiIndex := indexByID(apiProducts)
+	csvIndex := indexByID(csvProducts)
 
 	var result models.ComparisonResult
-	result.Errors = []models.ErrorDetail{}
-	
-	// Initialize the Categories map
-	result.Summary.Categories = make(map[string]int)
-	result.Summary.Categories["nome"] = 0
-	result.Summary.Categories["categoria"] = 0
-	result.Summary.Categories["preco"] = 0
-	result.Summary.Categories["estoque"] = 0
-	result.Summary.Categories["fornecedor"] = 0
-
-	errorChan := make(chan models.ErrorDetail, len(csvMap)+len(apiProducts))
-	matchedChan := make(chan bool, len(csvProducts))
+	result.Summary = newSummary()
 
-	var wg sync.WaitGroup
+	workers := opts.workerCount()
+	checker := newRuleChecker(opts)
+	csvShards := runShards(len(csvProducts), workers, func(lo, hi int) shardResult {
+		var shard shardResult
+		for i := lo; i < hi; i++ {
+			csvProduct := csvProducts[i]
+			// With duplicated IDs only the latest CSV line is compared
+			if csvIndex[csvProduct.ID] != i {
+				continue
+			}
+			shard.errors = checker.check(shard.errors, csvProduct, rules.SideCSV)
 
-	// Compare products present in the CSV against the API products
-	for id, csvProduct := range csvMap {
-		wg.Add(1)
-		go func(id int, csvProduct models.Product) {
-			defer wg.Done()
-			if apiProduct, ok := apiMap[id]; ok {
-				// Product exists in both, check for mismatches
-				mismatches := compareFields(apiProduct, csvProduct)
-				if len(mismatches) > 0 {
-					errorChan <- models.ErrorDetail{
-						Type:   "mismatch",
-						APIID:  id,
-						Fields: mismatches,
-					}
-				} else {
-					matchedChan <- true
-				}
-			} else {
+			apiPos, ok := apiIndex[csvProduct.ID]
+			if !ok {
 				// Product exists in CSV but not in API
-				errorChan <- models.ErrorDetail{
-					Type:  "missing_in_api",
-					APIID: id,
-				}
+				shard.errors = append(shard.errors, models.ErrorDetail{
+					Type:       "missing_in_api",
+					CSVLine:    csvProduct.CSVLine,
+					APIID:      csvProduct.ID,
+					Categoria:  csvProduct.Categoria,
+					Fornecedor: csvProduct.Fornecedor,
+				})
+				continue
 			}
-		}(id, csvProduct)
-	}
+
+			// Product exists in both, check for mismatches
+			apiProduct := apiProducts[apiPos]
+			mismatches := compareFields(apiProduct, csvProduct, opts)
+			if len(mismatches) == 0 {
+				shard.addMatched(apiProduct)
+				continue
+			}
+			shard.errors = append(shard.errors, models.ErrorDetail{
+				Type:       mismatchType(mismatches),
+				CSVLine:    csvProduct.CSVLine,
+				APIID:      csvProduct.ID,
+				Categoria:  apiProduct.Categoria,
+				Fornecedor: apiProduct.Fornecedor,
+				Fields:     mismatches,
+			})
+		}
+		return shard
+	})
 
 	// Find products missing in the CSV
-	for id, apiProduct := range apiMap {
-		wg.Add(1)
-		go func(id int, apiProduct models.Product) {
-			defer wg.Done()
-			if _, ok := csvMap[id]; !ok {
-				// Product exists in API but not in CSV
-				errorChan <- models.ErrorDetail{
-					Type:  "missing_in_csv",
-					APIID: id,
-					Nome:  apiProduct.Nome,
-				}
+	apiShards := runShards(len(apiProducts), workers, func(lo, hi int) shardResult {
+		var shard shardResult
+		for i := lo; i < hi; i++ {
+			apiProduct := apiProducts[i]
+			if apiIndex[apiProduct.ID] != i {
+				continue
 			}
-		}(id, apiProduct)
-	}
-
-	// A separate goroutine to wait for all comparisons to finish and then close the channels
-	go func() {
-		wg.Wait()
-		close(errorChan)
-		close(matchedChan)
-	}()
-
-	// Collect results
-	for errDetail := range errorChan {
-		result.Errors = append(result.Errors, errDetail)
-		switch errDetail.Type {
-		case "mismatch":
-			result.Summary.Mismatched++
-			// Count mismatches by category
-			for fieldName := range errDetail.Fields {
-				result.Summary.Categories[fieldName]++
+			shard.errors = checker.check(shard.errors, apiProduct, rules.SideAPI)
+			if _, ok := csvIndex[apiProduct.ID]; !ok {
+				// Product exists in API but not in CSV
+				shard.errors = append(shard.errors, models.ErrorDetail{
+					Type:       "missing_in_csv",
+					APIID:      apiProduct.ID,
+					Nome:       apiProduct.Nome,
+					Categoria:  apiProduct.Categoria,
+					Fornecedor: apiProduct.Fornecedor,
+				})
 			}
-		case "missing_in_api":
-			result.Summary.MissingInAPI++
-		case "missing_in_csv":
-			result.Summary.MissingInCSV++
+		}
+		return shard
+	})
+
+	// Collect results into a buffer sized for every shard
+	shards := append(csvShards, apiShards...)
+	total := 0
+	for _, shard := range shards {
+		total += len(shard.errors)
+	}
+	result.Errors = make([]models.ErrorDetail, 0, total)
+	breakdown := summaryBreakdown(&result.Summary)
+	for _, shard := range shards {
+		result.Errors = append(result.Errors, shard.errors...)
+		for key, n := range shard.matched {
+			result.Summary.Matched += n
+			breakdown.addMatched(key, n)
 		}
 	}
 
-	for range matchedChan {
-		result.Summary.Matched++
+	// Pair leftovers of the ID match that share the secondary key
+	if opts.SecondaryKey != nil {
+		result.Errors = pairRekeyedProducts(result.Errors, apiProducts, csvProducts, apiIndex, csvIndex, opts)
 	}
 
+	if opts.Consistency != nil {
+		result.Errors = append(result.Errors, checkConsistency(apiProducts, apiIndex, rules.SideAPI, opts.Consistency)...)
+		result.Errors = append(result.Errors, checkConsistency(csvProducts, csvIndex, rules.SideCSV, opts.Consistency)...)
+	}
+
+	if opts.Records {
+		attachRecords(result.Errors, apiProducts, csvProducts, apiIndex, csvIndex)
+	}
+
+	finalizer := newErrorFinalizer(opts, time.Now())
+	for i := range result.Errors {
+		finalizer.apply(&result.Errors[i])
+		countError(&result.Summary, result.Errors[i])
+	}
+	SortErrors(result.Errors)
+
+	result.Summary.Financial = financialSummary(apiProducts, csvProducts, apiIndex, csvIndex, result.Errors)
+
 	result.Summary.TotalAPIItems = len(apiProducts)
 	result.Summary.TotalCSVItems = len(csvProducts)
 
 	return result
 }
 
-func compareFields(api, csv models.Product) map[string]models.MismatchDetail {
-	fields := make(map[string]models.MismatchDetail)
-
-	fieldComparisons := map[string]struct {
-		apiValue interface{}
-		csvValue interface{}
-	}{
-		"nome":       {apiValue: api.Nome, csvValue: csv.Nome},
-		"categoria":  {apiValue: api.Categoria, csvValue: csv.Categoria},
-		"preco":      {apiValue: api.Preco, csvValue: csv.Preco},
-		"estoque":    {apiValue: api.Estoque, csvValue: csv.Estoque},
-		"fornecedor": {apiValue: api.Fornecedor, csvValue: csv.Fornecedor},
-	}
-
-	for fieldName, values := range fieldComparisons {
-		if values.apiValue != values.csvValue {
-			fields[fieldName] = models.MismatchDetail{
-				APIValue: values.apiValue,
-				CSVValue: values.csvValue,
+// financialSummary aggregates the inventory values of both sides and the price and stock
+// deltas of the discrepancies. Duplicated IDs only count once, like in the comparison.
+func financialSummary(apiProducts, csvProducts []models.Product, apiIndex, csvIndex map[int]int, errors []models.ErrorDetail) *models.FinancialSummary {
+	financial := newFinancialAccumulator()
+
+	for i, p := range apiProducts {
+		if apiIndex[p.ID] == i {
+			financial.addInventory(p, true, p)
+		}
+	}
+	for i, p := range csvProducts {
+		if csvIndex[p.ID] != i {
+			continue
+		}
+		group := p
+		if pos, ok := apiIndex[p.ID]; ok {
+			group = apiProducts[pos]
+		}
+		financial.addInventory(p, false, group)
+	}
+
+	for _, e := range errors {
+		if e.Suppressed {
+			continue
+		}
+		switch e.Type {
+		case "mismatch", "near_match":
+			financial.addPair(apiProducts[apiIndex[e.APIID]], csvProducts[csvIndex[e.APIID]], e.Fields)
+		case "id_changed":
+			financial.addPair(apiProducts[apiIndex[e.APIID]], csvProducts[csvIndex[e.CSVID]], e.Fields)
+		}
+	}
+
+	return financial.result()
+}
+
+// attachRecords embeds the full API and CSV records of each discrepancy.
+// The records point into the input slices, so they are not copied.
+func attachRecords(errors []models.ErrorDetail, apiProducts, csvProducts []models.Product, apiIndex, csvIndex map[int]int) {
+	for i := range errors {
+		e := &errors[i]
+		csvID := e.APIID
+		if e.Type == "id_changed" {
+			csvID = e.CSVID
+		}
+		if pos, ok := apiIndex[e.APIID]; ok && e.Type != "missing_in_api" && e.APIRecord == nil && e.Side != rules.SideCSV {
+			e.APIRecord = &apiProducts[pos]
+		}
+		if pos, ok := csvIndex[csvID]; ok && e.Type != "missing_in_csv" && e.CSVRecord == nil && e.Side != rules.SideAPI {
+			e.CSVRecord = &csvProducts[pos]
+		}
+	}
+}
+
+// newSummary returns an empty Summary with every field category initialized.
+func newSummary() models.Summary {
+	summary := models.Summary{
+		Categories:     make(map[string]int, len(FieldNames)),
+		NearCategories: make(map[string]int),
+		Severities:     make(map[string]int),
+		ByRule:         make(map[string]int),
+		ByCheck:        make(map[string]int),
+		ByCategoria:    make(map[string]models.GroupBreakdown),
+		ByFornecedor:   make(map[string]models.GroupBreakdown),
+	}
+	for _, field := range FieldNames {
+		summary.Categories[field] = 0
+	}
+	return summary
+}
+
+// countError adds a discrepancy to the summary counters.
+// Suppressed discrepancies and fields are only counted as suppressed.
+func countError(summary *models.Summary, errDetail models.ErrorDetail) {
+	summaryBreakdown(summary).AddError(errDetail)
+	if errDetail.Suppressed {
+		summary.Suppressed++
+		return
+	}
+	if errDetail.Severity != "" {
+		summary.Severities[errDetail.Severity]++
+	}
+
+	switch errDetail.Type {
+	case "mismatch":
+		summary.Mismatched++
+		// Count mismatches by category
+		for fieldName, detail := range errDetail.Fields {
+			if detail.SuppressedBy != "" {
+				continue
 			}
+			if detail.Near {
+				summary.NearCategories[fieldName]++
+			} else {
+				summary.Categories[fieldName]++
+			}
+		}
+	case "near_match":
+		summary.NearMatched++
+		for fieldName, detail := range errDetail.Fields {
+			if detail.SuppressedBy == "" {
+				summary.NearCategories[fieldName]++
+			}
+		}
+	case "id_changed":
+		summary.IDChanged++
+	case "missing_in_api":
+		summary.MissingInAPI++
+	case "missing_in_csv":
+		summary.MissingInCSV++
+	case "rule_violation":
+		summary.RuleViolations++
+		summary.ByRule[errDetail.Rule]++
+	case "consistency":
+		summary.Consistency++
+		summary.ByCheck[errDetail.Check]++
+	}
+}
+
+// shardResult holds the output of one worker over a contiguous range of rows.
+type shardResult struct {
+	errors  []models.ErrorDetail
+	matched map[groupKey]int // Matching products per categoria and fornecedor
+}
+
+func (s *shardResult) addMatched(p models.Product) {
+	if s.matched == nil {
+		s.matched = make(map[groupKey]int)
+	}
+	s.matched[groupKey{categoria: p.Categoria, fornecedor: p.Fornecedor}]++
+}
+
+// minShardSize keeps small inputs from being split into shards not worth a goroutine.
+const minShardSize = 4096
+
+// runShards splits [0, n) into at most workers contiguous ranges, runs fn on each of them
+// concurrently and returns the shard results in range order.
+func runShards(n, workers int, fn func(lo, hi int) shardResult) []shardResult {
+	shardCount := (n + minShardSize - 1) / minShardSize
+	if shardCount > workers {
+		shardCount = workers
+	}
+	if shardCount <= 1 {
+		return []shardResult{fn(0, n)}
+	}
+
+	size := (n + shardCount - 1) / shardCount
+	results := make([]shardResult, shardCount)
+	var wg sync.WaitGroup
+	for s := 0; s < shardCount; s++ {
+		lo, hi := s*size, min((s+1)*size, n)
+		wg.Add(1)
+		go func(s, lo, hi int) {
+			defer wg.Done()
+			results[s] = fn(lo, hi)
+		}(s, lo, hi)
+	}
+	wg.Wait()
+	return results
+}
+
+// indexByID maps each product ID to its position in the slice. When an ID is repeated, the
+// product from the latest CSV line wins whatever order the rows were parsed in; API
+// products, which have no line, use their last occurrence.
+func indexByID(products []models.Product) map[int]int {
+	index := make(map[int]int, len(products))
+	for i, p := range products {
+		if j, ok := index[p.ID]; ok && products[j].CSVLine > p.CSVLine {
+			continue
 		}
+		index[p.ID] = i
 	}
+	return index
+}
+
+// compareFields returns the differing fields of two products, or nil when they match.
+// The fields map is only allocated once a difference is found, since most rows match.
+func compareFields(api, csv models.Product, opts Options) map[string]models.MismatchDetail {
+	var fields map[string]models.MismatchDetail
+	add := func(fieldName string, detail models.MismatchDetail) {
+		if fields == nil {
+			fields = make(map[string]models.MismatchDetail, 2)
+		}
+		fields[fieldName] = detail
+	}
+
+	compareText := func(fieldName, apiValue, csvValue string) {
+		if apiValue == csvValue {
+			return
+		}
+		detail := models.MismatchDetail{
+			APIValue: apiValue,
+			CSVValue: csvValue,
+		}
+		if rule, ok := opts.Similarity[fieldName]; ok {
+			score, _ := Similarity(rule.Algorithm, apiValue, csvValue)
+			detail.Similarity = &score
+			detail.Near = score >= rule.Threshold
+		}
+		add(fieldName, detail)
+	}
+
+	compareText("nome", api.Nome, csv.Nome)
+	compareText("categoria", api.Categoria, csv.Categoria)
+
+	if api.Preco != csv.Preco {
+		if equal, delta := compareMoney(opts.Numeric["preco"], api.Preco, csv.Preco); !equal {
+			add("preco", newNumericMismatch(api.Preco, csv.Preco, delta))
+		}
+	}
+
+	if api.Estoque != csv.Estoque {
+		if equal, delta := compareNumeric(opts.Numeric["estoque"], float64(api.Estoque), float64(csv.Estoque)); !equal {
+			add("estoque", newNumericMismatch(api.Estoque, csv.Estoque, delta))
+		}
+	}
+
+	compareText("fornecedor", api.Fornecedor, csv.Fornecedor)
 
 	return fields
 }
+
+// mismatchType classifies a product with differing fields: "near_match" when every
+// difference is within its similarity threshold, "mismatch" otherwise.
+func mismatchType(fields map[string]models.MismatchDetail) string {
+	for _, detail := range fields {
+		if !detail.Near {
+			return "mismatch"
+		}
+	}
+	return "near_match"
+}
+
+// newNumericMismatch builds a MismatchDetail carrying the deltas of a numeric field.
+func newNumericMismatch(apiValue, csvValue interface{}, delta numericDelta) models.MismatchDetail {
+	detail := models.MismatchDetail{
+		APIValue: apiValue,
+		CSVValue: csvValue,
+		AbsDelta: &delta.abs,
+	}
+	if delta.hasPct {
+		detail.PctDelta = &delta.pct
+	}
+	return detail
+}
+
+// toFloat converts the numeric product field types to float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,123 @@
+package comparison
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
+)
+
+// BenchmarkCompareProducts measures the throughput and peak heap of the comparison engine
+// on synthetic catalogs where 5% of the rows differ. Sizes above 100k rows are skipped with
+// -short; run them once each with -benchtime=1x, e.g.
+//
+//	go test ./internal/comparison -run '^$' -bench CompareProducts -benchtime 1x
+func BenchmarkCompareProducts(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000, 5000000} {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			if testing.Short() && n > 100000 {
+				b.Skip("large catalog skipped in short mode")
+			}
+			apiProducts, csvProducts := generateCatalogs(n, 0.05)
+			for _, workers := range []int{1, 0} {
+				name := fmt.Sprintf("workers=%d", workers)
+				if workers == 0 {
+					name = "workers=cpus"
+				}
+				b.Run(name, func(b *testing.B) {
+					opts := DefaultOptions()
+					opts.Workers = workers
+					b.ReportAllocs()
+					runtime.GC()
+					var baseline runtime.MemStats
+					runtime.ReadMemStats(&baseline)
+					peak, stop := samplePeakHeap()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						CompareProducts(apiProducts, csvProducts, opts)
+					}
+					b.StopTimer()
+					stop()
+					b.ReportMetric(float64(n)*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+					var peakHeap uint64
+					if p := atomic.LoadUint64(peak); p > baseline.HeapInuse {
+						peakHeap = p - baseline.HeapInuse
+					}
+					b.ReportMetric(float64(peakHeap)/(1<<20), "peak-heap-MB")
+				})
+			}
+		})
+	}
+}
+
+// samplePeakHeap polls the heap in use until stop is called and records the highest value.
+func samplePeakHeap() (*uint64, func()) {
+	var peak uint64
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > atomic.LoadUint64(&peak) {
+				atomic.StoreUint64(&peak, stats.HeapInuse)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return &peak, func() {
+		close(done)
+		<-finished
+	}
+}
+
+// generateCatalogs builds an API catalog of n products and a CSV copy where a fraction of
+// rows differ, 1% are missing and 1% are extra.
+func generateCatalogs(n int, mismatchRate float64) ([]models.Product, []models.Product) {
+	rng := rand.New(rand.NewSource(42))
+	categorias := []string{"Móveis", "Hardware", "Acessórios", "Componentes", "Periféricos"}
+
+	apiProducts := make([]models.Product, n)
+	for i := range apiProducts {
+		apiProducts[i] = models.Product{
+			ID:         i + 1,
+			Nome:       fmt.Sprintf("Produto %d", i+1),
+			Categoria:  categorias[i%len(categorias)],
+			Preco:      money.FromCents(int64(rng.Intn(100000))),
+			Estoque:    rng.Intn(500),
+			Fornecedor: fmt.Sprintf("Fornecedor %d", i%500),
+		}
+	}
+
+	csvProducts := make([]models.Product, 0, n)
+	for _, p := range apiProducts {
+		roll := rng.Float64()
+		switch {
+		case roll < 0.01:
+			continue
+		case roll < 0.01+mismatchRate:
+			p.Preco += money.FromCents(int64(rng.Intn(500) + 1))
+		}
+		p.CSVLine = len(csvProducts) + 2
+		csvProducts = append(csvProducts, p)
+	}
+	for i := 0; i < n/100; i++ {
+		csvProducts = append(csvProducts, models.Product{ID: n + i + 1, Nome: "Extra", CSVLine: len(csvProducts) + 2})
+	}
+
+	return apiProducts, csvProducts
+}
@@ -0,0 +1,55 @@
+package comparison
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareProductsWorkersAgree(t *testing.T) {
+	// Enough rows to be split into several shards
+	apiProducts, csvProducts := generateCatalogs(3*minShardSize, 0.05)
+
+	opts := DefaultOptions()
+	opts.Workers = 1
+	want := CompareProducts(apiProducts, csvProducts, opts)
+	for _, workers := range []int{2, 3, 8} {
+		opts.Workers = workers
+		got := CompareProducts(apiProducts, csvProducts, opts)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: result differs from a single worker", workers)
+		}
+	}
+	if want.Summary.Mismatched == 0 || want.Summary.MissingInAPI == 0 || want.Summary.MissingInCSV == 0 {
+		t.Errorf("summary = %+v, want every kind of discrepancy", want.Summary)
+	}
+}
+
+func TestRunShards(t *testing.T) {
+	tests := []struct {
+		n, workers int
+		shards     int
+	}{
+		{0, 4, 1},
+		{10, 4, 1},
+		{minShardSize * 2, 4, 2},
+		{minShardSize * 10, 4, 4},
+		{minShardSize*4 + 1, 4, 4},
+	}
+	for _, tt := range tests {
+		covered := make([]int, tt.n)
+		shards := runShards(tt.n, tt.workers, func(lo, hi int) shardResult {
+			for i := lo; i < hi; i++ {
+				covered[i]++
+			}
+			return shardResult{}
+		})
+		if len(shards) != tt.shards {
+			t.Errorf("runShards(%d, %d) ran %d shards, want %d", tt.n, tt.workers, len(shards), tt.shards)
+		}
+		for i, n := range covered {
+			if n != 1 {
+				t.Fatalf("runShards(%d, %d) visited row %d %d times", tt.n, tt.workers, i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package comparison
+
+import (
+	"sort"
+	"strings"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
+)
+
+// Consistency checks run within a single source.
+const (
+	CheckDuplicateNome        = "duplicate_nome"        // Same nome under several IDs with different prices
+	CheckFornecedorCategorias = "fornecedor_categorias" // Fornecedor spanning more categorias than allowed
+	CheckNearDuplicate        = "near_duplicate"        // Near-identical products with very different prices
+)
+
+// defaultNearDuplicateRatio is the price ratio flagged between near duplicates when none is configured.
+const defaultNearDuplicateRatio = 2
+
+// maxNearDuplicateBlock bounds the pairwise comparison of near-duplicate candidates.
+// Larger blocks, typically a very generic first word, are skipped.
+const maxNearDuplicateBlock = 1000
+
+// checkConsistency runs the configured consistency checks over the products of one side,
+// considering the same product of each repeated ID as the comparison does. Findings are
+// "consistency" discrepancies listing the IDs involved, under the lowest of them.
+func checkConsistency(products []models.Product, index map[int]int, side string, rule *ConsistencyRule) []models.ErrorDetail {
+	unique := make([]models.Product, 0, len(index))
+	for i, p := range products {
+		if index[p.ID] == i {
+			unique = append(unique, p)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].ID < unique[j].ID })
+
+	var findings []models.ErrorDetail
+	if rule.DuplicateNome {
+		findings = append(findings, duplicateNomes(unique, side)...)
+	}
+	if rule.MaxCategorias > 0 {
+		findings = append(findings, fornecedorCategorias(unique, side, rule.MaxCategorias)...)
+	}
+	if rule.NearDuplicate != nil {
+		ratio := rule.NearDuplicateRatio
+		if ratio == 0 {
+			ratio = defaultNearDuplicateRatio
+		}
+		findings = append(findings, nearDuplicates(unique, side, *rule.NearDuplicate, ratio)...)
+	}
+	return findings
+}
+
+// newFinding builds a consistency discrepancy about the given products, sorted by ID.
+func newFinding(check, side string, group []models.Product) models.ErrorDetail {
+	ids := make([]int, len(group))
+	for i, p := range group {
+		ids[i] = p.ID
+	}
+	sort.Ints(ids)
+	return models.ErrorDetail{
+		Type:       "consistency",
+		APIID:      ids[0],
+		Nome:       group[0].Nome,
+		Categoria:  group[0].Categoria,
+		Fornecedor: group[0].Fornecedor,
+		Check:      check,
+		Side:       side,
+		IDs:        ids,
+	}
+}
+
+// duplicateNomes finds normalized nomes used by several IDs at different prices.
+func duplicateNomes(products []models.Product, side string) []models.ErrorDetail {
+	groups := make(map[string][]models.Product)
+	var order []string
+	for _, p := range products {
+		key := normalize(p.Nome)
+		if key == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], p)
+	}
+
+	var findings []models.ErrorDetail
+	for _, key := range order {
+		group := groups[key]
+		if len(group) < 2 || !pricesDiffer(group) {
+			continue
+		}
+		findings = append(findings, newFinding(CheckDuplicateNome, side, group))
+	}
+	return findings
+}
+
+func pricesDiffer(products []models.Product) bool {
+	for _, p := range products[1:] {
+		if p.Preco != products[0].Preco {
+			return true
+		}
+	}
+	return false
+}
+
+// fornecedorCategorias finds fornecedores whose products span more than maxCategorias
+// categorias. The finding lists the products outside the fornecedor's main categoria.
+func fornecedorCategorias(products []models.Product, side string, maxCategorias int) []models.ErrorDetail {
+	byFornecedor := make(map[string][]models.Product)
+	var order []string
+	for _, p := range products {
+		if p.Fornecedor == "" {
+			continue
+		}
+		if _, ok := byFornecedor[p.Fornecedor]; !ok {
+			order = append(order, p.Fornecedor)
+		}
+		byFornecedor[p.Fornecedor] = append(byFornecedor[p.Fornecedor], p)
+	}
+
+	var findings []models.ErrorDetail
+	for _, fornecedor := range order {
+		group := byFornecedor[fornecedor]
+		counts := make(map[string]int)
+		for _, p := range group {
+			counts[p.Categoria]++
+		}
+		if len(counts) <= maxCategorias {
+			continue
+		}
+
+		// The main categoria is the most common one, the first alphabetically on ties
+		main := ""
+		for categoria, n := range counts {
+			if n > counts[main] || (n == counts[main] && categoria < main) {
+				main = categoria
+			}
+		}
+
+		var outliers []models.Product
+		for _, p := range group {
+			if p.Categoria != main {
+				outliers = append(outliers, p)
+			}
+		}
+		finding := newFinding(CheckFornecedorCategorias, side, outliers)
+		finding.Nome = ""
+		finding.Categoria = main
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// nearDuplicates finds pairs of products in the same categoria whose nomes score at least
+// the similarity threshold, yet whose prices are at least ratio times apart. Candidates are
+// blocked on categoria and the first word of the nome; identical nomes are left to the
+// duplicate_nome check.
+func nearDuplicates(products []models.Product, side string, rule SimilarityRule, ratio float64) []models.ErrorDetail {
+	blocks := make(map[string][]models.Product)
+	var order []string
+	for _, p := range products {
+		words := strings.Fields(normalize(p.Nome))
+		if len(words) == 0 || p.Preco <= 0 {
+			continue
+		}
+		key := p.Categoria + "\x00" + words[0]
+		if _, ok := blocks[key]; !ok {
+			order = append(order, key)
+		}
+		blocks[key] = append(blocks[key], p)
+	}
+
+	var findings []models.ErrorDetail
+	for _, key := range order {
+		block := blocks[key]
+		if len(block) < 2 || len(block) > maxNearDuplicateBlock {
+			continue
+		}
+		for i := 0; i < len(block); i++ {
+			for j := i + 1; j < len(block); j++ {
+				a, b := block[i], block[j]
+				if normalize(a.Nome) == normalize(b.Nome) || !pricesApart(a.Preco, b.Preco, ratio) {
+					continue
+				}
+				score, _ := Similarity(rule.Algorithm, a.Nome, b.Nome)
+				if score < rule.Threshold {
+					continue
+				}
+				finding := newFinding(CheckNearDuplicate, side, []models.Product{a, b})
+				finding.MatchScore = &score
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// pricesApart reports whether the larger of two positive prices is at least ratio times the smaller.
+func pricesApart(a, b money.Amount, ratio float64) bool {
+	low, high := min(a, b), max(a, b)
+	return high.Float64() >= low.Float64()*ratio
+}
@@ -0,0 +1,82 @@
+package comparison
+
+import (
+	"fmt"
+	"testing"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/rules"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	products := []models.Product{
+		{ID: 1, Nome: "Caneta Azul", Categoria: "Papelaria", Fornecedor: "Bic", Preco: 250},
+		{ID: 2, Nome: "caneta  azul", Categoria: "Papelaria", Fornecedor: "Bic", Preco: 300}, // Duplicate nome, other price
+		{ID: 3, Nome: "Lapis", Categoria: "Papelaria", Fornecedor: "Faber", Preco: 100},
+		{ID: 4, Nome: "Lapis", Categoria: "Papelaria", Fornecedor: "Faber", Preco: 100}, // Same price, no finding
+		{ID: 5, Nome: "Caderno 96 folhas", Categoria: "Cadernos", Fornecedor: "Tilibra", Preco: 1500},
+		{ID: 6, Nome: "Caderno 98 folhas", Categoria: "Cadernos", Fornecedor: "Tilibra", Preco: 150},  // Near duplicate, 10x cheaper
+		{ID: 7, Nome: "Caderno 90 folhas", Categoria: "Cadernos", Fornecedor: "Tilibra", Preco: 1000}, // Near duplicate, 1.5x cheaper than 5
+		{ID: 8, Nome: "Mochila", Categoria: "Bolsas", Fornecedor: "Bic", Preco: 9000},
+		{ID: 9, Nome: "Estojo", Categoria: "Bolsas", Fornecedor: "Bic", Preco: 2000},
+		{ID: 10, Nome: "Agenda", Categoria: "Cadernos", Fornecedor: "Bic", Preco: 2500},
+	}
+
+	tests := []struct {
+		name string
+		rule ConsistencyRule
+		want []string // check:ids
+	}{
+		{
+			name: "duplicate nome",
+			rule: ConsistencyRule{DuplicateNome: true},
+			want: []string{"duplicate_nome:[1 2]"},
+		},
+		{
+			name: "fornecedor categorias",
+			rule: ConsistencyRule{MaxCategorias: 2},
+			// Bic spans Papelaria, Bolsas and Cadernos; Papelaria and Bolsas tie, Bolsas wins alphabetically
+			want: []string{"fornecedor_categorias:[1 2 10]"},
+		},
+		{
+			name: "near duplicates",
+			rule: ConsistencyRule{NearDuplicate: &SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0.9}},
+			want: []string{"near_duplicate:[5 6]", "near_duplicate:[6 7]"},
+		},
+		{
+			name: "near duplicates with a lower ratio",
+			rule: ConsistencyRule{NearDuplicate: &SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0.9}, NearDuplicateRatio: 1.5},
+			want: []string{"near_duplicate:[5 6]", "near_duplicate:[5 7]", "near_duplicate:[6 7]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			findings := checkConsistency(products, indexByID(products), rules.SideCSV, &rule)
+			var got []string
+			for _, f := range findings {
+				if f.Type != "consistency" || f.Side != rules.SideCSV || f.APIID != f.IDs[0] {
+					t.Errorf("malformed finding %+v", f)
+				}
+				got = append(got, fmt.Sprintf("%s:%v", f.Check, f.IDs))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsistencyUsesComparedRecord(t *testing.T) {
+	// The first row of ID 2 duplicates the nome of ID 1, but its latest row doesn't
+	products := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 250, CSVLine: 2},
+		{ID: 2, Nome: "Caneta", Preco: 300, CSVLine: 3},
+		{ID: 2, Nome: "Lapis", Preco: 300, CSVLine: 4},
+	}
+	findings := checkConsistency(products, indexByID(products), rules.SideCSV, &ConsistencyRule{DuplicateNome: true})
+	if len(findings) != 0 {
+		t.Errorf("findings = %+v, want none", findings)
+	}
+}
@@ -0,0 +1,405 @@
+package comparison
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/rules"
+)
+
+// DefaultSpillChunkRows is the number of products a SpillSorter keeps in memory
+// before writing a sorted run to disk.
+const DefaultSpillChunkRows = 250000
+
+// SpillSorter sorts products by ID with bounded memory using an external merge sort:
+// products are buffered up to a chunk size, each full chunk is sorted and spilled to a
+// temporary file, and Sorted merges all runs back in ID order.
+// Products sharing an ID keep their insertion order.
+type SpillSorter struct {
+	dir       string
+	chunkRows int
+	buf       []models.Product
+	runs      []string
+	count     int
+}
+
+// NewSpillSorter creates a sorter spilling runs of chunkRows products into dir
+// (the system temp directory when empty).
+func NewSpillSorter(dir string, chunkRows int) *SpillSorter {
+	if chunkRows <= 0 {
+		chunkRows = DefaultSpillChunkRows
+	}
+	return &SpillSorter{dir: dir, chunkRows: chunkRows}
+}
+
+// Add buffers a product, spilling the buffer to disk once it is full.
+func (s *SpillSorter) Add(p models.Product) error {
+	s.buf = append(s.buf, p)
+	s.count++
+	if len(s.buf) >= s.chunkRows {
+		return s.spill()
+	}
+	return nil
+}
+
+// Count returns the number of products added so far.
+func (s *SpillSorter) Count() int {
+	return s.count
+}
+
+// spill sorts the buffered products and writes them to a new run file.
+func (s *SpillSorter) spill() error {
+	sort.SliceStable(s.buf, func(i, j int) bool { return s.buf[i].ID < s.buf[j].ID })
+
+	f, err := os.CreateTemp(s.dir, "compare-run-*.gob")
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+	s.runs = append(s.runs, f.Name())
+
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for i := range s.buf {
+		if err := enc.Encode(&s.buf[i]); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Sorted returns an iterator over every added product in ID order.
+// When nothing was spilled the products are sorted and served from memory.
+func (s *SpillSorter) Sorted() (*ProductIterator, error) {
+	if len(s.runs) == 0 {
+		sort.SliceStable(s.buf, func(i, j int) bool { return s.buf[i].ID < s.buf[j].ID })
+		return &ProductIterator{mem: s.buf}, nil
+	}
+
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	s.buf = nil
+
+	it := &ProductIterator{}
+	for i, path := range s.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			it.Close()
+			return nil, fmt.Errorf("failed to open spill file: %w", err)
+		}
+		r := &runReader{file: f, dec: gob.NewDecoder(bufio.NewReader(f)), order: i}
+		ok, err := r.advance()
+		if err != nil {
+			f.Close()
+			it.Close()
+			return nil, err
+		}
+		it.readers = append(it.readers, r)
+		if ok {
+			it.heap = append(it.heap, r)
+		}
+	}
+	heap.Init(&it.heap)
+	return it, nil
+}
+
+// Close removes every run file written by the sorter.
+func (s *SpillSorter) Close() error {
+	var firstErr error
+	for _, path := range s.runs {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.runs = nil
+	return firstErr
+}
+
+// runReader streams one sorted run file.
+type runReader struct {
+	file    *os.File
+	dec     *gob.Decoder
+	current models.Product
+	order   int // Run index, used to keep insertion order between equal IDs
+}
+
+func (r *runReader) advance() (bool, error) {
+	var p models.Product
+	if err := r.dec.Decode(&p); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	r.current = p
+	return true, nil
+}
+
+// runHeap orders run readers by their current product ID.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].current.ID != h[j].current.ID {
+		return h[i].current.ID < h[j].current.ID
+	}
+	return h[i].order < h[j].order
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// ProductIterator yields products in ID order, either from memory or by k-way merging
+// the run files of a SpillSorter.
+type ProductIterator struct {
+	mem     []models.Product
+	pos     int
+	readers []*runReader
+	heap    runHeap
+}
+
+// Next returns the next product, or false once the iterator is exhausted.
+func (it *ProductIterator) Next() (models.Product, bool, error) {
+	if it.readers == nil {
+		if it.pos >= len(it.mem) {
+			return models.Product{}, false, nil
+		}
+		it.pos++
+		return it.mem[it.pos-1], true, nil
+	}
+
+	if len(it.heap) == 0 {
+		return models.Product{}, false, nil
+	}
+	r := it.heap[0]
+	p := r.current
+	ok, err := r.advance()
+	if err != nil {
+		return models.Product{}, false, err
+	}
+	if ok {
+		heap.Fix(&it.heap, 0)
+	} else {
+		heap.Pop(&it.heap)
+	}
+	return p, true, nil
+}
+
+// Close releases the open run files.
+func (it *ProductIterator) Close() {
+	for _, r := range it.readers {
+		r.file.Close()
+	}
+	it.readers = nil
+	it.heap = nil
+	it.mem = nil
+}
+
+// ErrorSink receives discrepancies as they are found, so they never have to be
+// held in memory all at once.
+type ErrorSink interface {
+	WriteErrors(errors []models.ErrorDetail) error
+}
+
+// streamBatchSize is the number of discrepancies buffered before flushing to the sink.
+const streamBatchSize = 1000
+
+// CompareSorted is the out-of-core counterpart of CompareProducts. It merge-joins two
+// ID-ordered streams, writing discrepancies to sink in batches, and returns the summary.
+// Only the current product of each side is kept in memory. When an ID is repeated the
+// product from the latest CSV line is compared, as in CompareProducts. The secondary-key pass
+// and the consistency checks need every record at once and are not run in this mode.
+// Since both streams are merged by ID, discrepancies reach the sink in canonical order.
+func CompareSorted(apiProducts, csvProducts *ProductIterator, opts Options, sink ErrorSink) (models.Summary, error) {
+	summary := newSummary()
+	financial := newFinancialAccumulator()
+	finalizer := newErrorFinalizer(opts, time.Now())
+	checker := newRuleChecker(opts)
+	batch := make([]models.ErrorDetail, 0, streamBatchSize)
+
+	// emit applies ignore rules and severity to a discrepancy, counts it and queues it for the sink
+	emit := func(errDetail *models.ErrorDetail) error {
+		finalizer.apply(errDetail)
+		countError(&summary, *errDetail)
+		batch = append(batch, *errDetail)
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+		err := sink.WriteErrors(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	// withRecords embeds copies of the records of a discrepancy when opts.Records is set
+	withRecords := func(errDetail *models.ErrorDetail, apiProduct, csvProduct *models.Product) *models.ErrorDetail {
+		if !opts.Records {
+			return errDetail
+		}
+		if apiProduct != nil {
+			record := *apiProduct
+			errDetail.APIRecord = &record
+		}
+		if csvProduct != nil {
+			record := *csvProduct
+			errDetail.CSVRecord = &record
+		}
+		return errDetail
+	}
+
+	// emitViolations emits the rule violations of a record
+	var violations []models.ErrorDetail
+	emitViolations := func(p models.Product, side string) error {
+		violations = checker.check(violations[:0], p, side)
+		for i := range violations {
+			if err := emit(&violations[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	apiSide := &uniqueReader{it: apiProducts}
+	csvSide := &uniqueReader{it: csvProducts}
+
+	apiProduct, apiOK, err := apiSide.next()
+	if err != nil {
+		return summary, err
+	}
+	csvProduct, csvOK, err := csvSide.next()
+	if err != nil {
+		return summary, err
+	}
+
+	for apiOK || csvOK {
+		switch {
+		case !csvOK || (apiOK && apiProduct.ID < csvProduct.ID):
+			// Product exists in API but not in CSV
+			financial.addInventory(apiProduct, true, apiProduct)
+			err = emit(withRecords(&models.ErrorDetail{Type: "missing_in_csv", APIID: apiProduct.ID, Nome: apiProduct.Nome,
+				Categoria: apiProduct.Categoria, Fornecedor: apiProduct.Fornecedor}, &apiProduct, nil))
+			if err == nil {
+				err = emitViolations(apiProduct, rules.SideAPI)
+			}
+			if err == nil {
+				apiProduct, apiOK, err = apiSide.next()
+			}
+		case !apiOK || csvProduct.ID < apiProduct.ID:
+			// Product exists in CSV but not in API
+			financial.addInventory(csvProduct, false, csvProduct)
+			err = emit(withRecords(&models.ErrorDetail{Type: "missing_in_api", CSVLine: csvProduct.CSVLine, APIID: csvProduct.ID,
+				Categoria: csvProduct.Categoria, Fornecedor: csvProduct.Fornecedor}, nil, &csvProduct))
+			if err == nil {
+				err = emitViolations(csvProduct, rules.SideCSV)
+			}
+			if err == nil {
+				csvProduct, csvOK, err = csvSide.next()
+			}
+		default:
+			// Product exists in both, check for mismatches
+			financial.addInventory(apiProduct, true, apiProduct)
+			financial.addInventory(csvProduct, false, apiProduct)
+			if mismatches := compareFields(apiProduct, csvProduct, opts); len(mismatches) > 0 {
+				errDetail := models.ErrorDetail{Type: mismatchType(mismatches), CSVLine: csvProduct.CSVLine, APIID: csvProduct.ID,
+					Categoria: apiProduct.Categoria, Fornecedor: apiProduct.Fornecedor, Fields: mismatches}
+				err = emit(withRecords(&errDetail, &apiProduct, &csvProduct))
+				if !errDetail.Suppressed {
+					financial.addPair(apiProduct, csvProduct, errDetail.Fields)
+				}
+			} else {
+				summary.Matched++
+				summaryBreakdown(&summary).addMatched(groupKey{categoria: apiProduct.Categoria, fornecedor: apiProduct.Fornecedor}, 1)
+			}
+			if err == nil {
+				err = emitViolations(apiProduct, rules.SideAPI)
+			}
+			if err == nil {
+				err = emitViolations(csvProduct, rules.SideCSV)
+			}
+			if err == nil {
+				apiProduct, apiOK, err = apiSide.next()
+			}
+			if err == nil {
+				csvProduct, csvOK, err = csvSide.next()
+			}
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	summary.TotalAPIItems = apiSide.count
+	summary.TotalCSVItems = csvSide.count
+	summary.Financial = financial.result()
+
+	if len(batch) > 0 {
+		if err := sink.WriteErrors(batch); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// uniqueReader collapses runs of equal IDs to the product with the latest CSV line, or the
+// last one for API products, and counts every row read.
+type uniqueReader struct {
+	it      *ProductIterator
+	pending *models.Product
+	count   int
+}
+
+func (u *uniqueReader) next() (models.Product, bool, error) {
+	var current models.Product
+	if u.pending != nil {
+		current = *u.pending
+		u.pending = nil
+	} else {
+		p, ok, err := u.it.Next()
+		if err != nil || !ok {
+			return models.Product{}, false, err
+		}
+		u.count++
+		current = p
+	}
+
+	for {
+		p, ok, err := u.it.Next()
+		if err != nil {
+			return models.Product{}, false, err
+		}
+		if !ok {
+			return current, true, nil
+		}
+		u.count++
+		if p.ID != current.ID {
+			u.pending = &p
+			return current, true, nil
+		}
+		if p.CSVLine >= current.CSVLine {
+			current = p
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package comparison
+
+import (
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestSpillSorter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	products := make([]models.Product, 1000)
+	for i := range products {
+		// Few distinct IDs, so many products share one
+		products[i] = models.Product{ID: rng.Intn(200), CSVLine: i + 2}
+	}
+	want := append([]models.Product(nil), products...)
+	sortStable(want)
+
+	tests := []struct {
+		name      string
+		chunkRows int
+		runs      int
+	}{
+		{"in memory", 5000, 0},
+		{"one full run", 1000, 1},
+		{"many runs", 64, 16},
+		{"single product runs", 1, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sorter := NewSpillSorter(dir, tt.chunkRows)
+			for _, p := range products {
+				if err := sorter.Add(p); err != nil {
+					t.Fatalf("Add: %v", err)
+				}
+			}
+			it, err := sorter.Sorted()
+			if err != nil {
+				t.Fatalf("Sorted: %v", err)
+			}
+			if len(sorter.runs) != tt.runs {
+				t.Errorf("spilled %d runs, want %d", len(sorter.runs), tt.runs)
+			}
+			got := drain(t, it)
+			it.Close()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("external sort differs from a stable in-memory sort")
+			}
+
+			if err := sorter.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("%d run files left after Close", len(entries))
+			}
+		})
+	}
+}
+
+func TestCompareSortedMatchesCompareProducts(t *testing.T) {
+	apiProducts, csvProducts := generateCatalogs(5000, 0.05)
+	// Repeated IDs on both sides
+	csvProducts = append(csvProducts, csvProducts[10], csvProducts[20])
+	csvProducts[len(csvProducts)-2].Estoque++
+	csvProducts[len(csvProducts)-2].CSVLine = len(csvProducts)
+	csvProducts[len(csvProducts)-1].CSVLine = len(csvProducts) + 1
+	apiProducts = append(apiProducts, apiProducts[30])
+	apiProducts[len(apiProducts)-1].Nome = "Renamed"
+
+	withRecords := DefaultOptions()
+	withRecords.Records = true
+	withSimilarity := DefaultOptions()
+	withSimilarity.Similarity = map[string]SimilarityRule{"nome": {Algorithm: AlgorithmLevenshtein, Threshold: 0.5}}
+
+	tests := []struct {
+		name      string
+		opts      Options
+		chunkRows int
+	}{
+		{"defaults in memory", DefaultOptions(), 0},
+		{"defaults spilled", DefaultOptions(), 700},
+		{"records", withRecords, 700},
+		{"similarity", withSimilarity, 700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := CompareProducts(apiProducts, csvProducts, tt.opts)
+
+			apiIter := sortedIterator(t, apiProducts, tt.chunkRows)
+			defer apiIter.Close()
+			csvIter := sortedIterator(t, csvProducts, tt.chunkRows)
+			defer csvIter.Close()
+			sink := &sliceSink{}
+			summary, err := CompareSorted(apiIter, csvIter, tt.opts, sink)
+			if err != nil {
+				t.Fatalf("CompareSorted: %v", err)
+			}
+
+			if !reflect.DeepEqual(summary, want.Summary) {
+				t.Errorf("summary = %+v\nwant %+v", summary, want.Summary)
+			}
+			if len(sink.errors) != len(want.Errors) {
+				t.Fatalf("got %d discrepancies, want %d", len(sink.errors), len(want.Errors))
+			}
+			for i := range want.Errors {
+				if !reflect.DeepEqual(sink.errors[i], want.Errors[i]) {
+					t.Fatalf("discrepancy %d = %+v\nwant %+v", i, sink.errors[i], want.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+// sliceSink collects the discrepancies written to it.
+type sliceSink struct {
+	errors []models.ErrorDetail
+}
+
+func (s *sliceSink) WriteErrors(errors []models.ErrorDetail) error {
+	s.errors = append(s.errors, errors...)
+	return nil
+}
+
+func sortedIterator(t *testing.T, products []models.Product, chunkRows int) *ProductIterator {
+	t.Helper()
+	sorter := NewSpillSorter(t.TempDir(), chunkRows)
+	t.Cleanup(func() { sorter.Close() })
+	for _, p := range products {
+		if err := sorter.Add(p); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	it, err := sorter.Sorted()
+	if err != nil {
+		t.Fatalf("Sorted: %v", err)
+	}
+	return it
+}
+
+func drain(t *testing.T, it *ProductIterator) []models.Product {
+	t.Helper()
+	var products []models.Product
+	for {
+		p, ok, err := it.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if !ok {
+			return products
+		}
+		products = append(products, p)
+	}
+}
+
+func sortStable(products []models.Product) {
+	for i := 1; i < len(products); i++ {
+		for j := i; j > 0 && products[j].ID < products[j-1].ID; j-- {
+			products[j], products[j-1] = products[j-1], products[j]
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package comparison
+
+import "hackathon-go/internal/models"
+
+// FieldNames lists the comparable product fields in their canonical order.
+var FieldNames = []string{"nome", "categoria", "preco", "estoque", "fornecedor"}
+
+// Fields numeric rules and similarity rules apply to.
+var (
+	numericFields = []string{"preco", "estoque"}
+	textFields    = []string{"nome", "categoria", "fornecedor"}
+)
+
+// fieldValue returns the value of a product field by its JSON name.
+func fieldValue(p models.Product, field string) (interface{}, bool) {
+	switch field {
+	case "nome":
+		return p.Nome, true
+	case "categoria":
+		return p.Categoria, true
+	case "preco":
+		return p.Preco, true
+	case "estoque":
+		return p.Estoque, true
+	case "fornecedor":
+		return p.Fornecedor, true
+	}
+	return nil, false
+}
+
+// isField reports whether name is one of FieldNames.
+func isField(name string) bool {
+	_, ok := fieldValue(models.Product{}, name)
+	return ok
+}
@@ -0,0 +1,146 @@
+package comparison
+
+import (
+	"math"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
+)
+
+// priceDeltaBuckets are the lower bounds, in percent of the API price, of the price delta histogram.
+var priceDeltaBuckets = []float64{0, 1, 5, 10, 25, 50, 100}
+
+// stockDeltaBuckets are the lower bounds, in units, of the stock delta histogram.
+var stockDeltaBuckets = []float64{1, 5, 10, 50, 100}
+
+// financialAccumulator builds the FinancialSummary of a comparison incrementally, so the
+// in-memory and the streaming engines share the same aggregation rules.
+type financialAccumulator struct {
+	total        *models.FinancialStats
+	byCategoria  map[string]*models.FinancialStats
+	byFornecedor map[string]*models.FinancialStats
+}
+
+func newFinancialAccumulator() *financialAccumulator {
+	return &financialAccumulator{
+		total:        newFinancialStats(),
+		byCategoria:  make(map[string]*models.FinancialStats),
+		byFornecedor: make(map[string]*models.FinancialStats),
+	}
+}
+
+func newFinancialStats() *models.FinancialStats {
+	return &models.FinancialStats{
+		PriceDeltaHistogram: newHistogram(priceDeltaBuckets),
+		StockDeltaHistogram: newHistogram(stockDeltaBuckets),
+	}
+}
+
+func newHistogram(bounds []float64) []models.HistogramBucket {
+	buckets := make([]models.HistogramBucket, len(bounds))
+	for i, lower := range bounds {
+		buckets[i].Min = lower
+		if i+1 < len(bounds) {
+			upper := bounds[i+1]
+			buckets[i].Max = &upper
+		}
+	}
+	return buckets
+}
+
+// groups returns the stats the product contributes to: the total, its categoria and its fornecedor.
+// The group product decides the categoria and fornecedor, so that both sides of a pair land
+// in the same groups; callers pass the API record when there is one.
+func (f *financialAccumulator) groups(group models.Product) []*models.FinancialStats {
+	categoria, ok := f.byCategoria[group.Categoria]
+	if !ok {
+		categoria = newFinancialStats()
+		f.byCategoria[group.Categoria] = categoria
+	}
+	fornecedor, ok := f.byFornecedor[group.Fornecedor]
+	if !ok {
+		fornecedor = newFinancialStats()
+		f.byFornecedor[group.Fornecedor] = fornecedor
+	}
+	return []*models.FinancialStats{f.total, categoria, fornecedor}
+}
+
+// addInventory adds preco × estoque of a product to the inventory value of its side. A
+// product whose value, or the sum with it, is out of range is counted apart instead.
+func (f *financialAccumulator) addInventory(p models.Product, apiSide bool, group models.Product) {
+	value, err := p.Preco.Mul(p.Estoque)
+	for _, stats := range f.groups(group) {
+		total := &stats.InventoryValueCSV
+		if apiSide {
+			total = &stats.InventoryValueAPI
+		}
+		sum, addErr := total.Add(value)
+		if err != nil || addErr != nil {
+			stats.InventoryOverflow++
+			continue
+		}
+		*total = sum
+	}
+}
+
+// addPair records the price and stock deltas of a product present on both sides.
+// Only fields reported as differing count, so tolerances and rounding rules apply, and
+// fields accepted by ignore rules are left out.
+func (f *financialAccumulator) addPair(api, csv models.Product, fields map[string]models.MismatchDetail) {
+	price, priceDiffers := fields["preco"]
+	stock, stockDiffers := fields["estoque"]
+	priceDiffers = priceDiffers && price.SuppressedBy == ""
+	stockDiffers = stockDiffers && stock.SuppressedBy == ""
+	if !priceDiffers && !stockDiffers {
+		return
+	}
+
+	for _, stats := range f.groups(api) {
+		if priceDiffers {
+			delta := api.Preco - csv.Preco
+			stats.PriceDeltaCount++
+			stats.TotalPriceDelta += delta
+			stats.TotalAbsPriceDelta += delta.Abs()
+			if price.PctDelta != nil {
+				addToHistogram(stats.PriceDeltaHistogram, *price.PctDelta)
+			}
+		}
+		if stockDiffers {
+			stats.StockDeltaCount++
+			stats.TotalStockDelta += api.Estoque - csv.Estoque
+			addToHistogram(stats.StockDeltaHistogram, math.Abs(float64(api.Estoque-csv.Estoque)))
+		}
+	}
+}
+
+func addToHistogram(buckets []models.HistogramBucket, value float64) {
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if value >= buckets[i].Min {
+			buckets[i].Count++
+			return
+		}
+	}
+}
+
+// result finalizes the means and inventory differences and returns the summary.
+func (f *financialAccumulator) result() *models.FinancialSummary {
+	finalize := func(stats *models.FinancialStats) models.FinancialStats {
+		stats.MeanPriceDelta = stats.TotalPriceDelta.Div(int64(stats.PriceDeltaCount), money.HalfEven)
+		stats.MeanAbsPriceDelta = stats.TotalAbsPriceDelta.Div(int64(stats.PriceDeltaCount), money.HalfEven)
+		stats.InventoryValueDiff = stats.InventoryValueAPI - stats.InventoryValueCSV
+		return *stats
+	}
+
+	summary := &models.FinancialSummary{
+		FinancialStats: finalize(f.total),
+		ByCategoria:    make(map[string]models.FinancialStats, len(f.byCategoria)),
+		ByFornecedor:   make(map[string]models.FinancialStats, len(f.byFornecedor)),
+	}
+	for name, stats := range f.byCategoria {
+		summary.ByCategoria[name] = finalize(stats)
+	}
+	for name, stats := range f.byFornecedor {
+		summary.ByFornecedor[name] = finalize(stats)
+	}
+	return summary
+}
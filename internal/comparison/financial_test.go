@@ -0,0 +1,123 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
+)
+
+func TestFinancialSummary(t *testing.T) {
+	api := []models.Product{
+		{ID: 1, Categoria: "A", Fornecedor: "X", Preco: 1000, Estoque: 10}, // 10.00 x 10
+		{ID: 2, Categoria: "A", Fornecedor: "Y", Preco: 500, Estoque: 4},   // 5.00 x 4
+		{ID: 3, Categoria: "B", Fornecedor: "X", Preco: 200, Estoque: 1},   // Missing in the CSV
+	}
+	csv := []models.Product{
+		{ID: 1, Categoria: "A", Fornecedor: "X", Preco: 1200, Estoque: 10, CSVLine: 2}, // +20% price
+		{ID: 2, Categoria: "Z", Fornecedor: "Y", Preco: 500, Estoque: 1, CSVLine: 3},   // Stock and categoria
+		{ID: 4, Categoria: "B", Fornecedor: "X", Preco: 300, Estoque: 2, CSVLine: 4},   // Missing in the API
+	}
+
+	summary := CompareProducts(api, csv, DefaultOptions()).Summary.Financial
+	if summary == nil {
+		t.Fatal("no financial summary")
+	}
+
+	total := summary.FinancialStats
+	checks := []struct {
+		name      string
+		got, want money.Amount
+	}{
+		{"inventory api", total.InventoryValueAPI, 10000 + 2000 + 200},
+		{"inventory csv", total.InventoryValueCSV, 12000 + 500 + 600},
+		{"inventory diff", total.InventoryValueDiff, 12200 - 13100},
+		{"total price delta", total.TotalPriceDelta, -200},
+		{"total abs price delta", total.TotalAbsPriceDelta, 200},
+		{"mean price delta", total.MeanPriceDelta, -200},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %s, want %s", c.name, c.got, c.want)
+		}
+	}
+	if total.PriceDeltaCount != 1 || total.StockDeltaCount != 1 || total.TotalStockDelta != 3 {
+		t.Errorf("counts = %d price, %d stock, stock delta %d; want 1, 1, 3", total.PriceDeltaCount, total.StockDeltaCount, total.TotalStockDelta)
+	}
+	if bucket := total.PriceDeltaHistogram[3]; bucket.Min != 10 || bucket.Count != 1 {
+		t.Errorf("price histogram = %+v, want the 20%% delta in the 10-25 bucket", total.PriceDeltaHistogram)
+	}
+	if bucket := total.StockDeltaHistogram[0]; bucket.Count != 1 {
+		t.Errorf("stock histogram = %+v, want the delta of 3 in the first bucket", total.StockDeltaHistogram)
+	}
+
+	// Both sides of a pair are grouped by the API record
+	if _, ok := summary.ByCategoria["Z"]; ok {
+		t.Error("the CSV categoria of a paired product got a group")
+	}
+	if got := summary.ByCategoria["A"].InventoryValueCSV; got != 12000+500 {
+		t.Errorf("categoria A csv inventory = %s, want 125.00", got)
+	}
+	if got := summary.ByFornecedor["X"].InventoryValueAPI; got != 10000+200 {
+		t.Errorf("fornecedor X api inventory = %s, want 102.00", got)
+	}
+}
+
+func TestFinancialSummaryIgnoresToleratedAndSuppressed(t *testing.T) {
+	api := []models.Product{{ID: 1, Preco: 1000}, {ID: 2, Preco: 1000}}
+	csv := []models.Product{{ID: 1, Preco: 1001, CSVLine: 2}, {ID: 2, Preco: 2000, CSVLine: 3}}
+
+	opts, err := DefaultOptions().WithOverrides([]byte(`{
+		"numeric": {"preco": {"abs_tolerance": 0.05}},
+		"ignore_rules": [{"id": "accept-2", "product_id": 2, "field": "preco"}]
+	}`))
+	if err != nil {
+		t.Fatalf("WithOverrides: %v", err)
+	}
+	financial := CompareProducts(api, csv, opts).Summary.Financial
+	if financial.PriceDeltaCount != 0 || financial.TotalAbsPriceDelta != 0 {
+		t.Errorf("price deltas = %d totalling %s, want none", financial.PriceDeltaCount, financial.TotalAbsPriceDelta)
+	}
+}
+
+func TestFinancialSummaryCountsInventoryOverflow(t *testing.T) {
+	api := []models.Product{
+		{ID: 1, Preco: 1000, Estoque: 2},
+		{ID: 2, Preco: 1 << 40, Estoque: 1 << 30}, // preco × estoque out of range
+	}
+	csv := []models.Product{{ID: 1, Preco: 1000, Estoque: 2, CSVLine: 2}, {ID: 2, Preco: 1000, Estoque: 1, CSVLine: 3}}
+
+	financial := CompareProducts(api, csv, DefaultOptions()).Summary.Financial
+	if financial.InventoryValueAPI != 2000 || financial.InventoryOverflow != 1 {
+		t.Errorf("api inventory = %s with %d out of range, want 20.00 with the huge product left out",
+			financial.InventoryValueAPI, financial.InventoryOverflow)
+	}
+	if financial.InventoryValueCSV != 3000 {
+		t.Errorf("csv inventory = %s, want 30.00", financial.InventoryValueCSV)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	tests := []struct {
+		value  float64
+		bucket int
+	}{
+		{0, 0}, {0.99, 0}, {1, 1}, {24.9, 3}, {100, 6}, {5000, 6},
+	}
+	for _, tt := range tests {
+		buckets := newHistogram(priceDeltaBuckets)
+		addToHistogram(buckets, tt.value)
+		for i, b := range buckets {
+			want := 0
+			if i == tt.bucket {
+				want = 1
+			}
+			if b.Count != want {
+				t.Errorf("value %v: bucket %d has %d, want %d", tt.value, i, b.Count, want)
+			}
+		}
+	}
+	if last := newHistogram(stockDeltaBuckets); last[len(last)-1].Max != nil {
+		t.Error("last bucket is not open-ended")
+	}
+}
@@ -0,0 +1,162 @@
+package comparison
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+// ValidateIgnoreRule checks that an ignore rule has at least one criterion and valid values.
+func ValidateIgnoreRule(rule models.IgnoreRule) error {
+	if rule.ProductID == nil && rule.Type == "" && rule.Field == "" && rule.ValuePattern == "" &&
+		rule.MinDelta == nil && rule.MaxDelta == nil {
+		return fmt.Errorf("ignore rule needs at least one criterion")
+	}
+	if rule.Field != "" && !isField(rule.Field) {
+		return fmt.Errorf("unknown field %q", rule.Field)
+	}
+	if (rule.ValuePattern != "" || rule.MinDelta != nil || rule.MaxDelta != nil) && rule.Field == "" {
+		return fmt.Errorf("value_pattern, min_delta and max_delta require a field")
+	}
+	if rule.ValuePattern != "" {
+		if _, err := regexp.Compile(rule.ValuePattern); err != nil {
+			return fmt.Errorf("invalid value_pattern: %w", err)
+		}
+	}
+	if rule.MinDelta != nil && rule.MaxDelta != nil && *rule.MinDelta > *rule.MaxDelta {
+		return fmt.Errorf("min_delta must not exceed max_delta")
+	}
+	return nil
+}
+
+// ignoreMatcher is an active ignore rule with its value pattern compiled.
+type ignoreMatcher struct {
+	rule    models.IgnoreRule
+	pattern *regexp.Regexp
+}
+
+// ActiveIgnoreRules returns the valid rules in effect at now, without their expiry dates,
+// so the set gives the same result whenever it is applied and two sets in effect can be
+// compared by value. Invalid rules are skipped; they are rejected when created through the API.
+func ActiveIgnoreRules(rules []models.IgnoreRule, now time.Time) []models.IgnoreRule {
+	var active []models.IgnoreRule
+	for _, rule := range rules {
+		if rule.ExpiresAt != nil && *rule.ExpiresAt <= now.Unix() {
+			continue
+		}
+		if ValidateIgnoreRule(rule) != nil {
+			continue
+		}
+		rule.ExpiresAt = nil
+		active = append(active, rule)
+	}
+	return active
+}
+
+// compileIgnoreRules keeps the rules in effect at now and compiles their patterns.
+func compileIgnoreRules(rules []models.IgnoreRule, now time.Time) []ignoreMatcher {
+	var matchers []ignoreMatcher
+	for _, rule := range ActiveIgnoreRules(rules, now) {
+		m := ignoreMatcher{rule: rule}
+		if rule.ValuePattern != "" {
+			m.pattern = regexp.MustCompile(rule.ValuePattern)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// matchesError reports whether the product and type criteria of the rule match the discrepancy.
+func (m ignoreMatcher) matchesError(e *models.ErrorDetail) bool {
+	if m.rule.ProductID != nil && *m.rule.ProductID != e.APIID && *m.rule.ProductID != e.CSVID {
+		return false
+	}
+	if m.rule.Type != "" && m.rule.Type != e.Type {
+		return false
+	}
+	return true
+}
+
+// matchesField reports whether the value criteria of the rule match a field difference.
+func (m ignoreMatcher) matchesField(detail models.MismatchDetail) bool {
+	if m.pattern != nil &&
+		!m.pattern.MatchString(fmt.Sprint(detail.APIValue)) && !m.pattern.MatchString(fmt.Sprint(detail.CSVValue)) {
+		return false
+	}
+	if m.rule.MinDelta != nil || m.rule.MaxDelta != nil {
+		if detail.AbsDelta == nil {
+			return false
+		}
+		if m.rule.MinDelta != nil && *detail.AbsDelta < *m.rule.MinDelta {
+			return false
+		}
+		if m.rule.MaxDelta != nil && *detail.AbsDelta > *m.rule.MaxDelta {
+			return false
+		}
+	}
+	return true
+}
+
+// apply marks what the rules suppress in a discrepancy. Rules without a field suppress the
+// whole discrepancy; rules with a field suppress that field, and the discrepancy once all
+// of its fields are suppressed. Nothing is removed, so suppressed items stay reviewable.
+func (m ignoreMatcher) apply(e *models.ErrorDetail) {
+	if !m.matchesError(e) {
+		return
+	}
+
+	if m.rule.Field == "" {
+		e.Suppressed = true
+		e.SuppressedBy = appendUnique(e.SuppressedBy, m.rule.ID)
+		return
+	}
+
+	detail, ok := e.Fields[m.rule.Field]
+	if !ok || detail.SuppressedBy != "" || !m.matchesField(detail) {
+		return
+	}
+	detail.SuppressedBy = m.rule.ID
+	e.Fields[m.rule.Field] = detail
+
+	for _, d := range e.Fields {
+		if d.SuppressedBy == "" {
+			return
+		}
+	}
+	e.Suppressed = true
+	e.SuppressedBy = appendUnique(e.SuppressedBy, m.rule.ID)
+}
+
+func appendUnique(ids []string, id string) []string {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// errorFinalizer applies ignore rules and severity scoring to new discrepancies, in the
+// same way for the in-memory and the streaming engines.
+type errorFinalizer struct {
+	ignore   []ignoreMatcher
+	severity *SeverityModel
+}
+
+func newErrorFinalizer(opts Options, now time.Time) *errorFinalizer {
+	return &errorFinalizer{
+		ignore:   compileIgnoreRules(opts.IgnoreRules, now),
+		severity: opts.Severity,
+	}
+}
+
+func (f *errorFinalizer) apply(e *models.ErrorDetail) {
+	for _, m := range f.ignore {
+		m.apply(e)
+	}
+	if f.severity != nil {
+		f.severity.Score(e)
+	}
+}
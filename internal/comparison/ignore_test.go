@@ -0,0 +1,175 @@
+package comparison
+
+import (
+	"testing"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+func TestValidateIgnoreRule(t *testing.T) {
+	id := 7
+	delta := func(d float64) *float64 { return &d }
+	tests := []struct {
+		name    string
+		rule    models.IgnoreRule
+		wantErr bool
+	}{
+		{"product", models.IgnoreRule{ProductID: &id}, false},
+		{"type", models.IgnoreRule{Type: "missing_in_api"}, false},
+		{"field with delta", models.IgnoreRule{Field: "preco", MaxDelta: delta(1)}, false},
+		{"no criterion", models.IgnoreRule{Reason: "nothing"}, true},
+		{"unknown field", models.IgnoreRule{Field: "cor"}, true},
+		{"pattern without field", models.IgnoreRule{ValuePattern: "x"}, true},
+		{"delta without field", models.IgnoreRule{MinDelta: delta(1)}, true},
+		{"invalid pattern", models.IgnoreRule{Field: "nome", ValuePattern: "("}, true},
+		{"min above max", models.IgnoreRule{Field: "preco", MinDelta: delta(2), MaxDelta: delta(1)}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateIgnoreRule(tt.rule); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateIgnoreRule() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	id := 1
+	now := time.Unix(1700000000, 0)
+	past, future := now.Unix()-1, now.Unix()+60
+	delta := func(d float64) *float64 { return &d }
+
+	mismatch := func() models.ErrorDetail {
+		return models.ErrorDetail{Type: "mismatch", APIID: 1, Fields: map[string]models.MismatchDetail{
+			"preco": {APIValue: "10.00", CSVValue: "10.50", AbsDelta: delta(0.5)},
+			"nome":  {APIValue: "Caneta Azul", CSVValue: "Caneta azul"},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		rules      []models.IgnoreRule
+		err        models.ErrorDetail
+		suppressed bool
+		fields     []string // Fields suppressed
+	}{
+		{
+			name:       "whole product",
+			rules:      []models.IgnoreRule{{ID: "r1", ProductID: &id}},
+			err:        mismatch(),
+			suppressed: true,
+		},
+		{
+			name:  "other type",
+			rules: []models.IgnoreRule{{ID: "r1", Type: "missing_in_api"}},
+			err:   mismatch(),
+		},
+		{
+			name:   "one field",
+			rules:  []models.IgnoreRule{{ID: "r1", Field: "preco", MaxDelta: delta(1)}},
+			err:    mismatch(),
+			fields: []string{"preco"},
+		},
+		{
+			name:  "delta out of range",
+			rules: []models.IgnoreRule{{ID: "r1", Field: "preco", MinDelta: delta(1)}},
+			err:   mismatch(),
+		},
+		{
+			name: "every field",
+			rules: []models.IgnoreRule{
+				{ID: "r1", Field: "preco", MaxDelta: delta(1)},
+				{ID: "r2", Field: "nome", ValuePattern: "(?i)^caneta"},
+			},
+			err:        mismatch(),
+			suppressed: true,
+			fields:     []string{"preco", "nome"},
+		},
+		{
+			name:  "expired",
+			rules: []models.IgnoreRule{{ID: "r1", ProductID: &id, ExpiresAt: &past}},
+			err:   mismatch(),
+		},
+		{
+			name:       "not expired yet",
+			rules:      []models.IgnoreRule{{ID: "r1", ProductID: &id, ExpiresAt: &future}},
+			err:        mismatch(),
+			suppressed: true,
+		},
+		{
+			name:       "re-keyed product by its CSV ID",
+			rules:      []models.IgnoreRule{{ID: "r1", ProductID: &id}},
+			err:        models.ErrorDetail{Type: "id_changed", APIID: 9, CSVID: 1},
+			suppressed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.err
+			finalizer := newErrorFinalizer(Options{IgnoreRules: tt.rules}, now)
+			finalizer.apply(&e)
+			if e.Suppressed != tt.suppressed {
+				t.Errorf("suppressed = %v, want %v", e.Suppressed, tt.suppressed)
+			}
+			for _, field := range tt.fields {
+				if e.Fields[field].SuppressedBy == "" {
+					t.Errorf("field %s not suppressed", field)
+				}
+			}
+			suppressedFields := 0
+			for _, detail := range e.Fields {
+				if detail.SuppressedBy != "" {
+					suppressedFields++
+				}
+			}
+			if suppressedFields != len(tt.fields) {
+				t.Errorf("%d fields suppressed, want %d", suppressedFields, len(tt.fields))
+			}
+		})
+	}
+}
+
+func TestSuppressedErrorsAreCountedApart(t *testing.T) {
+	api := []models.Product{{ID: 1, Preco: 1000}, {ID: 2, Preco: 1000}}
+	csv := []models.Product{{ID: 1, Preco: 1100, CSVLine: 2}, {ID: 2, Preco: 1100, CSVLine: 3}}
+	id := 2
+	opts := DefaultOptions()
+	opts.IgnoreRules = []models.IgnoreRule{{ID: "accepted", ProductID: &id}}
+
+	result := CompareProducts(api, csv, opts)
+	if len(result.Errors) != 2 {
+		t.Fatalf("got %d discrepancies, want both kept", len(result.Errors))
+	}
+	if result.Summary.Mismatched != 1 || result.Summary.Suppressed != 1 {
+		t.Errorf("mismatched = %d, suppressed = %d; want 1 and 1", result.Summary.Mismatched, result.Summary.Suppressed)
+	}
+	if e := result.Errors[1]; !e.Suppressed || len(e.SuppressedBy) != 1 || e.SuppressedBy[0] != "accepted" {
+		t.Errorf("discrepancy of product 2 = %+v, want suppressed by the rule", e)
+	}
+}
+
+func TestActiveIgnoreRules(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	past, future := now.Unix(), now.Unix()+60
+	rules := []models.IgnoreRule{
+		{ID: "expired", Type: "mismatch", ExpiresAt: &past},
+		{ID: "expiring", Type: "mismatch", ExpiresAt: &future},
+		{ID: "invalid", Reason: "no criterion"},
+		{ID: "kept", Field: "preco"},
+	}
+
+	active := ActiveIgnoreRules(rules, now)
+	if len(active) != 2 || active[0].ID != "expiring" || active[1].ID != "kept" {
+		t.Fatalf("ActiveIgnoreRules = %+v, want expiring and kept", active)
+	}
+	if active[0].ExpiresAt != nil {
+		t.Error("active rule kept its expiry date")
+	}
+	if rules[1].ExpiresAt == nil {
+		t.Error("ActiveIgnoreRules changed the given rules")
+	}
+	// The set applies the same way once its rules would have expired
+	if again := ActiveIgnoreRules(active, now.Add(time.Hour)); len(again) != 2 {
+		t.Errorf("active set applied later = %+v, want both rules", again)
+	}
+}
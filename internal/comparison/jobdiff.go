@@ -0,0 +1,221 @@
+package comparison
+
+import (
+	"fmt"
+	"sort"
+
+	"hackathon-go/internal/models"
+)
+
+// Statuses of a discrepancy between two jobs.
+const (
+	DiffResolved   = "resolved"
+	DiffNew        = "new"
+	DiffPersisting = "persisting"
+	DiffChanged    = "changed"
+)
+
+// diffKey is the stable identity of a discrepancy across jobs.
+// Rule violations and consistency findings are told apart by rule or check and side
+// instead of field.
+type diffKey struct {
+	apiID     int
+	errorType string
+	field     string
+	rule      string
+	check     string
+	side      string
+}
+
+// diffItem is one field of a discrepancy, or the whole discrepancy when it has no fields.
+type diffItem struct {
+	error  *models.ErrorDetail
+	detail *models.MismatchDetail
+}
+
+// DiffErrors compares the discrepancies of two jobs, before and after, by product ID, type
+// and field (rule or check and side for rule violations and consistency findings). A
+// discrepancy with several fields gives one entry per field. Entries found in both jobs
+// are changed when their API or CSV value differs. Entries are ordered by product ID,
+// type and field.
+func DiffErrors(before, after []models.ErrorDetail) models.JobDiff {
+	diff := models.JobDiff{}
+	diff.Entries = diffEntries(diffItems(before), diffItems(after), &diff.Summary)
+	return diff
+}
+
+// DiffStream compares the discrepancies of two jobs as DiffErrors does, reading them in
+// their canonical order from before and after, which return a batch at a time and an empty
+// one at the end. Entries are passed to emit in DiffErrors' order, a product and type at a
+// time, so only the discrepancies of one product are held. It returns the summary.
+func DiffStream(before, after func() ([]models.ErrorDetail, error), emit func(models.JobDiffEntry) error) (models.JobDiffSummary, error) {
+	var summary models.JobDiffSummary
+	readers := [2]*diffReader{{next: before}, {next: after}}
+	for {
+		var group *models.ErrorDetail
+		for _, r := range readers {
+			e, err := r.peek()
+			if err != nil {
+				return summary, err
+			}
+			if e != nil && (group == nil || e.APIID < group.APIID || e.APIID == group.APIID && typeRank(e.Type) < typeRank(group.Type)) {
+				group = e
+			}
+		}
+		if group == nil {
+			return summary, nil
+		}
+
+		apiID, errorType := group.APIID, group.Type
+		var items [2]map[diffKey]diffItem
+		for i, r := range readers {
+			items[i] = make(map[diffKey]diffItem)
+			for {
+				e, err := r.peek()
+				if err != nil {
+					return summary, err
+				}
+				if e == nil || e.APIID != apiID || e.Type != errorType {
+					break
+				}
+				addDiffItems(items[i], e)
+				r.pos++
+			}
+		}
+		for _, entry := range diffEntries(items[0], items[1], &summary) {
+			if err := emit(entry); err != nil {
+				return summary, err
+			}
+		}
+	}
+}
+
+// diffReader reads the discrepancies of a job a batch at a time.
+type diffReader struct {
+	next  func() ([]models.ErrorDetail, error)
+	batch []models.ErrorDetail
+	pos   int
+	done  bool
+}
+
+// peek returns the next discrepancy without consuming it, nil at the end.
+func (r *diffReader) peek() (*models.ErrorDetail, error) {
+	for r.pos >= len(r.batch) {
+		if r.done {
+			return nil, nil
+		}
+		batch, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		r.batch, r.pos, r.done = batch, 0, len(batch) == 0
+	}
+	return &r.batch[r.pos], nil
+}
+
+// diffEntries compares indexed discrepancies, counting them in summary, and returns the
+// entries in order.
+func diffEntries(beforeItems, afterItems map[diffKey]diffItem, summary *models.JobDiffSummary) []models.JobDiffEntry {
+	entries := make([]models.JobDiffEntry, 0)
+	add := func(key diffKey, status string, item diffItem, beforeDetail, afterDetail *models.MismatchDetail) {
+		entries = append(entries, models.JobDiffEntry{
+			Status:     status,
+			APIID:      key.apiID,
+			Type:       key.errorType,
+			Field:      key.field,
+			Rule:       key.rule,
+			Check:      key.check,
+			Side:       key.side,
+			Nome:       item.error.Nome,
+			Categoria:  item.error.Categoria,
+			Fornecedor: item.error.Fornecedor,
+			Before:     beforeDetail,
+			After:      afterDetail,
+		})
+	}
+
+	for key, b := range beforeItems {
+		a, ok := afterItems[key]
+		switch {
+		case !ok:
+			summary.Resolved++
+			add(key, DiffResolved, b, b.detail, nil)
+		case sameValues(b.detail, a.detail):
+			summary.Persisting++
+			add(key, DiffPersisting, a, b.detail, a.detail)
+		default:
+			summary.Changed++
+			add(key, DiffChanged, a, b.detail, a.detail)
+		}
+	}
+	for key, a := range afterItems {
+		if _, ok := beforeItems[key]; !ok {
+			summary.New++
+			add(key, DiffNew, a, nil, a.detail)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.APIID != b.APIID {
+			return a.APIID < b.APIID
+		}
+		if a.Type != b.Type {
+			return typeRank(a.Type) < typeRank(b.Type)
+		}
+		if a.Field != b.Field {
+			return fieldRank(a.Field) < fieldRank(b.Field)
+		}
+		if a.Side != b.Side {
+			return a.Side < b.Side
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Check < b.Check
+	})
+	return entries
+}
+
+// diffItems indexes the discrepancies of a job by identity.
+func diffItems(errors []models.ErrorDetail) map[diffKey]diffItem {
+	items := make(map[diffKey]diffItem, len(errors))
+	for i := range errors {
+		addDiffItems(items, &errors[i])
+	}
+	return items
+}
+
+// addDiffItems indexes a discrepancy, one item per field.
+func addDiffItems(items map[diffKey]diffItem, e *models.ErrorDetail) {
+	if len(e.Fields) == 0 {
+		items[diffKey{apiID: e.APIID, errorType: e.Type, rule: e.Rule, check: e.Check, side: e.Side}] = diffItem{error: e}
+		return
+	}
+	for field, detail := range e.Fields {
+		detail := detail
+		items[diffKey{apiID: e.APIID, errorType: e.Type, field: field}] = diffItem{error: e, detail: &detail}
+	}
+}
+
+// sameValues reports whether two field differences have the same API and CSV values.
+// Values are compared in their printed form, since stored results decode numbers as json.Number.
+func sameValues(a, b *models.MismatchDetail) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return fmt.Sprint(a.APIValue) == fmt.Sprint(b.APIValue) && fmt.Sprint(a.CSVValue) == fmt.Sprint(b.CSVValue)
+}
+
+// fieldRank orders fields as in FieldNames, after discrepancies without a field.
+func fieldRank(field string) int {
+	if field == "" {
+		return -1
+	}
+	for i, name := range FieldNames {
+		if name == field {
+			return i
+		}
+	}
+	return len(FieldNames)
+}
@@ -0,0 +1,135 @@
+package comparison
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestDiffErrors(t *testing.T) {
+	field := func(api, csv interface{}) map[string]models.MismatchDetail {
+		return map[string]models.MismatchDetail{"preco": {APIValue: api, CSVValue: csv}}
+	}
+	before := []models.ErrorDetail{
+		{Type: "mismatch", APIID: 1, Fields: field("2.50", "3.00")},           // Persisting
+		{Type: "mismatch", APIID: 2, Fields: field("1.00", "1.10")},           // Changed
+		{Type: "missing_in_api", APIID: 3},                                    // Resolved
+		{Type: "rule_violation", APIID: 5, Rule: "positive", Side: "api"},     // Persisting
+		{Type: "rule_violation", APIID: 5, Rule: "positive", Side: "csv"},     // Resolved
+		{Type: "consistency", APIID: 6, Check: "duplicate_nome", Side: "csv"}, // Persisting
+	}
+	after := []models.ErrorDetail{
+		// Stored results decode numbers as json.Number
+		{Type: "mismatch", APIID: 1, Fields: field(json.Number("2.50"), json.Number("3.00"))},
+		{Type: "mismatch", APIID: 2, Fields: field("1.00", "1.20")},
+		{Type: "missing_in_csv", APIID: 4}, // New
+		{Type: "rule_violation", APIID: 5, Rule: "positive", Side: "api"},
+		{Type: "consistency", APIID: 6, Check: "duplicate_nome", Side: "csv"},
+	}
+
+	diff := DiffErrors(before, after)
+	want := []struct {
+		apiID  int
+		typ    string
+		side   string
+		status string
+	}{
+		{1, "mismatch", "", DiffPersisting},
+		{2, "mismatch", "", DiffChanged},
+		{3, "missing_in_api", "", DiffResolved},
+		{4, "missing_in_csv", "", DiffNew},
+		{5, "rule_violation", "api", DiffPersisting},
+		{5, "rule_violation", "csv", DiffResolved},
+		{6, "consistency", "csv", DiffPersisting},
+	}
+	if len(diff.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(diff.Entries), len(want), diff.Entries)
+	}
+	for i, w := range want {
+		e := diff.Entries[i]
+		if e.APIID != w.apiID || e.Type != w.typ || e.Side != w.side || e.Status != w.status {
+			t.Errorf("entry %d = %d %s %s %s, want %d %s %s %s", i, e.APIID, e.Type, e.Side, e.Status, w.apiID, w.typ, w.side, w.status)
+		}
+	}
+	if s := diff.Summary; s != (models.JobDiffSummary{Resolved: 2, New: 1, Persisting: 3, Changed: 1}) {
+		t.Errorf("summary = %+v", s)
+	}
+	if e := diff.Entries[1]; e.Before == nil || e.After == nil || e.Before.CSVValue != "1.10" || e.After.CSVValue != "1.20" {
+		t.Errorf("changed entry = %+v, want before and after values", e)
+	}
+}
+
+func TestDiffErrorsSplitsFields(t *testing.T) {
+	before := []models.ErrorDetail{{Type: "mismatch", APIID: 1, Fields: map[string]models.MismatchDetail{
+		"nome":  {APIValue: "a", CSVValue: "b"},
+		"preco": {APIValue: "1", CSVValue: "2"},
+	}}}
+	after := []models.ErrorDetail{{Type: "mismatch", APIID: 1, Fields: map[string]models.MismatchDetail{
+		"preco": {APIValue: "1", CSVValue: "2"},
+	}}}
+
+	diff := DiffErrors(before, after)
+	if len(diff.Entries) != 2 {
+		t.Fatalf("got %d entries, want one per field", len(diff.Entries))
+	}
+	// Fields are ordered as in FieldNames
+	if diff.Entries[0].Field != "nome" || diff.Entries[0].Status != DiffResolved ||
+		diff.Entries[1].Field != "preco" || diff.Entries[1].Status != DiffPersisting {
+		t.Errorf("entries = %+v", diff.Entries)
+	}
+}
+
+func TestDiffStreamMatchesDiffErrors(t *testing.T) {
+	field := func(name string, api, csv interface{}) map[string]models.MismatchDetail {
+		return map[string]models.MismatchDetail{name: {APIValue: api, CSVValue: csv}}
+	}
+	before := []models.ErrorDetail{
+		{Type: "mismatch", APIID: 1, Fields: field("preco", "2.50", "3.00")},
+		{Type: "rule_violation", APIID: 1, Rule: "positive", Side: "csv"},
+		{Type: "mismatch", APIID: 2, Fields: field("nome", "a", "b")},
+		{Type: "missing_in_api", APIID: 3},
+		{Type: "consistency", APIID: 6, Check: "duplicate_nome", Side: "csv"},
+	}
+	after := []models.ErrorDetail{
+		{Type: "mismatch", APIID: 1, Fields: field("preco", "2.50", "3.10")},
+		{Type: "mismatch", APIID: 2, Fields: field("nome", "a", "b")},
+		{Type: "missing_in_csv", APIID: 4},
+		{Type: "mismatch", APIID: 5, Fields: field("estoque", "1", "0")},
+		{Type: "consistency", APIID: 6, Check: "duplicate_nome", Side: "csv"},
+	}
+	SortErrors(before)
+	SortErrors(after)
+	want := DiffErrors(before, after)
+
+	// batches reads discrepancies size at a time
+	batches := func(errors []models.ErrorDetail, size int) func() ([]models.ErrorDetail, error) {
+		return func() ([]models.ErrorDetail, error) {
+			batch := errors[:min(size, len(errors))]
+			errors = errors[len(batch):]
+			return batch, nil
+		}
+	}
+	for _, size := range []int{1, 2, 10} {
+		var entries []models.JobDiffEntry
+		summary, err := DiffStream(batches(before, size), batches(after, size), func(e models.JobDiffEntry) error {
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary != want.Summary {
+			t.Errorf("batches of %d: summary = %+v, want %+v", size, summary, want.Summary)
+		}
+		if len(entries) != len(want.Entries) {
+			t.Fatalf("batches of %d: got %d entries, want %d", size, len(entries), len(want.Entries))
+		}
+		for i, e := range entries {
+			w := want.Entries[i]
+			if e.APIID != w.APIID || e.Type != w.Type || e.Field != w.Field || e.Side != w.Side || e.Status != w.Status {
+				t.Errorf("batches of %d: entry %d = %+v, want %+v", size, i, e, w)
+			}
+		}
+	}
+}
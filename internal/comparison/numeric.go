@@ -0,0 +1,67 @@
+package comparison
+
+import (
+	"math"
+
+	"hackathon-go/internal/money"
+)
+
+// numericDelta describes how far apart two numeric values are.
+type numericDelta struct {
+	abs    float64
+	pct    float64
+	hasPct bool // false when the API value is zero and a percentage is undefined
+}
+
+// compareNumeric reports whether two numeric values are equal under the given rule,
+// together with their absolute and percentage difference.
+func compareNumeric(rule NumericRule, apiValue, csvValue float64) (bool, numericDelta) {
+	if rule.RoundDecimals != nil {
+		apiValue = roundTo(apiValue, *rule.RoundDecimals)
+		csvValue = roundTo(csvValue, *rule.RoundDecimals)
+	}
+
+	delta := newNumericDelta(math.Abs(apiValue-csvValue), apiValue)
+	return withinTolerance(rule, delta), delta
+}
+
+// compareMoney is the exact counterpart of compareNumeric for monetary amounts.
+// Rounding and differences are computed in cents, so no float noise is introduced.
+func compareMoney(rule NumericRule, apiValue, csvValue money.Amount) (bool, numericDelta) {
+	if rule.RoundDecimals != nil {
+		apiValue = apiValue.Round(*rule.RoundDecimals, rule.Rounding)
+		csvValue = csvValue.Round(*rule.RoundDecimals, rule.Rounding)
+	}
+
+	delta := newNumericDelta((apiValue - csvValue).Abs().Float64(), apiValue.Float64())
+	return withinTolerance(rule, delta), delta
+}
+
+func newNumericDelta(abs, apiValue float64) numericDelta {
+	delta := numericDelta{abs: abs}
+	if apiValue != 0 {
+		delta.pct = abs / math.Abs(apiValue) * 100
+		delta.hasPct = true
+	}
+	return delta
+}
+
+// withinTolerance reports whether a difference is accepted by the rule.
+func withinTolerance(rule NumericRule, delta numericDelta) bool {
+	if delta.abs == 0 {
+		return true
+	}
+	if rule.AbsTolerance > 0 && delta.abs <= rule.AbsTolerance {
+		return true
+	}
+	if rule.RelTolerancePct > 0 && delta.hasPct && delta.pct <= rule.RelTolerancePct {
+		return true
+	}
+	return false
+}
+
+// roundTo rounds a value half away from zero to the given number of decimals.
+func roundTo(value float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,233 @@
+package comparison
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
+	"hackathon-go/internal/rules"
+)
+
+// NumericRule controls how a numeric field is compared between the API and the CSV.
+// Values are considered equal when they match after rounding, or when their
+// difference falls within either the absolute or the relative tolerance.
+type NumericRule struct {
+	AbsTolerance    float64            `json:"abs_tolerance,omitempty"`     // Maximum accepted absolute difference
+	RelTolerancePct float64            `json:"rel_tolerance_pct,omitempty"` // Maximum accepted difference in percent of the API value
+	RoundDecimals   *int               `json:"round_decimals,omitempty"`    // Round both values to N decimals before comparing
+	Rounding        money.RoundingMode `json:"rounding,omitempty"`          // Rounding mode used for monetary fields
+}
+
+// SimilarityRule enables fuzzy comparison of a text field. Differing values scoring at or
+// above Threshold are reported as near matches instead of mismatches.
+type SimilarityRule struct {
+	Algorithm string  `json:"algorithm"` // levenshtein, jaro_winkler or token_set
+	Threshold float64 `json:"threshold"` // Minimum score, between 0 and 1, for a near match
+}
+
+// SecondaryKeyRule enables a second matching pass that pairs records left unmatched by ID
+// on a composite key, to detect products re-registered under a new ID.
+type SecondaryKeyRule struct {
+	Fields     []string        `json:"fields"`               // Fields forming the key, e.g. ["nome", "fornecedor"]
+	Similarity *SimilarityRule `json:"similarity,omitempty"` // Optional fuzzy matching of the key
+}
+
+// ConsistencyRule enables the intra-source consistency checks, run on the API and the CSV
+// products separately. Each check is disabled when its setting is left empty.
+type ConsistencyRule struct {
+	DuplicateNome      bool            `json:"duplicate_nome,omitempty"`       // Same nome under several IDs with different prices
+	MaxCategorias      int             `json:"max_categorias,omitempty"`       // Most categorias a fornecedor's products may span
+	NearDuplicate      *SimilarityRule `json:"near_duplicate,omitempty"`       // Similar nomes in the same categoria...
+	NearDuplicateRatio float64         `json:"near_duplicate_ratio,omitempty"` // ...priced at least this many times apart (default 2)
+}
+
+// Options configures how CompareProducts matches and compares products.
+type Options struct {
+	Numeric      map[string]NumericRule    `json:"numeric,omitempty"`       // field name -> numeric comparison rule
+	Similarity   map[string]SimilarityRule `json:"similarity,omitempty"`    // field name -> fuzzy comparison rule
+	SecondaryKey *SecondaryKeyRule         `json:"secondary_key,omitempty"` // Re-keyed product detection
+	Severity     *SeverityModel            `json:"severity,omitempty"`      // Severity scoring of discrepancies
+	IgnoreRules  []models.IgnoreRule       `json:"ignore_rules,omitempty"`  // Accepted discrepancies, marked as suppressed
+	Rules        []rules.Rule              `json:"rules,omitempty"`         // Business-rule assertions evaluated on every record
+	Records      bool                      `json:"records,omitempty"`       // Embed the full API and CSV records in each discrepancy
+	Consistency  *ConsistencyRule          `json:"consistency,omitempty"`   // Intra-source consistency checks
+	Workers      int                       `json:"workers,omitempty"`       // Comparison workers, defaults to the number of CPUs
+}
+
+// DefaultOptions returns the comparison options used when nothing else is configured.
+// Prices are rounded to cents before comparing, so float noise from either source is ignored.
+func DefaultOptions() Options {
+	cents := 2
+	return Options{
+		Numeric: map[string]NumericRule{
+			"preco": {RoundDecimals: &cents},
+		},
+		Severity: DefaultSeverityModel(),
+	}
+}
+
+// LoadOptions reads comparison options from a JSON file, applied on top of DefaultOptions.
+func LoadOptions(path string) (Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to read comparison options: %w", err)
+	}
+	return DefaultOptions().WithOverrides(data)
+}
+
+// Validate checks that the configured rules can be applied.
+func (o Options) Validate() error {
+	for field, rule := range o.Numeric {
+		if !slices.Contains(numericFields, field) {
+			return fmt.Errorf("numeric rules apply to preco and estoque, not %q", field)
+		}
+		if rule.AbsTolerance < 0 || rule.RelTolerancePct < 0 {
+			return fmt.Errorf("field %s: tolerances must not be negative", field)
+		}
+		if rule.RoundDecimals == nil {
+			continue
+		}
+		if *rule.RoundDecimals < 0 {
+			return fmt.Errorf("field %s: round_decimals must not be negative", field)
+		}
+		// Prices are kept in cents, so they can't be rounded to more decimals
+		if field == "preco" && *rule.RoundDecimals > money.Scale {
+			return fmt.Errorf("field %s: round_decimals must be at most %d", field, money.Scale)
+		}
+	}
+
+	for field, rule := range o.Similarity {
+		if !slices.Contains(textFields, field) {
+			return fmt.Errorf("similarity rules apply to nome, categoria and fornecedor, not %q", field)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	if key := o.SecondaryKey; key != nil {
+		if len(key.Fields) == 0 {
+			return fmt.Errorf("secondary key needs at least one field")
+		}
+		for _, field := range key.Fields {
+			if !isField(field) {
+				return fmt.Errorf("unknown secondary key field %q", field)
+			}
+		}
+		if key.Similarity != nil {
+			if err := key.Similarity.validate(); err != nil {
+				return fmt.Errorf("secondary key: %w", err)
+			}
+		}
+	}
+
+	for _, rule := range o.IgnoreRules {
+		if err := ValidateIgnoreRule(rule); err != nil {
+			return err
+		}
+	}
+
+	if check := o.Consistency; check != nil {
+		if check.MaxCategorias < 0 {
+			return fmt.Errorf("max_categorias must not be negative")
+		}
+		if check.NearDuplicate != nil {
+			if err := check.NearDuplicate.validate(); err != nil {
+				return fmt.Errorf("near_duplicate: %w", err)
+			}
+		}
+		if check.NearDuplicateRatio != 0 && check.NearDuplicateRatio < 1 {
+			return fmt.Errorf("near_duplicate_ratio must be at least 1")
+		}
+	}
+
+	if _, err := rules.CompileAll(o.Rules); err != nil {
+		return err
+	}
+
+	if o.Severity != nil {
+		if err := o.Severity.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workerCount returns the number of comparison workers to run.
+func (o Options) workerCount() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return runtime.NumCPU()
+}
+
+func (r SimilarityRule) validate() error {
+	if _, ok := similarityFuncs[r.Algorithm]; !ok {
+		return fmt.Errorf("unknown similarity algorithm %q", r.Algorithm)
+	}
+	if r.Threshold < 0 || r.Threshold > 1 {
+		return fmt.Errorf("similarity threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+// WithOverrides returns a copy of the options with the given JSON document applied on top.
+// The receiver is never modified, so shared defaults can be safely overridden per request.
+func (o Options) WithOverrides(data []byte) (Options, error) {
+	base, err := json.Marshal(o)
+	if err != nil {
+		return Options{}, err
+	}
+
+	var merged, defaults Options
+	if err := json.Unmarshal(base, &merged); err != nil {
+		return Options{}, err
+	}
+	if err := json.Unmarshal(base, &defaults); err != nil {
+		return Options{}, err
+	}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return Options{}, fmt.Errorf("invalid comparison options: %w", err)
+	}
+
+	// Decoding a map replaces its values, so the rule given for a field that already has
+	// one is decoded again on top of a copy of the existing rule, keeping the settings it
+	// doesn't mention. A null rule removes the field's rule.
+	var fieldRules struct {
+		Numeric    map[string]json.RawMessage `json:"numeric"`
+		Similarity map[string]json.RawMessage `json:"similarity"`
+	}
+	if err := json.Unmarshal(data, &fieldRules); err != nil {
+		return Options{}, fmt.Errorf("invalid comparison options: %w", err)
+	}
+	for field, raw := range fieldRules.Numeric {
+		if string(raw) == "null" {
+			delete(merged.Numeric, field)
+			continue
+		}
+		rule := defaults.Numeric[field]
+		if err := json.Unmarshal(raw, &rule); err != nil {
+			return Options{}, fmt.Errorf("invalid comparison options: %w", err)
+		}
+		merged.Numeric[field] = rule
+	}
+	for field, raw := range fieldRules.Similarity {
+		if string(raw) == "null" {
+			delete(merged.Similarity, field)
+			continue
+		}
+		rule := defaults.Similarity[field]
+		if err := json.Unmarshal(raw, &rule); err != nil {
+			return Options{}, fmt.Errorf("invalid comparison options: %w", err)
+		}
+		merged.Similarity[field] = rule
+	}
+	if err := merged.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid comparison options: %w", err)
+	}
+	return merged, nil
+}
@@ -0,0 +1,146 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/money"
+)
+
+func TestWithOverridesMergesFieldRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides string
+		field     string
+		want      *NumericRule // nil when the field has no rule
+	}{
+		{
+			name:      "no overrides keep the default",
+			overrides: `{}`,
+			field:     "preco",
+			want:      &NumericRule{RoundDecimals: intPtr(2)},
+		},
+		{
+			name:      "tolerance keeps the default rounding",
+			overrides: `{"numeric": {"preco": {"abs_tolerance": 0.05}}}`,
+			field:     "preco",
+			want:      &NumericRule{AbsTolerance: 0.05, RoundDecimals: intPtr(2)},
+		},
+		{
+			name:      "given settings replace the default",
+			overrides: `{"numeric": {"preco": {"round_decimals": 1, "rounding": "half_even"}}}`,
+			field:     "preco",
+			want:      &NumericRule{RoundDecimals: intPtr(1), Rounding: money.HalfEven},
+		},
+		{
+			name:      "new fields get the given rule",
+			overrides: `{"numeric": {"estoque": {"abs_tolerance": 1}}}`,
+			field:     "estoque",
+			want:      &NumericRule{AbsTolerance: 1},
+		},
+		{
+			name:      "null removes the rule",
+			overrides: `{"numeric": {"preco": null}}`,
+			field:     "preco",
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := DefaultOptions().WithOverrides([]byte(tt.overrides))
+			if err != nil {
+				t.Fatalf("WithOverrides: %v", err)
+			}
+			got, ok := opts.Numeric[tt.field]
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("rule of %s = %+v, want none", tt.field, got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no rule for %s", tt.field)
+			}
+			if got.AbsTolerance != tt.want.AbsTolerance || got.RelTolerancePct != tt.want.RelTolerancePct || got.Rounding != tt.want.Rounding {
+				t.Errorf("rule of %s = %+v, want %+v", tt.field, got, *tt.want)
+			}
+			if (got.RoundDecimals == nil) != (tt.want.RoundDecimals == nil) ||
+				got.RoundDecimals != nil && *got.RoundDecimals != *tt.want.RoundDecimals {
+				t.Errorf("round_decimals of %s = %v, want %v", tt.field, deref(got.RoundDecimals), deref(tt.want.RoundDecimals))
+			}
+		})
+	}
+}
+
+func TestWithOverridesLeavesDefaultsUnchanged(t *testing.T) {
+	defaults := DefaultOptions()
+	if _, err := defaults.WithOverrides([]byte(`{"numeric": {"preco": {"round_decimals": 0}}}`)); err != nil {
+		t.Fatalf("WithOverrides: %v", err)
+	}
+	if got := *defaults.Numeric["preco"].RoundDecimals; got != 2 {
+		t.Errorf("default round_decimals changed to %d", got)
+	}
+}
+
+func TestWithOverridesMergesSimilarityRules(t *testing.T) {
+	base, err := DefaultOptions().WithOverrides([]byte(`{"similarity": {"nome": {"algorithm": "levenshtein", "threshold": 0.8}}}`))
+	if err != nil {
+		t.Fatalf("WithOverrides: %v", err)
+	}
+	opts, err := base.WithOverrides([]byte(`{"similarity": {"nome": {"threshold": 0.9}}}`))
+	if err != nil {
+		t.Fatalf("WithOverrides: %v", err)
+	}
+	want := SimilarityRule{Algorithm: "levenshtein", Threshold: 0.9}
+	if got := opts.Similarity["nome"]; got != want {
+		t.Errorf("rule of nome = %+v, want %+v", got, want)
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func deref(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+func TestValidateRoundDecimals(t *testing.T) {
+	tests := []struct {
+		overrides string
+		wantErr   bool
+	}{
+		{`{"numeric": {"preco": {"round_decimals": 0}}}`, false},
+		{`{"numeric": {"preco": {"round_decimals": 2}}}`, false},
+		{`{"numeric": {"preco": {"round_decimals": 3}}}`, true},
+		{`{"numeric": {"preco": {"round_decimals": -1}}}`, true},
+		{`{"numeric": {"estoque": {"round_decimals": 4}}}`, false},
+	}
+	for _, tt := range tests {
+		if _, err := DefaultOptions().WithOverrides([]byte(tt.overrides)); (err != nil) != tt.wantErr {
+			t.Errorf("WithOverrides(%s) = %v, want error %v", tt.overrides, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateFieldRules(t *testing.T) {
+	tests := []struct {
+		overrides string
+		wantErr   bool
+	}{
+		{`{"numeric": {"estoque": {"abs_tolerance": 1, "rel_tolerance_pct": 0.5}}}`, false},
+		{`{"numeric": {"prco": {"abs_tolerance": 1}}}`, true},
+		{`{"numeric": {"nome": {"abs_tolerance": 1}}}`, true},
+		{`{"numeric": {"preco": {"abs_tolerance": -0.01}}}`, true},
+		{`{"numeric": {"estoque": {"rel_tolerance_pct": -5}}}`, true},
+		{`{"similarity": {"fornecedor": {"algorithm": "token_set", "threshold": 0.9}}}`, false},
+		{`{"similarity": {"preco": {"algorithm": "token_set", "threshold": 0.9}}}`, true},
+		{`{"similarity": {"name": {"algorithm": "levenshtein", "threshold": 0.9}}}`, true},
+	}
+	for _, tt := range tests {
+		if _, err := DefaultOptions().WithOverrides([]byte(tt.overrides)); (err != nil) != tt.wantErr {
+			t.Errorf("WithOverrides(%s) = %v, want error %v", tt.overrides, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package comparison
+
+import (
+	"fmt"
+	"sort"
+
+	"hackathon-go/internal/models"
+)
+
+// Sort keys accepted by SortErrorsBy.
+const (
+	SortByAPIID      = "api_id"
+	SortByType       = "type"
+	SortByCSVLine    = "csv_line"
+	SortByField      = "field"
+	SortByPriceDelta = "price_delta"
+	SortBySeverity   = "severity"
+)
+
+// SortErrors puts discrepancies in their canonical order: by API ID, then type, then CSV ID,
+// then side and consistency check.
+// Types are ranked as listed in ErrorTypes.
+// Results are stored in this order so that repeated reads and paging are stable.
+func SortErrors(errors []models.ErrorDetail) {
+	sort.SliceStable(errors, func(i, j int) bool {
+		return canonicalLess(errors[i], errors[j])
+	})
+}
+
+func canonicalLess(a, b models.ErrorDetail) bool {
+	if a.APIID != b.APIID {
+		return a.APIID < b.APIID
+	}
+	if a.Type != b.Type {
+		return typeRank(a.Type) < typeRank(b.Type)
+	}
+	if a.CSVID != b.CSVID {
+		return a.CSVID < b.CSVID
+	}
+	// Rule violations and consistency findings of the API come before those of the CSV
+	if a.Side != b.Side {
+		return a.Side < b.Side
+	}
+	return a.Check < b.Check
+}
+
+// SortErrorsBy sorts discrepancies by the given key, ascending or descending, with ties
+// broken by the canonical order. Discrepancies lacking the key (e.g. no price delta)
+// always come last.
+func SortErrorsBy(errors []models.ErrorDetail, key string, desc bool) error {
+	less, err := ErrorLess(key, desc)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(errors, func(i, j int) bool {
+		return less(errors[i], errors[j])
+	})
+	return nil
+}
+
+// ErrorLess returns the order SortErrorsBy sorts discrepancies in, for readers that select
+// the first ones without sorting all of them.
+func ErrorLess(key string, desc bool) (func(a, b models.ErrorDetail) bool, error) {
+	value, ok := sortKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", key)
+	}
+
+	return func(x, y models.ErrorDetail) bool {
+		a, aOK := value(x)
+		b, bOK := value(y)
+		if aOK != bOK {
+			return aOK
+		}
+		if aOK && a != b {
+			if desc {
+				return a > b
+			}
+			return a < b
+		}
+		return canonicalLess(x, y)
+	}, nil
+}
+
+// sortValue extracts a comparable value from a discrepancy, or false when it has none.
+type sortValue func(models.ErrorDetail) (float64, bool)
+
+var sortKeys = map[string]sortValue{
+	SortByAPIID: func(e models.ErrorDetail) (float64, bool) {
+		return float64(e.APIID), true
+	},
+	SortByType: func(e models.ErrorDetail) (float64, bool) {
+		return float64(typeRank(e.Type)), true
+	},
+	SortByCSVLine: func(e models.ErrorDetail) (float64, bool) {
+		return float64(e.CSVLine), e.CSVLine > 0
+	},
+	SortByField: func(e models.ErrorDetail) (float64, bool) {
+		// Rank by the first differing field in FieldNames order
+		for i, field := range FieldNames {
+			if _, ok := e.Fields[field]; ok {
+				return float64(i), true
+			}
+		}
+		return 0, false
+	},
+	SortByPriceDelta: func(e models.ErrorDetail) (float64, bool) {
+		detail, ok := e.Fields["preco"]
+		if !ok || detail.AbsDelta == nil {
+			return 0, false
+		}
+		return *detail.AbsDelta, true
+	},
+	SortBySeverity: func(e models.ErrorDetail) (float64, bool) {
+		return e.SeverityScore, e.Severity != ""
+	},
+}
+
+// ErrorTypes lists the discrepancy types in the order used when sorting by type.
+var ErrorTypes = []string{"mismatch", "near_match", "id_changed", "missing_in_api", "missing_in_csv", "rule_violation", "consistency"}
+
+func typeRank(errorType string) int {
+	for i, t := range ErrorTypes {
+		if t == errorType {
+			return i
+		}
+	}
+	return len(ErrorTypes)
+}
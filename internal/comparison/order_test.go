@@ -0,0 +1,122 @@
+package comparison
+
+import (
+	"math/rand"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestSortErrors(t *testing.T) {
+	ordered := []models.ErrorDetail{
+		{APIID: 1, Type: "mismatch"},
+		{APIID: 1, Type: "rule_violation", Side: "api"},
+		{APIID: 1, Type: "rule_violation", Side: "csv"},
+		{APIID: 2, Type: "id_changed", CSVID: 7},
+		{APIID: 2, Type: "id_changed", CSVID: 9},
+		{APIID: 3, Type: "missing_in_api"},
+		{APIID: 3, Type: "consistency", Side: "api", Check: "duplicate_nome"},
+		{APIID: 3, Type: "consistency", Side: "api", Check: "near_duplicate"},
+		{APIID: 10, Type: "missing_in_csv"},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 20; run++ {
+		errors := append([]models.ErrorDetail(nil), ordered...)
+		rng.Shuffle(len(errors), func(i, j int) { errors[i], errors[j] = errors[j], errors[i] })
+		SortErrors(errors)
+		for i := range errors {
+			if errors[i].APIID != ordered[i].APIID || errors[i].Type != ordered[i].Type ||
+				errors[i].CSVID != ordered[i].CSVID || errors[i].Side != ordered[i].Side || errors[i].Check != ordered[i].Check {
+				t.Fatalf("position %d = %+v, want %+v", i, errors[i], ordered[i])
+			}
+		}
+	}
+}
+
+func TestSortErrorsBy(t *testing.T) {
+	delta := func(d float64) map[string]models.MismatchDetail {
+		return map[string]models.MismatchDetail{"preco": {AbsDelta: &d}}
+	}
+	errors := []models.ErrorDetail{
+		{APIID: 1, Type: "missing_in_csv"},
+		{APIID: 2, Type: "mismatch", CSVLine: 5, Fields: delta(3), Severity: "low", SeverityScore: 10},
+		{APIID: 3, Type: "mismatch", CSVLine: 3, Fields: delta(8), Severity: "high", SeverityScore: 80},
+		{APIID: 4, Type: "missing_in_api", CSVLine: 4, Severity: "medium", SeverityScore: 50},
+		{APIID: 5, Type: "mismatch", CSVLine: 2, Fields: delta(3)},
+	}
+
+	tests := []struct {
+		key  string
+		desc bool
+		want []int // API IDs in order
+	}{
+		{SortByAPIID, false, []int{1, 2, 3, 4, 5}},
+		{SortByAPIID, true, []int{5, 4, 3, 2, 1}},
+		{SortByType, false, []int{2, 3, 5, 4, 1}},
+		{SortByCSVLine, false, []int{5, 3, 4, 2, 1}},
+		{SortByCSVLine, true, []int{2, 4, 3, 5, 1}},
+		{SortByPriceDelta, true, []int{3, 2, 5, 1, 4}},
+		{SortByPriceDelta, false, []int{2, 5, 3, 1, 4}},
+		{SortBySeverity, true, []int{3, 4, 2, 1, 5}},
+		{SortByField, false, []int{2, 3, 5, 1, 4}},
+	}
+	for _, tt := range tests {
+		sorted := append([]models.ErrorDetail(nil), errors...)
+		if err := SortErrorsBy(sorted, tt.key, tt.desc); err != nil {
+			t.Fatalf("SortErrorsBy(%s): %v", tt.key, err)
+		}
+		for i, id := range tt.want {
+			if sorted[i].APIID != id {
+				t.Errorf("SortErrorsBy(%s, desc=%v) = %v, want %v", tt.key, tt.desc, apiIDs(sorted), tt.want)
+				break
+			}
+		}
+	}
+
+	if err := SortErrorsBy(errors, "nome", false); err == nil {
+		t.Error("SortErrorsBy accepted an unknown key")
+	}
+}
+
+func TestDuplicateIDsUseLatestCSVLine(t *testing.T) {
+	rows := []models.Product{
+		{ID: 1, Estoque: 1, CSVLine: 2},
+		{ID: 1, Estoque: 2, CSVLine: 3},
+		{ID: 1, Estoque: 3, CSVLine: 4},
+		{ID: 2, Estoque: 5, CSVLine: 5},
+	}
+	api := []models.Product{{ID: 1, Estoque: 9}, {ID: 2, Estoque: 5}}
+
+	// Rows come out of the concurrent parser in any order
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 20; run++ {
+		csv := append([]models.Product(nil), rows...)
+		rng.Shuffle(len(csv), func(i, j int) { csv[i], csv[j] = csv[j], csv[i] })
+
+		if pos := indexByID(csv)[1]; csv[pos].CSVLine != 4 {
+			t.Fatalf("indexByID picked line %d, want 4", csv[pos].CSVLine)
+		}
+		result := CompareProducts(api, csv, DefaultOptions())
+		if len(result.Errors) != 1 || result.Errors[0].CSVLine != 4 {
+			t.Fatalf("discrepancies = %+v, want one on line 4", result.Errors)
+		}
+		if got := result.Errors[0].Fields["estoque"].CSVValue; got != 3 {
+			t.Fatalf("compared estoque %v, want 3", got)
+		}
+	}
+}
+
+func TestIndexByIDUsesLastAPIProduct(t *testing.T) {
+	api := []models.Product{{ID: 1, Nome: "a"}, {ID: 1, Nome: "b"}}
+	if pos := indexByID(api)[1]; pos != 1 {
+		t.Errorf("indexByID picked position %d, want 1", pos)
+	}
+}
+
+func apiIDs(errors []models.ErrorDetail) []int {
+	ids := make([]int, len(errors))
+	for i, e := range errors {
+		ids[i] = e.APIID
+	}
+	return ids
+}
@@ -0,0 +1,65 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestAttachRecords(t *testing.T) {
+	api := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 250},
+		{ID: 2, Nome: "Lapis", Preco: 100},
+		{ID: 3, Nome: "Regua", Fornecedor: "Acrimet"},
+	}
+	csv := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 300, CSVLine: 2},
+		{ID: 4, Nome: "Extra", CSVLine: 3},
+		{ID: 5, Nome: "Regua", Fornecedor: "Acrimet", CSVLine: 4},
+	}
+
+	tests := []struct {
+		records   bool
+		secondary bool
+		want      map[int][2]int // API ID -> IDs of the embedded API and CSV records, 0 for none
+	}{
+		{
+			records: false,
+			want:    map[int][2]int{1: {0, 0}, 2: {0, 0}, 3: {0, 0}, 4: {0, 0}, 5: {0, 0}},
+		},
+		{
+			records: true,
+			want:    map[int][2]int{1: {1, 1}, 2: {2, 0}, 3: {3, 0}, 4: {0, 4}, 5: {0, 5}},
+		},
+		{
+			// Re-keyed products carry the records of both IDs
+			records:   true,
+			secondary: true,
+			want:      map[int][2]int{1: {1, 1}, 2: {2, 0}, 3: {3, 5}, 4: {0, 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Records = tt.records
+		if tt.secondary {
+			opts.SecondaryKey = &SecondaryKeyRule{Fields: []string{"nome", "fornecedor"}}
+		}
+		result := CompareProducts(api, csv, opts)
+		if len(result.Errors) != len(tt.want) {
+			t.Fatalf("records=%v secondary=%v: got %d discrepancies, want %d", tt.records, tt.secondary, len(result.Errors), len(tt.want))
+		}
+		for _, e := range result.Errors {
+			if got := [2]int{recordID(e.APIRecord), recordID(e.CSVRecord)}; got != tt.want[e.APIID] {
+				t.Errorf("records=%v secondary=%v: %s of %d records = %v, want %v", tt.records, tt.secondary, e.Type, e.APIID, got, tt.want[e.APIID])
+			}
+		}
+	}
+}
+
+func recordID(p *models.Product) int {
+	if p == nil {
+		return 0
+	}
+	return p.ID
+}
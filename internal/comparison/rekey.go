@@ -0,0 +1,220 @@
+package comparison
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"hackathon-go/internal/models"
+)
+
+// maxRekeyBlock bounds the number of products of a block of re-key candidates, so fuzzy
+// scoring stays far from quadratic. Larger blocks, such as a very common categoria, are
+// skipped; their products can still be paired through their other blocks.
+const maxRekeyBlock = 1000
+
+// rekeyCandidate is a possible pairing of a CSV-only and an API-only product.
+type rekeyCandidate struct {
+	csv, api int // Positions in csvOnly and apiOnly
+	score    float64
+	exact    bool // Same composite key, already paired
+}
+
+// pairRekeyedProducts runs the secondary-key pass over the leftovers of the ID match.
+// A missing_in_api record (only in the CSV) and a missing_in_csv record (only in the API)
+// sharing the same composite key are replaced by a single "id_changed" discrepancy.
+//
+// Exact key matches are paired first. With a similarity rule, the remaining products are
+// scored within blocks sharing their categoria, their fornecedor or the first word of
+// their key, and the best-scoring pairs are taken first.
+func pairRekeyedProducts(errors []models.ErrorDetail, apiProducts, csvProducts []models.Product, apiIndex, csvIndex map[int]int, opts Options) []models.ErrorDetail {
+	rule := opts.SecondaryKey
+
+	var csvOnly, apiOnly []models.Product
+	for _, e := range errors {
+		switch e.Type {
+		case "missing_in_api":
+			csvOnly = append(csvOnly, csvProducts[csvIndex[e.APIID]])
+		case "missing_in_csv":
+			apiOnly = append(apiOnly, apiProducts[apiIndex[e.APIID]])
+		}
+	}
+	if len(csvOnly) == 0 || len(apiOnly) == 0 {
+		return errors
+	}
+
+	// Iterate in ID order so pairing is reproducible between runs
+	sort.Slice(csvOnly, func(i, j int) bool { return csvOnly[i].ID < csvOnly[j].ID })
+	sort.Slice(apiOnly, func(i, j int) bool { return apiOnly[i].ID < apiOnly[j].ID })
+
+	csvKeys := make([]string, len(csvOnly))
+	for i, p := range csvOnly {
+		csvKeys[i] = compositeKey(p, rule.Fields)
+	}
+	apiKeys := make([]string, len(apiOnly))
+	apiByKey := make(map[string][]int)
+	for i, p := range apiOnly {
+		apiKeys[i] = compositeKey(p, rule.Fields)
+		apiByKey[apiKeys[i]] = append(apiByKey[apiKeys[i]], i)
+	}
+
+	usedCSV := make([]bool, len(csvOnly))
+	usedAPI := make([]bool, len(apiOnly))
+
+	// Products sharing a key are paired in ID order
+	var candidates []rekeyCandidate
+	for c, key := range csvKeys {
+		if matches := apiByKey[key]; len(matches) > 0 {
+			candidates = append(candidates, rekeyCandidate{csv: c, api: matches[0], score: 1, exact: true})
+			usedCSV[c], usedAPI[matches[0]] = true, true
+			apiByKey[key] = matches[1:]
+		}
+	}
+	if rule.Similarity != nil {
+		fuzzy := fuzzyRekeyCandidates(csvOnly, apiOnly, csvKeys, apiKeys, usedCSV, usedAPI, *rule.Similarity)
+		// Best pairs first, ties in ID order so pairing is reproducible
+		sort.Slice(fuzzy, func(i, j int) bool {
+			a, b := fuzzy[i], fuzzy[j]
+			if a.score != b.score {
+				return a.score > b.score
+			}
+			if a.csv != b.csv {
+				return a.csv < b.csv
+			}
+			return a.api < b.api
+		})
+		candidates = append(candidates, fuzzy...)
+	}
+
+	pairedCSV := make(map[int]bool)
+	pairedAPI := make(map[int]bool)
+	var pairs []models.ErrorDetail
+
+	for _, candidate := range candidates {
+		if !candidate.exact {
+			if usedCSV[candidate.csv] || usedAPI[candidate.api] {
+				continue
+			}
+			usedCSV[candidate.csv], usedAPI[candidate.api] = true, true
+		}
+		csvProduct, apiProduct := csvOnly[candidate.csv], apiOnly[candidate.api]
+		pairedCSV[csvProduct.ID] = true
+		pairedAPI[apiProduct.ID] = true
+
+		score := candidate.score
+		detail := models.ErrorDetail{
+			Type:       "id_changed",
+			CSVLine:    csvProduct.CSVLine,
+			APIID:      apiProduct.ID,
+			CSVID:      csvProduct.ID,
+			Nome:       apiProduct.Nome,
+			Categoria:  apiProduct.Categoria,
+			Fornecedor: apiProduct.Fornecedor,
+			MatchScore: &score,
+		}
+		if fields := compareFields(apiProduct, csvProduct, opts); len(fields) > 0 {
+			detail.Fields = fields
+		}
+		pairs = append(pairs, detail)
+	}
+
+	if len(pairs) == 0 {
+		return errors
+	}
+
+	kept := make([]models.ErrorDetail, 0, len(errors)-len(pairs))
+	for _, e := range errors {
+		if (e.Type == "missing_in_api" && pairedCSV[e.APIID]) || (e.Type == "missing_in_csv" && pairedAPI[e.APIID]) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return append(kept, pairs...)
+}
+
+// compositeKey joins the normalized values of the given fields into a matching key.
+func compositeKey(p models.Product, fields []string) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		value, _ := fieldValue(p, field)
+		parts[i] = normalize(fmt.Sprint(value))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// fuzzyRekeyCandidates scores the products with different keys that share a block, and
+// returns the pairs scoring at or above the rule's threshold. Products already paired are
+// left out.
+func fuzzyRekeyCandidates(csvOnly, apiOnly []models.Product, csvKeys, apiKeys []string, usedCSV, usedAPI []bool, rule SimilarityRule) []rekeyCandidate {
+	type block struct{ csv, api []int }
+	blocks := make(map[string]*block)
+	var order []string
+	add := func(key string, csv bool, i int) {
+		b, ok := blocks[key]
+		if !ok {
+			b = &block{}
+			blocks[key] = b
+			order = append(order, key)
+		}
+		if csv {
+			b.csv = append(b.csv, i)
+		} else {
+			b.api = append(b.api, i)
+		}
+	}
+	for i, p := range csvOnly {
+		if usedCSV[i] {
+			continue
+		}
+		for _, key := range rekeyBlocks(p, csvKeys[i]) {
+			add(key, true, i)
+		}
+	}
+	for i, p := range apiOnly {
+		if usedAPI[i] {
+			continue
+		}
+		for _, key := range rekeyBlocks(p, apiKeys[i]) {
+			add(key, false, i)
+		}
+	}
+
+	// Products sharing several blocks are only scored once
+	scored := make(map[[2]int]bool)
+	var candidates []rekeyCandidate
+	for _, key := range order {
+		b := blocks[key]
+		if len(b.csv) == 0 || len(b.api) == 0 || len(b.csv)+len(b.api) > maxRekeyBlock {
+			continue
+		}
+		for _, c := range b.csv {
+			for _, a := range b.api {
+				if csvKeys[c] == apiKeys[a] || scored[[2]int{c, a}] {
+					continue
+				}
+				scored[[2]int{c, a}] = true
+				score, _ := Similarity(rule.Algorithm, csvKeys[c], apiKeys[a])
+				if score >= rule.Threshold {
+					candidates = append(candidates, rekeyCandidate{csv: c, api: a, score: score})
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// rekeyBlocks returns the blocks of a re-key candidate: its categoria, its fornecedor and
+// the first word of its composite key. Pairs sharing none of them are not scored.
+func rekeyBlocks(p models.Product, key string) []string {
+	var blocks []string
+	if categoria := normalize(p.Categoria); categoria != "" {
+		blocks = append(blocks, "categoria\x00"+categoria)
+	}
+	if fornecedor := normalize(p.Fornecedor); fornecedor != "" {
+		blocks = append(blocks, "fornecedor\x00"+fornecedor)
+	}
+	if words := strings.Fields(key); len(words) > 0 {
+		blocks = append(blocks, "key\x00"+words[0])
+	}
+	return blocks
+}
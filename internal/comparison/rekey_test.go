@@ -0,0 +1,134 @@
+package comparison
+
+import (
+	"fmt"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestPairRekeyedProducts(t *testing.T) {
+	fuzzy := &SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0.8}
+	tests := []struct {
+		name       string
+		api, csv   []models.Product
+		similarity *SimilarityRule
+		want       map[int]int // CSV ID -> API ID of the id_changed pairs
+	}{
+		{
+			name: "exact key",
+			api:  []models.Product{{ID: 1, Nome: "Arroz 5kg", Fornecedor: "Camil"}},
+			csv:  []models.Product{{ID: 101, Nome: "arroz  5KG", Fornecedor: "camil"}},
+			want: map[int]int{101: 1},
+		},
+		{
+			name: "different key without similarity",
+			api:  []models.Product{{ID: 1, Nome: "Arroz 5kg", Fornecedor: "Camil"}},
+			csv:  []models.Product{{ID: 101, Nome: "Arroz 5 kg", Fornecedor: "Camil"}},
+			want: map[int]int{},
+		},
+		{
+			name: "duplicated keys pair in ID order",
+			api: []models.Product{
+				{ID: 2, Nome: "Sal", Fornecedor: "Cisne"},
+				{ID: 1, Nome: "Sal", Fornecedor: "Cisne"},
+			},
+			csv: []models.Product{
+				{ID: 102, Nome: "Sal", Fornecedor: "Cisne"},
+				{ID: 101, Nome: "Sal", Fornecedor: "Cisne"},
+				{ID: 103, Nome: "Sal", Fornecedor: "Cisne"},
+			},
+			want: map[int]int{101: 1, 102: 2},
+		},
+		{
+			name:       "best score wins over first come",
+			similarity: &SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0.85},
+			api: []models.Product{
+				{ID: 1, Nome: "Cafe Torrado 500g", Fornecedor: "Pilao"},
+				{ID: 2, Nome: "Cafe Torrado 250g", Fornecedor: "Pilao"},
+			},
+			csv: []models.Product{
+				// Closer to ID 2 than to ID 1, but 102 is closer still
+				{ID: 101, Nome: "Cafe Torrado 2g", Fornecedor: "Pilao"},
+				{ID: 102, Nome: "Cafe Torrado 250 g", Fornecedor: "Pilao"},
+			},
+			want: map[int]int{101: 1, 102: 2},
+		},
+		{
+			name:       "exact keys are paired before fuzzy ones",
+			similarity: fuzzy,
+			api: []models.Product{
+				{ID: 1, Nome: "Leite Integral", Fornecedor: "Italac"},
+			},
+			csv: []models.Product{
+				{ID: 101, Nome: "Leite Integra", Fornecedor: "Italac"},
+				{ID: 102, Nome: "Leite Integral", Fornecedor: "Italac"},
+			},
+			want: map[int]int{102: 1},
+		},
+		{
+			name:       "below threshold",
+			similarity: fuzzy,
+			api:        []models.Product{{ID: 1, Nome: "Oleo de Soja", Fornecedor: "Liza"}},
+			csv:        []models.Product{{ID: 101, Nome: "Oleo de Milho", Fornecedor: "Liza"}},
+			want:       map[int]int{},
+		},
+		{
+			name:       "no shared block",
+			similarity: &SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0.5},
+			api:        []models.Product{{ID: 1, Nome: "Farinha", Categoria: "Graos", Fornecedor: "Dona Benta"}},
+			csv:        []models.Product{{ID: 101, Nome: "Farinho", Categoria: "Padaria", Fornecedor: "Yoki"}},
+			want:       map[int]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.SecondaryKey = &SecondaryKeyRule{Fields: []string{"nome", "fornecedor"}, Similarity: tt.similarity}
+			for i := range tt.csv {
+				tt.csv[i].CSVLine = i + 2
+			}
+
+			result := CompareProducts(tt.api, tt.csv, opts)
+			got := map[int]int{}
+			for _, e := range result.Errors {
+				if e.Type == "id_changed" {
+					got[e.CSVID] = e.APIID
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("pairs = %v, want %v", got, tt.want)
+			}
+			if result.Summary.IDChanged != len(tt.want) {
+				t.Errorf("summary id_changed = %d, want %d", result.Summary.IDChanged, len(tt.want))
+			}
+			wantMissing := len(tt.api) + len(tt.csv) - 2*len(tt.want)
+			if missing := result.Summary.MissingInAPI + result.Summary.MissingInCSV; missing != wantMissing {
+				t.Errorf("missing records = %d, want %d", missing, wantMissing)
+			}
+		})
+	}
+}
+
+func TestRekeyBlocksSkipOversizedBlocks(t *testing.T) {
+	// Every product shares one categoria, too common to be a block, and nothing else
+	var api, csv []models.Product
+	for i := 0; i < maxRekeyBlock; i++ {
+		api = append(api, models.Product{ID: i + 1, Nome: fmt.Sprintf("a%d", i), Categoria: "Geral"})
+		csv = append(csv, models.Product{ID: maxRekeyBlock + i + 1, Nome: fmt.Sprintf("b%d", i), Categoria: "Geral", CSVLine: i + 2})
+	}
+	candidates := fuzzyRekeyCandidates(csv, api, keysOf(csv), keysOf(api),
+		make([]bool, len(csv)), make([]bool, len(api)), SimilarityRule{Algorithm: AlgorithmLevenshtein, Threshold: 0})
+	if len(candidates) != 0 {
+		t.Errorf("got %d candidates from an oversized block", len(candidates))
+	}
+}
+
+func keysOf(products []models.Product) []string {
+	keys := make([]string, len(products))
+	for i, p := range products {
+		keys[i] = compositeKey(p, []string{"nome"})
+	}
+	return keys
+}
@@ -0,0 +1,166 @@
+package comparison
+
+import (
+	"fmt"
+	"math"
+
+	"hackathon-go/internal/models"
+)
+
+// Severity levels assigned by the default model, from most to least severe.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// maxSeverityScore caps the score of a single discrepancy.
+const maxSeverityScore = 100
+
+// DeltaThreshold adds Score to a numeric field difference reaching both Abs and Pct.
+// A zero Abs or Pct is not checked.
+type DeltaThreshold struct {
+	Abs   float64 `json:"abs,omitempty"`
+	Pct   float64 `json:"pct,omitempty"`
+	Score float64 `json:"score"`
+}
+
+// FieldSeverity scores a difference in one field. Weight is the base score of any
+// difference; for numeric fields the highest matching threshold is added on top, and
+// near matches only count for Weight scaled by their dissimilarity.
+type FieldSeverity struct {
+	Weight     float64          `json:"weight"`
+	Thresholds []DeltaThreshold `json:"thresholds,omitempty"`
+}
+
+// SeverityLevel names the scores at or above MinScore.
+type SeverityLevel struct {
+	Name     string  `json:"name"`
+	MinScore float64 `json:"min_score"`
+}
+
+// SeverityModel assigns a score between 0 and 100 and a level to each discrepancy.
+type SeverityModel struct {
+	Fields           map[string]FieldSeverity `json:"fields,omitempty"`   // field name -> scoring rule
+	Types            map[string]float64       `json:"types,omitempty"`    // discrepancy type -> base score
+	StockOutConflict float64                  `json:"stock_out_conflict"` // Added when one side has estoque 0 and the other does not
+	Levels           []SeverityLevel          `json:"levels,omitempty"`   // Ordered from the highest MinScore down
+}
+
+// DefaultSeverityModel returns the severity model used when nothing else is configured.
+// A price 10x off or a stock-out conflict ends up critical, while a small stock
+// difference stays low.
+func DefaultSeverityModel() *SeverityModel {
+	return &SeverityModel{
+		Fields: map[string]FieldSeverity{
+			"preco": {Weight: 20, Thresholds: []DeltaThreshold{
+				{Pct: 5, Score: 15},
+				{Pct: 25, Score: 35},
+				{Pct: 100, Score: 60},
+			}},
+			"estoque": {Weight: 5, Thresholds: []DeltaThreshold{
+				{Abs: 10, Score: 10},
+				{Abs: 100, Score: 25},
+			}},
+			"categoria":  {Weight: 15},
+			"nome":       {Weight: 10},
+			"fornecedor": {Weight: 10},
+		},
+		Types: map[string]float64{
+			"missing_in_api": 40,
+			"missing_in_csv": 30,
+			"id_changed":     20,
+			"rule_violation": 30,
+			"consistency":    30,
+		},
+		StockOutConflict: 75,
+		Levels: []SeverityLevel{
+			{Name: SeverityCritical, MinScore: 80},
+			{Name: SeverityHigh, MinScore: 50},
+			{Name: SeverityMedium, MinScore: 20},
+			{Name: SeverityLow, MinScore: 0},
+		},
+	}
+}
+
+// validate checks that levels are named and ordered from the highest MinScore down.
+func (m *SeverityModel) validate() error {
+	for i, level := range m.Levels {
+		if level.Name == "" {
+			return fmt.Errorf("severity levels need a name")
+		}
+		if i > 0 && level.MinScore >= m.Levels[i-1].MinScore {
+			return fmt.Errorf("severity levels must be ordered by decreasing min_score")
+		}
+	}
+	return nil
+}
+
+// Score sets the severity score and level of a discrepancy.
+func (m *SeverityModel) Score(e *models.ErrorDetail) {
+	score := m.Types[e.Type]
+
+	for fieldName, detail := range e.Fields {
+		if detail.SuppressedBy != "" {
+			continue
+		}
+		rule := m.Fields[fieldName]
+		if detail.Near && detail.Similarity != nil {
+			score += rule.Weight * (1 - *detail.Similarity)
+			continue
+		}
+		score += rule.Weight + rule.thresholdScore(detail)
+	}
+
+	if m.StockOutConflict > 0 && isStockOutConflict(e) {
+		score += m.StockOutConflict
+	}
+
+	score = math.Min(score, maxSeverityScore)
+	e.SeverityScore = math.Round(score*100) / 100
+	e.Severity = m.level(score)
+}
+
+// thresholdScore returns the highest score among the thresholds reached by a difference.
+func (r FieldSeverity) thresholdScore(detail models.MismatchDetail) float64 {
+	if detail.AbsDelta == nil {
+		return 0
+	}
+	best := 0.0
+	for _, t := range r.Thresholds {
+		if t.Abs > 0 && *detail.AbsDelta < t.Abs {
+			continue
+		}
+		if t.Pct > 0 && (detail.PctDelta == nil || *detail.PctDelta < t.Pct) {
+			continue
+		}
+		best = math.Max(best, t.Score)
+	}
+	return best
+}
+
+// level returns the name of the highest level reached by a score.
+func (m *SeverityModel) level(score float64) string {
+	for _, level := range m.Levels {
+		if score >= level.MinScore {
+			return level.Name
+		}
+	}
+	return ""
+}
+
+// isStockOutConflict reports whether one side has the product out of stock while the other
+// has it in stock. An estoque difference accepted by an ignore rule is no conflict.
+func isStockOutConflict(e *models.ErrorDetail) bool {
+	detail, ok := e.Fields["estoque"]
+	if !ok || detail.SuppressedBy != "" {
+		return false
+	}
+	apiStock, apiOK := toFloat(detail.APIValue)
+	csvStock, csvOK := toFloat(detail.CSVValue)
+	if !apiOK || !csvOK {
+		return false
+	}
+	return (apiStock == 0) != (csvStock == 0)
+}
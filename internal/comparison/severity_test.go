@@ -0,0 +1,128 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestSeverityScore(t *testing.T) {
+	pct := func(p float64) *float64 { return &p }
+	tests := []struct {
+		name  string
+		err   models.ErrorDetail
+		score float64
+		level string
+	}{
+		{
+			name:  "missing in api",
+			err:   models.ErrorDetail{Type: "missing_in_api"},
+			score: 40, level: SeverityMedium,
+		},
+		{
+			name: "small price difference",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"preco": {AbsDelta: pct(0.5), PctDelta: pct(1)},
+			}},
+			score: 20, level: SeverityMedium,
+		},
+		{
+			name: "price 10x off",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"preco": {AbsDelta: pct(90), PctDelta: pct(900)},
+			}},
+			score: 80, level: SeverityCritical,
+		},
+		{
+			name: "small stock difference",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"estoque": {APIValue: 10, CSVValue: 12, AbsDelta: pct(2), PctDelta: pct(20)},
+			}},
+			score: 5, level: SeverityLow,
+		},
+		{
+			name: "stock-out conflict",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"estoque": {APIValue: 0, CSVValue: 12, AbsDelta: pct(12)},
+			}},
+			score: 90, level: SeverityCritical,
+		},
+		{
+			name: "near match scales with dissimilarity",
+			err: models.ErrorDetail{Type: "near_match", Fields: map[string]models.MismatchDetail{
+				"nome": {Near: true, Similarity: pct(0.9)},
+			}},
+			score: 1, level: SeverityLow,
+		},
+		{
+			name: "suppressed fields don't count",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"categoria": {SuppressedBy: "rule-1"},
+				"nome":      {},
+			}},
+			score: 10, level: SeverityLow,
+		},
+		{
+			name: "suppressed stock-out conflict",
+			err: models.ErrorDetail{Type: "mismatch", Fields: map[string]models.MismatchDetail{
+				"estoque": {APIValue: 0, CSVValue: 12, AbsDelta: pct(12), SuppressedBy: "rule-1"},
+				"nome":    {},
+			}},
+			score: 10, level: SeverityLow,
+		},
+		{
+			name: "capped at 100",
+			err: models.ErrorDetail{Type: "id_changed", Fields: map[string]models.MismatchDetail{
+				"preco":   {AbsDelta: pct(90), PctDelta: pct(900)},
+				"estoque": {APIValue: 0, CSVValue: 500, AbsDelta: pct(500)},
+			}},
+			score: 100, level: SeverityCritical,
+		},
+	}
+
+	model := DefaultSeverityModel()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.err
+			model.Score(&e)
+			if e.SeverityScore != tt.score || e.Severity != tt.level {
+				t.Errorf("score = %v (%s), want %v (%s)", e.SeverityScore, e.Severity, tt.score, tt.level)
+			}
+		})
+	}
+}
+
+func TestSeverityModelValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		levels  []SeverityLevel
+		wantErr bool
+	}{
+		{"default", DefaultSeverityModel().Levels, false},
+		{"unnamed", []SeverityLevel{{MinScore: 10}}, true},
+		{"unordered", []SeverityLevel{{Name: "low", MinScore: 0}, {Name: "high", MinScore: 50}}, true},
+		{"equal", []SeverityLevel{{Name: "a", MinScore: 50}, {Name: "b", MinScore: 50}}, true},
+	}
+	for _, tt := range tests {
+		model := &SeverityModel{Levels: tt.levels}
+		if err := model.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSeverityIgnoresSuppressedStockOut(t *testing.T) {
+	api := []models.Product{{ID: 1, Nome: "Arroz", Estoque: 0}}
+	csv := []models.Product{{ID: 1, Nome: "Arroz integral", Estoque: 12, CSVLine: 2}}
+	id := 1
+	opts := DefaultOptions()
+	opts.IgnoreRules = []models.IgnoreRule{{ID: "estoque-ok", ProductID: &id, Field: "estoque"}}
+
+	errors := CompareProducts(api, csv, opts).Errors
+	if len(errors) != 1 {
+		t.Fatalf("got %d discrepancies, want 1", len(errors))
+	}
+	if e := errors[0]; e.Fields["estoque"].SuppressedBy != "estoque-ok" || e.SeverityScore >= DefaultSeverityModel().StockOutConflict {
+		t.Errorf("discrepancy = %+v, want the suppressed estoque left out of the score", e)
+	}
+}
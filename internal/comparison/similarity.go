@@ -0,0 +1,179 @@
+package comparison
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Similarity algorithms supported by SimilarityRule.
+const (
+	AlgorithmLevenshtein = "levenshtein"
+	AlgorithmJaroWinkler = "jaro_winkler"
+	AlgorithmTokenSet    = "token_set"
+)
+
+// similarityFuncs maps an algorithm name to its scoring function.
+// Every function returns a score between 0 (unrelated) and 1 (identical).
+var similarityFuncs = map[string]func(a, b string) float64{
+	AlgorithmLevenshtein: LevenshteinRatio,
+	AlgorithmJaroWinkler: JaroWinkler,
+	AlgorithmTokenSet:    TokenSetRatio,
+}
+
+// Similarity scores two strings with the named algorithm after normalizing them.
+// It returns false when the algorithm is unknown.
+func Similarity(algorithm, a, b string) (float64, bool) {
+	fn, ok := similarityFuncs[algorithm]
+	if !ok {
+		return 0, false
+	}
+	return fn(normalize(a), normalize(b)), true
+}
+
+// normalize lowercases a string, replaces punctuation with spaces and collapses whitespace.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// LevenshteinRatio returns 1 - distance/maxLen, where distance is the edit distance in runes.
+func LevenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+// levenshtein computes the edit distance between two rune slices using two rows.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity, which favours strings sharing a prefix
+// and is therefore forgiving with abbreviations such as "Cx." and "Caixa".
+func JaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	// Count transpositions between the matched characters of both strings
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// TokenSetRatio compares the sets of words of both strings, so reordered or repeated
+// words do not count as differences. The score is the best LevenshteinRatio among the
+// shared words and the shared words joined with each side's remaining words.
+func TokenSetRatio(a, b string) float64 {
+	setA, setB := tokenSet(a), tokenSet(b)
+
+	var common, onlyA, onlyB []string
+	for token := range setA {
+		if setB[token] {
+			common = append(common, token)
+		} else {
+			onlyA = append(onlyA, token)
+		}
+	}
+	for token := range setB {
+		if !setA[token] {
+			onlyB = append(onlyB, token)
+		}
+	}
+	sort.Strings(common)
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+
+	base := strings.Join(common, " ")
+	withA := strings.TrimSpace(base + " " + strings.Join(onlyA, " "))
+	withB := strings.TrimSpace(base + " " + strings.Join(onlyB, " "))
+
+	best := LevenshteinRatio(withA, withB)
+	if len(common) > 0 {
+		best = max(best, LevenshteinRatio(base, withA), LevenshteinRatio(base, withB))
+	}
+	return best
+}
+
+func tokenSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, token := range strings.Fields(s) {
+		set[token] = true
+	}
+	return set
+}
@@ -0,0 +1,90 @@
+package comparison
+
+import (
+	"math"
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		a, b      string
+		want      float64
+	}{
+		{AlgorithmLevenshtein, "", "", 1},
+		{AlgorithmLevenshtein, "abc", "abc", 1},
+		{AlgorithmLevenshtein, "kitten", "sitting", 1 - 3.0/7},
+		{AlgorithmLevenshtein, "abc", "", 0},
+		{AlgorithmLevenshtein, "Café", "cafe", 0.75}, // One rune differs after lowercasing
+		{AlgorithmLevenshtein, "Caixa-Grande", "caixa grande", 1},
+		{AlgorithmJaroWinkler, "martha", "marhta", 0.9611111111111111},
+		{AlgorithmJaroWinkler, "dwayne", "duane", 0.84},
+		{AlgorithmJaroWinkler, "abc", "xyz", 0},
+		{AlgorithmJaroWinkler, "", "", 1},
+		{AlgorithmJaroWinkler, "abc", "", 0},
+		{AlgorithmTokenSet, "Arroz Tipo 1", "tipo 1 arroz", 1},
+		{AlgorithmTokenSet, "arroz arroz", "arroz", 1},
+		{AlgorithmTokenSet, "arroz integral", "arroz", 1}, // Shared words alone match one side
+		{AlgorithmTokenSet, "abc", "xyz", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+"/"+tt.a+"/"+tt.b, func(t *testing.T) {
+			got, ok := Similarity(tt.algorithm, tt.a, tt.b)
+			if !ok {
+				t.Fatalf("unknown algorithm %s", tt.algorithm)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Similarity(%s, %q, %q) = %v, want %v", tt.algorithm, tt.a, tt.b, got, tt.want)
+			}
+			if back, _ := Similarity(tt.algorithm, tt.b, tt.a); math.Abs(back-got) > 1e-9 {
+				t.Errorf("Similarity(%s) is not symmetric: %v and %v", tt.algorithm, got, back)
+			}
+		})
+	}
+
+	if _, ok := Similarity("soundex", "a", "b"); ok {
+		t.Error("Similarity accepted an unknown algorithm")
+	}
+}
+
+func TestCompareNearMatches(t *testing.T) {
+	api := []models.Product{
+		{ID: 1, Nome: "Arroz Tipo 1 5kg", Fornecedor: "Camil"},
+		{ID: 2, Nome: "Feijão Preto", Fornecedor: "Kicaldo"},
+		{ID: 3, Nome: "Açúcar", Fornecedor: "União"},
+	}
+	csv := []models.Product{
+		{ID: 1, Nome: "Arroz Tipo1 5kg", Fornecedor: "Camil", CSVLine: 2},
+		{ID: 2, Nome: "Feijão Carioca", Fornecedor: "Kicaldo", CSVLine: 3},
+		{ID: 3, Nome: "Açúcar", Fornecedor: "Uniao", CSVLine: 4},
+	}
+	opts := DefaultOptions()
+	opts.Similarity = map[string]SimilarityRule{
+		"nome":       {Algorithm: AlgorithmLevenshtein, Threshold: 0.9},
+		"fornecedor": {Algorithm: AlgorithmJaroWinkler, Threshold: 0.8},
+	}
+
+	result := CompareProducts(api, csv, opts)
+	want := map[int]string{1: "near_match", 2: "mismatch", 3: "near_match"}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("got %d discrepancies, want %d: %+v", len(result.Errors), len(want), result.Errors)
+	}
+	for _, e := range result.Errors {
+		if e.Type != want[e.APIID] {
+			t.Errorf("product %d: type %s, want %s", e.APIID, e.Type, want[e.APIID])
+		}
+		for field, detail := range e.Fields {
+			if detail.Similarity == nil {
+				t.Errorf("product %d: field %s has no similarity score", e.APIID, field)
+			}
+		}
+	}
+	if result.Summary.NearMatched != 2 || result.Summary.Mismatched != 1 {
+		t.Errorf("summary near_matched=%d mismatched=%d, want 2 and 1", result.Summary.NearMatched, result.Summary.Mismatched)
+	}
+	if result.Summary.NearCategories["nome"] != 1 || result.Summary.NearCategories["fornecedor"] != 1 {
+		t.Errorf("near categories = %v", result.Summary.NearCategories)
+	}
+}
@@ -0,0 +1,209 @@
+package comparison
+
+import (
+	"sort"
+
+	"hackathon-go/internal/models"
+)
+
+// Three-way statuses, in the style of a merge tool: the updated CSV is the local side and
+// the API the upstream side, both compared against the baseline CSV.
+const (
+	ThreeWayUnchanged       = "unchanged"
+	ThreeWayChangedLocally  = "changed_locally"
+	ThreeWayChangedUpstream = "changed_upstream"
+	ThreeWayChangedBoth     = "changed_both"
+)
+
+// Per-side changes of a product in a three-way comparison.
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+// CompareThreeWay classifies every product of the baseline CSV, the updated CSV and the API
+// by the side that changed it since the baseline. Field differences follow the rules in opts,
+// so tolerances and similarity thresholds decide what counts as a change.
+//
+// A product changed on both sides is a conflict when the two sides disagree: a field changed
+// to different values, a product modified on one side and removed on the other, or a product
+// added on both sides with different values. With duplicated IDs the latest row is used.
+func CompareThreeWay(baseline, updated, apiProducts []models.Product, opts Options) models.ThreeWayResult {
+	baseIndex := indexByID(baseline)
+	localIndex := indexByID(updated)
+	upstreamIndex := indexByID(apiProducts)
+
+	ids := make([]int, 0, len(upstreamIndex))
+	seen := make(map[int]bool, len(upstreamIndex))
+	for _, index := range []map[int]int{baseIndex, localIndex, upstreamIndex} {
+		for id := range index {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+
+	result := models.ThreeWayResult{
+		Summary: models.ThreeWaySummary{
+			TotalBaseline:  len(baseline),
+			TotalUpdated:   len(updated),
+			TotalAPI:       len(apiProducts),
+			LocalFields:    make(map[string]int),
+			UpstreamFields: make(map[string]int),
+			ConflictFields: make(map[string]int),
+		},
+		Products: []models.ThreeWayProduct{},
+	}
+
+	lookup := func(products []models.Product, index map[int]int, id int) *models.Product {
+		if pos, ok := index[id]; ok {
+			return &products[pos]
+		}
+		return nil
+	}
+
+	for _, id := range ids {
+		product := classifyThreeWay(id,
+			lookup(baseline, baseIndex, id),
+			lookup(updated, localIndex, id),
+			lookup(apiProducts, upstreamIndex, id),
+			opts)
+
+		summary := &result.Summary
+		switch product.Status {
+		case ThreeWayUnchanged:
+			summary.Unchanged++
+			continue
+		case ThreeWayChangedLocally:
+			summary.ChangedLocally++
+		case ThreeWayChangedUpstream:
+			summary.ChangedUpstream++
+		case ThreeWayChangedBoth:
+			summary.ChangedBoth++
+		}
+		if product.Conflict {
+			summary.Conflicts++
+		}
+		for fieldName, field := range product.Fields {
+			if field.Changed != "upstream" {
+				summary.LocalFields[fieldName]++
+			}
+			if field.Changed != "local" {
+				summary.UpstreamFields[fieldName]++
+			}
+			if field.Conflict {
+				summary.ConflictFields[fieldName]++
+			}
+		}
+		result.Products = append(result.Products, product)
+	}
+
+	return result
+}
+
+// classifyThreeWay compares the versions of one product; a nil version does not exist on that side.
+func classifyThreeWay(id int, base, local, upstream *models.Product, opts Options) models.ThreeWayProduct {
+	product := models.ThreeWayProduct{ID: id}
+
+	// Descriptive fields come from the most recent version available
+	for _, p := range []*models.Product{base, upstream, local} {
+		if p != nil {
+			product.Nome, product.Categoria, product.Fornecedor = p.Nome, p.Categoria, p.Fornecedor
+		}
+	}
+	if local != nil {
+		product.CSVLine = local.CSVLine
+	}
+
+	var localFields, upstreamFields map[string]models.MismatchDetail
+	product.Local, localFields = sideChange(base, local, opts)
+	product.Upstream, upstreamFields = sideChange(base, upstream, opts)
+
+	switch {
+	case product.Local == "" && product.Upstream == "":
+		product.Status = ThreeWayUnchanged
+		return product
+	case product.Upstream == "":
+		product.Status = ThreeWayChangedLocally
+	case product.Local == "":
+		product.Status = ThreeWayChangedUpstream
+	default:
+		product.Status = ThreeWayChangedBoth
+	}
+
+	// Fields whose local and upstream values still differ, for conflict detection
+	var divergent map[string]models.MismatchDetail
+	if local != nil && upstream != nil {
+		divergent = compareFields(*upstream, *local, opts)
+	}
+
+	value := func(p *models.Product, fieldName string) interface{} {
+		if p == nil {
+			return nil
+		}
+		v, _ := fieldValue(*p, fieldName)
+		return v
+	}
+
+	for _, fieldName := range FieldNames {
+		_, localChanged := localFields[fieldName]
+		_, upstreamChanged := upstreamFields[fieldName]
+		_, diverges := divergent[fieldName]
+		// Products added on both sides have no baseline, so every divergent field is a change on both
+		if base == nil && diverges {
+			localChanged, upstreamChanged = true, true
+		}
+		if !localChanged && !upstreamChanged {
+			continue
+		}
+
+		field := models.ThreeWayField{
+			Base:     value(base, fieldName),
+			Local:    value(local, fieldName),
+			Upstream: value(upstream, fieldName),
+		}
+		switch {
+		case localChanged && upstreamChanged:
+			field.Changed = "both"
+			field.Conflict = diverges
+		case localChanged:
+			field.Changed = "local"
+		default:
+			field.Changed = "upstream"
+		}
+		if product.Fields == nil {
+			product.Fields = make(map[string]models.ThreeWayField)
+		}
+		product.Fields[fieldName] = field
+		product.Conflict = product.Conflict || field.Conflict
+	}
+
+	// Modifying a product on one side while removing it on the other is a conflict as well
+	if (product.Local == changeRemoved && product.Upstream == changeModified) ||
+		(product.Local == changeModified && product.Upstream == changeRemoved) {
+		product.Conflict = true
+	}
+
+	return product
+}
+
+// sideChange describes how one side changed a product since the baseline,
+// with the modified fields. An empty change means the product is unchanged.
+func sideChange(base, side *models.Product, opts Options) (string, map[string]models.MismatchDetail) {
+	switch {
+	case base == nil && side == nil:
+		return "", nil
+	case base == nil:
+		return changeAdded, nil
+	case side == nil:
+		return changeRemoved, nil
+	}
+	fields := compareFields(*base, *side, opts)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return changeModified, fields
+}
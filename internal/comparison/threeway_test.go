@@ -0,0 +1,101 @@
+package comparison
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+func TestCompareThreeWay(t *testing.T) {
+	base := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 250, Estoque: 10},
+		{ID: 2, Nome: "Lapis", Preco: 100, Estoque: 5},
+		{ID: 3, Nome: "Borracha", Preco: 80, Estoque: 7},
+		{ID: 4, Nome: "Regua", Preco: 350, Estoque: 2},
+		{ID: 5, Nome: "Cola", Preco: 400, Estoque: 3},
+		{ID: 6, Nome: "Tesoura", Preco: 900, Estoque: 1},
+		{ID: 7, Nome: "Clips", Preco: 120, Estoque: 50},
+	}
+	updated := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 250, Estoque: 10, CSVLine: 2}, // Unchanged
+		{ID: 2, Nome: "Lapis", Preco: 110, Estoque: 5, CSVLine: 3},   // Price changed locally
+		{ID: 3, Nome: "Borracha", Preco: 80, Estoque: 7, CSVLine: 4},
+		{ID: 4, Nome: "Regua", Preco: 360, Estoque: 2, CSVLine: 5}, // Price changed on both sides alike
+		{ID: 5, Nome: "Cola", Preco: 410, Estoque: 3, CSVLine: 6},  // Price changed on both sides differently
+		{ID: 6, Nome: "Tesoura", Preco: 950, Estoque: 1, CSVLine: 7},
+		// ID 7 removed locally
+		{ID: 8, Nome: "Grampo", Preco: 50, Estoque: 9, CSVLine: 8}, // Added on both sides differently
+	}
+	api := []models.Product{
+		{ID: 1, Nome: "Caneta", Preco: 250, Estoque: 10},
+		{ID: 2, Nome: "Lapis", Preco: 100, Estoque: 5},
+		{ID: 3, Nome: "Borracha", Preco: 80, Estoque: 8}, // Stock changed upstream
+		{ID: 4, Nome: "Regua", Preco: 360, Estoque: 2},
+		{ID: 5, Nome: "Cola", Preco: 420, Estoque: 3},
+		// ID 6 removed upstream while modified locally
+		{ID: 7, Nome: "Clips", Preco: 130, Estoque: 50}, // Modified upstream, removed locally
+		{ID: 8, Nome: "Grampo", Preco: 60, Estoque: 9},
+	}
+
+	result := CompareThreeWay(base, updated, api, DefaultOptions())
+
+	want := map[int]struct {
+		status          string
+		local, upstream string
+		conflict        bool
+	}{
+		2: {ThreeWayChangedLocally, changeModified, "", false},
+		3: {ThreeWayChangedUpstream, "", changeModified, false},
+		4: {ThreeWayChangedBoth, changeModified, changeModified, false},
+		5: {ThreeWayChangedBoth, changeModified, changeModified, true},
+		6: {ThreeWayChangedBoth, changeModified, changeRemoved, true},
+		7: {ThreeWayChangedBoth, changeRemoved, changeModified, true},
+		8: {ThreeWayChangedBoth, changeAdded, changeAdded, true},
+	}
+	if len(result.Products) != len(want) {
+		t.Fatalf("got %d changed products, want %d: %+v", len(result.Products), len(want), result.Products)
+	}
+	for i, p := range result.Products {
+		if i > 0 && p.ID <= result.Products[i-1].ID {
+			t.Errorf("products not ordered by ID")
+		}
+		w, ok := want[p.ID]
+		if !ok {
+			t.Errorf("unexpected product %d", p.ID)
+			continue
+		}
+		if p.Status != w.status || p.Local != w.local || p.Upstream != w.upstream || p.Conflict != w.conflict {
+			t.Errorf("product %d = %s (local %q, upstream %q, conflict %v), want %s (local %q, upstream %q, conflict %v)",
+				p.ID, p.Status, p.Local, p.Upstream, p.Conflict, w.status, w.local, w.upstream, w.conflict)
+		}
+	}
+
+	if field := result.Products[3].Fields["preco"]; field.Changed != "both" || !field.Conflict {
+		t.Errorf("preco of product 5 = %+v, want a conflict changed on both sides", field)
+	}
+	if field := result.Products[2].Fields["preco"]; field.Changed != "both" || field.Conflict {
+		t.Errorf("preco of product 4 = %+v, want changed on both sides alike", field)
+	}
+
+	s := result.Summary
+	if s.Unchanged != 1 || s.ChangedLocally != 1 || s.ChangedUpstream != 1 || s.ChangedBoth != 5 || s.Conflicts != 4 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.ConflictFields["preco"] != 2 || s.UpstreamFields["estoque"] != 1 {
+		t.Errorf("field counts = conflicts %v, upstream %v", s.ConflictFields, s.UpstreamFields)
+	}
+}
+
+func TestCompareThreeWayAppliesTolerances(t *testing.T) {
+	base := []models.Product{{ID: 1, Preco: 1000}}
+	updated := []models.Product{{ID: 1, Preco: 1001, CSVLine: 2}}
+	api := []models.Product{{ID: 1, Preco: 1000}}
+
+	opts, err := DefaultOptions().WithOverrides([]byte(`{"numeric": {"preco": {"abs_tolerance": 0.05}}}`))
+	if err != nil {
+		t.Fatalf("WithOverrides: %v", err)
+	}
+	if result := CompareThreeWay(base, updated, api, opts); len(result.Products) != 0 {
+		t.Errorf("changes within tolerance reported: %+v", result.Products)
+	}
+}
@@ -0,0 +1,101 @@
+// Package config reads the environment shared by cmd/server and cmd/worker, so servers and
+// workers of a deployment agree on storage, uploads, retention and the queue.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"hackathon-go/internal/queue"
+	"hackathon-go/internal/storage"
+)
+
+// Config is the configuration read from the environment.
+type Config struct {
+	Storage storage.Config
+	Queue   queue.Config
+	BlobDir string // Directory of the uploaded files
+	// SpillDir holds the sorted runs of streamed comparisons, the system temp directory when empty
+	SpillDir string
+
+	Retention     time.Duration // How long jobs are kept, 0 to keep them until deleted
+	SweepInterval time.Duration // How often expired data and orphans are swept
+
+	Workers int // Workers per process, 0 for none
+
+	// Used by the server only
+	OptionsFile        string // File holding the default comparison options, if any
+	StreamingThreshold int64  // Uploads larger than this many bytes are compared out of core, 0 for never
+}
+
+// FromEnv reads the configuration from the environment, using the defaults for unset
+// variables. It fails on the first invalid value.
+func FromEnv() (*Config, error) {
+	return load(os.Getenv)
+}
+
+func load(getenv func(string) string) (*Config, error) {
+	orDefault := func(name, def string) string {
+		if value := getenv(name); value != "" {
+			return value
+		}
+		return def
+	}
+
+	redisAddr := orDefault("REDIS_ADDR", "localhost:6379")
+	cfg := &Config{
+		Storage: storage.Config{
+			Backend:   getenv("STORAGE_BACKEND"),
+			RedisAddr: redisAddr,
+			Dir:       orDefault("STORAGE_DIR", "data"),
+
+			Format:      getenv("RESULT_FORMAT"),
+			Compression: getenv("RESULT_COMPRESSION"),
+		},
+		Queue: queue.Config{
+			Backend:   orDefault("QUEUE_BACKEND", getenv("STORAGE_BACKEND")),
+			RedisAddr: redisAddr,
+			Dir:       orDefault("QUEUE_DIR", "queue"),
+		},
+		BlobDir:     orDefault("BLOB_DIR", "blobs"),
+		SpillDir:    getenv("SPILL_DIR"),
+		OptionsFile: getenv("COMPARISON_OPTIONS_FILE"),
+	}
+
+	var err error
+	duration := func(name string, def time.Duration, zeroAllowed bool) time.Duration {
+		raw := getenv(name)
+		if raw == "" || err != nil {
+			return def
+		}
+		d, parseErr := time.ParseDuration(raw)
+		if parseErr != nil || d < 0 || d == 0 && !zeroAllowed {
+			err = fmt.Errorf("invalid %s: %q", name, raw)
+		}
+		return d
+	}
+	integer := func(name string, def int64, min int64) int64 {
+		raw := getenv(name)
+		if raw == "" || err != nil {
+			return def
+		}
+		n, parseErr := strconv.ParseInt(raw, 10, 64)
+		if parseErr != nil || n < min {
+			err = fmt.Errorf("invalid %s: %q", name, raw)
+		}
+		return n
+	}
+
+	cfg.Retention = duration("JOB_RETENTION", 24*time.Hour, true)
+	cfg.SweepInterval = duration("SWEEP_INTERVAL", 10*time.Minute, false)
+	cfg.Queue.VisibilityTimeout = duration("QUEUE_VISIBILITY_TIMEOUT", 5*time.Minute, false)
+	cfg.Queue.MaxAttempts = int(integer("QUEUE_MAX_ATTEMPTS", 3, 1))
+	cfg.Workers = int(integer("WORKERS", 1, 0))
+	cfg.StreamingThreshold = integer("STREAMING_THRESHOLD_BYTES", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.RedisAddr != "localhost:6379" || cfg.Queue.RedisAddr != "localhost:6379" {
+		t.Errorf("Redis addresses = %q, %q, want localhost:6379", cfg.Storage.RedisAddr, cfg.Queue.RedisAddr)
+	}
+	if cfg.Storage.Dir != "data" || cfg.Queue.Dir != "queue" || cfg.BlobDir != "blobs" {
+		t.Errorf("directories = %q, %q, %q", cfg.Storage.Dir, cfg.Queue.Dir, cfg.BlobDir)
+	}
+	if cfg.Retention != 24*time.Hour || cfg.SweepInterval != 10*time.Minute {
+		t.Errorf("retention, sweep interval = %v, %v", cfg.Retention, cfg.SweepInterval)
+	}
+	if cfg.Queue.VisibilityTimeout != 5*time.Minute || cfg.Queue.MaxAttempts != 3 || cfg.Workers != 1 {
+		t.Errorf("visibility, attempts, workers = %v, %d, %d", cfg.Queue.VisibilityTimeout, cfg.Queue.MaxAttempts, cfg.Workers)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := load(env(map[string]string{
+		"REDIS_ADDR":                "redis:6379",
+		"STORAGE_BACKEND":           "fs",
+		"STORAGE_DIR":               "/var/data",
+		"RESULT_FORMAT":             "json",
+		"RESULT_COMPRESSION":        "none",
+		"BLOB_DIR":                  "/var/blobs",
+		"SPILL_DIR":                 "/tmp/spill",
+		"JOB_RETENTION":             "0",
+		"QUEUE_MAX_ATTEMPTS":        "5",
+		"QUEUE_VISIBILITY_TIMEOUT":  "30s",
+		"WORKERS":                   "0",
+		"STREAMING_THRESHOLD_BYTES": "1048576",
+		"COMPARISON_OPTIONS_FILE":   "options.json",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.Backend != "fs" || cfg.Storage.Dir != "/var/data" || cfg.Storage.Format != "json" || cfg.Storage.Compression != "none" {
+		t.Errorf("storage = %+v", cfg.Storage)
+	}
+	// The queue uses the storage backend unless QUEUE_BACKEND is set
+	if cfg.Queue.Backend != "fs" || cfg.Queue.RedisAddr != "redis:6379" || cfg.Queue.MaxAttempts != 5 || cfg.Queue.VisibilityTimeout != 30*time.Second {
+		t.Errorf("queue = %+v", cfg.Queue)
+	}
+	if cfg.BlobDir != "/var/blobs" || cfg.SpillDir != "/tmp/spill" || cfg.OptionsFile != "options.json" {
+		t.Errorf("blob dir, spill dir, options file = %q, %q, %q", cfg.BlobDir, cfg.SpillDir, cfg.OptionsFile)
+	}
+	if cfg.Retention != 0 || cfg.Workers != 0 || cfg.StreamingThreshold != 1<<20 {
+		t.Errorf("retention, workers, streaming threshold = %v, %d, %d", cfg.Retention, cfg.Workers, cfg.StreamingThreshold)
+	}
+
+	cfg, err = load(env(map[string]string{"STORAGE_BACKEND": "fs", "QUEUE_BACKEND": "memory"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Queue.Backend != "memory" {
+		t.Errorf("queue backend = %q, want memory", cfg.Queue.Backend)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"JOB_RETENTION", "-1h"},
+		{"JOB_RETENTION", "a day"},
+		{"SWEEP_INTERVAL", "0"},
+		{"SWEEP_INTERVAL", "-1m"},
+		{"QUEUE_VISIBILITY_TIMEOUT", "-5m"},
+		{"QUEUE_MAX_ATTEMPTS", "0"},
+		{"QUEUE_MAX_ATTEMPTS", "three"},
+		{"WORKERS", "-1"},
+		{"STREAMING_THRESHOLD_BYTES", "1MB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			if _, err := load(env(map[string]string{tt.name: tt.value})); err == nil {
+				t.Errorf("%s=%q accepted", tt.name, tt.value)
+			}
+		})
+	}
+}
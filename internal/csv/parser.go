@@ -76,3 +76,34 @@ func ParseProducts(file io.Reader) ([]models.Product, error) {
 
 	return products, nil
 }
+
+// StreamProducts reads a CSV file row by row and calls fn for each parsed product,
+// without holding the file in memory. It stops at the first parse error or error from fn.
+func StreamProducts(file io.Reader, fn func(models.Product) error) error {
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	// Assuming the CSV has a header, which we'll skip
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	line := 1
+	for {
+		line++
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read csv record at line %d: %w", line, err)
+		}
+
+		product, err := parseRecord(record, line)
+		if err != nil {
+			return err
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+}
@@ -3,6 +3,7 @@ package csv
 import (
 	"fmt"
 	"hackathon-go/internal/models"
+	"hackathon-go/internal/money"
 	"strconv"
 	"sync"
 )
@@ -45,7 +46,7 @@ func parseRecord(record []string, line int) (models.Product, error) {
 		return models.Product{}, fmt.Errorf("invalid id at line %d: %w", line, err)
 	}
 
-	preco, err := strconv.ParseFloat(record[colPreco], 64)
+	preco, err := money.Parse(record[colPreco], money.DefaultRounding)
 	if err != nil {
 		return models.Product{}, fmt.Errorf("invalid preco at line %d: %w", line, err)
 	}
@@ -62,6 +63,22 @@ func parseRecord(record []string, line int) (models.Product, error) {
 		Preco:      preco,
 		Estoque:    estoque,
 		Fornecedor: record[colFornecedor],
+		CSVLine:    line,
 	}
 	return product, nil
-}
\ No newline at end of file
+}
+
+// Columns lists the CSV columns in file order.
+var Columns = []string{"id", "nome", "categoria", "preco", "estoque", "fornecedor"}
+
+// FormatRecord converts a product back into a CSV record, the inverse of parseRecord.
+func FormatRecord(p models.Product) []string {
+	record := make([]string, totalCols)
+	record[colID] = strconv.Itoa(p.ID)
+	record[colNome] = p.Nome
+	record[colCategoria] = p.Categoria
+	record[colPreco] = p.Preco.String()
+	record[colEstoque] = strconv.Itoa(p.Estoque)
+	record[colFornecedor] = p.Fornecedor
+	return record
+}
@@ -1,13 +1,16 @@
 package models
 
+import "hackathon-go/internal/money"
+
 // Product defines the structure for product data from the API.
 type Product struct {
-	ID         int     `json:"id"`
-	Nome       string  `json:"nome"`
-	Categoria  string  `json:"categoria"`
-	Preco      float64 `json:"preco"`
-	Estoque    int     `json:"estoque"`
-	Fornecedor string  `json:"fornecedor"`
+	ID         int          `json:"id"`
+	Nome       string       `json:"nome"`
+	Categoria  string       `json:"categoria"`
+	Preco      money.Amount `json:"preco"` // Fixed-point, exact to the cent
+	Estoque    int          `json:"estoque"`
+	Fornecedor string       `json:"fornecedor"`
+	CSVLine    int          `json:"-"` // Line in the uploaded CSV, zero for API products
 }
 
 // Pagination defines the structure for pagination info from the API.
@@ -27,36 +30,266 @@ type APIResponse struct {
 }
 
 // Summary holds a summary of the comparison between API and CSV data.
+// Matched counts exact matches, NearMatched products whose only differences are within
+// their similarity thresholds, and Mismatched products with at least one hard mismatch.
 type Summary struct {
-	TotalAPIItems int                    `json:"total_api_items"`
-	TotalCSVItems int                    `json:"total_csv_items"`
-	Matched       int                    `json:"matched"`
-	Mismatched    int                    `json:"mismatched"`
-	MissingInCSV  int                    `json:"missing_in_csv"`
-	MissingInAPI  int                    `json:"missing_in_api"`
-	Categories    map[string]int         `json:"categories"`
+	TotalAPIItems  int                       `json:"total_api_items"`
+	TotalCSVItems  int                       `json:"total_csv_items"`
+	Matched        int                       `json:"matched"`
+	NearMatched    int                       `json:"near_matched"`
+	Mismatched     int                       `json:"mismatched"`
+	MissingInCSV   int                       `json:"missing_in_csv"`
+	MissingInAPI   int                       `json:"missing_in_api"`
+	IDChanged      int                       `json:"id_changed"`      // Products paired on the secondary key under a new ID
+	Suppressed     int                       `json:"suppressed"`      // Discrepancies accepted by ignore rules, not counted above
+	RuleViolations int                       `json:"rule_violations"` // Records failing a business rule
+	ByRule         map[string]int            `json:"by_rule"`         // Violations per rule name
+	Consistency    int                       `json:"consistency"`     // Intra-source consistency findings
+	ByCheck        map[string]int            `json:"by_check"`        // Consistency findings per check
+	Categories     map[string]int            `json:"categories"`      // Hard mismatches per field
+	NearCategories map[string]int            `json:"near_categories"` // Near matches per field
+	Severities     map[string]int            `json:"severities"`      // Discrepancies per severity level
+	Financial      *FinancialSummary         `json:"financial,omitempty"`
+	ByCategoria    map[string]GroupBreakdown `json:"by_categoria"`  // Per product categoria
+	ByFornecedor   map[string]GroupBreakdown `json:"by_fornecedor"` // Per fornecedor
+}
+
+// GroupBreakdown counts the comparison outcome of the products of one categoria or fornecedor.
+// Products are grouped by their API record when they have one, by their CSV record otherwise.
+type GroupBreakdown struct {
+	Total          int            `json:"total"`
+	Matched        int            `json:"matched"`
+	NearMatched    int            `json:"near_matched"`
+	Mismatched     int            `json:"mismatched"`
+	IDChanged      int            `json:"id_changed"`
+	MissingInCSV   int            `json:"missing_in_csv"`
+	MissingInAPI   int            `json:"missing_in_api"`
+	Suppressed     int            `json:"suppressed"`
+	RuleViolations int            `json:"rule_violations"`  // Business-rule violations, not counted in Total
+	Consistency    int            `json:"consistency"`      // Consistency findings, not counted in Total
+	Fields         map[string]int `json:"fields,omitempty"` // Hard mismatches per field
+}
+
+// HistogramBucket counts values in [Min, Max); Max is nil for the last, open-ended bucket.
+type HistogramBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// FinancialStats aggregates the monetary impact of the divergences of a group of products.
+// Deltas are API minus CSV; inventory values are the sum of preco × estoque on each side.
+type FinancialStats struct {
+	PriceDeltaCount     int               `json:"price_delta_count"`
+	TotalPriceDelta     money.Amount      `json:"total_price_delta"`
+	TotalAbsPriceDelta  money.Amount      `json:"total_abs_price_delta"`
+	MeanPriceDelta      money.Amount      `json:"mean_price_delta"`
+	MeanAbsPriceDelta   money.Amount      `json:"mean_abs_price_delta"`
+	StockDeltaCount     int               `json:"stock_delta_count"`
+	TotalStockDelta     int               `json:"total_stock_delta"`
+	InventoryValueAPI   money.Amount      `json:"inventory_value_api"`
+	InventoryValueCSV   money.Amount      `json:"inventory_value_csv"`
+	InventoryValueDiff  money.Amount      `json:"inventory_value_diff"`
+	InventoryOverflow   int               `json:"inventory_overflow,omitempty"` // Products whose preco × estoque is out of range, left out of the inventory values
+	PriceDeltaHistogram []HistogramBucket `json:"price_delta_histogram"`        // Buckets of the price delta in percent
+	StockDeltaHistogram []HistogramBucket `json:"stock_delta_histogram"`        // Buckets of the absolute stock delta in units
+}
+
+// FinancialSummary holds the overall financial aggregates and their breakdown per
+// product categoria and per fornecedor.
+type FinancialSummary struct {
+	FinancialStats
+	ByCategoria  map[string]FinancialStats `json:"by_categoria"`
+	ByFornecedor map[string]FinancialStats `json:"by_fornecedor"`
 }
 
 // MismatchDetail stores the differing values for a field.
+// Numeric fields also carry the absolute and percentage difference between both sides.
 type MismatchDetail struct {
-	APIValue interface{} `json:"api"`
-	CSVValue interface{} `json:"csv"`
+	APIValue     interface{} `json:"api"`
+	CSVValue     interface{} `json:"csv"`
+	AbsDelta     *float64    `json:"abs_delta,omitempty"`     // |api - csv| for numeric fields
+	PctDelta     *float64    `json:"pct_delta,omitempty"`     // AbsDelta as a percentage of the API value
+	Similarity   *float64    `json:"similarity,omitempty"`    // Fuzzy score between 0 and 1 for text fields
+	Near         bool        `json:"near_match,omitempty"`    // Similarity reached the configured threshold
+	SuppressedBy string      `json:"suppressed_by,omitempty"` // ID of the ignore rule accepting this difference
 }
 
 // ErrorDetail describes a single discrepancy found during comparison.
+// For "id_changed" discrepancies APIID and CSVID hold the product's ID on each side.
 type ErrorDetail struct {
-	Type    string                    `json:"type"`
-	CSVLine int                       `json:"csv_line,omitempty"`
-	APIID   int                       `json:"api_id"`
-	Nome    string                    `json:"nome,omitempty"`
-	Fields  map[string]MismatchDetail `json:"fields,omitempty"`
+	Type          string                    `json:"type"`
+	CSVLine       int                       `json:"csv_line,omitempty"`
+	APIID         int                       `json:"api_id"`
+	CSVID         int                       `json:"csv_id,omitempty"`
+	Nome          string                    `json:"nome,omitempty"`
+	Categoria     string                    `json:"categoria,omitempty"`  // Categoria used to group the discrepancy
+	Fornecedor    string                    `json:"fornecedor,omitempty"` // Fornecedor used to group the discrepancy
+	Fields        map[string]MismatchDetail `json:"fields,omitempty"`
+	MatchScore    *float64                  `json:"match_score,omitempty"`    // Secondary key score for "id_changed"
+	Severity      string                    `json:"severity,omitempty"`       // Severity level, e.g. "critical"
+	SeverityScore float64                   `json:"severity_score,omitempty"` // Severity score between 0 and 100
+	Suppressed    bool                      `json:"suppressed,omitempty"`     // Accepted by ignore rules, kept for review
+	SuppressedBy  []string                  `json:"suppressed_by,omitempty"`  // IDs of the ignore rules that matched
+	Rule          string                    `json:"rule,omitempty"`           // Violated rule, for "rule_violation"
+	Side          string                    `json:"side,omitempty"`           // Source of a rule violation or consistency finding: api or csv
+	Check         string                    `json:"check,omitempty"`          // Failed check, for "consistency"
+	IDs           []int                     `json:"ids,omitempty"`            // Products involved, for "consistency"
+	APIRecord     *Product                  `json:"api_record,omitempty"`     // Full API record, when records are embedded
+	CSVRecord     *Product                  `json:"csv_record,omitempty"`     // Full CSV record, when records are embedded
+}
+
+// IgnoreRule accepts known discrepancies. Every criterion that is set must match: the
+// product ID (on either side), the discrepancy type, and for Field, a regular expression on
+// the API or CSV value and a range of the absolute numeric delta. Timestamps are Unix seconds.
+type IgnoreRule struct {
+	ID           string   `json:"id"`
+	ProductID    *int     `json:"product_id,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Field        string   `json:"field,omitempty"`
+	ValuePattern string   `json:"value_pattern,omitempty"`
+	MinDelta     *float64 `json:"min_delta,omitempty"`
+	MaxDelta     *float64 `json:"max_delta,omitempty"`
+	ExpiresAt    *int64   `json:"expires_at,omitempty"` // No expiry when nil
+	Reason       string   `json:"reason"`
+	CreatedAt    int64    `json:"created_at"`
 }
 
 // ComparisonResult represents the full report of a comparison task.
 type ComparisonResult struct {
-	Summary     Summary       `json:"summary"`
-	Errors      []ErrorDetail `json:"errors"`
-	StartedAt   int64         `json:"started_at"`   // Unix timestamp when processing started
-	CompletedAt int64         `json:"completed_at"` // Unix timestamp when processing completed
-	DurationMs  int64         `json:"duration_ms"`  // Total processing time in milliseconds
+	Summary     Summary         `json:"summary"`
+	Errors      []ErrorDetail   `json:"errors"`
+	StartedAt   int64           `json:"started_at"`          // Unix timestamp when processing started
+	CompletedAt int64           `json:"completed_at"`        // Unix timestamp when processing completed
+	DurationMs  int64           `json:"duration_ms"`         // Total processing time in milliseconds
+	Streamed    bool            `json:"streamed,omitempty"`  // Errors were written incrementally and are stored separately
+	ThreeWay    *ThreeWayResult `json:"three_way,omitempty"` // Classification against a baseline CSV, for three-way jobs
+}
+
+// ThreeWayField holds the values of a changed field in the baseline CSV, the updated CSV and the API.
+// Values are nil on a side where the product does not exist.
+type ThreeWayField struct {
+	Base     interface{} `json:"base"`
+	Local    interface{} `json:"local"`
+	Upstream interface{} `json:"upstream"`
+	Changed  string      `json:"changed"`            // local, upstream or both
+	Conflict bool        `json:"conflict,omitempty"` // Both sides changed the field to different values
+}
+
+// ThreeWayProduct classifies a product of a three-way comparison.
+type ThreeWayProduct struct {
+	ID         int                      `json:"id"`
+	CSVLine    int                      `json:"csv_line,omitempty"` // Line in the updated CSV
+	Nome       string                   `json:"nome"`
+	Categoria  string                   `json:"categoria"`
+	Fornecedor string                   `json:"fornecedor"`
+	Status     string                   `json:"status"`             // unchanged, changed_locally, changed_upstream or changed_both
+	Local      string                   `json:"local,omitempty"`    // added, removed or modified in the updated CSV
+	Upstream   string                   `json:"upstream,omitempty"` // added, removed or modified in the API
+	Conflict   bool                     `json:"conflict,omitempty"` // Both sides made incompatible changes
+	Fields     map[string]ThreeWayField `json:"fields,omitempty"`
+}
+
+// ThreeWaySummary counts the products of a three-way comparison per status.
+type ThreeWaySummary struct {
+	TotalBaseline   int            `json:"total_baseline"`
+	TotalUpdated    int            `json:"total_updated"`
+	TotalAPI        int            `json:"total_api"`
+	Unchanged       int            `json:"unchanged"`
+	ChangedLocally  int            `json:"changed_locally"`
+	ChangedUpstream int            `json:"changed_upstream"`
+	ChangedBoth     int            `json:"changed_both"`
+	Conflicts       int            `json:"conflicts"`
+	LocalFields     map[string]int `json:"local_fields"`    // Field name -> products changed in the updated CSV
+	UpstreamFields  map[string]int `json:"upstream_fields"` // Field name -> products changed in the API
+	ConflictFields  map[string]int `json:"conflict_fields"` // Field name -> products with a conflict on the field
+}
+
+// ThreeWayResult is the outcome of comparing a baseline CSV, an updated CSV and the API.
+// Products holds every product that is not unchanged, ordered by ID.
+type ThreeWayResult struct {
+	Summary  ThreeWaySummary   `json:"summary"`
+	Products []ThreeWayProduct `json:"products"`
+}
+
+// JobDiffEntry is a discrepancy compared between two jobs. A discrepancy is identified by
+// product ID, type and field, or rule and side for rule violations; discrepancies without
+// fields have an empty field.
+type JobDiffEntry struct {
+	Status     string          `json:"status"` // resolved, new, persisting or changed
+	APIID      int             `json:"api_id"`
+	Type       string          `json:"type"`
+	Field      string          `json:"field,omitempty"`
+	Rule       string          `json:"rule,omitempty"`  // Violated rule, for "rule_violation"
+	Check      string          `json:"check,omitempty"` // Failed check, for "consistency"
+	Side       string          `json:"side,omitempty"`  // Side of the violating record, for "rule_violation"
+	Nome       string          `json:"nome,omitempty"`
+	Categoria  string          `json:"categoria,omitempty"`
+	Fornecedor string          `json:"fornecedor,omitempty"`
+	Before     *MismatchDetail `json:"before,omitempty"` // Field values in the first job
+	After      *MismatchDetail `json:"after,omitempty"`  // Field values in the second job
+}
+
+// JobDiffSummary counts the entries of a job diff per status.
+type JobDiffSummary struct {
+	Resolved   int `json:"resolved"`   // Only in the first job
+	New        int `json:"new"`        // Only in the second job
+	Persisting int `json:"persisting"` // In both jobs with the same values
+	Changed    int `json:"changed"`    // In both jobs with different values
+}
+
+// JobDiff compares the discrepancies of two jobs.
+type JobDiff struct {
+	JobID   string         `json:"job_id"`
+	OtherID string         `json:"other_id"`
+	Summary JobDiffSummary `json:"summary"`
+	Entries []JobDiffEntry `json:"entries"`
+}
+
+// Job states recorded in the job index.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobMeta describes a job in the job index.
+type JobMeta struct {
+	ID           string     `json:"job_id"`
+	Filename     string     `json:"filename"`                // Original name of the uploaded file
+	Size         int64      `json:"size"`                    // Upload size in bytes
+	SourceHash   string     `json:"source_hash,omitempty"`   // SHA-256 of the upload, its key in the blob store
+	BaselineHash string     `json:"baseline_hash,omitempty"` // SHA-256 of the baseline, for three-way jobs
+	Mode         string     `json:"mode,omitempty"`          // streaming or three_way, empty for a regular comparison
+	Uploader     string     `json:"uploader,omitempty"`      // Given with the upload, the client address otherwise
+	Status       string     `json:"status"`                  // queued, running, completed or failed
+	Error        string     `json:"error,omitempty"`         // Step that failed, e.g. error_parsing_csv
+	CSVRows      int        `json:"csv_rows"`
+	APIRows      int        `json:"api_rows"`
+	CreatedAt    int64      `json:"created_at"`
+	StartedAt    int64      `json:"started_at,omitempty"`   // When a worker last started the comparison
+	HeartbeatAt  int64      `json:"heartbeat_at,omitempty"` // When the worker running the job last reported it alive
+	Attempts     int        `json:"attempts,omitempty"`     // Times a worker started the comparison
+	FinishedAt   int64      `json:"finished_at,omitempty"`
+	Counts       *JobCounts `json:"counts,omitempty"`      // Summary counts, once completed
+	Fingerprint  string     `json:"fingerprint,omitempty"` // Hash of the inputs, options and API snapshot of the comparison
+	CachedFrom   string     `json:"cached_from,omitempty"` // Job whose identical comparison this job reuses
+	LinkedBy     []string   `json:"linked_by,omitempty"`   // Jobs reusing the result of this job
+	Pinned       bool       `json:"pinned,omitempty"`      // Kept until deleted
+	ExpiresAt    int64      `json:"expires_at,omitempty"`  // When the job expires, unless pinned or kept until deleted
+}
+
+// JobCounts holds the main summary counts of a completed job.
+type JobCounts struct {
+	Matched        int `json:"matched"`
+	NearMatched    int `json:"near_matched"`
+	Mismatched     int `json:"mismatched"`
+	MissingInCSV   int `json:"missing_in_csv"`
+	MissingInAPI   int `json:"missing_in_api"`
+	IDChanged      int `json:"id_changed"`
+	Suppressed     int `json:"suppressed"`
+	RuleViolations int `json:"rule_violations"`
+	Consistency    int `json:"consistency"`
+	Discrepancies  int `json:"discrepancies"` // Unsuppressed comparison discrepancies
 }
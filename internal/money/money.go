@@ -0,0 +1,291 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places kept by an Amount.
+const Scale = 2
+
+// scaleFactor is 10^Scale, the number of minor units in one major unit.
+const scaleFactor = 100
+
+// RoundingMode defines how values with more than Scale decimals are rounded.
+type RoundingMode int
+
+const (
+	HalfUp   RoundingMode = iota // Round half away from zero (19.905 -> 19.91)
+	HalfEven                     // Round half to the nearest even digit (19.905 -> 19.90)
+	Down                         // Truncate towards zero (19.909 -> 19.90)
+	Up                           // Round away from zero (19.901 -> 19.91)
+)
+
+// DefaultRounding is the rounding mode used when decoding amounts from JSON.
+var DefaultRounding = HalfUp
+
+var roundingNames = map[RoundingMode]string{
+	HalfUp:   "half_up",
+	HalfEven: "half_even",
+	Down:     "down",
+	Up:       "up",
+}
+
+// String returns the configuration name of the rounding mode.
+func (m RoundingMode) String() string {
+	if name, ok := roundingNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("RoundingMode(%d)", int(m))
+}
+
+// MarshalText encodes the rounding mode by name.
+func (m RoundingMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a rounding mode by name.
+func (m *RoundingMode) UnmarshalText(text []byte) error {
+	for mode, name := range roundingNames {
+		if name == string(text) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rounding mode %q", string(text))
+}
+
+// Amount is a monetary value stored as an integer number of minor units (cents).
+// Its zero value is 0.00.
+type Amount int64
+
+// FromCents returns the amount for the given number of minor units.
+func FromCents(cents int64) Amount {
+	return Amount(cents)
+}
+
+// Parse converts a decimal string such as "19.9", "-3", "1e2" or "19.905" to an Amount.
+// Decimal notation with an optional exponent is accepted, as in JSON numbers: no
+// fractions, hexadecimal or special values.
+// Digits beyond Scale are rounded exactly, without going through binary floating point.
+func Parse(s string, mode RoundingMode) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if !isDecimal(s) {
+		return 0, fmt.Errorf("invalid amount %s", quote(s))
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %s", quote(s))
+	}
+	cents, err := fromRat(r, mode)
+	if err != nil {
+		return 0, fmt.Errorf("amount %s out of range", quote(s))
+	}
+	return cents, nil
+}
+
+// maxExponent bounds the exponent of parsed amounts. Anything larger is out of range or
+// rounds to zero, and would only make big.Rat allocate huge powers of ten.
+const maxExponent = 400
+
+// isDecimal reports whether s is a decimal number: an optional sign, digits with an
+// optional fraction, and an optional exponent of at most maxExponent.
+func isDecimal(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(s), "e")
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return false
+	}
+	if !hasExponent {
+		return true
+	}
+	if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+		exponent = exponent[1:]
+	}
+	if exponent == "" || !isDigits(exponent) {
+		return false
+	}
+	n, err := strconv.Atoi(exponent)
+	return err == nil && n <= maxExponent
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// quote quotes an input for an error message, truncated so huge inputs don't produce
+// huge errors.
+func quote(s string) string {
+	const max = 32
+	if len(s) > max {
+		return strconv.Quote(s[:max]) + "..."
+	}
+	return strconv.Quote(s)
+}
+
+// FromFloat converts a float64 to an Amount using its shortest decimal representation,
+// so 19.9 becomes 19.90 rather than 19.899999999999998578...
+func FromFloat(f float64, mode RoundingMode) (Amount, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid amount %v", f)
+	}
+	return Parse(strconv.FormatFloat(f, 'g', -1, 64), mode)
+}
+
+func fromRat(r *big.Rat, mode RoundingMode) (Amount, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt64(scaleFactor))
+	cents := roundRat(scaled, mode)
+	if !cents.IsInt64() {
+		return 0, fmt.Errorf("amount out of range")
+	}
+	return Amount(cents.Int64()), nil
+}
+
+// roundRat rounds a rational number to an integer using the given mode.
+func roundRat(r *big.Rat, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	// away moves the truncated quotient one unit away from zero
+	away := func() *big.Int {
+		return quo.Add(quo, big.NewInt(int64(r.Sign())))
+	}
+
+	// Compare twice the remainder with the denominator to locate the halfway point
+	twiceRem := new(big.Int).Abs(rem)
+	twiceRem.Lsh(twiceRem, 1)
+	half := twiceRem.Cmp(r.Denom())
+
+	switch mode {
+	case Down:
+		return quo
+	case Up:
+		return away()
+	case HalfEven:
+		if half > 0 || (half == 0 && quo.Bit(0) == 1) {
+			return away()
+		}
+		return quo
+	default:
+		if half >= 0 {
+			return away()
+		}
+		return quo
+	}
+}
+
+// Cents returns the amount as an integer number of minor units.
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Float64 returns the nearest float64 to the amount, for ratios and statistics.
+func (a Amount) Float64() float64 {
+	return float64(a) / scaleFactor
+}
+
+// Abs returns the absolute value of the amount.
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Round rounds the amount to the given number of decimals (0 <= decimals <= Scale).
+func (a Amount) Round(decimals int, mode RoundingMode) Amount {
+	if decimals >= Scale {
+		return a
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	unit := int64(math.Pow10(Scale - decimals))
+	r := big.NewRat(int64(a), unit)
+	return Amount(roundRat(r, mode).Int64() * unit)
+}
+
+// ErrOutOfRange is returned by arithmetic whose result doesn't fit an Amount.
+var ErrOutOfRange = errors.New("amount out of range")
+
+// Mul multiplies the amount by an integer quantity, e.g. preco by estoque. It returns
+// ErrOutOfRange instead of wrapping around when the product doesn't fit an Amount.
+func (a Amount) Mul(quantity int) (Amount, error) {
+	q := int64(quantity)
+	product := int64(a) * q
+	if a != 0 && (product/int64(a) != q || a == -1 && q == math.MinInt64) {
+		return 0, ErrOutOfRange
+	}
+	return Amount(product), nil
+}
+
+// Add returns the sum of two amounts, or ErrOutOfRange when it doesn't fit an Amount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if b > 0 && sum < a || b < 0 && sum > a {
+		return 0, ErrOutOfRange
+	}
+	return sum, nil
+}
+
+// Div divides the amount by an integer count, e.g. to compute a mean, rounding with mode.
+// Dividing by zero returns zero.
+func (a Amount) Div(n int64, mode RoundingMode) Amount {
+	if n == 0 {
+		return 0
+	}
+	return Amount(roundRat(big.NewRat(int64(a), n), mode).Int64())
+}
+
+// String formats the amount with exactly Scale decimals, e.g. "19.90".
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, cents/scaleFactor, Scale, cents%scaleFactor)
+}
+
+// MarshalJSON encodes the amount as a JSON number with exactly Scale decimals.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or numeric string without converting through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	parsed, err := Parse(string(data), DefaultRounding)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,224 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		mode RoundingMode
+		want Amount
+	}{
+		{"19.9", HalfUp, 1990},
+		{"-3", HalfUp, -300},
+		{"+3", HalfUp, 300},
+		{" 7.5 ", HalfUp, 750},
+		{".5", HalfUp, 50},
+		{"5.", HalfUp, 500},
+		{"1e2", HalfUp, 10000},
+		{"1.5E-1", HalfUp, 15},
+		{"1e-400", HalfUp, 0},
+		{"19.905", HalfUp, 1991},
+		{"19.905", HalfEven, 1990},
+		{"19.915", HalfEven, 1992},
+		{"19.909", Down, 1990},
+		{"19.901", Up, 1991},
+		{"-19.905", HalfUp, -1991},
+		{"-19.901", Down, -1990},
+		{"-19.901", Up, -1991},
+		{"0.1", HalfUp, 10}, // Not 0.1000000000000000055...
+	}
+	for _, tt := range tests {
+		t.Run(tt.in+"/"+tt.mode.String(), func(t *testing.T) {
+			got, err := Parse(tt.in, tt.mode)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []string{
+		"",
+		"abc",
+		"1/2",
+		"0x1p-2",
+		"0x10",
+		"0b101",
+		"0o17",
+		"1_000",
+		"Inf",
+		"NaN",
+		".",
+		"-",
+		"1e",
+		"1e+",
+		"1e2.5",
+		"1.2.3",
+		"1e401",
+		"1e99999999999999999999",
+		"99999999999999999999",
+	}
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			if got, err := Parse(in, HalfUp); err == nil {
+				t.Errorf("Parse(%q) = %s, want an error", in, got)
+			}
+		})
+	}
+}
+
+func TestParseErrorTruncatesInput(t *testing.T) {
+	huge := "9" + strings.Repeat("0", 100000)
+	_, err := Parse(huge, HalfUp)
+	if err == nil {
+		t.Fatal("Parse of a huge amount succeeded")
+	}
+	if len(err.Error()) > 100 {
+		t.Errorf("error has %d bytes, want a truncated input", len(err.Error()))
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		decimals int
+		mode     RoundingMode
+		want     Amount
+	}{
+		{1995, 1, HalfUp, 2000},
+		{1995, 1, HalfEven, 2000},
+		{1985, 1, HalfEven, 1980},
+		{1999, 0, Down, 1900},
+		{1901, 0, Up, 2000},
+		{-1950, 0, HalfUp, -2000},
+		{1234, 2, HalfUp, 1234},
+		{1234, 5, HalfUp, 1234},
+		{1250, -1, HalfEven, 1200},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Round(tt.decimals, tt.mode); got != tt.want {
+			t.Errorf("%s.Round(%d, %s) = %s, want %s", tt.amount, tt.decimals, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		n      int64
+		mode   RoundingMode
+		want   Amount
+	}{
+		{1000, 3, HalfUp, 333},
+		{1000, 6, HalfUp, 167},
+		{5, 2, HalfEven, 2},
+		{7, 2, HalfEven, 4},
+		{1000, 0, HalfUp, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Div(tt.n, tt.mode); got != tt.want {
+			t.Errorf("%s.Div(%d, %s) = %s, want %s", tt.amount, tt.n, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		quantity int
+		want     Amount
+		err      error
+	}{
+		{1990, 3, 5970, nil},
+		{-250, 4, -1000, nil},
+		{0, math.MaxInt64, 0, nil},
+		{math.MaxInt64 / 2, 2, math.MaxInt64 - 1, nil},
+		{math.MaxInt64/2 + 1, 2, 0, ErrOutOfRange},
+		{1 << 40, 1 << 30, 0, ErrOutOfRange},
+		{-1, math.MinInt64, 0, ErrOutOfRange},
+		{math.MinInt64, -1, 0, ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		got, err := tt.amount.Mul(tt.quantity)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%d.Mul(%d) = %d, %v, want %d, %v", int64(tt.amount), tt.quantity, int64(got), err, int64(tt.want), tt.err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b Amount
+		want Amount
+		err  error
+	}{
+		{1990, 10, 2000, nil},
+		{-500, 200, -300, nil},
+		{math.MaxInt64, -1, math.MaxInt64 - 1, nil},
+		{math.MaxInt64, 1, 0, ErrOutOfRange},
+		{math.MinInt64, -1, 0, ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%d.Add(%d) = %d, %v, want %d, %v", int64(tt.a), int64(tt.b), int64(got), err, int64(tt.want), tt.err)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Amount
+	}{
+		{19.9, 1990},
+		{0.1 + 0.2, 30},
+		{1e21, 0}, // Out of range
+	}
+	for _, tt := range tests {
+		got, err := FromFloat(tt.in, HalfUp)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("FromFloat(%v) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("FromFloat(%v) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{`19.9`, 1990},
+		{`"19.905"`, 1991},
+		{`null`, 0},
+	}
+	for _, tt := range tests {
+		var got Amount
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(Amount(-105))
+	if err != nil || string(data) != "-1.05" {
+		t.Errorf("Marshal(-1.05) = %s, %v", data, err)
+	}
+	if err := json.Unmarshal([]byte(`"0x1p-2"`), new(Amount)); err == nil {
+		t.Error("Unmarshal of a hexadecimal float succeeded")
+	}
+}
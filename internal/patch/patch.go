@@ -0,0 +1,243 @@
+package patch
+
+import (
+	encodingcsv "encoding/csv"
+	"fmt"
+	"io"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/csv"
+	"hackathon-go/internal/models"
+)
+
+// Change operations.
+const (
+	OpReplace = "replace" // A field of an uploaded row was set to the API value
+	OpAdd     = "add"     // A row built from the API product was appended
+	OpRemove  = "remove"  // An uploaded row was dropped
+)
+
+// Selection chooses which discrepancies are corrected with API values.
+// A field difference is corrected when its field is in Fields or its discrepancy type is in Types.
+// Selecting missing_in_csv appends the missing rows, selecting missing_in_api drops the extra rows,
+// and selecting id_changed also restores the API ID.
+type Selection struct {
+	Fields            []string `json:"fields,omitempty"`
+	Types             []string `json:"types,omitempty"`
+	IncludeSuppressed bool     `json:"include_suppressed,omitempty"` // Also correct discrepancies suppressed by ignore rules
+}
+
+// Validate checks that every selected field and type exists.
+func (s Selection) Validate() error {
+	if len(s.Fields) == 0 && len(s.Types) == 0 {
+		return fmt.Errorf("select at least one field or discrepancy type")
+	}
+	for _, field := range s.Fields {
+		if !contains(comparison.FieldNames, field) {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	for _, t := range s.Types {
+		if !contains(comparison.ErrorTypes, t) {
+			return fmt.Errorf("unknown discrepancy type %q", t)
+		}
+		if t == "rule_violation" || t == "consistency" {
+			return fmt.Errorf("%s discrepancies have no API value to apply", t)
+		}
+	}
+	return nil
+}
+
+// Change describes one modification made to the uploaded CSV.
+type Change struct {
+	Op     string   `json:"op"`              // replace, add or remove
+	Line   int      `json:"line,omitempty"`  // Line in the uploaded CSV; appended rows have none
+	ID     int      `json:"id"`              // Product ID of the row
+	Field  string   `json:"field,omitempty"` // Changed column, for replace
+	From   string   `json:"from,omitempty"`  // Previous value, for replace
+	To     string   `json:"to,omitempty"`    // New value, for replace
+	Row    []string `json:"row,omitempty"`   // Whole row, for add and remove
+	Reason string   `json:"reason"`          // Discrepancy type behind the change
+}
+
+// Patch lists every change made to produce a corrected CSV, in file order.
+type Patch struct {
+	Selection Selection `json:"selection"`
+	Replaced  int       `json:"replaced"`
+	Added     int       `json:"added"`
+	Removed   int       `json:"removed"`
+	Changes   []Change  `json:"changes"`
+}
+
+// Apply copies the uploaded CSV from source to w, applying the API values selected by sel
+// to the rows with discrepancies, and returns the patch describing the changes.
+// Rows without changes are written exactly as parsed. apiProducts is the API snapshot the
+// job was compared against; it provides the values of corrected fields and appended rows.
+func Apply(source io.Reader, w io.Writer, errors []models.ErrorDetail, apiProducts []models.Product, sel Selection) (*Patch, error) {
+	apiByID := make(map[int]models.Product, len(apiProducts))
+	for _, p := range apiProducts {
+		apiByID[p.ID] = p
+	}
+
+	// Discrepancies tied to an uploaded row are looked up by line
+	byLine := make(map[int]models.ErrorDetail)
+	var missingInCSV []models.ErrorDetail
+	for _, e := range errors {
+		if e.Suppressed && !sel.IncludeSuppressed {
+			continue
+		}
+		switch {
+		case e.Type == "missing_in_csv":
+			missingInCSV = append(missingInCSV, e)
+		case e.Type != "rule_violation" && e.Type != "consistency" && e.CSVLine > 0:
+			byLine[e.CSVLine] = e
+		}
+	}
+
+	reader := encodingcsv.NewReader(source)
+	reader.FieldsPerRecord = -1
+	writer := encodingcsv.NewWriter(w)
+	patch := &Patch{Selection: sel, Changes: []Change{}}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	line := 1
+	for {
+		line++
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv record at line %d: %w", line, err)
+		}
+
+		if e, ok := byLine[line]; ok {
+			keep, changes := correctRow(record, line, e, apiByID, sel)
+			patch.add(changes)
+			if !keep {
+				continue
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	if sel.hasType("missing_in_csv") {
+		for _, e := range missingInCSV {
+			apiProduct, ok := apiByID[e.APIID]
+			if !ok {
+				continue
+			}
+			row := padRecord(csv.FormatRecord(apiProduct), len(header))
+			if err := writer.Write(row); err != nil {
+				return nil, err
+			}
+			patch.add([]Change{{Op: OpAdd, ID: apiProduct.ID, Row: row, Reason: e.Type}})
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// correctRow applies the selected corrections of a discrepancy to its row in place.
+// It reports whether the row is kept and the changes made.
+func correctRow(record []string, line int, e models.ErrorDetail, apiByID map[int]models.Product, sel Selection) (bool, []Change) {
+	rowID := e.APIID
+	if e.CSVID != 0 {
+		rowID = e.CSVID
+	}
+
+	if e.Type == "missing_in_api" {
+		if !sel.hasType(e.Type) {
+			return true, nil
+		}
+		return false, []Change{{Op: OpRemove, Line: line, ID: rowID, Row: append([]string(nil), record...), Reason: e.Type}}
+	}
+
+	apiProduct, ok := apiByID[e.APIID]
+	if !ok {
+		return true, nil
+	}
+	apiRecord := csv.FormatRecord(apiProduct)
+
+	var changes []Change
+	replace := func(field string) {
+		col := columnIndex(field)
+		if col >= len(record) || record[col] == apiRecord[col] {
+			return
+		}
+		changes = append(changes, Change{Op: OpReplace, Line: line, ID: rowID, Field: field,
+			From: record[col], To: apiRecord[col], Reason: e.Type})
+		record[col] = apiRecord[col]
+	}
+
+	if e.Type == "id_changed" && sel.hasType(e.Type) {
+		replace("id")
+	}
+	for _, field := range comparison.FieldNames {
+		detail, ok := e.Fields[field]
+		if !ok || (detail.SuppressedBy != "" && !sel.IncludeSuppressed) {
+			continue
+		}
+		if contains(sel.Fields, field) || sel.hasType(e.Type) {
+			replace(field)
+		}
+	}
+	return true, changes
+}
+
+func (p *Patch) add(changes []Change) {
+	for _, change := range changes {
+		switch change.Op {
+		case OpReplace:
+			p.Replaced++
+		case OpAdd:
+			p.Added++
+		case OpRemove:
+			p.Removed++
+		}
+	}
+	p.Changes = append(p.Changes, changes...)
+}
+
+func (s Selection) hasType(t string) bool {
+	return contains(s.Types, t)
+}
+
+// columnIndex returns the position of a column in the uploaded CSV.
+func columnIndex(name string) int {
+	for i, column := range csv.Columns {
+		if column == name {
+			return i
+		}
+	}
+	return len(csv.Columns)
+}
+
+func padRecord(record []string, width int) []string {
+	for len(record) < width {
+		record = append(record, "")
+	}
+	return record
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
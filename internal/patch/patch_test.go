@@ -0,0 +1,151 @@
+package patch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/csv"
+	"hackathon-go/internal/models"
+)
+
+const source = `id,nome,categoria,preco,estoque,fornecedor
+1,Caneta,Papelaria,2.50,10,Bic
+2,Lapis,Papelaria,1.00,5,Faber
+3,Borracha,Papelaria,0.80,7,Faber
+9,Extra,Papelaria,1.00,1,Bic
+`
+
+var apiProducts = []models.Product{
+	{ID: 1, Nome: "Caneta", Categoria: "Papelaria", Preco: 300, Estoque: 10, Fornecedor: "Bic"}, // Price differs
+	{ID: 2, Nome: "Lápis", Categoria: "Papelaria", Preco: 100, Estoque: 6, Fornecedor: "Faber"}, // Nome and stock differ
+	{ID: 3, Nome: "Borracha", Categoria: "Papelaria", Preco: 80, Estoque: 7, Fornecedor: "Faber"},
+	{ID: 4, Nome: "Regua", Categoria: "Papelaria", Preco: 350, Estoque: 2, Fornecedor: "Acrimet"}, // Missing in the CSV
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		sel     Selection
+		want    string
+		changes [3]int // Replaced, added, removed
+	}{
+		{
+			name: "one field",
+			sel:  Selection{Fields: []string{"preco"}},
+			want: `id,nome,categoria,preco,estoque,fornecedor
+1,Caneta,Papelaria,3.00,10,Bic
+2,Lapis,Papelaria,1.00,5,Faber
+3,Borracha,Papelaria,0.80,7,Faber
+9,Extra,Papelaria,1.00,1,Bic
+`,
+			changes: [3]int{1, 0, 0},
+		},
+		{
+			name: "mismatches",
+			sel:  Selection{Types: []string{"mismatch"}},
+			want: `id,nome,categoria,preco,estoque,fornecedor
+1,Caneta,Papelaria,3.00,10,Bic
+2,Lápis,Papelaria,1.00,6,Faber
+3,Borracha,Papelaria,0.80,7,Faber
+9,Extra,Papelaria,1.00,1,Bic
+`,
+			changes: [3]int{3, 0, 0},
+		},
+		{
+			name: "missing rows",
+			sel:  Selection{Types: []string{"missing_in_csv", "missing_in_api"}},
+			want: `id,nome,categoria,preco,estoque,fornecedor
+1,Caneta,Papelaria,2.50,10,Bic
+2,Lapis,Papelaria,1.00,5,Faber
+3,Borracha,Papelaria,0.80,7,Faber
+4,Regua,Papelaria,3.50,2,Acrimet
+`,
+			changes: [3]int{0, 1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sel.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			errors := compare(t)
+			var out bytes.Buffer
+			patch, err := Apply(strings.NewReader(source), &out, errors, apiProducts, tt.sel)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("corrected csv:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+			if got := [3]int{patch.Replaced, patch.Added, patch.Removed}; got != tt.changes {
+				t.Errorf("replaced, added, removed = %v, want %v", got, tt.changes)
+			}
+			if len(patch.Changes) != tt.changes[0]+tt.changes[1]+tt.changes[2] {
+				t.Errorf("%d changes listed", len(patch.Changes))
+			}
+		})
+	}
+}
+
+func TestApplyRecordsChanges(t *testing.T) {
+	var out bytes.Buffer
+	patch, err := Apply(strings.NewReader(source), &out, compare(t), apiProducts, Selection{Fields: []string{"preco"}})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := Change{Op: OpReplace, Line: 2, ID: 1, Field: "preco", From: "2.50", To: "3.00", Reason: "mismatch"}
+	if len(patch.Changes) != 1 || patch.Changes[0].Op != want.Op || patch.Changes[0].Line != want.Line ||
+		patch.Changes[0].From != want.From || patch.Changes[0].To != want.To || patch.Changes[0].Reason != want.Reason {
+		t.Errorf("changes = %+v, want %+v", patch.Changes, want)
+	}
+}
+
+func TestApplySkipsSuppressed(t *testing.T) {
+	errors := compare(t)
+	for i := range errors {
+		if errors[i].APIID == 1 {
+			errors[i].Suppressed = true
+		}
+	}
+	for _, include := range []bool{false, true} {
+		var out bytes.Buffer
+		patch, err := Apply(strings.NewReader(source), &out, errors, apiProducts, Selection{Fields: []string{"preco"}, IncludeSuppressed: include})
+		if err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if want := map[bool]int{false: 0, true: 1}[include]; patch.Replaced != want {
+			t.Errorf("include_suppressed=%v: %d replaced, want %d", include, patch.Replaced, want)
+		}
+	}
+}
+
+func TestSelectionValidate(t *testing.T) {
+	tests := []struct {
+		sel     Selection
+		wantErr bool
+	}{
+		{Selection{Fields: []string{"preco"}}, false},
+		{Selection{Types: []string{"id_changed"}}, false},
+		{Selection{}, true},
+		{Selection{Fields: []string{"cor"}}, true},
+		{Selection{Types: []string{"unknown"}}, true},
+		{Selection{Types: []string{"rule_violation"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.sel.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v, want error %v", tt.sel, err, tt.wantErr)
+		}
+	}
+}
+
+func compare(t *testing.T) []models.ErrorDetail {
+	t.Helper()
+	csvProducts, err := csv.ParseProducts(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("ParseProducts: %v", err)
+	}
+	return comparison.CompareProducts(apiProducts, csvProducts, comparison.DefaultOptions()).Errors
+}
@@ -0,0 +1,277 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subdirectories of a directory queue. Every task is a JSON file in one of them, moved
+// between them by renames, which are atomic, so several processes sharing the directory
+// never claim the same task.
+const (
+	readyDir      = "ready"      // <enqueue time in ns>-<task ID>.json, claimed in name order
+	processingDir = "processing" // <task ID>.<delivery token>.json, modified at the last claim or extension
+	deadDir       = "dead"       // <task ID>.json
+)
+
+// dirQueue is a Queue keeping its tasks in files of a local directory.
+type dirQueue struct {
+	dir         string
+	visibility  time.Duration
+	maxAttempts int
+}
+
+// NewDirQueue returns a Queue keeping its tasks in dir, created if needed.
+func NewDirQueue(dir string, visibility time.Duration, maxAttempts int) (Queue, error) {
+	if dir == "" {
+		return nil, errors.New("the fs queue backend needs a directory")
+	}
+	for _, sub := range []string{readyDir, processingDir, deadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &dirQueue{dir: dir, visibility: visibility, maxAttempts: maxAttempts}, nil
+}
+
+func (q *dirQueue) path(sub, name string) string {
+	return filepath.Join(q.dir, sub, name)
+}
+
+func (q *dirQueue) readyPath(taskID string) string {
+	return q.path(readyDir, fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), taskID))
+}
+
+// write stores a task in a temporary file, then renames it to path.
+func (q *dirQueue) write(path string, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readTask(path string) (*Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (q *dirQueue) Enqueue(task *Task) error {
+	newTask(task)
+	return q.write(q.readyPath(task.ID), task)
+}
+
+func (q *dirQueue) Dequeue(ctx context.Context) (*Delivery, error) {
+	for {
+		if err := q.reclaim(); err != nil {
+			return nil, err
+		}
+		d, err := q.claim()
+		if err != nil || d != nil {
+			return d, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// reclaim makes the deliveries whose visibility timeout expired ready again.
+func (q *dirQueue) reclaim() error {
+	entries, err := os.ReadDir(filepath.Join(q.dir, processingDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) < q.visibility {
+			continue
+		}
+		taskID, _, _ := strings.Cut(entry.Name(), ".")
+		err = os.Rename(q.path(processingDir, entry.Name()), q.readyPath(taskID))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// claim delivers the oldest ready task, nil when there is none.
+func (q *dirQueue) claim() (*Delivery, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, readyDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		_, name, ok := strings.Cut(entry.Name(), "-")
+		taskID, isTask := strings.CutSuffix(name, ".json")
+		if !ok || !isTask {
+			continue
+		}
+
+		// Renames keep the modification time, which starts the visibility timeout of the
+		// claimed task, so it is set first
+		ready := q.path(readyDir, entry.Name())
+		now := time.Now()
+		if err := os.Chtimes(ready, now, now); errors.Is(err, fs.ErrNotExist) {
+			continue // Claimed by another consumer
+		} else if err != nil {
+			return nil, err
+		}
+		token := taskID + "." + uuid.New().String() + ".json"
+		processing := q.path(processingDir, token)
+		if err := os.Rename(ready, processing); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		task, err := readTask(processing)
+		if err != nil {
+			fmt.Printf("Warning: Moving unreadable task %s to the dead-letter list: %v\n", taskID, err)
+			if err := os.Rename(processing, q.path(deadDir, taskID+".json")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		task.Attempts++
+		if err := q.write(processing, task); err != nil {
+			return nil, err
+		}
+		return &Delivery{Task: task, token: token, exhausted: task.Attempts > q.maxAttempts}, nil
+	}
+	return nil, nil
+}
+
+func (q *dirQueue) Extend(d *Delivery) error {
+	now := time.Now()
+	err := os.Chtimes(q.path(processingDir, d.token), now, now)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrLost
+	}
+	return err
+}
+
+func (q *dirQueue) Ack(d *Delivery) error {
+	err := os.Remove(q.path(processingDir, d.token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrLost
+	}
+	return err
+}
+
+func (q *dirQueue) Fail(d *Delivery, cause error) (bool, error) {
+	// The delivery is taken out of the processing directory first, so it can't be
+	// reclaimed while its failure is recorded
+	failing, err := os.CreateTemp(q.dir, ".fail-*")
+	if err != nil {
+		return false, err
+	}
+	failing.Close()
+	if err := os.Rename(q.path(processingDir, d.token), failing.Name()); err != nil {
+		os.Remove(failing.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, ErrLost
+		}
+		return false, err
+	}
+
+	task := failed(d, cause)
+	dead := task.Attempts >= q.maxAttempts
+	data, err := json.Marshal(task)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(failing.Name(), data, 0o644); err != nil {
+		return false, err
+	}
+	target := q.readyPath(task.ID)
+	if dead {
+		target = q.path(deadDir, task.ID+".json")
+	}
+	return dead, os.Rename(failing.Name(), target)
+}
+
+// count returns the number of tasks in a subdirectory.
+func (q *dirQueue) count(sub string) (int64, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *dirQueue) DeadLetters() ([]Task, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, deadDir))
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, entry := range entries {
+		task, err := readTask(q.path(deadDir, entry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: Skipping unreadable dead letter %s: %v\n", entry.Name(), err)
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, nil
+}
+
+func (q *dirQueue) Stats() (Stats, error) {
+	var stats Stats
+	var err error
+	if stats.Ready, err = q.count(readyDir); err != nil {
+		return stats, err
+	}
+	if stats.InFlight, err = q.count(processingDir); err != nil {
+		return stats, err
+	}
+	stats.Dead, err = q.count(deadDir)
+	return stats, err
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryQueue is a Queue held in memory, for a single process. Its tasks are lost when the
+// process exits.
+type memoryQueue struct {
+	visibility  time.Duration
+	maxAttempts int
+
+	mu       sync.Mutex
+	ready    []Task
+	inFlight map[string]*lease // By delivery token
+	dead     []Task
+	wake     chan struct{}
+}
+
+// lease is a delivered task and the end of its visibility timeout.
+type lease struct {
+	task     Task
+	deadline time.Time
+}
+
+// NewMemoryQueue returns a Queue held in memory.
+func NewMemoryQueue(visibility time.Duration, maxAttempts int) Queue {
+	return &memoryQueue{
+		visibility:  visibility,
+		maxAttempts: maxAttempts,
+		inFlight:    make(map[string]*lease),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// push adds a task to the ready tasks and wakes a waiting consumer. The lock must be held.
+func (q *memoryQueue) push(task Task) {
+	q.ready = append(q.ready, task)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *memoryQueue) Enqueue(task *Task) error {
+	newTask(task)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.push(*task)
+	return nil
+}
+
+func (q *memoryQueue) Dequeue(ctx context.Context) (*Delivery, error) {
+	for {
+		if d := q.next(); d != nil {
+			return d, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// next delivers the oldest ready task, after making the timed out deliveries ready again.
+func (q *memoryQueue) next() *Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for token, l := range q.inFlight {
+		if now.After(l.deadline) {
+			delete(q.inFlight, token)
+			q.ready = append(q.ready, l.task)
+		}
+	}
+	if len(q.ready) == 0 {
+		return nil
+	}
+
+	task := q.ready[0]
+	q.ready = q.ready[1:]
+	task.Attempts++
+	token := uuid.New().String()
+	q.inFlight[token] = &lease{task: task, deadline: now.Add(q.visibility)}
+	return &Delivery{Task: &task, token: token, exhausted: task.Attempts > q.maxAttempts}
+}
+
+func (q *memoryQueue) Extend(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, ok := q.inFlight[d.token]
+	if !ok {
+		return ErrLost
+	}
+	l.deadline = time.Now().Add(q.visibility)
+	return nil
+}
+
+func (q *memoryQueue) Ack(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.inFlight[d.token]; !ok {
+		return ErrLost
+	}
+	delete(q.inFlight, d.token)
+	return nil
+}
+
+func (q *memoryQueue) Fail(d *Delivery, cause error) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.inFlight[d.token]; !ok {
+		return false, ErrLost
+	}
+	delete(q.inFlight, d.token)
+
+	task := failed(d, cause)
+	if task.Attempts >= q.maxAttempts {
+		q.dead = append(q.dead, task)
+		return true, nil
+	}
+	q.push(task)
+	return false, nil
+}
+
+func (q *memoryQueue) DeadLetters() ([]Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Task{}, q.dead...), nil
+}
+
+func (q *memoryQueue) Stats() (Stats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Stats{Ready: int64(len(q.ready)), InFlight: int64(len(q.inFlight)), Dead: int64(len(q.dead))}, nil
+}
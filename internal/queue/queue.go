@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrLost is returned when acknowledging, extending or failing a delivery whose visibility
+// timeout expired: the task was made visible again and may be running elsewhere.
+var ErrLost = errors.New("delivery lost: its visibility timeout expired")
+
+// ErrTimedOut is the failure of a task whose every delivery timed out without an
+// acknowledgement, typically because its consumer crashed.
+var ErrTimedOut = errors.New("every delivery of the task timed out")
+
+// Task is a unit of work for a job.
+type Task struct {
+	ID         string          `json:"id"`
+	JobID      string          `json:"job_id"`
+	Payload    json.RawMessage `json:"payload,omitempty"` // Defined by the producer
+	EnqueuedAt int64           `json:"enqueued_at"`
+	Attempts   int             `json:"attempts"`        // Deliveries so far, the current one included
+	Error      string          `json:"error,omitempty"` // Last failure
+}
+
+// Delivery is a task handed to one consumer. The task stays invisible to other consumers
+// for the visibility timeout, extended with Extend, until the delivery is acknowledged or
+// failed. Unacknowledged tasks are delivered again, so tasks run at least once.
+type Delivery struct {
+	Task      *Task
+	token     string
+	exhausted bool
+}
+
+// Exhausted reports whether the task was delivered more than the allowed attempts, every
+// previous delivery timing out. It must be failed without running.
+func (d *Delivery) Exhausted() bool {
+	return d.exhausted
+}
+
+// Queue is a durable queue of tasks with acknowledgements and a dead-letter list.
+type Queue interface {
+	Enqueue(task *Task) error
+	// Dequeue waits for a task until ctx is done.
+	Dequeue(ctx context.Context) (*Delivery, error)
+	// Extend restarts the visibility timeout of a delivery.
+	Extend(d *Delivery) error
+	// Ack removes a task once run.
+	Ack(d *Delivery) error
+	// Fail makes a task visible again, or moves it to the dead-letter list once it used
+	// all its attempts. It reports whether the task was dead-lettered.
+	Fail(d *Delivery, cause error) (bool, error)
+	DeadLetters() ([]Task, error)
+	Stats() (Stats, error)
+}
+
+// Stats counts the tasks of a queue.
+type Stats struct {
+	Ready    int64 `json:"ready"`     // Waiting for a consumer
+	InFlight int64 `json:"in_flight"` // Delivered, not acknowledged yet
+	Dead     int64 `json:"dead"`      // In the dead-letter list
+}
+
+// Queue backends.
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendFS     = "fs"
+)
+
+// Config selects and configures a queue backend.
+type Config struct {
+	Backend   string // redis (default), memory or fs
+	RedisAddr string // Address of the Redis server, for the redis backend
+	Dir       string // Directory holding the tasks, for the fs backend
+
+	VisibilityTimeout time.Duration // How long a delivery stays invisible, 5 minutes when zero
+	MaxAttempts       int           // Deliveries before a task is dead-lettered, 3 when zero
+}
+
+// pollInterval is how often idle consumers look for tasks, or for timed out deliveries.
+const pollInterval = 500 * time.Millisecond
+
+// New returns the queue backend selected by cfg.
+func New(cfg Config) (Queue, error) {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+
+	switch cfg.Backend {
+	case "", BackendRedis:
+		return NewRedisQueue(cfg.RedisAddr, cfg.VisibilityTimeout, cfg.MaxAttempts)
+	case BackendMemory:
+		return NewMemoryQueue(cfg.VisibilityTimeout, cfg.MaxAttempts), nil
+	case BackendFS:
+		return NewDirQueue(cfg.Dir, cfg.VisibilityTimeout, cfg.MaxAttempts)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+	}
+}
+
+// newTask prepares a task for enqueueing, assigning its ID if needed.
+func newTask(task *Task) {
+	if task.ID == "" {
+		task.ID = uuid.New().String()
+	}
+	if task.EnqueuedAt == 0 {
+		task.EnqueuedAt = time.Now().Unix()
+	}
+}
+
+// failed returns a copy of a delivered task recording its failure.
+func failed(d *Delivery, cause error) Task {
+	task := *d.Task
+	task.Error = cause.Error()
+	return task
+}
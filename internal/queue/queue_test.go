@@ -0,0 +1,327 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testQueues returns a queue of every backend that runs without a server.
+func testQueues(t *testing.T, visibility time.Duration, maxAttempts int) map[string]Queue {
+	t.Helper()
+	dir, err := NewDirQueue(t.TempDir(), visibility, maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Queue{
+		"memory": NewMemoryQueue(visibility, maxAttempts),
+		"fs":     dir,
+	}
+}
+
+// dequeue returns the next delivery, failing the test when none comes within a second.
+func dequeue(t *testing.T, q Queue) *Delivery {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	d, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	return d
+}
+
+// empty checks that no task is delivered for a while.
+func empty(t *testing.T, q Queue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if d, err := q.Dequeue(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Dequeue = %+v, %v, want no task", d, err)
+	}
+}
+
+func checkStats(t *testing.T, q Queue, want Stats) {
+	t.Helper()
+	stats, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != want {
+		t.Errorf("Stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestEnqueueAndAck(t *testing.T) {
+	for name, q := range testQueues(t, time.Minute, 3) {
+		t.Run(name, func(t *testing.T) {
+			first := &Task{JobID: "first", Payload: json.RawMessage(`{"mode":"streaming"}`)}
+			if err := q.Enqueue(first); err != nil {
+				t.Fatal(err)
+			}
+			if first.ID == "" || first.EnqueuedAt == 0 {
+				t.Errorf("enqueued task = %+v, want an ID and an enqueue time", first)
+			}
+			if err := q.Enqueue(&Task{JobID: "second"}); err != nil {
+				t.Fatal(err)
+			}
+			checkStats(t, q, Stats{Ready: 2})
+
+			d := dequeue(t, q)
+			if d.Task.ID != first.ID || d.Task.JobID != "first" || string(d.Task.Payload) != `{"mode":"streaming"}` {
+				t.Errorf("first delivery = %+v, want the first task", d.Task)
+			}
+			if d.Task.Attempts != 1 || d.Exhausted() {
+				t.Errorf("first delivery: %d attempts, exhausted %v", d.Task.Attempts, d.Exhausted())
+			}
+			checkStats(t, q, Stats{Ready: 1, InFlight: 1})
+
+			if err := q.Ack(d); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Ack(d); err != ErrLost {
+				t.Errorf("second Ack: %v, want ErrLost", err)
+			}
+			if d := dequeue(t, q); d.Task.JobID != "second" {
+				t.Errorf("second delivery = %+v, want the second task", d.Task)
+			}
+			empty(t, q)
+		})
+	}
+}
+
+func TestLeaseExpires(t *testing.T) {
+	visibility := 100 * time.Millisecond
+	for name, q := range testQueues(t, visibility, 3) {
+		t.Run(name, func(t *testing.T) {
+			if err := q.Enqueue(&Task{JobID: "job"}); err != nil {
+				t.Fatal(err)
+			}
+			lost := dequeue(t, q)
+			empty(t, q) // Invisible while leased
+
+			time.Sleep(2 * visibility)
+			d := dequeue(t, q)
+			if d.Task.ID != lost.Task.ID || d.Task.Attempts != 2 {
+				t.Errorf("delivery after the timeout = %+v, want the task on its second attempt", d.Task)
+			}
+
+			// The consumer whose lease expired can't settle the task anymore
+			if err := q.Extend(lost); err != ErrLost {
+				t.Errorf("Extend of an expired delivery: %v, want ErrLost", err)
+			}
+			if err := q.Ack(lost); err != ErrLost {
+				t.Errorf("Ack of an expired delivery: %v, want ErrLost", err)
+			}
+			if _, err := q.Fail(lost, errors.New("late")); err != ErrLost {
+				t.Errorf("Fail of an expired delivery: %v, want ErrLost", err)
+			}
+			if err := q.Ack(d); err != nil {
+				t.Errorf("Ack of the new delivery: %v", err)
+			}
+			checkStats(t, q, Stats{})
+		})
+	}
+}
+
+func TestExtendKeepsLease(t *testing.T) {
+	visibility := 300 * time.Millisecond
+	for name, q := range testQueues(t, visibility, 3) {
+		t.Run(name, func(t *testing.T) {
+			if err := q.Enqueue(&Task{JobID: "job"}); err != nil {
+				t.Fatal(err)
+			}
+			d := dequeue(t, q)
+			time.Sleep(200 * time.Millisecond)
+			if err := q.Extend(d); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(200 * time.Millisecond)
+			empty(t, q) // Past the first timeout, within the extended one
+			if err := q.Ack(d); err != nil {
+				t.Errorf("Ack of an extended delivery: %v", err)
+			}
+		})
+	}
+}
+
+func TestFailRetriesThenDeadLetters(t *testing.T) {
+	for name, q := range testQueues(t, time.Minute, 2) {
+		t.Run(name, func(t *testing.T) {
+			if err := q.Enqueue(&Task{JobID: "job"}); err != nil {
+				t.Fatal(err)
+			}
+
+			d := dequeue(t, q)
+			dead, err := q.Fail(d, errors.New("api down"))
+			if err != nil || dead {
+				t.Fatalf("first Fail = %v, %v, want a retry", dead, err)
+			}
+			checkStats(t, q, Stats{Ready: 1})
+
+			d = dequeue(t, q)
+			if d.Task.Attempts != 2 || d.Task.Error != "api down" {
+				t.Errorf("retry = %+v, want the second attempt with the first failure", d.Task)
+			}
+			dead, err = q.Fail(d, errors.New("still down"))
+			if err != nil || !dead {
+				t.Fatalf("last Fail = %v, %v, want the task dead-lettered", dead, err)
+			}
+			if _, err := q.Fail(d, errors.New("again")); err != ErrLost {
+				t.Errorf("Fail of a dead-lettered delivery: %v, want ErrLost", err)
+			}
+			checkStats(t, q, Stats{Dead: 1})
+			empty(t, q)
+
+			letters, err := q.DeadLetters()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(letters) != 1 || letters[0].JobID != "job" || letters[0].Attempts != 2 || letters[0].Error != "still down" {
+				t.Errorf("DeadLetters = %+v, want the task with its last failure", letters)
+			}
+		})
+	}
+}
+
+func TestExhaustedAfterTimeouts(t *testing.T) {
+	visibility := 50 * time.Millisecond
+	for name, q := range testQueues(t, visibility, 1) {
+		t.Run(name, func(t *testing.T) {
+			if err := q.Enqueue(&Task{JobID: "job"}); err != nil {
+				t.Fatal(err)
+			}
+			if d := dequeue(t, q); d.Exhausted() {
+				t.Error("first delivery exhausted")
+			}
+			time.Sleep(2 * visibility)
+
+			d := dequeue(t, q)
+			if !d.Exhausted() {
+				t.Fatalf("delivery after every attempt timed out not exhausted: %+v", d.Task)
+			}
+			dead, err := q.Fail(d, ErrTimedOut)
+			if err != nil || !dead {
+				t.Errorf("Fail of an exhausted delivery = %v, %v, want the task dead-lettered", dead, err)
+			}
+		})
+	}
+}
+
+func TestDirQueueDeadLettersUnreadableTasks(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewDirQueue(dir, time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, readyDir, "00000000000000000001-broken.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(&Task{JobID: "job"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := dequeue(t, q); d.Task.JobID != "job" {
+		t.Errorf("delivery = %+v, want the readable task", d.Task)
+	}
+	checkStats(t, q, Stats{InFlight: 1, Dead: 1})
+}
+
+func TestWorkerRetriesFailedTasks(t *testing.T) {
+	q := NewMemoryQueue(time.Minute, 3)
+	if err := q.Enqueue(&Task{JobID: "flaky"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(&Task{JobID: "panics"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	var dead []string
+	done := make(chan struct{})
+	w := &Worker{
+		Queue: q,
+		Handle: func(task *Task) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[task.JobID]++
+			if task.JobID == "panics" {
+				panic("bad input")
+			}
+			if runs[task.JobID] == 1 {
+				return errors.New("transient")
+			}
+			return nil
+		},
+		Failed: func(task *Task, err error, isDead bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			if isDead {
+				dead = append(dead, task.JobID)
+				close(done)
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no task dead-lettered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if runs["flaky"] != 2 || runs["panics"] != 3 {
+		t.Errorf("runs = %v, want flaky twice and panics on every attempt", runs)
+	}
+	if len(dead) != 1 || dead[0] != "panics" {
+		t.Errorf("dead-lettered %v, want [panics]", dead)
+	}
+}
+
+func TestWorkerHeartbeats(t *testing.T) {
+	q := NewMemoryQueue(time.Minute, 3)
+	if err := q.Enqueue(&Task{JobID: "long"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	beats := 0
+	done := make(chan struct{})
+	w := &Worker{
+		Queue: q,
+		Handle: func(task *Task) error {
+			time.Sleep(200 * time.Millisecond)
+			close(done)
+			return nil
+		},
+		Heartbeat: func(task *Task) {
+			mu.Lock()
+			defer mu.Unlock()
+			beats++
+		},
+		ExtendEvery: 40 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task not run")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if beats < 2 {
+		t.Errorf("%d heartbeats while the task ran, want one per extension", beats)
+	}
+}
@@ -0,0 +1,283 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Keys of the Redis queue. Tasks are entries of a stream read by a consumer group, which
+// tracks the deliveries not acknowledged yet, how long ago and how many times each entry
+// was delivered. Entries are deleted once acknowledged.
+const (
+	streamKey     = "queue:jobs"
+	consumerGroup = "workers"
+	deadKey       = "queue:jobs:dead" // List of dead-lettered tasks
+)
+
+// blockTimeout bounds how long a consumer waits for new entries, so it also checks for
+// timed out deliveries.
+const blockTimeout = 5 * time.Second
+
+// redisQueue is a Queue kept in a Redis stream. Each entry holds a task whose Attempts
+// count the deliveries of earlier entries of the same task.
+type redisQueue struct {
+	client      *redis.Client
+	consumer    string
+	visibility  time.Duration
+	maxAttempts int
+}
+
+// NewRedisQueue returns a Queue kept in the Redis server at addr, creating its consumer
+// group if needed.
+func NewRedisQueue(addr string, visibility time.Duration, maxAttempts int) (Queue, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	ctx := context.Background()
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		return nil, err
+	}
+	err := client.XGroupCreateMkStream(ctx, streamKey, consumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	return &redisQueue{
+		client:      client,
+		consumer:    fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		visibility:  visibility,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// redisToken identifies a delivery: the stream entry and its delivery count, which any
+// later delivery of the entry increments.
+func redisToken(id string, deliveries int64) string {
+	return fmt.Sprintf("%s/%d", id, deliveries)
+}
+
+func (q *redisQueue) Enqueue(task *Task) error {
+	newTask(task)
+	return q.add(q.client, task)
+}
+
+func (q *redisQueue) add(c redis.Cmdable, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return c.XAdd(context.Background(), &redis.XAddArgs{Stream: streamKey, Values: map[string]interface{}{"task": data}}).Err()
+}
+
+func (q *redisQueue) Dequeue(ctx context.Context) (*Delivery, error) {
+	for {
+		// Deliveries idle for longer than the visibility timeout are claimed first. XCLAIM
+		// checks the idle time again, so only one consumer claims each
+		expired, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: streamKey,
+			Group:  consumerGroup,
+			Idle:   q.visibility,
+			Start:  "-",
+			End:    "+",
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(expired) > 0 {
+			claimed, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   streamKey,
+				Group:    consumerGroup,
+				Consumer: q.consumer,
+				MinIdle:  q.visibility,
+				Messages: []string{expired[0].ID},
+			}).Result()
+			if err != nil {
+				return nil, err
+			}
+			if len(claimed) > 0 {
+				deliveries, err := q.deliveries(ctx, claimed[0].ID)
+				if err != nil {
+					return nil, err
+				}
+				return q.delivery(claimed[0], deliveries)
+			}
+		}
+
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroup,
+			Consumer: q.consumer,
+			Streams:  []string{streamKey, ">"},
+			Count:    1,
+			Block:    min(blockTimeout, q.visibility),
+		}).Result()
+		if err == redis.Nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			return q.delivery(streams[0].Messages[0], 1)
+		}
+	}
+}
+
+// deliveries returns how many times a pending entry was delivered, 0 once acknowledged.
+func (q *redisQueue) deliveries(ctx context.Context, id string) (int64, error) {
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamKey,
+		Group:  consumerGroup,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	return pending[0].RetryCount, nil
+}
+
+func (q *redisQueue) delivery(msg redis.XMessage, deliveries int64) (*Delivery, error) {
+	data, _ := msg.Values["task"].(string)
+	var task Task
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		// Unreadable entries are dead-lettered as they are, or they would be claimed forever
+		ctx := context.Background()
+		pipe := q.client.TxPipeline()
+		pipe.RPush(ctx, deadKey, data)
+		pipe.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		pipe.XDel(ctx, streamKey, msg.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("dead-lettered unreadable task in stream entry %s: %w", msg.ID, err)
+	}
+	task.Attempts += int(deliveries)
+	return &Delivery{
+		Task:      &task,
+		token:     redisToken(msg.ID, deliveries),
+		exhausted: task.Attempts > q.maxAttempts,
+	}, nil
+}
+
+// owned returns the stream entry of a delivery, or ErrLost when it was delivered again.
+func (q *redisQueue) owned(d *Delivery) (string, error) {
+	id, _, _ := strings.Cut(d.token, "/")
+	deliveries, err := q.deliveries(context.Background(), id)
+	if err != nil {
+		return "", err
+	}
+	if redisToken(id, deliveries) != d.token {
+		return "", ErrLost
+	}
+	return id, nil
+}
+
+// extendScript resets the idle time of a stream entry if the delivery is still the last
+// one of the entry, in one step so the entry can't be claimed by another consumer between
+// the check and the claim. It returns 0 when the delivery was lost.
+// KEYS[1] is the stream; ARGV holds the group, the consumer, the entry ID and the delivery
+// count of the delivery.
+var extendScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1)
+if #pending == 0 or tostring(pending[1][4]) ~= ARGV[4] then
+	return 0
+end
+-- Claiming the entry resets its idle time; JUSTID leaves its delivery count unchanged
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], 'JUSTID')
+return 1
+`)
+
+func (q *redisQueue) Extend(d *Delivery) error {
+	id, deliveries, _ := strings.Cut(d.token, "/")
+	extended, err := extendScript.Run(context.Background(), q.client, []string{streamKey},
+		consumerGroup, q.consumer, id, deliveries).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrLost
+	}
+	return nil
+}
+
+func (q *redisQueue) Ack(d *Delivery) error {
+	id, err := q.owned(d)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	pipe := q.client.TxPipeline()
+	pipe.XAck(ctx, streamKey, consumerGroup, id)
+	pipe.XDel(ctx, streamKey, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Fail replaces the entry of a delivery with a new entry of the task, or moves the task to
+// the dead-letter list, in one transaction.
+func (q *redisQueue) Fail(d *Delivery, cause error) (bool, error) {
+	id, err := q.owned(d)
+	if err != nil {
+		return false, err
+	}
+	task := failed(d, cause)
+	dead := task.Attempts >= q.maxAttempts
+	data, err := json.Marshal(task)
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	pipe := q.client.TxPipeline()
+	if dead {
+		pipe.RPush(ctx, deadKey, data)
+	} else if err := q.add(pipe, &task); err != nil {
+		return false, err
+	}
+	pipe.XAck(ctx, streamKey, consumerGroup, id)
+	pipe.XDel(ctx, streamKey, id)
+	_, err = pipe.Exec(ctx)
+	return dead, err
+}
+
+func (q *redisQueue) DeadLetters() ([]Task, error) {
+	entries, err := q.client.LRange(context.Background(), deadKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(entries))
+	for _, entry := range entries {
+		var task Task
+		if err := json.Unmarshal([]byte(entry), &task); err != nil {
+			fmt.Printf("Warning: Skipping unreadable dead letter: %v\n", err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// Stats counts the tasks of the queue. Acknowledged entries are deleted, so the stream
+// holds the ready and in-flight tasks.
+func (q *redisQueue) Stats() (Stats, error) {
+	ctx := context.Background()
+	pipe := q.client.Pipeline()
+	length := pipe.XLen(ctx, streamKey)
+	pending := pipe.XPending(ctx, streamKey, consumerGroup)
+	dead := pipe.LLen(ctx, deadKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Stats{}, err
+	}
+	inFlight := pending.Val().Count
+	return Stats{Ready: length.Val() - inFlight, InFlight: inFlight, Dead: dead.Val()}, nil
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Worker consumes the tasks of a queue one at a time.
+type Worker struct {
+	Queue       Queue
+	Handle      func(task *Task) error                 // Runs a task; an error fails its delivery
+	Failed      func(task *Task, err error, dead bool) // Optional, called once a delivery failed; dead when the task was dead-lettered
+	Heartbeat   func(task *Task)                       // Optional, called each time the visibility of a running task is extended
+	ExtendEvery time.Duration                          // How often the visibility of a running task is extended, a minute when zero; below the visibility timeout
+}
+
+// Run consumes tasks until ctx is done. The task running when ctx is done is finished
+// first.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		d, err := w.Queue.Dequeue(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to dequeue a task: %v\n", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		w.process(d)
+	}
+}
+
+// process runs a delivered task, extending its visibility meanwhile, then acknowledges or
+// fails it.
+func (w *Worker) process(d *Delivery) {
+	if d.Exhausted() {
+		w.fail(d, ErrTimedOut)
+		return
+	}
+
+	every := w.ExtendEvery
+	if every <= 0 {
+		every = time.Minute
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.Queue.Extend(d); err != nil {
+					fmt.Printf("Warning: Failed to extend task %s of job %s: %v\n", d.Task.ID, d.Task.JobID, err)
+				} else if w.Heartbeat != nil {
+					w.Heartbeat(d.Task)
+				}
+			}
+		}
+	}()
+	err := w.handle(d.Task)
+	close(done)
+
+	if err != nil {
+		w.fail(d, err)
+		return
+	}
+	if err := w.Queue.Ack(d); err != nil {
+		fmt.Printf("Warning: Failed to acknowledge task %s of job %s: %v\n", d.Task.ID, d.Task.JobID, err)
+	}
+}
+
+// handle runs Handle, turning a panic into an error so the task is retried instead of
+// taking the process down.
+func (w *Worker) handle(task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.Handle(task)
+}
+
+func (w *Worker) fail(d *Delivery, cause error) {
+	dead, err := w.Queue.Fail(d, cause)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record the failure of task %s of job %s: %v\n", d.Task.ID, d.Task.JobID, err)
+		return
+	}
+	if dead {
+		fmt.Printf("Warning: Task %s of job %s dead-lettered after %d attempts: %v\n", d.Task.ID, d.Task.JobID, d.Task.Attempts, cause)
+	}
+	if w.Failed != nil {
+		w.Failed(d.Task, cause, dead)
+	}
+}
@@ -0,0 +1,558 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"hackathon-go/internal/models"
+)
+
+// valueType is the static type of an expression. Types are checked when a rule is
+// compiled, so evaluating a compiled rule cannot fail.
+type valueType int
+
+const (
+	typeNumber valueType = iota
+	typeString
+	typeBool
+	typeNumberList
+	typeStringList
+)
+
+func (t valueType) String() string {
+	return [...]string{"number", "string", "bool", "number list", "string list"}[t]
+}
+
+// fieldTypes lists the product fields available to expressions.
+var fieldTypes = map[string]valueType{
+	"id":         typeNumber,
+	"nome":       typeString,
+	"categoria":  typeString,
+	"preco":      typeNumber,
+	"estoque":    typeNumber,
+	"fornecedor": typeString,
+}
+
+// functions lists the built-in functions with their argument and result types.
+var functions = map[string]struct {
+	arg    valueType
+	result valueType
+	fn     func(interface{}) interface{}
+}{
+	"len":   {typeString, typeNumber, func(v interface{}) interface{} { return float64(len([]rune(v.(string)))) }},
+	"lower": {typeString, typeString, func(v interface{}) interface{} { return strings.ToLower(v.(string)) }},
+	"upper": {typeString, typeString, func(v interface{}) interface{} { return strings.ToUpper(v.(string)) }},
+	"trim":  {typeString, typeString, func(v interface{}) interface{} { return strings.TrimSpace(v.(string)) }},
+	"abs":   {typeNumber, typeNumber, func(v interface{}) interface{} { return math.Abs(v.(float64)) }},
+}
+
+// node is a type-checked expression. Values are float64, string, bool or []interface{}.
+type node interface {
+	typ() valueType
+	eval(p *models.Product) interface{}
+}
+
+type literal struct {
+	value interface{}
+	t     valueType
+}
+
+func (n literal) typ() valueType                   { return n.t }
+func (n literal) eval(*models.Product) interface{} { return n.value }
+
+type field struct {
+	name string
+}
+
+func (n field) typ() valueType { return fieldTypes[n.name] }
+func (n field) eval(p *models.Product) interface{} {
+	switch n.name {
+	case "id":
+		return float64(p.ID)
+	case "nome":
+		return p.Nome
+	case "categoria":
+		return p.Categoria
+	case "preco":
+		return p.Preco.Float64()
+	case "estoque":
+		return float64(p.Estoque)
+	default:
+		return p.Fornecedor
+	}
+}
+
+type list struct {
+	items []node
+	t     valueType
+}
+
+func (n list) typ() valueType { return n.t }
+func (n list) eval(p *models.Product) interface{} {
+	values := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		values[i] = item.eval(p)
+	}
+	return values
+}
+
+type call struct {
+	name string
+	arg  node
+}
+
+func (n call) typ() valueType { return functions[n.name].result }
+func (n call) eval(p *models.Product) interface{} {
+	return functions[n.name].fn(n.arg.eval(p))
+}
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (n unary) typ() valueType { return n.x.typ() }
+func (n unary) eval(p *models.Product) interface{} {
+	if n.op == "-" {
+		return -n.x.eval(p).(float64)
+	}
+	return !n.x.eval(p).(bool)
+}
+
+type binary struct {
+	op      string
+	l, r    node
+	t       valueType
+	pattern *regexp.Regexp // Compiled right operand of "matches"
+}
+
+func (n binary) typ() valueType { return n.t }
+func (n binary) eval(p *models.Product) interface{} {
+	// Logical operators short-circuit
+	switch n.op {
+	case "and":
+		return n.l.eval(p).(bool) && n.r.eval(p).(bool)
+	case "or":
+		return n.l.eval(p).(bool) || n.r.eval(p).(bool)
+	case "matches":
+		return n.pattern.MatchString(n.l.eval(p).(string))
+	}
+
+	l, r := n.l.eval(p), n.r.eval(p)
+	switch n.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "in":
+		for _, item := range r.([]interface{}) {
+			if item == l {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(l.(string), r.(string))
+	}
+
+	if ls, ok := l.(string); ok {
+		rs := r.(string)
+		switch n.op {
+		case "<":
+			return ls < rs
+		case "<=":
+			return ls <= rs
+		case ">":
+			return ls > rs
+		case ">=":
+			return ls >= rs
+		case "+":
+			return ls + rs
+		}
+	}
+
+	lf, rf := l.(float64), r.(float64)
+	switch n.op {
+	case "<":
+		return lf < rf
+	case "<=":
+		return lf <= rf
+	case ">":
+		return lf > rf
+	case ">=":
+		return lf >= rf
+	case "+":
+		return lf + rf
+	case "-":
+		return lf - rf
+	case "*":
+		return lf * rf
+	case "/":
+		return lf / rf
+	default:
+		return math.Mod(lf, rf)
+	}
+}
+
+// parser is a recursive descent parser over the tokens of an expression:
+//
+//	or         = and { ("or" | "||") and }
+//	and        = not { ("and" | "&&") not }
+//	not        = ("not" | "!") not | comparison
+//	comparison = sum [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | ["not"] "in" | ["not"] "contains" | "matches") sum ]
+//	sum        = product { ("+" | "-") product }
+//	product    = unary { ("*" | "/" | "%") unary }
+//	unary      = "-" unary | primary
+//	primary    = number | string | "true" | "false" | field | function "(" or ")" | "[" or { "," or } "]" | "(" or ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse parses and type-checks an expression.
+func parse(expr string) (node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token when it is one of the given operators or keywords.
+func (p *parser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator && tok.kind != tokenIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at position %d", text, tok.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return l, nil
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newBinary("or", l, r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return l, nil
+		}
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newBinary("and", l, r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != typeBool {
+			return nil, fmt.Errorf("not needs a bool, got %s", x.typ())
+		}
+		return unary{op: "not", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	negated := false
+	if _, ok := p.accept("not"); ok {
+		negated = true
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in", "contains", "matches")
+	if !ok {
+		if negated {
+			return nil, fmt.Errorf("expected in or contains after not at position %d", p.peek().pos)
+		}
+		return l, nil
+	}
+	if negated && op != "in" && op != "contains" {
+		return nil, fmt.Errorf("not can only precede in or contains")
+	}
+
+	r, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	n, err := newBinary(op, l, r)
+	if err != nil {
+		return nil, err
+	}
+	if negated {
+		return unary{op: "not", x: n}, nil
+	}
+	return n, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newBinary(op, l, r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newBinary(op, l, r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != typeNumber {
+			return nil, fmt.Errorf("unary - needs a number, got %s", x.typ())
+		}
+		return unary{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return literal{value: f, t: typeNumber}, nil
+
+	case tokenString:
+		return literal{value: tok.text, t: typeString}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true", "false":
+			return literal{value: tok.text == "true", t: typeBool}, nil
+		}
+		if _, ok := fieldTypes[tok.text]; ok {
+			return field{name: tok.text}, nil
+		}
+		if fn, ok := functions[tok.text]; ok {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			if arg.typ() != fn.arg {
+				return nil, fmt.Errorf("%s needs a %s, got %s", tok.text, fn.arg, arg.typ())
+			}
+			return call{name: tok.text, arg: arg}, nil
+		}
+		return nil, fmt.Errorf("unknown identifier %q at position %d", tok.text, tok.pos)
+
+	case tokenOperator:
+		switch tok.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			return p.parseList(tok)
+		}
+	}
+
+	if tok.kind == tokenEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *parser) parseList(open token) (node, error) {
+	var items []node
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if item.typ() != typeNumber && item.typ() != typeString {
+			return nil, fmt.Errorf("list items must be numbers or strings, got %s", item.typ())
+		}
+		if len(items) > 0 && item.typ() != items[0].typ() {
+			return nil, fmt.Errorf("list at position %d mixes %s and %s", open.pos, items[0].typ(), item.typ())
+		}
+		items = append(items, item)
+
+		if _, ok := p.accept(","); !ok {
+			break
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+
+	t := typeNumberList
+	if items[0].typ() == typeString {
+		t = typeStringList
+	}
+	return list{items: items, t: t}, nil
+}
+
+// newBinary type-checks a binary operation.
+func newBinary(op string, l, r node) (node, error) {
+	lt, rt := l.typ(), r.typ()
+	mismatch := fmt.Errorf("%s cannot be applied to %s and %s", op, lt, rt)
+
+	switch op {
+	case "and", "or":
+		if lt != typeBool || rt != typeBool {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeBool}, nil
+
+	case "==", "!=":
+		if lt != rt || lt == typeNumberList || lt == typeStringList {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeBool}, nil
+
+	case "<", "<=", ">", ">=":
+		if lt != rt || (lt != typeNumber && lt != typeString) {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeBool}, nil
+
+	case "in":
+		if !(lt == typeNumber && rt == typeNumberList) && !(lt == typeString && rt == typeStringList) {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeBool}, nil
+
+	case "contains":
+		if lt != typeString || rt != typeString {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeBool}, nil
+
+	case "matches":
+		pattern, ok := r.(literal)
+		if lt != typeString || !ok || rt != typeString {
+			return nil, fmt.Errorf("matches needs a string and a string literal pattern")
+		}
+		re, err := regexp.Compile(pattern.value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return binary{op: op, l: l, r: r, t: typeBool, pattern: re}, nil
+
+	case "+":
+		if lt != rt || (lt != typeNumber && lt != typeString) {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: lt}, nil
+
+	default: // - * / %
+		if lt != typeNumber || rt != typeNumber {
+			return nil, mismatch
+		}
+		return binary{op: op, l: l, r: r, t: typeNumber}, nil
+	}
+}
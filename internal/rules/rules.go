@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"fmt"
+
+	"hackathon-go/internal/models"
+)
+
+// Sides a rule can be evaluated on.
+const (
+	SideAPI = "api"
+	SideCSV = "csv"
+)
+
+// Rule is a named assertion that every product record must satisfy, written in a small
+// expression language over the fields id, nome, categoria, preco, estoque and fornecedor:
+//
+//	preco > 0
+//	estoque <= 500
+//	categoria in ["Móveis", "Hardware"]
+//	preco * estoque < 1e6
+//	not (lower(nome) contains lower(fornecedor))
+//
+// Operators are arithmetic (+ - * / %), comparisons (== != < <= > >=), in and not in over
+// lists, contains and not contains on strings, matches against a regular expression, and
+// and / or / not (also && || !). Functions are len, lower, upper, trim and abs.
+type Rule struct {
+	Name  string   `json:"name"`
+	Expr  string   `json:"expr"`
+	Sides []string `json:"sides,omitempty"` // api and/or csv; both when empty
+}
+
+// Compiled is a parsed and type-checked rule, ready to be evaluated.
+type Compiled struct {
+	Rule
+	root node
+}
+
+// Compile parses a rule and checks that its expression is a well-typed condition.
+func Compile(rule Rule) (*Compiled, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("rules need a name")
+	}
+	for _, side := range rule.Sides {
+		if side != SideAPI && side != SideCSV {
+			return nil, fmt.Errorf("rule %q: unknown side %q", rule.Name, side)
+		}
+	}
+
+	root, err := parse(rule.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+	}
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("rule %q: expression must be a condition, got %s", rule.Name, root.typ())
+	}
+	return &Compiled{Rule: rule, root: root}, nil
+}
+
+// CompileAll compiles a set of rules, which must have distinct names.
+func CompileAll(rules []Rule) ([]*Compiled, error) {
+	compiled := make([]*Compiled, 0, len(rules))
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		c, err := Compile(rule)
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// AppliesTo reports whether the rule is evaluated on records of the given side.
+func (c *Compiled) AppliesTo(side string) bool {
+	if len(c.Sides) == 0 {
+		return true
+	}
+	for _, s := range c.Sides {
+		if s == side {
+			return true
+		}
+	}
+	return false
+}
+
+// Holds reports whether a product satisfies the rule.
+func (c *Compiled) Holds(p *models.Product) bool {
+	return c.root.eval(p).(bool)
+}
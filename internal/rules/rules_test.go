@@ -0,0 +1,112 @@
+package rules
+
+import (
+	"testing"
+
+	"hackathon-go/internal/models"
+)
+
+var product = models.Product{
+	ID:         42,
+	Nome:       "  Cadeira Gamer ",
+	Categoria:  "Móveis",
+	Preco:      129990, // 1299.90
+	Estoque:    3,
+	Fornecedor: "Gamer",
+}
+
+func TestHolds(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"preco > 0", true},
+		{"preco >= 1299.9", true},
+		{"preco == 1299.9", true},
+		{"estoque <= 2", false},
+		{"id % 2 == 0", true},
+		{"preco * estoque < 1e4", true},
+		{"preco * estoque < 3.5e3", false},
+		{"-estoque < 0", true},
+		{"abs(0 - estoque) == 3", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"1 + 2 * 3 == 7", true},
+		{"estoque / 2 == 1.5", true},
+		{"categoria in [\"Móveis\", \"Hardware\"]", true},
+		{"categoria not in ['Móveis']", false},
+		{"id in [1, 2, 42]", true},
+		{"lower(nome) contains lower(fornecedor)", true},
+		{"not (lower(nome) contains lower(fornecedor))", false},
+		{"nome not contains 'Mesa'", true},
+		{"trim(nome) == 'Cadeira Gamer'", true},
+		{"len(trim(nome)) == 13", true},
+		{"len(categoria) == 6", true}, // Runes, not bytes
+		{"upper(fornecedor) == 'GAMER'", true},
+		{"nome matches '^\\\\s*Cadeira'", true},
+		{"fornecedor + '!' == 'Gamer!'", true},
+		{"categoria > 'A'", true},
+		{"preco > 0 and estoque > 5", false},
+		{"preco > 0 && estoque > 5 || id == 42", true},
+		{"estoque > 5 or !(preco > 0)", false},
+		{"not estoque > 5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule, err := Compile(Rule{Name: "test", Expr: tt.expr})
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.expr, err)
+			}
+			p := product
+			if got := rule.Holds(&p); got != tt.want {
+				t.Errorf("%q holds = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"no name", Rule{Expr: "preco > 0"}},
+		{"unknown side", Rule{Name: "r", Expr: "preco > 0", Sides: []string{"erp"}}},
+		{"not a condition", Rule{Name: "r", Expr: "preco + 1"}},
+		{"unknown field", Rule{Name: "r", Expr: "cor == 'azul'"}},
+		{"unknown function", Rule{Name: "r", Expr: "round(preco) > 0"}},
+		{"mixed types", Rule{Name: "r", Expr: "preco == 'caro'"}},
+		{"string arithmetic", Rule{Name: "r", Expr: "nome - 'a' == ''"}},
+		{"function argument", Rule{Name: "r", Expr: "len(preco) > 0"}},
+		{"mixed list", Rule{Name: "r", Expr: "id in [1, 'a']"}},
+		{"list type", Rule{Name: "r", Expr: "nome in [1, 2]"}},
+		{"pattern not literal", Rule{Name: "r", Expr: "nome matches fornecedor"}},
+		{"invalid pattern", Rule{Name: "r", Expr: "nome matches '('"}},
+		{"unterminated string", Rule{Name: "r", Expr: "nome == 'abc"}},
+		{"unexpected character", Rule{Name: "r", Expr: "preco > 0 ; estoque > 0"}},
+		{"trailing tokens", Rule{Name: "r", Expr: "preco > 0 estoque"}},
+		{"unbalanced parenthesis", Rule{Name: "r", Expr: "(preco > 0"}},
+		{"empty", Rule{Name: "r", Expr: ""}},
+		{"not before comparison", Rule{Name: "r", Expr: "nome not == 'a'"}},
+	}
+	for _, tt := range tests {
+		if _, err := Compile(tt.rule); err == nil {
+			t.Errorf("%s: Compile(%q) succeeded", tt.name, tt.rule.Expr)
+		}
+	}
+}
+
+func TestCompileAll(t *testing.T) {
+	if _, err := CompileAll([]Rule{{Name: "a", Expr: "preco > 0"}, {Name: "a", Expr: "estoque > 0"}}); err == nil {
+		t.Error("CompileAll accepted duplicate names")
+	}
+	compiled, err := CompileAll([]Rule{{Name: "a", Expr: "preco > 0"}, {Name: "b", Expr: "estoque > 0", Sides: []string{SideCSV}}})
+	if err != nil {
+		t.Fatalf("CompileAll: %v", err)
+	}
+	if !compiled[0].AppliesTo(SideAPI) || !compiled[0].AppliesTo(SideCSV) {
+		t.Error("a rule without sides doesn't apply to both")
+	}
+	if compiled[1].AppliesTo(SideAPI) || !compiled[1].AppliesTo(SideCSV) {
+		t.Error("a csv rule applies to the wrong sides")
+	}
+}
@@ -0,0 +1,999 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
+)
+
+// Results are stored as a header under the job ID, holding everything but the
+// discrepancies, and the discrepancies in canonical order, split into chunks:
+//
+//	<job>              header (storedResult with Chunked set, or the Link of a job
+//	                   reusing the result of another one)
+//	<job>:chunks       list of the number of discrepancies in each chunk
+//	<job>:chunk:<n>    array of the discrepancies of chunk n
+//	<job>:index:<name> list of the positions of the discrepancies with a given type,
+//	                   field, severity or suppression (see indexNames)
+//	<job>:records      records referenced by the discrepancies
+//	<job>:threeway:chunks, <job>:threeway:chunk:<n>
+//	                   products of a three-way result, chunked the same way
+//
+// The header and chunks are encoded by the payloadCodec of the store (see encoding.go).
+// A page of discrepancies, filtered or not, only reads the chunks holding it.
+
+// chunkSize is the number of discrepancies per chunk.
+const chunkSize = 500
+
+// writeBatchSize bounds the discrepancies written to the backend at once.
+const writeBatchSize = 50 * chunkSize
+
+func chunkDirKey(jobID string) string {
+	return jobID + ":chunks"
+}
+
+func chunkKey(jobID string, n int) string {
+	return jobID + ":chunk:" + strconv.Itoa(n)
+}
+
+func indexKey(jobID, name string) string {
+	return jobID + ":index:" + name
+}
+
+// threeWayKey is the prefix of the chunks of the products of a three-way result, used in
+// place of the job ID with chunkDirKey and chunkKey.
+func threeWayKey(jobID string) string {
+	return jobID + ":threeway"
+}
+
+// isResultKey reports whether a key of a job holds part of its result: the header, chunks,
+// chunk directory, indexes, records, three-way products or legacy discrepancy list.
+func isResultKey(jobID, key string) bool {
+	switch key {
+	case jobID, chunkDirKey(jobID), recordsKey(jobID), jobID + ":errors":
+		return true
+	}
+	return strings.HasPrefix(key, jobID+":chunk:") || strings.HasPrefix(key, jobID+":index:") ||
+		strings.HasPrefix(key, threeWayKey(jobID)+":")
+}
+
+// ErrorQuery selects and orders discrepancies. Type, Field, Severity and Suppressed are
+// served by the secondary indexes of a result; Value and Sort are applied while reading the
+// discrepancies the indexes select. Every criterion that is set must match.
+type ErrorQuery struct {
+	Type       string // Discrepancy type
+	Field      string // Field with a difference
+	Value      string // Substring of the API or CSV value of Field, case-insensitive
+	Severity   string // Severity level
+	Suppressed string // "true" or "false"
+	Sort       string // One of the comparison sort keys, canonical order when empty
+	Desc       bool   // Descending order of Sort
+}
+
+// indexNames returns the indexes the query selects on.
+func (q ErrorQuery) indexNames() []string {
+	var names []string
+	if q.Type != "" {
+		names = append(names, "type:"+q.Type)
+	}
+	if q.Field != "" {
+		names = append(names, "field:"+q.Field)
+	}
+	if q.Severity != "" {
+		names = append(names, "severity:"+q.Severity)
+	}
+	if q.Suppressed != "" {
+		names = append(names, "suppressed:"+q.Suppressed)
+	}
+	return names
+}
+
+// indexed reports whether the indexes alone select the discrepancies, in canonical order.
+func (q ErrorQuery) indexed() bool {
+	return !q.hasValue() && q.Sort == ""
+}
+
+func (q ErrorQuery) hasValue() bool {
+	return q.Field != "" && q.Value != ""
+}
+
+// Matches reports whether a discrepancy meets the query.
+func (q ErrorQuery) Matches(e models.ErrorDetail) bool {
+	if q.Type != "" && e.Type != q.Type {
+		return false
+	}
+	if q.Severity != "" && e.Severity != q.Severity {
+		return false
+	}
+	if q.Suppressed != "" && strconv.FormatBool(e.Suppressed) != q.Suppressed {
+		return false
+	}
+	if q.Field != "" {
+		detail, ok := e.Fields[q.Field]
+		if !ok {
+			return false
+		}
+		if q.Value != "" {
+			value := strings.ToLower(q.Value)
+			if !strings.Contains(strings.ToLower(fmt.Sprint(detail.APIValue)), value) &&
+				!strings.Contains(strings.ToLower(fmt.Sprint(detail.CSVValue)), value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// errorIndexNames returns the indexes a discrepancy belongs to.
+func errorIndexNames(e models.ErrorDetail) []string {
+	names := []string{"type:" + e.Type, "suppressed:" + strconv.FormatBool(e.Suppressed)}
+	for field := range e.Fields {
+		names = append(names, "field:"+field)
+	}
+	if e.Severity != "" {
+		names = append(names, "severity:"+e.Severity)
+	}
+	return names
+}
+
+// chunkBatch is a run of consecutive chunks ready to be written, with the index entries
+// and records of their discrepancies.
+type chunkBatch struct {
+	first   int      // Number of the first chunk
+	chunks  [][]byte // Encoded chunks
+	lengths []int    // Discrepancies per chunk
+	indexes map[string][]int
+	records recordSet
+}
+
+// chunkBackend is what the chunked result layout needs from a storage backend.
+type chunkBackend interface {
+	getHeader(jobID string) ([]byte, error) // ErrNotFound when missing
+	setHeader(jobID string, data []byte, expiration time.Duration) error
+	legacyErrors(jobID string, stored *storedResult) ([]models.ErrorDetail, error)
+	writeChunks(jobID string, batch *chunkBatch, expiration time.Duration) error
+	chunkLengths(jobID string) ([]int, error)
+	readChunks(jobID string, numbers []int) ([][]byte, error) // nil for a missing chunk
+	indexLen(jobID, name string) (int, error)
+	indexRange(jobID, name string, start, stop int) ([]int, error) // stop is inclusive, -1 for the end
+	indexBatch() int                                               // Index entries worth reading at once
+	loadRecords(jobID string, refs []string) (map[string]*models.Product, error)
+	payloads() *payloadCodec // Encodes headers and chunks
+}
+
+// chunkWriter appends discrepancies to the chunks of a job. Every call to WriteErrors
+// starts a new chunk, so chunks are full except the last of each call.
+type chunkWriter struct {
+	b          chunkBackend
+	jobID      string
+	expiration time.Duration
+	position   int // Position of the next discrepancy
+	chunk      int // Number of the next chunk
+}
+
+// WriteErrors appends a batch of discrepancies and refreshes the expiration of the job's keys.
+func (w *chunkWriter) WriteErrors(errors []models.ErrorDetail) error {
+	for start := 0; start < len(errors); start += writeBatchSize {
+		if err := w.writeBatch(errors[start:min(start+writeBatchSize, len(errors))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *chunkWriter) writeBatch(errors []models.ErrorDetail) error {
+	batch := &chunkBatch{first: w.chunk, indexes: make(map[string][]int), records: make(recordSet)}
+	for start := 0; start < len(errors); start += chunkSize {
+		chunk := errors[start:min(start+chunkSize, len(errors))]
+		stored := make([]storedError, len(chunk))
+		for i, e := range chunk {
+			var err error
+			if stored[i], err = batch.records.store(e); err != nil {
+				return err
+			}
+			for _, name := range errorIndexNames(e) {
+				batch.indexes[name] = append(batch.indexes[name], w.position+start+i)
+			}
+		}
+		data, err := w.b.payloads().encode(stored)
+		if err != nil {
+			return err
+		}
+		batch.chunks = append(batch.chunks, data)
+		batch.lengths = append(batch.lengths, len(chunk))
+	}
+
+	if err := w.b.writeChunks(w.jobID, batch, w.expiration); err != nil {
+		return err
+	}
+	w.position += len(errors)
+	w.chunk += len(batch.chunks)
+	return nil
+}
+
+// saveResult stores the discrepancies of a result in chunks, then the products of a
+// three-way result, then its header. Streamed results already had their discrepancies
+// appended through an ErrorWriter.
+func saveResult(b chunkBackend, jobID string, result *models.ComparisonResult, expiration time.Duration) error {
+	if !result.Streamed {
+		w := &chunkWriter{b: b, jobID: jobID, expiration: expiration}
+		if err := w.WriteErrors(result.Errors); err != nil {
+			return err
+		}
+	}
+
+	header := storedResult{ComparisonResult: result, Chunked: true}
+	if result.ThreeWay != nil {
+		if err := writeThreeWay(b, jobID, result.ThreeWay.Products, expiration); err != nil {
+			return err
+		}
+		headerResult := *result
+		headerResult.ThreeWay = &models.ThreeWayResult{Summary: result.ThreeWay.Summary}
+		header = storedResult{ComparisonResult: &headerResult, Chunked: true, ThreeWayChunked: true}
+	}
+	data, err := b.payloads().encode(header)
+	if err != nil {
+		return err
+	}
+	return b.setHeader(jobID, data, expiration)
+}
+
+// writeThreeWay stores the products of a three-way result in chunks.
+func writeThreeWay(b chunkBackend, jobID string, products []models.ThreeWayProduct, expiration time.Duration) error {
+	for first := 0; first < len(products); first += writeBatchSize {
+		batch := &chunkBatch{first: first / chunkSize, indexes: map[string][]int{}}
+		end := min(first+writeBatchSize, len(products))
+		for start := first; start < end; start += chunkSize {
+			chunk := products[start:min(start+chunkSize, end)]
+			data, err := b.payloads().encode(chunk)
+			if err != nil {
+				return err
+			}
+			batch.chunks = append(batch.chunks, data)
+			batch.lengths = append(batch.lengths, len(chunk))
+		}
+		if err := b.writeChunks(threeWayKey(jobID), batch, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkResult stores the header of a job reusing the result of another one.
+func linkResult(b chunkBackend, jobID, targetID string, expiration time.Duration) error {
+	data, err := b.payloads().encode(storedResult{Link: targetID})
+	if err != nil {
+		return err
+	}
+	return b.setHeader(jobID, data, expiration)
+}
+
+// loadHeader reads the header of a result, following the link of a job reusing the result
+// of another one. It returns the job holding the discrepancies; links are not chained.
+// The Errors of the result are nil.
+func loadHeader(b chunkBackend, jobID string) (*models.ComparisonResult, *storedResult, string, error) {
+	data, err := b.getHeader(jobID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var result models.ComparisonResult
+	stored := storedResult{ComparisonResult: &result}
+	if err := b.payloads().decode(data, &stored); err != nil {
+		return nil, nil, "", err
+	}
+
+	if stored.Link != "" {
+		jobID = stored.Link
+		if data, err = b.getHeader(jobID); err != nil {
+			return nil, nil, "", err
+		}
+		result = models.ComparisonResult{}
+		stored = storedResult{ComparisonResult: &result}
+		if err := b.payloads().decode(data, &stored); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	result.Errors = nil
+	return &result, &stored, jobID, nil
+}
+
+// resultLink returns the job whose result a job reuses, empty when it has its own.
+func resultLink(b chunkBackend, jobID string) (string, error) {
+	data, err := b.getHeader(jobID)
+	if err != nil {
+		return "", err
+	}
+	var stored storedResult
+	if err := b.payloads().decode(data, &stored); err != nil {
+		return "", err
+	}
+	return stored.Link, nil
+}
+
+// getResult reads a result with every discrepancy, and every product of a three-way result.
+func getResult(b chunkBackend, jobID string) (*models.ComparisonResult, error) {
+	result, stored, jobID, err := loadHeader(b, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Chunked {
+		result.Errors, err = readAllErrors(b, jobID)
+	} else {
+		result.Errors, err = b.legacyErrors(jobID, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.ThreeWayChunked {
+		if result.ThreeWay.Products, _, err = readThreeWay(b, jobID, ThreeWayQuery{}, 0, -1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ThreeWayQuery selects products of a three-way result. Every criterion that is set must match.
+type ThreeWayQuery struct {
+	Status   string // Three-way status, e.g. changed_upstream
+	Conflict bool   // Conflicting products only
+	Field    string // Products with a change in this field
+}
+
+// Matches reports whether a product meets the query.
+func (q ThreeWayQuery) Matches(p models.ThreeWayProduct) bool {
+	if q.Status != "" && p.Status != q.Status {
+		return false
+	}
+	if q.Conflict && !p.Conflict {
+		return false
+	}
+	if q.Field != "" {
+		if _, ok := p.Fields[q.Field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// getThreeWay reads the summary of a three-way result and a page of its products matching
+// q, with the number of matching products. The result is nil for a job that was not
+// compared in three-way mode.
+func getThreeWay(b chunkBackend, jobID string, q ThreeWayQuery, offset, limit int) (*models.ThreeWayResult, int, error) {
+	result, stored, jobID, err := loadHeader(b, jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if result.ThreeWay == nil {
+		return nil, 0, nil
+	}
+
+	threeWay := &models.ThreeWayResult{Summary: result.ThreeWay.Summary}
+	var total int
+	if stored.ThreeWayChunked {
+		threeWay.Products, total, err = readThreeWay(b, jobID, q, offset, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		return threeWay, total, nil
+	}
+
+	// Stored with the products in the header
+	threeWay.Products = []models.ThreeWayProduct{}
+	for _, p := range result.ThreeWay.Products {
+		if !q.Matches(p) {
+			continue
+		}
+		if total >= offset && (limit < 0 || total < offset+limit) {
+			threeWay.Products = append(threeWay.Products, p)
+		}
+		total++
+	}
+	return threeWay, total, nil
+}
+
+// readThreeWay returns the products of a three-way result matching q, from offset and at
+// most limit of them (all when negative), with the number of matching ones. Without
+// criteria only the chunks of the page are read; otherwise every chunk is, one at a time.
+func readThreeWay(b chunkBackend, jobID string, q ThreeWayQuery, offset, limit int) ([]models.ThreeWayProduct, int, error) {
+	key := threeWayKey(jobID)
+	lengths, err := b.chunkLengths(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	layout := newChunkLayout(lengths)
+	inPage := func(i int) bool { return i >= offset && (limit < 0 || i < offset+limit) }
+
+	products := []models.ThreeWayProduct{}
+	matching := 0
+	for n := range lengths {
+		if q == (ThreeWayQuery{}) {
+			// Positions are matches: skip the chunks before the page, stop after it
+			if layout.starts[n]+lengths[n] <= offset {
+				continue
+			}
+			if limit >= 0 && layout.starts[n] >= offset+limit {
+				break
+			}
+		}
+		data, err := b.readChunks(key, []int{n})
+		if err != nil {
+			return nil, 0, err
+		}
+		if data[0] == nil {
+			continue // Chunk expired
+		}
+		var chunk []models.ThreeWayProduct
+		if err := b.payloads().decode(data[0], &chunk); err != nil {
+			return nil, 0, err
+		}
+		for i, p := range chunk {
+			if q == (ThreeWayQuery{}) {
+				if inPage(layout.starts[n] + i) {
+					products = append(products, p)
+				}
+				continue
+			}
+			if !q.Matches(p) {
+				continue
+			}
+			if inPage(matching) {
+				products = append(products, p)
+			}
+			matching++
+		}
+	}
+	if q == (ThreeWayQuery{}) {
+		return products, layout.total, nil
+	}
+	return products, matching, nil
+}
+
+// getResultSummary reads a result without its discrepancies.
+func getResultSummary(b chunkBackend, jobID string) (*models.ComparisonResult, error) {
+	result, _, _, err := loadHeader(b, jobID)
+	return result, err
+}
+
+// getErrors reads a page of the discrepancies of a result matching q. Results stored
+// before chunking have no indexes and are filtered in memory.
+func getErrors(b chunkBackend, jobID string, q ErrorQuery, offset, limit int) ([]models.ErrorDetail, int, error) {
+	less, err := q.less()
+	if err != nil {
+		return nil, 0, err
+	}
+	_, stored, jobID, err := loadHeader(b, jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if stored.Chunked {
+		return readErrors(b, jobID, q, less, offset, limit)
+	}
+
+	all, err := b.legacyErrors(jobID, stored)
+	if err != nil {
+		return nil, 0, err
+	}
+	page := newErrorPage(less, offset, limit)
+	for i, e := range all {
+		if q.Matches(e) {
+			page.add(i, storedError{ErrorDetail: e})
+		}
+	}
+	return restoreErrors(page.errors(), nil), page.total, nil
+}
+
+// less returns the order of the query's Sort key, nil for the canonical order.
+func (q ErrorQuery) less() (func(a, b models.ErrorDetail) bool, error) {
+	if q.Sort == "" {
+		return nil, nil
+	}
+	return comparison.ErrorLess(q.Sort, q.Desc)
+}
+
+// chunkLayout locates discrepancies by position.
+type chunkLayout struct {
+	starts []int // Position of the first discrepancy of each chunk
+	total  int
+}
+
+func newChunkLayout(lengths []int) chunkLayout {
+	layout := chunkLayout{starts: make([]int, len(lengths))}
+	for i, n := range lengths {
+		layout.starts[i] = layout.total
+		layout.total += n
+	}
+	return layout
+}
+
+// chunkOf returns the chunk holding a position and the position within the chunk.
+func (l chunkLayout) chunkOf(position int) (int, int) {
+	n := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > position }) - 1
+	return n, position - l.starts[n]
+}
+
+// readAllErrors reads every discrepancy of a chunked result.
+func readAllErrors(b chunkBackend, jobID string) ([]models.ErrorDetail, error) {
+	lengths, err := b.chunkLengths(jobID)
+	if err != nil {
+		return nil, err
+	}
+	layout := newChunkLayout(lengths)
+	positions := make([]int, layout.total)
+	for i := range positions {
+		positions[i] = i
+	}
+	return readPositions(b, jobID, layout, positions)
+}
+
+// scanBatch is the number of positions read from an index, and of discrepancies
+// checked against a query, at once.
+const scanBatch = 10 * chunkSize
+
+// readErrors returns the discrepancies of a chunked result matching q, from offset and at
+// most limit of them (all when limit is negative), with the number of matching ones.
+//
+// A single index criterion is served from its index. Several are intersected on their
+// indexes, a batch of positions at a time, and only the chunks of the page are read.
+// A value filter or a sort order needs the discrepancies the indexes select: they are read
+// a batch at a time. In canonical order only the page is kept; a sort order keeps the first
+// offset+limit discrepancies in that order, so deep pages of sorted queries hold more than
+// the page. Readers of whole results use an ErrorIterator instead.
+func readErrors(b chunkBackend, jobID string, q ErrorQuery, less func(a, b models.ErrorDetail) bool, offset, limit int) ([]models.ErrorDetail, int, error) {
+	lengths, err := b.chunkLengths(jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	layout := newChunkLayout(lengths)
+	stop := func(total int) int {
+		if limit < 0 {
+			return total - 1
+		}
+		return min(offset+limit, total) - 1
+	}
+
+	names := q.indexNames()
+	if q.indexed() && len(names) == 0 {
+		var positions []int
+		for p := offset; p <= stop(layout.total); p++ {
+			positions = append(positions, p)
+		}
+		errors, err := readPositions(b, jobID, layout, positions)
+		return errors, layout.total, err
+	}
+	if q.indexed() && len(names) == 1 {
+		total, err := b.indexLen(jobID, names[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		if offset >= total || limit == 0 {
+			return []models.ErrorDetail{}, total, nil
+		}
+		positions, err := b.indexRange(jobID, names[0], offset, stop(total))
+		if err != nil {
+			return nil, 0, err
+		}
+		errors, err := readPositions(b, jobID, layout, positions)
+		return errors, total, err
+	}
+
+	if q.indexed() {
+		var page []int
+		total := 0
+		err := walkPositions(b, jobID, layout, names, func(positions []int) error {
+			for _, p := range positions {
+				if total >= offset && (limit < 0 || total < offset+limit) {
+					page = append(page, p)
+				}
+				total++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		errors, err := readPositions(b, jobID, layout, page)
+		return errors, total, err
+	}
+
+	page := newErrorPage(less, offset, limit)
+	err = walkPositions(b, jobID, layout, names, func(positions []int) error {
+		stored, kept, err := readStored(b, jobID, layout, positions)
+		if err != nil {
+			return err
+		}
+		for i, e := range stored {
+			if q.Matches(e.ErrorDetail) {
+				page.add(kept[i], e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	errors, err := restoreRecords(b, jobID, page.errors())
+	return errors, page.total, err
+}
+
+// ErrorIterator reads the discrepancies of a result matching a query in canonical order,
+// a batch at a time, so only one batch is held in memory. The query's Sort is ignored.
+type ErrorIterator struct {
+	b      chunkBackend
+	jobID  string
+	q      ErrorQuery
+	layout chunkLayout
+	walker *positionWalker
+	legacy []models.ErrorDetail // Matching discrepancies of a result stored before chunking
+}
+
+// readErrorsInOrder returns an iterator over the discrepancies of a result matching q.
+// Results stored before chunking are read at once.
+func readErrorsInOrder(b chunkBackend, jobID string, q ErrorQuery) (*ErrorIterator, error) {
+	_, stored, jobID, err := loadHeader(b, jobID)
+	if err != nil {
+		return nil, err
+	}
+	it := &ErrorIterator{b: b, jobID: jobID, q: q}
+	if !stored.Chunked {
+		all, err := b.legacyErrors(jobID, stored)
+		if err != nil {
+			return nil, err
+		}
+		comparison.SortErrors(all)
+		it.legacy = []models.ErrorDetail{}
+		for _, e := range all {
+			if q.Matches(e) {
+				it.legacy = append(it.legacy, e)
+			}
+		}
+		return it, nil
+	}
+
+	lengths, err := b.chunkLengths(jobID)
+	if err != nil {
+		return nil, err
+	}
+	it.layout = newChunkLayout(lengths)
+	if it.walker, err = newPositionWalker(b, jobID, it.layout, q.indexNames()); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// Next returns the next discrepancies, at most a scan batch of them, none at the end.
+func (it *ErrorIterator) Next() ([]models.ErrorDetail, error) {
+	if it.walker == nil {
+		batch := it.legacy[:min(scanBatch, len(it.legacy))]
+		it.legacy = it.legacy[len(batch):]
+		return batch, nil
+	}
+	for {
+		positions, err := it.walker.next()
+		if err != nil || positions == nil {
+			return nil, err
+		}
+		stored, _, err := readStored(it.b, it.jobID, it.layout, positions)
+		if err != nil {
+			return nil, err
+		}
+		matching := stored[:0]
+		for _, e := range stored {
+			if it.q.Matches(e.ErrorDetail) {
+				matching = append(matching, e)
+			}
+		}
+		if len(matching) > 0 {
+			return restoreRecords(it.b, it.jobID, matching)
+		}
+	}
+}
+
+// walkPositions calls visit with the positions selected by every named index, or every
+// position without any, in ascending order and at most scanBatch at a time.
+func walkPositions(b chunkBackend, jobID string, layout chunkLayout, names []string, visit func(positions []int) error) error {
+	w, err := newPositionWalker(b, jobID, layout, names)
+	if err != nil {
+		return err
+	}
+	for {
+		positions, err := w.next()
+		if err != nil || positions == nil {
+			return err
+		}
+		if err := visit(positions); err != nil {
+			return err
+		}
+	}
+}
+
+// positionWalker reads the positions selected by every named index, or every position
+// without any, in ascending order. The smallest index drives the walk; the others are read
+// alongside it.
+type positionWalker struct {
+	layout chunkLayout
+	driver *indexCursor // Nil without indexes
+	others []*indexCursor
+	start  int // Next position, or entry of the driver, to read
+}
+
+func newPositionWalker(b chunkBackend, jobID string, layout chunkLayout, names []string) (*positionWalker, error) {
+	w := &positionWalker{layout: layout}
+	if len(names) == 0 {
+		return w, nil
+	}
+	cursors := make([]*indexCursor, len(names))
+	for i, name := range names {
+		n, err := b.indexLen(jobID, name)
+		if err != nil {
+			return nil, err
+		}
+		cursors[i] = &indexCursor{b: b, jobID: jobID, name: name, len: n}
+	}
+	sort.Slice(cursors, func(i, j int) bool { return cursors[i].len < cursors[j].len })
+	w.driver, w.others = cursors[0], cursors[1:]
+	return w, nil
+}
+
+// next returns the next selected positions, at most scanBatch of them, nil once every
+// position was walked.
+func (w *positionWalker) next() ([]int, error) {
+	if w.driver == nil {
+		if w.start >= w.layout.total {
+			return nil, nil
+		}
+		end := min(w.start+scanBatch, w.layout.total)
+		positions := make([]int, 0, end-w.start)
+		for p := w.start; p < end; p++ {
+			positions = append(positions, p)
+		}
+		w.start = end
+		return positions, nil
+	}
+
+	for w.start < w.driver.len {
+		positions, err := w.driver.read(w.start, scanBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(positions) == 0 {
+			break
+		}
+		w.start += scanBatch
+		selected := positions[:0:0]
+		for _, p := range positions {
+			in := true
+			for _, c := range w.others {
+				if in, err = c.contains(p); err != nil {
+					return nil, err
+				}
+				if !in {
+					break
+				}
+			}
+			if in {
+				selected = append(selected, p)
+			}
+		}
+		if len(selected) > 0 {
+			return selected, nil
+		}
+	}
+	return nil, nil
+}
+
+// indexCursor reads an index forward, indexBatch entries of the backend at a time.
+type indexCursor struct {
+	b     chunkBackend
+	jobID string
+	name  string
+	len   int
+	next  int   // Position in the index of the first entry after buf
+	buf   []int // Entries read and not passed yet
+
+	fetched      []int // Entries read for read, from fetchedStart
+	fetchedStart int
+}
+
+// read returns n entries of the index from start. Entries are read in order.
+func (c *indexCursor) read(start, n int) ([]int, error) {
+	if start < c.fetchedStart || start+n > c.fetchedStart+len(c.fetched) {
+		fetched, err := c.b.indexRange(c.jobID, c.name, start, min(start+max(n, c.b.indexBatch()), c.len)-1)
+		if err != nil {
+			return nil, err
+		}
+		c.fetched, c.fetchedStart = fetched, start
+	}
+	from := start - c.fetchedStart
+	return c.fetched[from:min(from+n, len(c.fetched))], nil
+}
+
+// contains reports whether the index holds position p. Positions must be asked in
+// ascending order.
+func (c *indexCursor) contains(p int) (bool, error) {
+	for {
+		for len(c.buf) > 0 && c.buf[0] < p {
+			c.buf = c.buf[1:]
+		}
+		if len(c.buf) > 0 {
+			return c.buf[0] == p, nil
+		}
+		if c.next >= c.len {
+			return false, nil
+		}
+		positions, err := c.read(c.next, scanBatch)
+		if err != nil {
+			return false, err
+		}
+		if len(positions) == 0 {
+			return false, nil
+		}
+		c.next += len(positions)
+		c.buf = positions
+	}
+}
+
+// errorPage collects the page of a scan: the discrepancies from offset, at most limit of
+// them (all when limit is negative), in canonical order or the order of less. In order, it
+// keeps the first offset+limit discrepancies seen in a heap.
+type errorPage struct {
+	less          func(a, b models.ErrorDetail) bool
+	offset, limit int
+	total         int // Discrepancies added
+	items         []pagedError
+}
+
+// pagedError is a discrepancy of a page with its position in the result, which breaks ties.
+type pagedError struct {
+	position int
+	stored   storedError
+}
+
+func newErrorPage(less func(a, b models.ErrorDetail) bool, offset, limit int) *errorPage {
+	return &errorPage{less: less, offset: offset, limit: limit}
+}
+
+// before reports whether a comes before b in the page's order.
+func (pg *errorPage) before(a, b pagedError) bool {
+	if pg.less != nil {
+		if pg.less(a.stored.ErrorDetail, b.stored.ErrorDetail) {
+			return true
+		}
+		if pg.less(b.stored.ErrorDetail, a.stored.ErrorDetail) {
+			return false
+		}
+	}
+	return a.position < b.position
+}
+
+// add offers a matching discrepancy to the page. Discrepancies are added in position order.
+func (pg *errorPage) add(position int, e storedError) {
+	pg.total++
+	item := pagedError{position: position, stored: e}
+	if pg.less == nil {
+		if pg.total > pg.offset && (pg.limit < 0 || pg.total <= pg.offset+pg.limit) {
+			pg.items = append(pg.items, item)
+		}
+		return
+	}
+	if pg.limit < 0 {
+		pg.items = append(pg.items, item)
+		return
+	}
+	keep := pg.offset + pg.limit
+	if keep == 0 {
+		return
+	}
+	if len(pg.items) < keep {
+		heap.Push((*pageHeap)(pg), item)
+		return
+	}
+	if pg.before(item, pg.items[0]) {
+		pg.items[0] = item
+		heap.Fix((*pageHeap)(pg), 0)
+	}
+}
+
+// errors returns the discrepancies of the page, in order.
+func (pg *errorPage) errors() []storedError {
+	if pg.less != nil {
+		sort.Slice(pg.items, func(i, j int) bool { return pg.before(pg.items[i], pg.items[j]) })
+	}
+	items := pg.items
+	if pg.less != nil {
+		items = items[min(pg.offset, len(items)):]
+	}
+	stored := make([]storedError, len(items))
+	for i, item := range items {
+		stored[i] = item.stored
+	}
+	return stored
+}
+
+// pageHeap is the heap of a sorted page, its last discrepancy at the root.
+type pageHeap errorPage
+
+func (h *pageHeap) Len() int           { return len(h.items) }
+func (h *pageHeap) Less(i, j int) bool { return (*errorPage)(h).before(h.items[j], h.items[i]) }
+func (h *pageHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *pageHeap) Push(x interface{}) { h.items = append(h.items, x.(pagedError)) }
+func (h *pageHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+// readPositions reads the discrepancies at the given positions, in that order, with their
+// records.
+func readPositions(b chunkBackend, jobID string, layout chunkLayout, positions []int) ([]models.ErrorDetail, error) {
+	if len(positions) == 0 {
+		return []models.ErrorDetail{}, nil
+	}
+	stored, _, err := readStored(b, jobID, layout, positions)
+	if err != nil {
+		return nil, err
+	}
+	return restoreRecords(b, jobID, stored)
+}
+
+// readStored reads the stored discrepancies at the given positions, in that order, and
+// the positions read. Positions past the end or in an expired chunk are skipped.
+func readStored(b chunkBackend, jobID string, layout chunkLayout, positions []int) ([]storedError, []int, error) {
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, p := range positions {
+		if p < 0 || p >= layout.total {
+			continue
+		}
+		if n, _ := layout.chunkOf(p); !seen[n] {
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+	data, err := b.readChunks(jobID, numbers)
+	if err != nil {
+		return nil, nil, err
+	}
+	chunks := make(map[int][]storedError, len(numbers))
+	for i, n := range numbers {
+		if data[i] == nil {
+			continue // Chunk expired
+		}
+		var chunk []storedError
+		if err := b.payloads().decode(data[i], &chunk); err != nil {
+			return nil, nil, err
+		}
+		chunks[n] = chunk
+	}
+
+	stored := make([]storedError, 0, len(positions))
+	kept := make([]int, 0, len(positions))
+	for _, p := range positions {
+		if p < 0 || p >= layout.total {
+			continue
+		}
+		n, i := layout.chunkOf(p)
+		if i < len(chunks[n]) {
+			stored = append(stored, chunks[n][i])
+			kept = append(kept, p)
+		}
+	}
+	return stored, kept, nil
+}
+
+// restoreRecords puts the records of the job back into stored discrepancies.
+func restoreRecords(b chunkBackend, jobID string, stored []storedError) ([]models.ErrorDetail, error) {
+	var records map[string]*models.Product
+	if refs := recordRefs(stored); len(refs) > 0 {
+		var err error
+		if records, err = b.loadRecords(jobID, refs); err != nil {
+			return nil, err
+		}
+	}
+	return restoreErrors(stored, records), nil
+}
@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
+)
+
+// testErrors returns n discrepancies in canonical order, spread over types, fields and
+// severities, some with an embedded record.
+func testErrors(n int) []models.ErrorDetail {
+	types := []string{"mismatch", "near_match", "missing_in_api", "missing_in_csv"}
+	severities := []string{"low", "medium", "high", "critical"}
+	fields := []string{"nome", "preco", "estoque"}
+	errors := make([]models.ErrorDetail, n)
+	for i := range errors {
+		e := models.ErrorDetail{
+			Type:          types[i%len(types)],
+			APIID:         i + 1,
+			CSVLine:       i + 2,
+			Nome:          fmt.Sprintf("Produto %d", i),
+			Severity:      severities[(i/3)%len(severities)],
+			SeverityScore: float64((i * 7) % 100),
+			Suppressed:    i%10 == 0,
+		}
+		if e.Type == "mismatch" || e.Type == "near_match" {
+			field := fields[(i/4)%len(fields)]
+			delta := float64((i * 13) % 97)
+			e.Fields = map[string]models.MismatchDetail{
+				field: {APIValue: fmt.Sprintf("api-%d", i%7), CSVValue: fmt.Sprintf("csv-%d", i%5), AbsDelta: &delta},
+			}
+		}
+		if i%5 == 0 {
+			e.APIRecord = &models.Product{ID: i + 1, Nome: e.Nome}
+		}
+		errors[i] = e
+	}
+	return errors
+}
+
+// expectedErrors selects a page the way GetErrors should, from every discrepancy in memory.
+func expectedErrors(t *testing.T, all []models.ErrorDetail, q ErrorQuery, offset, limit int) ([]models.ErrorDetail, int) {
+	t.Helper()
+	var matching []models.ErrorDetail
+	for _, e := range all {
+		if q.Matches(e) {
+			matching = append(matching, e)
+		}
+	}
+	if q.Sort != "" {
+		if err := comparison.SortErrorsBy(matching, q.Sort, q.Desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := len(matching)
+	start := min(offset, total)
+	end := total
+	if limit >= 0 {
+		end = min(start+limit, total)
+	}
+	return append([]models.ErrorDetail{}, matching[start:end]...), total
+}
+
+func TestGetErrors(t *testing.T) {
+	// More discrepancies than a scan batch, so intersections and scans span several
+	all := testErrors(scanBatch + 2*chunkSize + 17)
+	tests := []struct {
+		name          string
+		q             ErrorQuery
+		offset, limit int
+	}{
+		{"first page", ErrorQuery{}, 0, 100},
+		{"page across chunks", ErrorQuery{}, chunkSize - 10, 20},
+		{"past the end", ErrorQuery{}, len(all) + 5, 10},
+		{"everything", ErrorQuery{}, 0, -1},
+		{"count only", ErrorQuery{Type: "mismatch"}, 0, 0},
+		{"one index", ErrorQuery{Type: "near_match"}, 300, 50},
+		{"two indexes", ErrorQuery{Type: "mismatch", Field: "preco"}, 0, 30},
+		{"two indexes deep page", ErrorQuery{Type: "mismatch", Field: "preco"}, 400, 30},
+		{"three indexes", ErrorQuery{Type: "mismatch", Severity: "high", Suppressed: "false"}, 10, 25},
+		{"empty intersection", ErrorQuery{Type: "missing_in_api", Field: "preco"}, 0, 10},
+		{"value", ErrorQuery{Field: "nome", Value: "API-3"}, 5, 20},
+		{"value without field", ErrorQuery{Value: "api-3"}, 0, 10},
+		{"value and type", ErrorQuery{Type: "near_match", Field: "estoque", Value: "csv-1"}, 0, -1},
+		{"sort", ErrorQuery{Sort: comparison.SortBySeverity, Desc: true}, 0, 40},
+		{"sort deep page", ErrorQuery{Sort: comparison.SortBySeverity}, 3000, 40},
+		{"sort with missing keys", ErrorQuery{Sort: comparison.SortByPriceDelta, Desc: true}, len(all) - 30, 40},
+		{"sort and filters", ErrorQuery{Type: "mismatch", Field: "preco", Sort: comparison.SortByPriceDelta, Desc: true}, 0, 25},
+		{"sort, value and everything", ErrorQuery{Field: "preco", Value: "csv-2", Sort: comparison.SortByCSVLine, Desc: true}, 3, -1},
+		{"sort count only", ErrorQuery{Sort: comparison.SortByAPIID}, 10, 0},
+	}
+
+	for name, s := range testStores(t) {
+		if err := s.SaveResult("job", &models.ComparisonResult{Errors: all}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				got, total, err := s.GetErrors("job", tt.q, tt.offset, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, wantTotal := expectedErrors(t, all, tt.q, tt.offset, tt.limit)
+				if total != wantTotal {
+					t.Errorf("total = %d, want %d", total, wantTotal)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("got %d discrepancies, want %d", len(got), len(want))
+				}
+				for i := range got {
+					if !reflect.DeepEqual(got[i], want[i]) {
+						t.Fatalf("discrepancy %d = %+v, want %+v", i, got[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGetErrorsRejectsUnknownSort(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.SaveResult("job", &models.ComparisonResult{Errors: testErrors(3)}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetErrors("job", ErrorQuery{Sort: "nome"}, 0, 10); err == nil {
+		t.Error("GetErrors accepted an unknown sort key")
+	}
+}
+
+func TestGetErrorsStreamed(t *testing.T) {
+	all := testErrors(3*chunkSize + 40)
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// Every write starts a chunk, so chunks are not all full
+			w := s.NewErrorWriter("job", time.Hour)
+			for _, batch := range [][]models.ErrorDetail{all[:10], all[10 : chunkSize+30], all[chunkSize+30:]} {
+				if err := w.WriteErrors(batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.SaveResult("job", &models.ComparisonResult{Streamed: true}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, q := range []ErrorQuery{{}, {Type: "mismatch", Field: "nome"}, {Sort: comparison.SortBySeverity}} {
+				got, total, err := s.GetErrors("job", q, 5, chunkSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, wantTotal := expectedErrors(t, all, q, 5, chunkSize)
+				if total != wantTotal || !reflect.DeepEqual(got, want) {
+					t.Errorf("%+v: got %d of %d discrepancies, want %d of %d", q, len(got), total, len(want), wantTotal)
+				}
+			}
+
+			result, err := s.GetResult("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Errors, all) {
+				t.Errorf("GetResult returned %d discrepancies, want %d", len(result.Errors), len(all))
+			}
+		})
+	}
+}
+
+func TestGetErrorsLegacy(t *testing.T) {
+	s := NewMemoryStore().(*kvStore)
+	all := testErrors(30)
+	stored := storedResult{ComparisonResult: &models.ComparisonResult{}}
+	for _, e := range all {
+		stored.Errors = append(stored.Errors, storedError{ErrorDetail: e})
+	}
+	data, err := s.codec.encode(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setHeader("job", data, 0)
+
+	q := ErrorQuery{Field: "preco", Sort: comparison.SortByPriceDelta, Desc: true}
+	got, total, err := s.GetErrors("job", q, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantTotal := expectedErrors(t, all, q, 1, 3)
+	if total != wantTotal || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v (%d), want %+v (%d)", got, total, want, wantTotal)
+	}
+}
+
+// readAll reads every discrepancy of an iterator, checking the size of its batches.
+func readAll(t *testing.T, it *ErrorIterator) []models.ErrorDetail {
+	t.Helper()
+	var all []models.ErrorDetail
+	for {
+		batch, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) == 0 {
+			return all
+		}
+		if len(batch) > scanBatch {
+			t.Fatalf("batch of %d discrepancies, want at most %d", len(batch), scanBatch)
+		}
+		all = append(all, batch...)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	all := testErrors(scanBatch + 2*chunkSize + 17)
+	queries := []ErrorQuery{
+		{},
+		{Type: "near_match"},
+		{Type: "mismatch", Field: "preco"},
+		{Field: "nome", Value: "API-3"},
+		{Type: "missing_in_api", Field: "preco"},
+		{Sort: comparison.SortBySeverity}, // Ignored
+	}
+	for name, s := range testStores(t) {
+		if err := s.SaveResult("job", &models.ComparisonResult{Errors: all}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range queries {
+			t.Run(fmt.Sprintf("%s/%+v", name, q), func(t *testing.T) {
+				it, err := s.ReadErrors("job", q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, _ := expectedErrors(t, all, ErrorQuery{Type: q.Type, Field: q.Field, Value: q.Value}, 0, -1)
+				if got := readAll(t, it); len(got) != len(want) || len(got) > 0 && !reflect.DeepEqual(got, want) {
+					t.Errorf("read %d discrepancies, want %d", len(got), len(want))
+				}
+			})
+		}
+	}
+
+	if _, err := NewMemoryStore().ReadErrors("missing", ErrorQuery{}); err != ErrNotFound {
+		t.Errorf("ReadErrors of a missing job: %v, want ErrNotFound", err)
+	}
+}
+
+func TestReadErrorsLegacy(t *testing.T) {
+	s := NewMemoryStore().(*kvStore)
+	all := testErrors(30)
+	stored := storedResult{ComparisonResult: &models.ComparisonResult{}}
+	// Stored out of order: they are read in canonical order
+	for i := len(all) - 1; i >= 0; i-- {
+		stored.Errors = append(stored.Errors, storedError{ErrorDetail: all[i]})
+	}
+	data, err := s.codec.encode(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setHeader("job", data, 0)
+
+	it, err := s.ReadErrors("job", ErrorQuery{Type: "mismatch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := expectedErrors(t, all, ErrorQuery{Type: "mismatch"}, 0, -1)
+	if got := readAll(t, it); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func testThreeWay(n int) *models.ThreeWayResult {
+	statuses := []string{"changed_locally", "changed_upstream", "changed_both"}
+	threeWay := &models.ThreeWayResult{Summary: models.ThreeWaySummary{TotalAPI: n}}
+	for i := 0; i < n; i++ {
+		p := models.ThreeWayProduct{ID: i + 1, Nome: fmt.Sprintf("Produto %d", i), Status: statuses[i%3], Conflict: i%7 == 0}
+		if i%2 == 0 {
+			p.Fields = map[string]models.ThreeWayField{"preco": {Base: "1", Local: "2", Upstream: "1", Changed: "local"}}
+		}
+		threeWay.Products = append(threeWay.Products, p)
+	}
+	return threeWay
+}
+
+func TestGetThreeWay(t *testing.T) {
+	threeWay := testThreeWay(2*chunkSize + 33)
+	tests := []struct {
+		name          string
+		q             ThreeWayQuery
+		offset, limit int
+	}{
+		{"first page", ThreeWayQuery{}, 0, 100},
+		{"page across chunks", ThreeWayQuery{}, chunkSize - 5, 10},
+		{"last chunk", ThreeWayQuery{}, 2 * chunkSize, 100},
+		{"past the end", ThreeWayQuery{}, 5000, 10},
+		{"status", ThreeWayQuery{Status: "changed_both"}, 100, 50},
+		{"conflicts with a field", ThreeWayQuery{Conflict: true, Field: "preco"}, 0, -1},
+	}
+
+	for name, s := range testStores(t) {
+		result := &models.ComparisonResult{ThreeWay: threeWay}
+		if err := s.SaveResult("job", result, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.ThreeWay.Products) != len(threeWay.Products) {
+			t.Fatal("SaveResult changed the result it saved")
+		}
+
+		summary, err := s.GetResultSummary("job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.ThreeWay == nil || summary.ThreeWay.Products != nil || summary.ThreeWay.Summary.TotalAPI != len(threeWay.Products) {
+			t.Errorf("%s: summary three-way = %+v, want the summary alone", name, summary.ThreeWay)
+		}
+		full, err := s.GetResult("job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(full.ThreeWay.Products, threeWay.Products) {
+			t.Errorf("%s: GetResult returned %d three-way products, want %d", name, len(full.ThreeWay.Products), len(threeWay.Products))
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				got, total, err := s.GetThreeWay("job", tt.q, tt.offset, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var matching []models.ThreeWayProduct
+				for _, p := range threeWay.Products {
+					if tt.q.Matches(p) {
+						matching = append(matching, p)
+					}
+				}
+				start := min(tt.offset, len(matching))
+				end := len(matching)
+				if tt.limit >= 0 {
+					end = min(start+tt.limit, end)
+				}
+				want := append([]models.ThreeWayProduct{}, matching[start:end]...)
+				if total != len(matching) || !reflect.DeepEqual(got.Products, want) {
+					t.Errorf("got %d of %d products, want %d of %d", len(got.Products), total, len(want), len(matching))
+				}
+				if got.Summary.TotalAPI != len(threeWay.Products) {
+					t.Errorf("summary = %+v", got.Summary)
+				}
+			})
+		}
+	}
+}
+
+func TestGetThreeWayWithoutThreeWay(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.SaveResult("job", &models.ComparisonResult{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if threeWay, _, err := s.GetThreeWay("job", ThreeWayQuery{}, 0, 10); err != nil || threeWay != nil {
+		t.Errorf("GetThreeWay = %+v, %v, want nil", threeWay, err)
+	}
+	if _, _, err := s.GetThreeWay("missing", ThreeWayQuery{}, 0, 10); err != ErrNotFound {
+		t.Errorf("GetThreeWay of a missing job: %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetThreeWayLegacy(t *testing.T) {
+	s := NewMemoryStore().(*kvStore)
+	threeWay := testThreeWay(20)
+	data, err := s.codec.encode(storedResult{ComparisonResult: &models.ComparisonResult{ThreeWay: threeWay}, Chunked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setHeader("job", data, 0)
+
+	got, total, err := s.GetThreeWay("job", ThreeWayQuery{Status: "changed_locally"}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 || len(got.Products) != 2 || got.Products[0].ID != 7 || got.Products[1].ID != 10 {
+		t.Errorf("got %+v (%d)", got.Products, total)
+	}
+}
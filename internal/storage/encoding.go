@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+// Formats of stored result payloads.
+const (
+	FormatJSON   = "json"
+	FormatBinary = "binary"
+)
+
+// Compressions of stored result payloads.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// Encoded payloads start with payloadMarker, then a format and a compression byte. Payloads
+// stored before encoding was recorded are bare JSON, which never starts with the marker.
+const payloadMarker = 0x00
+
+// Format and compression bytes of encoded payloads.
+const (
+	formatJSON byte = iota
+	formatBinary
+)
+
+const (
+	compressionNone byte = iota
+	compressionGzip
+)
+
+// payloadCodec encodes the result headers and chunks written by a store, and decodes
+// them whatever encoding they were written with.
+type payloadCodec struct {
+	format      byte
+	compression byte
+
+	entries     atomic.Int64
+	jsonBytes   atomic.Int64
+	storedBytes atomic.Int64
+}
+
+// newPayloadCodec returns a codec writing the given format and compression, json and gzip
+// when empty.
+func newPayloadCodec(format, compression string) (*payloadCodec, error) {
+	c := &payloadCodec{}
+	switch format {
+	case "", FormatJSON:
+		c.format = formatJSON
+	case FormatBinary:
+		c.format = formatBinary
+	default:
+		return nil, fmt.Errorf("unknown result format %q", format)
+	}
+	switch compression {
+	case "", CompressionGzip:
+		c.compression = compressionGzip
+	case CompressionNone:
+		c.compression = compressionNone
+	default:
+		return nil, fmt.Errorf("unknown result compression %q", compression)
+	}
+	return c, nil
+}
+
+// defaultPayloadCodec returns a codec writing gzip-compressed JSON.
+func defaultPayloadCodec() *payloadCodec {
+	c, _ := newPayloadCodec("", "")
+	return c
+}
+
+// encode marshals v and encodes it with the format and compression of the codec.
+func (c *payloadCodec) encode(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{payloadMarker, c.format, c.compression})
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if c.compression == compressionGzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	if c.format == formatBinary {
+		err = encodeBinary(w, data)
+	} else {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.entries.Add(1)
+	c.jsonBytes.Add(int64(len(data)))
+	c.storedBytes.Add(int64(buf.Len()))
+	return buf.Bytes(), nil
+}
+
+// decode decodes a payload written with any format and compression, or as bare JSON,
+// into v.
+func (c *payloadCodec) decode(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != payloadMarker {
+		return decodeJSON(data, v)
+	}
+	if len(data) < 3 {
+		return errors.New("truncated result payload")
+	}
+	format, compression := data[1], data[2]
+
+	var r io.Reader = bytes.NewReader(data[3:])
+	switch compression {
+	case compressionNone:
+	case compressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return fmt.Errorf("unknown result compression %d", compression)
+	}
+
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case formatJSON:
+	case formatBinary:
+		if plain, err = decodeBinary(plain); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown result format %d", format)
+	}
+	return decodeJSON(plain, v)
+}
+
+// EncodingStats reports the size of the result payloads written since the store was opened.
+type EncodingStats struct {
+	Format      string  `json:"format"`
+	Compression string  `json:"compression"`
+	Entries     int64   `json:"entries"`      // Headers and chunks written
+	JSONBytes   int64   `json:"json_bytes"`   // Their size as plain JSON
+	StoredBytes int64   `json:"stored_bytes"` // Their size as stored
+	SavedBytes  int64   `json:"saved_bytes"`  // JSONBytes - StoredBytes
+	Ratio       float64 `json:"ratio"`        // StoredBytes / JSONBytes, 0 before any write
+}
+
+func (c *payloadCodec) stats() EncodingStats {
+	stats := EncodingStats{
+		Format:      FormatJSON,
+		Compression: CompressionNone,
+		Entries:     c.entries.Load(),
+		JSONBytes:   c.jsonBytes.Load(),
+		StoredBytes: c.storedBytes.Load(),
+	}
+	if c.format == formatBinary {
+		stats.Format = FormatBinary
+	}
+	if c.compression == compressionGzip {
+		stats.Compression = CompressionGzip
+	}
+	stats.SavedBytes = stats.JSONBytes - stats.StoredBytes
+	if stats.JSONBytes > 0 {
+		stats.Ratio = float64(stats.StoredBytes) / float64(stats.JSONBytes)
+	}
+	return stats
+}
+
+// The binary format is the token stream of a JSON document: one tag byte per token,
+// followed by its value. Strings and number texts are prefixed with their length as a
+// uvarint, integers are zigzag varints, and object keys are numbered in order of first
+// appearance so repeated keys take one or two bytes.
+const (
+	binNull byte = iota
+	binFalse
+	binTrue
+	binInt    // varint
+	binNumber // Number text that is not an int64
+	binString
+	binObject
+	binArray
+	binEnd    // Ends the innermost object or array
+	binKey    // New key, numbered after the previous ones
+	binKeyRef // Key number
+)
+
+// encodeBinary writes the binary form of a JSON document.
+func encodeBinary(w io.Writer, data []byte) error {
+	bw := bufio.NewWriter(w)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	keys := make(map[string]uint64)
+	var scratch [binary.MaxVarintLen64]byte
+	writeUvarint := func(n uint64) {
+		bw.Write(scratch[:binary.PutUvarint(scratch[:], n)])
+	}
+	writeText := func(tag byte, s string) {
+		bw.WriteByte(tag)
+		writeUvarint(uint64(len(s)))
+		bw.WriteString(s)
+	}
+
+	// frames holds the open objects and arrays; in an object, the next token is a key
+	// when keyNext is set
+	type frame struct{ object, keyNext bool }
+	var frames []frame
+	valueDone := func() {
+		if n := len(frames); n > 0 && frames[n-1].object {
+			frames[n-1].keyNext = true
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if n := len(frames); n > 0 && frames[n-1].keyNext {
+			if key, ok := tok.(string); ok {
+				frames[n-1].keyNext = false
+				if n, ok := keys[key]; ok {
+					bw.WriteByte(binKeyRef)
+					writeUvarint(n)
+				} else {
+					keys[key] = uint64(len(keys))
+					writeText(binKey, key)
+				}
+				continue
+			}
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				bw.WriteByte(binObject)
+				frames = append(frames, frame{object: true, keyNext: true})
+			case '[':
+				bw.WriteByte(binArray)
+				frames = append(frames, frame{})
+			default:
+				bw.WriteByte(binEnd)
+				frames = frames[:len(frames)-1]
+				valueDone()
+			}
+			continue
+		case nil:
+			bw.WriteByte(binNull)
+		case bool:
+			if t {
+				bw.WriteByte(binTrue)
+			} else {
+				bw.WriteByte(binFalse)
+			}
+		case json.Number:
+			s := string(t)
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+				bw.WriteByte(binInt)
+				bw.Write(scratch[:binary.PutVarint(scratch[:], n)])
+			} else {
+				writeText(binNumber, s)
+			}
+		case string:
+			writeText(binString, t)
+		}
+		valueDone()
+	}
+	return bw.Flush()
+}
+
+// decodeBinary reads a binary document back as JSON.
+func decodeBinary(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	var out bytes.Buffer
+	var keys []string
+	readText := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if n > uint64(r.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	writeString := func(s string) {
+		data, _ := json.Marshal(s)
+		out.Write(data)
+	}
+
+	// frames holds the closing byte of the open objects and arrays, and whether a member
+	// was written yet
+	type frame struct {
+		close byte
+		empty bool
+	}
+	var frames []frame
+	afterKey := false
+	for {
+		tag, err := r.ReadByte()
+		if err == io.EOF {
+			if len(frames) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Members after the first one, and keys, are preceded by a comma
+		if n := len(frames); n > 0 && tag != binEnd && !afterKey {
+			if !frames[n-1].empty {
+				out.WriteByte(',')
+			}
+			frames[n-1].empty = false
+		}
+		afterKey = false
+
+		switch tag {
+		case binNull:
+			out.WriteString("null")
+		case binFalse:
+			out.WriteString("false")
+		case binTrue:
+			out.WriteString("true")
+		case binInt:
+			n, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(strconv.FormatInt(n, 10))
+		case binNumber:
+			s, err := readText()
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(s)
+		case binString:
+			s, err := readText()
+			if err != nil {
+				return nil, err
+			}
+			writeString(s)
+		case binObject:
+			out.WriteByte('{')
+			frames = append(frames, frame{close: '}', empty: true})
+		case binArray:
+			out.WriteByte('[')
+			frames = append(frames, frame{close: ']', empty: true})
+		case binEnd:
+			if len(frames) == 0 {
+				return nil, errors.New("unbalanced binary payload")
+			}
+			out.WriteByte(frames[len(frames)-1].close)
+			frames = frames[:len(frames)-1]
+		case binKey:
+			key, err := readText()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			writeString(key)
+			out.WriteByte(':')
+			afterKey = true
+		case binKeyRef:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if n >= uint64(len(keys)) {
+				return nil, errors.New("unknown key in binary payload")
+			}
+			writeString(keys[n])
+			out.WriteByte(':')
+			afterKey = true
+		default:
+			return nil, fmt.Errorf("unknown tag %d in binary payload", tag)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPayloadCodecRoundTrip(t *testing.T) {
+	want := []storedError{
+		{ErrorDetail: testResult().Errors[1], APIRecordRef: "api:3"},
+		{ErrorDetail: testResult().Errors[1]},
+	}
+	for _, format := range []string{"", FormatJSON, FormatBinary} {
+		for _, compression := range []string{"", CompressionGzip, CompressionNone} {
+			t.Run(format+"/"+compression, func(t *testing.T) {
+				c, err := newPayloadCodec(format, compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := c.encode(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantFormat := formatJSON
+				if format == FormatBinary {
+					wantFormat = formatBinary
+				}
+				if data[1] != wantFormat {
+					t.Errorf("written with format %d, want %d", data[1], wantFormat)
+				}
+				var got []storedError
+				if err := c.decode(data, &got); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("decoded %+v, want %+v", got, want)
+				}
+				if stats := c.stats(); stats.Entries != 1 || stats.StoredBytes != int64(len(data)) {
+					t.Errorf("stats = %+v", stats)
+				}
+			})
+		}
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tests := []string{
+		`null`,
+		`[]`,
+		`{}`,
+		`{"a":{},"b":[],"c":[[],{}]}`,
+		`[true,false,null,0,-1,9223372036854775807,-9223372036854775808]`,
+		`[1.5,-2e10,18446744073709551616,0.000001,1E3]`,
+		`{"nome":"Feijão \"preto\"\n","k":"\u0000"}`,
+		`[{"id":1,"nome":"a"},{"id":2,"nome":"b"},{"nome":"c","id":3}]`,
+	}
+	for _, doc := range tests {
+		t.Run(doc, func(t *testing.T) {
+			var encoded bytes.Buffer
+			if err := encodeBinary(&encoded, []byte(doc)); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decodeBinary(encoded.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := decodeJSON(decoded, &got); err != nil {
+				t.Fatalf("decoded invalid JSON %s: %v", decoded, err)
+			}
+			if err := decodeJSON([]byte(doc), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(normalizeNumbers(got), normalizeNumbers(want)) {
+				t.Errorf("round trip gave %s", decoded)
+			}
+		})
+	}
+}
+
+// BenchmarkPayloadCodec encodes and decodes a chunk of discrepancies in every format and
+// compression, reporting the stored size against plain JSON.
+func BenchmarkPayloadCodec(b *testing.B) {
+	chunk := make([]storedError, 500)
+	for i := range chunk {
+		chunk[i] = storedError{ErrorDetail: testResult().Errors[i%len(testResult().Errors)], APIRecordRef: fmt.Sprintf("api:%d", i)}
+	}
+	for _, format := range []string{FormatJSON, FormatBinary} {
+		for _, compression := range []string{CompressionNone, CompressionGzip} {
+			b.Run(format+"/"+compression, func(b *testing.B) {
+				c, err := newPayloadCodec(format, compression)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					data, err := c.encode(chunk)
+					if err != nil {
+						b.Fatal(err)
+					}
+					var decoded []storedError
+					if err := c.decode(data, &decoded); err != nil {
+						b.Fatal(err)
+					}
+				}
+				stats := c.stats()
+				b.ReportMetric(float64(stats.StoredBytes)/float64(stats.Entries), "stored-B/op")
+				b.ReportMetric(float64(stats.SavedBytes)/float64(stats.Entries), "saved-B/op")
+				b.ReportMetric(stats.Ratio, "stored/json")
+			})
+		}
+	}
+}
+
+// legacyBinary is {"a":[1,"x"],"b":[{"k":-2},{"k":null}]} in the binary format.
+var legacyBinary = []byte{
+	binObject,
+	binKey, 1, 'a', binArray, binInt, 2, binString, 1, 'x', binEnd,
+	binKey, 1, 'b', binArray,
+	binObject, binKey, 1, 'k', binInt, 3, binEnd,
+	binObject, binKeyRef, 2, binNull, binEnd,
+	binEnd,
+	binEnd,
+}
+
+func TestPayloadCodecDecodesEveryEncoding(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(legacyBinary)
+	zw.Close()
+
+	want := map[string]interface{}{
+		"a": []interface{}{"1", "x"},
+		"b": []interface{}{map[string]interface{}{"k": "-2"}, map[string]interface{}{"k": nil}},
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bare json", []byte(`{"a":[1,"x"],"b":[{"k":-2},{"k":null}]}`)},
+		{"binary", append([]byte{payloadMarker, formatBinary, compressionNone}, legacyBinary...)},
+		{"gzipped binary", append([]byte{payloadMarker, formatBinary, compressionGzip}, zipped.Bytes()...)},
+	}
+	c := defaultPayloadCodec()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			if err := c.decode(tt.data, &got); err != nil {
+				t.Fatal(err)
+			}
+			// Numbers decode as json.Number; compare their text
+			normalized := normalizeNumbers(got)
+			if !reflect.DeepEqual(normalized, want) {
+				t.Errorf("decoded %#v, want %#v", normalized, want)
+			}
+		})
+	}
+}
+
+func TestPayloadCodecRejectsCorruptPayloads(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", []byte{payloadMarker, formatJSON}},
+		{"unknown format", []byte{payloadMarker, 9, compressionNone, '{', '}'}},
+		{"unknown compression", []byte{payloadMarker, formatJSON, 9, '{', '}'}},
+		{"oversized length", []byte{payloadMarker, formatBinary, compressionNone, binString, 0xff, 0xff, 0xff, 0xff, 0x0f, 'x'}},
+		{"truncated text", []byte{payloadMarker, formatBinary, compressionNone, binString, 5, 'x'}},
+		{"unclosed object", []byte{payloadMarker, formatBinary, compressionNone, binObject}},
+		{"unknown key", []byte{payloadMarker, formatBinary, compressionNone, binObject, binKeyRef, 0, binNull, binEnd}},
+		{"unknown tag", []byte{payloadMarker, formatBinary, compressionNone, 0x7f}},
+	}
+	c := defaultPayloadCodec()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := c.decode(tt.data, &v); err == nil {
+				t.Errorf("decoded %v from a corrupt payload", v)
+			}
+		})
+	}
+}
+
+func TestNewPayloadCodecRejectsUnknownSettings(t *testing.T) {
+	if _, err := newPayloadCodec("xml", ""); err == nil {
+		t.Error("accepted an unknown format")
+	}
+	if _, err := newPayloadCodec("", "zstd"); err == nil {
+		t.Error("accepted an unknown compression")
+	}
+}
+
+// normalizeNumbers replaces the json.Number values of a decoded document by their text.
+func normalizeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = normalizeNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = normalizeNumbers(e)
+		}
+	case interface{ String() string }:
+		return t.String()
+	}
+	return v
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Each expiring key of the filesystem backend has its Unix expiration date in a file of its
+// own next to its value, so setting it rewrites only that file. fsExpiresFile held every
+// expiration date before; it is split into those files on open.
+const (
+	fsValueSuffix  = ".gz"
+	fsExpirySuffix = ".expires"
+	fsExpiresFile  = "expires.json"
+)
+
+// NewFSStore returns a Store keeping each key in a gzip file of dir, created if needed.
+// Values are the same JSON documents as in Redis; lists are one JSON entry per line.
+// Result payloads, which the payload codec already compresses, are written as they are.
+func NewFSStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.New("the fs storage backend needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	f := &fsKV{dir: dir, expires: make(map[string]int64)}
+	if err := f.loadExpires(); err != nil {
+		return nil, err
+	}
+	return &kvStore{kv: f, codec: defaultPayloadCodec()}, nil
+}
+
+// fsKV is a kv storing each key in a gzip file named after the key. Lists are appended to
+// as further gzip members, which readers decode as a single stream. Values starting with
+// payloadMarker are encoded by the payload codec and written uncompressed: gzip files
+// start with another byte, so readers tell them apart.
+type fsKV struct {
+	dir     string
+	mu      sync.Mutex
+	expires map[string]int64 // Unix expiration date per key, as in the expiry files
+}
+
+func (f *fsKV) path(key string) string {
+	return filepath.Join(f.dir, url.QueryEscape(key)+fsValueSuffix)
+}
+
+func (f *fsKV) expiryPath(key string) string {
+	return filepath.Join(f.dir, url.QueryEscape(key)+fsExpirySuffix)
+}
+
+// loadExpires reads the expiration date of every key, splitting fsExpiresFile first.
+func (f *fsKV) loadExpires() error {
+	legacy := filepath.Join(f.dir, fsExpiresFile)
+	data, err := os.ReadFile(legacy)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var expires map[string]int64
+		if err := json.Unmarshal(data, &expires); err != nil {
+			return err
+		}
+		for key, expiresAt := range expires {
+			if err := f.writeExpiry(key, expiresAt); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(legacy); err != nil {
+			return err
+		}
+	}
+
+	files, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), fsExpirySuffix)
+		if file.IsDir() || !ok {
+			continue
+		}
+		key, err := url.QueryUnescape(name)
+		if err != nil {
+			continue // Not written by this backend
+		}
+		data, err := os.ReadFile(filepath.Join(f.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		expiresAt, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expiration of key %q: %w", key, err)
+		}
+		f.expires[key] = expiresAt
+	}
+	return nil
+}
+
+// live reports whether a key has not expired, removing it otherwise. The lock must be held.
+func (f *fsKV) live(key string, now time.Time) (bool, error) {
+	expiresAt, ok := f.expires[key]
+	if !ok || now.Unix() < expiresAt {
+		return true, nil
+	}
+	return false, f.remove(key)
+}
+
+// setExpiry records the expiration of a key from now, 0 for none. The lock must be held.
+func (f *fsKV) setExpiry(key string, expiration time.Duration) error {
+	if expiration > 0 {
+		return f.writeExpiry(key, time.Now().Add(expiration).Unix())
+	}
+	if _, had := f.expires[key]; !had {
+		return nil
+	}
+	if err := os.Remove(f.expiryPath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	delete(f.expires, key)
+	return nil
+}
+
+// writeExpiry replaces the expiry file of a key. The lock must be held.
+func (f *fsKV) writeExpiry(key string, expiresAt int64) error {
+	if err := writeFileAtomic(f.expiryPath(key), []byte(strconv.FormatInt(expiresAt, 10))); err != nil {
+		return err
+	}
+	f.expires[key] = expiresAt
+	return nil
+}
+
+// remove deletes the value and expiry files of a key. The lock must be held.
+func (f *fsKV) remove(key string) error {
+	for _, path := range []string{f.path(key), f.expiryPath(key)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	delete(f.expires, key)
+	return nil
+}
+
+// read returns the decompressed content of a key's file, ErrNotFound when it does not exist.
+// The lock must be held.
+func (f *fsKV) read(key string) ([]byte, error) {
+	live, err := f.live(key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !live {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	if first, err := r.Peek(1); err == nil && first[0] == payloadMarker {
+		return io.ReadAll(r)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+func (f *fsKV) get(key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read(key)
+}
+
+func (f *fsKV) set(key string, value []byte, expiration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data := value
+	if len(value) == 0 || value[0] != payloadMarker {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(value); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	if err := writeFileAtomic(f.path(key), data); err != nil {
+		return err
+	}
+	return f.setExpiry(key, expiration)
+}
+
+func (f *fsKV) push(key string, entries [][]byte, expiration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// An expired list starts over
+	if _, err := f.live(key, time.Now()); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path(key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	for _, entry := range entries {
+		if _, err := gz.Write(entry); err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := gz.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return f.setExpiry(key, expiration)
+}
+
+func (f *fsKV) list(key string) ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.read(key)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries [][]byte
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			entries = append(entries, bytes.TrimSuffix(line, []byte("\n")))
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *fsKV) del(keys ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range keys {
+		if err := f.remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fsKV) expire(keys []string, expiration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		live, err := f.live(key, now)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(f.path(key)); !live || errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := f.setExpiry(key, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fsKV) keys() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), fsValueSuffix)
+		if file.IsDir() || !ok {
+			continue
+		}
+		key, err := url.QueryUnescape(name)
+		if err != nil {
+			continue // Not written by this backend
+		}
+		live, err := f.live(key, now)
+		if err != nil {
+			return nil, err
+		}
+		if live {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// writeFileAtomic replaces a file through a temporary file, so readers never see it half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
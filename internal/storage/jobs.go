@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+// jobsKey holds the job index: every job ID ordered by creation time in Redis (see
+// jobIndexKey for the other orders), the entry of every job in the kv backends.
+const jobsKey = "jobs"
+
+// jobMetaKey returns the key holding the metadata of a job.
+func jobMetaKey(jobID string) string {
+	return jobID + ":meta"
+}
+
+// fingerprintKey returns the key holding the job that ran the comparison with a given
+// fingerprint: a hash of its inputs, options and API snapshot.
+func fingerprintKey(fingerprint string) string {
+	return "fingerprint:" + fingerprint
+}
+
+// JobSortFields lists the fields jobs can be sorted by.
+var JobSortFields = []string{"created_at", "finished_at", "filename", "size", "csv_rows", "discrepancies"}
+
+// JobQuery selects a page of the job index.
+type JobQuery struct {
+	Status string // Only jobs in this state, all when empty
+	From   int64  // Only jobs created at or after this Unix time, when set
+	To     int64  // Only jobs created at or before this Unix time, when set
+	Sort   string // One of JobSortFields, created_at when empty
+	Desc   bool   // Descending order
+	Offset int
+	Limit  int // All matching jobs when zero
+}
+
+// Validate checks the sort field of the query.
+func (q JobQuery) Validate() error {
+	if q.Sort == "" {
+		return nil
+	}
+	for _, field := range JobSortFields {
+		if field == q.Sort {
+			return nil
+		}
+	}
+	return fmt.Errorf("sort must be one of %s", strings.Join(JobSortFields, ", "))
+}
+
+// jobStatuses lists the states the job index is scoped by.
+var jobStatuses = []string{models.JobQueued, models.JobRunning, models.JobCompleted, models.JobFailed}
+
+// jobEntry is what the job index keeps of a job: its status, the fields jobs are sorted
+// by and its expiration, so a page is selected without loading the metadata of every job.
+type jobEntry struct {
+	ID            string `json:"-"`
+	Status        string `json:"status"`
+	CreatedAt     int64  `json:"created_at"`
+	FinishedAt    int64  `json:"finished_at,omitempty"`
+	Filename      string `json:"filename,omitempty"`
+	Size          int64  `json:"size,omitempty"`
+	CSVRows       int    `json:"csv_rows,omitempty"`
+	Discrepancies int    `json:"discrepancies,omitempty"`
+	ExpiresAt     int64  `json:"expires_at,omitempty"` // Unix time, zero when kept until deleted
+}
+
+// newJobEntry returns the index entry of a job whose metadata is written now with the
+// given expiration.
+func newJobEntry(meta *models.JobMeta, expiration time.Duration) jobEntry {
+	entry := jobEntry{
+		ID:         meta.ID,
+		Status:     meta.Status,
+		CreatedAt:  meta.CreatedAt,
+		FinishedAt: meta.FinishedAt,
+		Filename:   meta.Filename,
+		Size:       meta.Size,
+		CSVRows:    meta.CSVRows,
+	}
+	if meta.Counts != nil {
+		entry.Discrepancies = meta.Counts.Discrepancies
+	}
+	if expiration > 0 {
+		entry.ExpiresAt = time.Now().Add(expiration).Unix()
+	}
+	return entry
+}
+
+// metaExpiration returns the expiration left to the metadata of a job indexed before its
+// index entry was kept, zero when it is kept until deleted.
+func metaExpiration(meta *models.JobMeta, now time.Time) time.Duration {
+	if expiration, ok := remaining(meta, now); ok {
+		return expiration
+	}
+	return 0
+}
+
+// expired reports whether the job has expired at now.
+func (e jobEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != 0 && e.ExpiresAt <= now.Unix()
+}
+
+// score returns the value of a numeric sort field of the entry.
+func (e jobEntry) score(field string) float64 {
+	switch field {
+	case "finished_at":
+		return float64(e.FinishedAt)
+	case "size":
+		return float64(e.Size)
+	case "csv_rows":
+		return float64(e.CSVRows)
+	case "discrepancies":
+		return float64(e.Discrepancies)
+	default:
+		return float64(e.CreatedAt)
+	}
+}
+
+// selectJobs applies the status and date filters, order and page of a query to the
+// entries of the job index. It returns the IDs of the page and the number of matching
+// jobs. Ties are ordered by ID, as in a Redis sorted set.
+func selectJobs(entries []jobEntry, q JobQuery) ([]string, int) {
+	matching := make([]jobEntry, 0, len(entries))
+	for _, entry := range entries {
+		if q.Status != "" && entry.Status != q.Status {
+			continue
+		}
+		if (q.From != 0 && entry.CreatedAt < q.From) || (q.To != 0 && entry.CreatedAt > q.To) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+
+	key := jobSortKey(q.Sort)
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		if c := key(a, b); c != 0 {
+			return (c < 0) != q.Desc
+		}
+		return (a.ID < b.ID) != q.Desc
+	})
+
+	total := len(matching)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+	ids := make([]string, 0, end-start)
+	for _, entry := range matching[start:end] {
+		ids = append(ids, entry.ID)
+	}
+	return ids, total
+}
+
+// jobSortKey returns a comparison of two jobs on a sort field: negative, zero or positive.
+func jobSortKey(field string) func(a, b jobEntry) int {
+	if field == "filename" {
+		return func(a, b jobEntry) int { return strings.Compare(a.Filename, b.Filename) }
+	}
+	return func(a, b jobEntry) int { return cmp.Compare(a.score(field), b.score(field)) }
+}
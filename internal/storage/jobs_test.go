@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+func TestListJobs(t *testing.T) {
+	jobs := []models.JobMeta{
+		{ID: "a", Filename: "b.csv", Size: 30, Status: models.JobCompleted, CreatedAt: 100, FinishedAt: 110, CSVRows: 3, Counts: &models.JobCounts{Discrepancies: 5}},
+		{ID: "b", Filename: "a.csv", Size: 10, Status: models.JobFailed, CreatedAt: 200, FinishedAt: 205},
+		{ID: "c", Filename: "c.csv", Size: 20, Status: models.JobCompleted, CreatedAt: 300, FinishedAt: 390, CSVRows: 1, Counts: &models.JobCounts{Discrepancies: 1}},
+		{ID: "d", Filename: "a.csv", Size: 20, Status: models.JobRunning, CreatedAt: 300},
+	}
+	tests := []struct {
+		name  string
+		q     JobQuery
+		want  []string
+		total int
+	}{
+		{"newest first", JobQuery{Desc: true}, []string{"d", "c", "b", "a"}, 4},
+		{"oldest first", JobQuery{}, []string{"a", "b", "c", "d"}, 4},
+		{"page", JobQuery{Desc: true, Offset: 1, Limit: 2}, []string{"c", "b"}, 4},
+		{"past the end", JobQuery{Offset: 10, Limit: 2}, []string{}, 4},
+		{"status", JobQuery{Status: models.JobCompleted, Desc: true}, []string{"c", "a"}, 2},
+		{"date range", JobQuery{From: 150, To: 300}, []string{"b", "c", "d"}, 3},
+		{"filename with ties by ID", JobQuery{Sort: "filename"}, []string{"b", "d", "a", "c"}, 4},
+		{"size descending", JobQuery{Sort: "size", Desc: true}, []string{"a", "d", "c", "b"}, 4},
+		{"discrepancies", JobQuery{Sort: "discrepancies", Status: models.JobCompleted}, []string{"c", "a"}, 2},
+		{"sort, dates and page", JobQuery{Sort: "finished_at", From: 150, Offset: 1, Limit: 1}, []string{"b"}, 3},
+		{"csv rows in a state", JobQuery{Sort: "csv_rows", Status: models.JobFailed}, []string{"b"}, 1},
+	}
+
+	for name, s := range testStores(t) {
+		for i := range jobs {
+			if err := s.SaveJobMeta(&jobs[i], time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				page, total, err := s.ListJobs(tt.q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := []string{}
+				for _, job := range page {
+					ids = append(ids, job.ID)
+				}
+				if !reflect.DeepEqual(ids, tt.want) || total != tt.total {
+					t.Errorf("ListJobs = %v (%d), want %v (%d)", ids, total, tt.want, tt.total)
+				}
+			})
+		}
+	}
+}
+
+func TestListJobsFollowsUpdates(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			meta := &models.JobMeta{ID: "a", Status: models.JobRunning, CreatedAt: 100}
+			if err := s.SaveJobMeta(meta, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			meta.Status = models.JobCompleted
+			if err := s.SaveJobMeta(meta, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, total, _ := s.ListJobs(JobQuery{Status: models.JobRunning}); total != 0 {
+				t.Errorf("%d running jobs after completion, want 0", total)
+			}
+			if page, _, _ := s.ListJobs(JobQuery{Status: models.JobCompleted}); len(page) != 1 || page[0].Status != models.JobCompleted {
+				t.Errorf("completed jobs = %+v", page)
+			}
+
+			if err := s.DeleteJob("a"); err != nil {
+				t.Fatal(err)
+			}
+			if _, total, _ := s.ListJobs(JobQuery{}); total != 0 {
+				t.Errorf("%d jobs after deletion, want 0", total)
+			}
+		})
+	}
+}
+
+func TestListJobsDropsExpiredJobs(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.SaveJobMeta(&models.JobMeta{ID: "kept", CreatedAt: 1}, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SaveJobMeta(&models.JobMeta{ID: "gone", CreatedAt: 2}, time.Nanosecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(1100 * time.Millisecond)
+
+			page, total, err := s.ListJobs(JobQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 || len(page) != 1 || page[0].ID != "kept" {
+				t.Errorf("ListJobs = %+v (%d), want only the kept job", page, total)
+			}
+		})
+	}
+}
+
+func TestJobIndexUpgradesCreationTimes(t *testing.T) {
+	s := NewMemoryStore().(*kvStore)
+	meta := models.JobMeta{ID: "old", Filename: "old.csv", Status: models.JobCompleted, CreatedAt: 100}
+	data, _ := json.Marshal(meta)
+	s.kv.set(jobMetaKey("old"), data, 0)
+	// An index written before entries were kept, with a job whose metadata expired
+	s.kv.set(jobsKey, []byte(`{"old":100,"expired":50}`), 0)
+
+	page, total, err := s.ListJobs(JobQuery{Sort: "filename"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || page[0].ID != "old" {
+		t.Errorf("ListJobs = %+v (%d), want the old job", page, total)
+	}
+	index, err := s.jobIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := index["old"]; entry.Filename != "old.csv" || entry.Status != models.JobCompleted {
+		t.Errorf("upgraded entry = %+v", entry)
+	}
+}
+
+func TestUpdateJobMeta(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			increment := func(meta *models.JobMeta) (time.Duration, error) {
+				meta.Attempts++
+				return time.Hour, nil
+			}
+			if err := s.UpdateJobMeta("a", increment); err != ErrNotFound {
+				t.Fatalf("UpdateJobMeta of a missing job: %v, want ErrNotFound", err)
+			}
+			if err := s.SaveJobMeta(&models.JobMeta{ID: "a", Status: models.JobRunning, CreatedAt: 100}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			// Concurrent updates are all kept
+			const updates = 20
+			var wg sync.WaitGroup
+			for i := 0; i < updates; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := s.UpdateJobMeta("a", increment); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// A failed update changes nothing
+			failed := errors.New("failed")
+			err := s.UpdateJobMeta("a", func(meta *models.JobMeta) (time.Duration, error) {
+				meta.Status = models.JobFailed
+				return 0, failed
+			})
+			if err != failed {
+				t.Errorf("UpdateJobMeta = %v, want the error of the update", err)
+			}
+
+			meta, err := s.GetJobMeta("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Attempts != updates || meta.Status != models.JobRunning {
+				t.Errorf("metadata after the updates = %+v", meta)
+			}
+			if _, total, _ := s.ListJobs(JobQuery{Status: models.JobRunning}); total != 1 {
+				t.Errorf("%d running jobs in the index, want 1", total)
+			}
+		})
+	}
+}
@@ -0,0 +1,733 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+// kv is the key-value primitive behind the memory and filesystem backends. Values and list
+// entries are opaque bytes; an expiration of 0 keeps the key until it is deleted.
+type kv interface {
+	get(key string) ([]byte, error) // ErrNotFound when missing or expired
+	set(key string, value []byte, expiration time.Duration) error
+	push(key string, entries [][]byte, expiration time.Duration) error // Appends to a list, refreshing its expiration
+	list(key string) ([][]byte, error)                                 // Empty when missing or expired
+	del(keys ...string) error                                          // Removes the keys at once
+	expire(keys []string, expiration time.Duration) error              // Sets the expiration of existing keys
+	keys() ([]string, error)
+}
+
+// kvStore implements Store on top of a kv, with the same keys as the Redis backend.
+// Lists stand in for Redis hashes: records referenced by discrepancies are kept in a list
+// of recordEntry under the job's records key.
+type kvStore struct {
+	kv     kv
+	codec  *payloadCodec
+	mu     sync.Mutex // Serializes read-modify-write updates of the ignore rules
+	metaMu sync.Mutex // Serializes updates of job metadata
+}
+
+// recordEntry is one record of a job, as kept by the kv backends.
+type recordEntry struct {
+	Ref    string          `json:"ref"`
+	Record json.RawMessage `json:"record"`
+}
+
+// SaveResult saves a comparison result with a given job ID, as a header and chunks of discrepancies.
+func (s *kvStore) SaveResult(jobID string, result *models.ComparisonResult, expiration time.Duration) error {
+	return saveResult(s, jobID, result, expiration)
+}
+
+// GetResult retrieves a comparison result by job ID, with every discrepancy.
+func (s *kvStore) GetResult(jobID string) (*models.ComparisonResult, error) {
+	return getResult(s, jobID)
+}
+
+// GetResultSummary retrieves a comparison result without its discrepancies.
+func (s *kvStore) GetResultSummary(jobID string) (*models.ComparisonResult, error) {
+	return getResultSummary(s, jobID)
+}
+
+// LinkResult makes a job reuse the result of another one, which must have its own result.
+func (s *kvStore) LinkResult(jobID, targetID string, expiration time.Duration) error {
+	return linkResult(s, jobID, targetID, expiration)
+}
+
+// GetErrors retrieves a page of the discrepancies of a result matching q and the number
+// of matching discrepancies. A negative limit returns every matching discrepancy from offset.
+func (s *kvStore) GetErrors(jobID string, q ErrorQuery, offset, limit int) ([]models.ErrorDetail, int, error) {
+	return getErrors(s, jobID, q, offset, limit)
+}
+
+// ReadErrors returns an iterator over the discrepancies of a result matching q, in
+// canonical order and a batch at a time.
+func (s *kvStore) ReadErrors(jobID string, q ErrorQuery) (*ErrorIterator, error) {
+	return readErrorsInOrder(s, jobID, q)
+}
+
+// GetThreeWay retrieves the summary of a three-way result and a page of its products
+// matching q, with the number of matching products. The result is nil when the job was
+// not compared in three-way mode.
+func (s *kvStore) GetThreeWay(jobID string, q ThreeWayQuery, offset, limit int) (*models.ThreeWayResult, int, error) {
+	return getThreeWay(s, jobID, q, offset, limit)
+}
+
+// NewErrorWriter returns an ErrorWriter appending to the chunks of the given job.
+func (s *kvStore) NewErrorWriter(jobID string, expiration time.Duration) ErrorWriter {
+	return &chunkWriter{b: s, jobID: jobID, expiration: expiration}
+}
+
+func (s *kvStore) payloads() *payloadCodec {
+	return s.codec
+}
+
+// EncodingStats reports the size of the result payloads written since the store was opened.
+func (s *kvStore) EncodingStats() EncodingStats {
+	return s.codec.stats()
+}
+
+func (s *kvStore) getHeader(jobID string) ([]byte, error) {
+	return s.kv.get(jobID)
+}
+
+func (s *kvStore) setHeader(jobID string, data []byte, expiration time.Duration) error {
+	return s.kv.set(jobID, data, expiration)
+}
+
+// legacyErrors loads the discrepancies of a result stored before chunking.
+func (s *kvStore) legacyErrors(jobID string, stored *storedResult) ([]models.ErrorDetail, error) {
+	// Streamed results kept their errors in a separate list
+	if stored.Streamed {
+		entries, err := s.kv.list(jobID + ":errors")
+		if err != nil {
+			return nil, err
+		}
+		stored.Errors = make([]storedError, len(entries))
+		for i, entry := range entries {
+			if err := decodeJSON(entry, &stored.Errors[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	records, err := s.loadRecords(jobID, recordRefs(stored.Errors))
+	if err != nil {
+		return nil, err
+	}
+	return restoreErrors(stored.Errors, records), nil
+}
+
+// writeChunks stores a batch of chunks with their index entries and records.
+func (s *kvStore) writeChunks(jobID string, batch *chunkBatch, expiration time.Duration) error {
+	for i, chunk := range batch.chunks {
+		if err := s.kv.set(chunkKey(jobID, batch.first+i), chunk, expiration); err != nil {
+			return err
+		}
+	}
+	if err := s.kv.push(chunkDirKey(jobID), intEntries(batch.lengths), expiration); err != nil {
+		return err
+	}
+	for name, positions := range batch.indexes {
+		if err := s.kv.push(indexKey(jobID, name), intEntries(positions), expiration); err != nil {
+			return err
+		}
+	}
+	if len(batch.records) == 0 {
+		return nil
+	}
+	entries := make([][]byte, 0, len(batch.records))
+	for ref, record := range batch.records {
+		entry, err := json.Marshal(recordEntry{Ref: ref, Record: record.([]byte)})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return s.kv.push(recordsKey(jobID), entries, expiration)
+}
+
+func (s *kvStore) chunkLengths(jobID string) ([]int, error) {
+	return s.intList(chunkDirKey(jobID))
+}
+
+func (s *kvStore) readChunks(jobID string, numbers []int) ([][]byte, error) {
+	chunks := make([][]byte, len(numbers))
+	for i, n := range numbers {
+		data, err := s.kv.get(chunkKey(jobID, n))
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		chunks[i] = data
+	}
+	return chunks, nil
+}
+
+func (s *kvStore) indexLen(jobID, name string) (int, error) {
+	positions, err := s.intList(indexKey(jobID, name))
+	return len(positions), err
+}
+
+func (s *kvStore) indexRange(jobID, name string, start, stop int) ([]int, error) {
+	positions, err := s.intList(indexKey(jobID, name))
+	if err != nil {
+		return nil, err
+	}
+	if stop < 0 || stop >= len(positions) {
+		stop = len(positions) - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+	return positions[start : stop+1], nil
+}
+
+// indexBatch is the whole index: the kv backends read a list at once anyway.
+func (s *kvStore) indexBatch() int {
+	return math.MaxInt32
+}
+
+// loadRecords reads the job's record list, keeping the given references.
+func (s *kvStore) loadRecords(jobID string, refs []string) (map[string]*models.Product, error) {
+	records := make(map[string]*models.Product, len(refs))
+	if len(refs) == 0 {
+		return records, nil
+	}
+	wanted := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		wanted[ref] = true
+	}
+
+	entries, err := s.kv.list(recordsKey(jobID))
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range entries {
+		var entry recordEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		if !wanted[entry.Ref] {
+			continue
+		}
+		var p models.Product
+		if err := json.Unmarshal(entry.Record, &p); err != nil {
+			return nil, err
+		}
+		records[entry.Ref] = &p
+	}
+	return records, nil
+}
+
+// intList reads a list of integers.
+func (s *kvStore) intList(key string) ([]int, error) {
+	entries, err := s.kv.list(key)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int, len(entries))
+	for i, entry := range entries {
+		if ints[i], err = strconv.Atoi(string(entry)); err != nil {
+			return nil, err
+		}
+	}
+	return ints, nil
+}
+
+func intEntries(ints []int) [][]byte {
+	entries := make([][]byte, len(ints))
+	for i, n := range ints {
+		entries[i] = []byte(strconv.Itoa(n))
+	}
+	return entries
+}
+
+// GetJobSource retrieves the uploaded CSV of a job stored before uploads were kept in the
+// blob store.
+func (s *kvStore) GetJobSource(jobID string) ([]byte, error) {
+	return s.kv.get(jobID + ":source")
+}
+
+// SaveJobAPIProducts keeps the API products a job was compared against.
+func (s *kvStore) SaveJobAPIProducts(jobID string, products []models.Product, expiration time.Duration) error {
+	return s.setProducts(jobID+":api", products, expiration)
+}
+
+// GetJobAPIProducts retrieves the API products a job was compared against.
+// A job reusing the result of another one uses its API snapshot.
+func (s *kvStore) GetJobAPIProducts(jobID string) ([]models.Product, error) {
+	products, err := s.getProducts(jobID + ":api")
+	if err == ErrNotFound {
+		if link, _ := resultLink(s, jobID); link != "" {
+			return s.getProducts(link + ":api")
+		}
+	}
+	return products, err
+}
+
+// jobIndex loads the job index: the entry of every job, by ID. Indexes written before
+// entries were kept only hold creation times; their entries are rebuilt from the metadata.
+// The lock must be held.
+func (s *kvStore) jobIndex() (map[string]jobEntry, error) {
+	index := make(map[string]jobEntry)
+	data, err := s.kv.get(jobsKey)
+	if err == ErrNotFound {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	legacy := false
+	now := time.Now()
+	for id, value := range raw {
+		var entry jobEntry
+		if err := json.Unmarshal(value, &entry); err == nil {
+			entry.ID = id
+			index[id] = entry
+			continue
+		}
+		legacy = true
+		meta, err := s.GetJobMeta(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		index[id] = newJobEntry(meta, metaExpiration(meta, now))
+	}
+	if legacy {
+		if err := s.saveJobIndex(index); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+func (s *kvStore) saveJobIndex(index map[string]jobEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return s.kv.set(jobsKey, data, 0)
+}
+
+// SaveJobMeta creates or updates the metadata of a job and its entry in the index.
+func (s *kvStore) SaveJobMeta(meta *models.JobMeta, expiration time.Duration) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	return s.saveJobMeta(meta, expiration)
+}
+
+// UpdateJobMeta applies update to the metadata of a job and saves it, with other updates
+// of job metadata held off meanwhile.
+func (s *kvStore) UpdateJobMeta(jobID string, update JobUpdate) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	meta, err := s.GetJobMeta(jobID)
+	if err != nil {
+		return err
+	}
+	expiration, err := update(meta)
+	if err != nil {
+		return err
+	}
+	return s.saveJobMeta(meta, expiration)
+}
+
+// saveJobMeta stores the metadata of a job and its entry in the job index. metaMu must be held.
+func (s *kvStore) saveJobMeta(meta *models.JobMeta, expiration time.Duration) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.set(jobMetaKey(meta.ID), data, expiration); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.jobIndex()
+	if err != nil {
+		return err
+	}
+	entry := newJobEntry(meta, expiration)
+	if current, ok := index[meta.ID]; ok && current == entry {
+		return nil
+	}
+	index[meta.ID] = entry
+	return s.saveJobIndex(index)
+}
+
+// SetFingerprint records the job that ran the comparison with a given fingerprint.
+func (s *kvStore) SetFingerprint(fingerprint, jobID string, expiration time.Duration) error {
+	return s.kv.set(fingerprintKey(fingerprint), []byte(jobID), expiration)
+}
+
+// GetFingerprint retrieves the job that ran the comparison with a given fingerprint.
+func (s *kvStore) GetFingerprint(fingerprint string) (string, error) {
+	jobID, err := s.kv.get(fingerprintKey(fingerprint))
+	return string(jobID), err
+}
+
+// GetJobMeta retrieves the metadata of a job.
+func (s *kvStore) GetJobMeta(jobID string) (*models.JobMeta, error) {
+	data, err := s.kv.get(jobMetaKey(jobID))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta models.JobMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// ListJobs returns a page of the job index and the number of matching jobs. The page is
+// selected on the index entries, and only its metadata is read. Expired jobs are dropped
+// from the index on the way.
+func (s *kvStore) ListJobs(q JobQuery) ([]models.JobMeta, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.jobIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	changed := false
+	now := time.Now()
+	for {
+		entries := make([]jobEntry, 0, len(index))
+		for id, entry := range index {
+			if entry.expired(now) {
+				delete(index, id)
+				changed = true
+				continue
+			}
+			entries = append(entries, entry)
+		}
+
+		ids, total := selectJobs(entries, q)
+		jobs := make([]models.JobMeta, 0, len(ids))
+		missing := false
+		for _, id := range ids {
+			meta, err := s.GetJobMeta(id)
+			if err == ErrNotFound {
+				// Deleted without going through the index; select the page again without it
+				delete(index, id)
+				changed, missing = true, true
+				continue
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+			jobs = append(jobs, *meta)
+		}
+		if missing {
+			continue
+		}
+		if changed {
+			if err := s.saveJobIndex(index); err != nil {
+				return nil, 0, err
+			}
+		}
+		return jobs, total, nil
+	}
+}
+
+// GetJobStatus retrieves the current status of a job.
+func (s *kvStore) GetJobStatus(jobID string) (string, error) {
+	if status, err := s.kv.get(jobID + ":status"); err == nil {
+		return string(status), nil
+	}
+	if s.hasResult(jobID) {
+		return "Processamento finalizado", nil
+	}
+	return "Job criado", nil
+}
+
+// GetJobProgress retrieves the current progress of a job.
+func (s *kvStore) GetJobProgress(jobID string) (int, error) {
+	progress, err := s.kv.get(jobID + ":progress")
+	if err != nil {
+		if s.hasResult(jobID) {
+			return 100, nil // Job completed
+		}
+		return 0, err
+	}
+	return strconv.Atoi(string(progress))
+}
+
+// HasJobResults checks if a job has completed results.
+func (s *kvStore) HasJobResults(jobID string) (bool, error) {
+	return s.hasResult(jobID), nil
+}
+
+func (s *kvStore) hasResult(jobID string) bool {
+	_, err := s.kv.get(jobID)
+	return err == nil
+}
+
+// SetJobStatus sets the current status of a job.
+func (s *kvStore) SetJobStatus(jobID, status string, expiration time.Duration) error {
+	return s.kv.set(jobID+":status", []byte(status), expiration)
+}
+
+// SetJobProgress sets the current progress of a job.
+func (s *kvStore) SetJobProgress(jobID string, progress int, expiration time.Duration) error {
+	return s.kv.set(jobID+":progress", []byte(strconv.Itoa(progress)), expiration)
+}
+
+// jobKeys returns the keys of a job.
+func (s *kvStore) jobKeys(jobID string) ([]string, error) {
+	keys, err := s.kv.keys()
+	if err != nil {
+		return nil, err
+	}
+	var jobKeys []string
+	for _, key := range keys {
+		if isJobKey(jobID, key) {
+			jobKeys = append(jobKeys, key)
+		}
+	}
+	return jobKeys, nil
+}
+
+// SetJobExpiration sets the expiration of every key of a job, 0 to keep the job until it is
+// deleted. It returns ErrNotFound when the job has no keys.
+func (s *kvStore) SetJobExpiration(jobID string, expiration time.Duration) error {
+	keys, err := s.jobKeys(jobID)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrNotFound
+	}
+	if err := s.kv.expire(keys, expiration); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.jobIndex()
+	if err != nil {
+		return err
+	}
+	entry, ok := index[jobID]
+	if !ok {
+		return nil
+	}
+	entry.ExpiresAt = 0
+	if expiration > 0 {
+		entry.ExpiresAt = time.Now().Add(expiration).Unix()
+	}
+	index[jobID] = entry
+	return s.saveJobIndex(index)
+}
+
+// DeleteJob removes every key of a job at once, then drops it from the job index. It
+// returns ErrNotFound when the job has no keys.
+func (s *kvStore) DeleteJob(jobID string) error {
+	keys, err := s.jobKeys(jobID)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrNotFound
+	}
+	if err := s.kv.del(keys...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.jobIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[jobID]; !ok {
+		return nil
+	}
+	delete(index, jobID)
+	return s.saveJobIndex(index)
+}
+
+// ClearJobResult removes the result of a job, complete or partial, so the job can run
+// again. The rest of the job is kept.
+func (s *kvStore) ClearJobResult(jobID string) error {
+	keys, err := s.jobKeys(jobID)
+	if err != nil {
+		return err
+	}
+	var resultKeys []string
+	for _, key := range keys {
+		if isResultKey(jobID, key) {
+			resultKeys = append(resultKeys, key)
+		}
+	}
+	if len(resultKeys) == 0 {
+		return nil
+	}
+	return s.kv.del(resultKeys...)
+}
+
+// SweepOrphans removes the status and progress keys of jobs whose result never landed and
+// that are not running with a heartbeat within heartbeatTimeout, and returns those jobs.
+func (s *kvStore) SweepOrphans(heartbeatTimeout time.Duration) ([]string, error) {
+	keys, err := s.kv.keys()
+	if err != nil {
+		return nil, err
+	}
+	return sweepOrphans(s, statusJobIDs(keys), heartbeatTimeout, s.kv.del)
+}
+
+// SaveAPIProducts caches the API products and their version for 5 minutes, and returns
+// the version.
+func (s *kvStore) SaveAPIProducts(products []models.Product) (string, error) {
+	data, err := json.Marshal(products)
+	if err != nil {
+		return "", err
+	}
+	version := snapshotVersion(data)
+	if err := s.kv.set(apiProductsKey, data, 5*time.Minute); err != nil {
+		return version, err
+	}
+	return version, s.kv.set(apiProductsVersionKey, []byte(version), 5*time.Minute)
+}
+
+// GetAPIProducts retrieves the cached API products and their version.
+func (s *kvStore) GetAPIProducts() ([]models.Product, string, error) {
+	products, err := s.getProducts(apiProductsKey)
+	if err != nil {
+		return nil, "", err
+	}
+	version, err := s.GetAPIProductsVersion()
+	if err != nil {
+		return nil, "", err
+	}
+	return products, version, nil
+}
+
+// GetAPIProductsVersion retrieves the SnapshotVersion of the cached API products.
+func (s *kvStore) GetAPIProductsVersion() (string, error) {
+	version, err := s.kv.get(apiProductsVersionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(version), nil
+}
+
+func (s *kvStore) setProducts(key string, products []models.Product, expiration time.Duration) error {
+	data, err := json.Marshal(products)
+	if err != nil {
+		return err
+	}
+	return s.kv.set(key, data, expiration)
+}
+
+func (s *kvStore) getProducts(key string) ([]models.Product, error) {
+	data, err := s.kv.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []models.Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ignoreRules loads every ignore rule, by ID. Rules are kept as a single JSON object.
+func (s *kvStore) ignoreRules() (map[string]models.IgnoreRule, error) {
+	rules := make(map[string]models.IgnoreRule)
+	data, err := s.kv.get(ignoreRulesKey)
+	if err == ErrNotFound {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *kvStore) saveIgnoreRules(rules map[string]models.IgnoreRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return s.kv.set(ignoreRulesKey, data, 0)
+}
+
+// SaveIgnoreRule creates or replaces an ignore rule.
+func (s *kvStore) SaveIgnoreRule(rule *models.IgnoreRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.ignoreRules()
+	if err != nil {
+		return err
+	}
+	rules[rule.ID] = *rule
+	return s.saveIgnoreRules(rules)
+}
+
+// GetIgnoreRule retrieves an ignore rule by ID.
+func (s *kvStore) GetIgnoreRule(id string) (*models.IgnoreRule, error) {
+	rules, err := s.ignoreRules()
+	if err != nil {
+		return nil, err
+	}
+	rule, ok := rules[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &rule, nil
+}
+
+// GetIgnoreRules retrieves every ignore rule, ordered by creation time.
+func (s *kvStore) GetIgnoreRules() ([]models.IgnoreRule, error) {
+	byID, err := s.ignoreRules()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]models.IgnoreRule, 0, len(byID))
+	for _, rule := range byID {
+		rules = append(rules, rule)
+	}
+	sortIgnoreRules(rules)
+	return rules, nil
+}
+
+// DeleteIgnoreRule removes an ignore rule. It returns ErrNotFound when the rule does not exist.
+func (s *kvStore) DeleteIgnoreRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.ignoreRules()
+	if err != nil {
+		return err
+	}
+	if _, ok := rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(rules, id)
+	return s.saveIgnoreRules(rules)
+}
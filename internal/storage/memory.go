@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often expired keys are dropped from the memory backend.
+const memorySweepInterval = time.Minute
+
+// NewMemoryStore returns a Store keeping everything in process memory, for local runs and
+// tests. Its content is lost when the process exits.
+func NewMemoryStore() Store {
+	return &kvStore{kv: &memoryKV{entries: make(map[string]*memoryEntry)}, codec: defaultPayloadCodec()}
+}
+
+// memoryKV is an in-process kv with per-key expiration.
+type memoryKV struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	list      [][]byte
+	expiresAt time.Time // Zero when the key does not expire
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// expiry returns the expiration date of a key written now, zero when it does not expire.
+func expiry(now time.Time, expiration time.Duration) time.Time {
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(expiration)
+}
+
+// lookup returns the live entry of a key, dropping it when expired. The lock must be held.
+func (m *memoryKV) lookup(key string, now time.Time) *memoryEntry {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+// sweep drops expired keys, at most once per memorySweepInterval. The lock must be held.
+func (m *memoryKV) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < memorySweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, e := range m.entries {
+		if e.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func (m *memoryKV) get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.lookup(key, time.Now())
+	if e == nil || e.value == nil {
+		return nil, ErrNotFound
+	}
+	return e.value, nil
+}
+
+func (m *memoryKV) set(key string, value []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	m.entries[key] = &memoryEntry{value: append([]byte{}, value...), expiresAt: expiry(now, expiration)}
+	return nil
+}
+
+func (m *memoryKV) push(key string, entries [][]byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	e := m.lookup(key, now)
+	if e == nil {
+		e = &memoryEntry{}
+		m.entries[key] = e
+	}
+	for _, entry := range entries {
+		e.list = append(e.list, append([]byte{}, entry...))
+	}
+	e.expiresAt = expiry(now, expiration)
+	return nil
+}
+
+func (m *memoryKV) list(key string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.lookup(key, time.Now())
+	if e == nil {
+		return nil, nil
+	}
+	return append([][]byte{}, e.list...), nil
+}
+
+func (m *memoryKV) del(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *memoryKV) expire(keys []string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if e := m.lookup(key, now); e != nil {
+			e.expiresAt = expiry(now, expiration)
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) keys() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		if m.lookup(key, now) != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
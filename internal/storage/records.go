@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"hackathon-go/internal/models"
+)
+
+// storedError is the stored form of a discrepancy. Embedded records are replaced by
+// references into the job's record hash, so a record shared by several discrepancies
+// (e.g. a mismatch and a rule violation) is stored once.
+type storedError struct {
+	models.ErrorDetail
+	APIRecordRef string `json:"api_record_ref,omitempty"`
+	CSVRecordRef string `json:"csv_record_ref,omitempty"`
+}
+
+// storedResult is the stored header of a comparison result. The discrepancies are stored
+// in chunks (see chunks.go); results stored before chunking have them inline, or in a list
+// when streamed.
+type storedResult struct {
+	*models.ComparisonResult
+	Errors          []storedError `json:"errors,omitempty"`
+	Chunked         bool          `json:"chunked,omitempty"`
+	ThreeWayChunked bool          `json:"three_way_chunked,omitempty"` // Three-way products are in chunks of their own
+	Link            string        `json:"link,omitempty"`              // Job whose result is reused, instead of all of the above
+}
+
+// recordSet collects the distinct records referenced by stored discrepancies, by reference.
+type recordSet map[string]interface{}
+
+// recordsKey returns the Redis hash holding the records of a job.
+func recordsKey(jobID string) string {
+	return jobID + ":records"
+}
+
+// store moves the records of a discrepancy into the set and returns its stored form.
+func (rs recordSet) store(e models.ErrorDetail) (storedError, error) {
+	stored := storedError{ErrorDetail: e}
+	if e.APIRecord != nil {
+		stored.APIRecordRef = "api:" + strconv.Itoa(e.APIRecord.ID)
+		if err := rs.add(stored.APIRecordRef, e.APIRecord); err != nil {
+			return stored, err
+		}
+		stored.APIRecord = nil
+	}
+	if e.CSVRecord != nil {
+		// CSV rows are told apart by line, since an ID may be repeated in the file
+		stored.CSVRecordRef = "csv:" + strconv.Itoa(e.CSVRecord.CSVLine)
+		if e.CSVRecord.CSVLine == 0 {
+			stored.CSVRecordRef = "csv:id:" + strconv.Itoa(e.CSVRecord.ID)
+		}
+		if err := rs.add(stored.CSVRecordRef, e.CSVRecord); err != nil {
+			return stored, err
+		}
+		stored.CSVRecord = nil
+	}
+	return stored, nil
+}
+
+func (rs recordSet) add(ref string, p *models.Product) error {
+	if _, ok := rs[ref]; ok {
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	rs[ref] = data
+	return nil
+}
+
+// recordRefs returns the distinct record references of stored discrepancies.
+func recordRefs(stored []storedError) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, e := range stored {
+		for _, ref := range []string{e.APIRecordRef, e.CSVRecordRef} {
+			if ref != "" && !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// restoreErrors puts the records back into stored discrepancies. A record missing from
+// records, e.g. expired, leaves the discrepancy without it.
+func restoreErrors(stored []storedError, records map[string]*models.Product) []models.ErrorDetail {
+	errors := make([]models.ErrorDetail, len(stored))
+	for i, e := range stored {
+		errors[i] = e.ErrorDetail
+		if e.APIRecordRef != "" {
+			errors[i].APIRecord = records[e.APIRecordRef]
+		}
+		if e.CSVRecordRef != "" {
+			errors[i].CSVRecord = records[e.CSVRecordRef]
+		}
+	}
+	return errors
+}
+
+// loadRecords retrieves records from the job's record hash, by reference.
+func (r *RedisClient) loadRecords(jobID string, refs []string) (map[string]*models.Product, error) {
+	records := make(map[string]*models.Product, len(refs))
+	for start := 0; start < len(refs); start += redisBatchSize {
+		batch := refs[start:min(start+redisBatchSize, len(refs))]
+		values, err := r.Client.HMGet(ctx, recordsKey(jobID), batch...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue // Record expired or missing
+			}
+			var p models.Product
+			if err := json.Unmarshal([]byte(data), &p); err != nil {
+				return nil, err
+			}
+			records[batch[i]] = &p
+		}
+	}
+	return records, nil
+}
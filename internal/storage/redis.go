@@ -1,9 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"hackathon-go/internal/models"
@@ -13,9 +19,11 @@ import (
 
 var ctx = context.Background()
 
-// RedisClient is a wrapper for the Redis client.
+// RedisClient is a wrapper for the Redis client, and the Redis storage backend.
 type RedisClient struct {
-	Client *redis.Client
+	Client      *redis.Client
+	codec       *payloadCodec
+	jobsIndexed atomic.Bool // The sorted sets of the job index were built
 }
 
 // NewRedisClient creates and returns a new Redis client.
@@ -28,35 +36,657 @@ func NewRedisClient(addr string) (*RedisClient, error) {
 		return nil, err
 	}
 
-	return &RedisClient{Client: rdb}, nil
+	return &RedisClient{Client: rdb, codec: defaultPayloadCodec()}, nil
 }
 
-// SaveResult saves a comparison result to Redis with a given job ID.
+// notFound translates a missing Redis key into ErrNotFound.
+func notFound(err error) error {
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SaveResult saves a comparison result to Redis with a given job ID, as a header and
+// chunks of discrepancies. Records embedded in the discrepancies are stored once each in
+// a separate hash.
 func (r *RedisClient) SaveResult(jobID string, result *models.ComparisonResult, expiration time.Duration) error {
-	data, err := json.Marshal(result)
+	return saveResult(r, jobID, result, expiration)
+}
+
+// GetResult retrieves a comparison result from Redis by job ID, with every discrepancy.
+func (r *RedisClient) GetResult(jobID string) (*models.ComparisonResult, error) {
+	return getResult(r, jobID)
+}
+
+// GetResultSummary retrieves a comparison result without its discrepancies.
+func (r *RedisClient) GetResultSummary(jobID string) (*models.ComparisonResult, error) {
+	return getResultSummary(r, jobID)
+}
+
+// LinkResult makes a job reuse the result of another one, which must have its own result.
+func (r *RedisClient) LinkResult(jobID, targetID string, expiration time.Duration) error {
+	return linkResult(r, jobID, targetID, expiration)
+}
+
+// GetErrors retrieves a page of the discrepancies of a result matching q, through its
+// secondary indexes, and the number of matching discrepancies. A negative limit returns
+// every matching discrepancy from offset.
+func (r *RedisClient) GetErrors(jobID string, q ErrorQuery, offset, limit int) ([]models.ErrorDetail, int, error) {
+	return getErrors(r, jobID, q, offset, limit)
+}
+
+// ReadErrors returns an iterator over the discrepancies of a result matching q, in
+// canonical order and a batch at a time.
+func (r *RedisClient) ReadErrors(jobID string, q ErrorQuery) (*ErrorIterator, error) {
+	return readErrorsInOrder(r, jobID, q)
+}
+
+// GetThreeWay retrieves the summary of a three-way result and a page of its products
+// matching q, with the number of matching products. The result is nil when the job was
+// not compared in three-way mode.
+func (r *RedisClient) GetThreeWay(jobID string, q ThreeWayQuery, offset, limit int) (*models.ThreeWayResult, int, error) {
+	return getThreeWay(r, jobID, q, offset, limit)
+}
+
+func (r *RedisClient) payloads() *payloadCodec {
+	return r.codec
+}
+
+// EncodingStats reports the size of the result payloads written since the client was created.
+func (r *RedisClient) EncodingStats() EncodingStats {
+	return r.codec.stats()
+}
+
+func (r *RedisClient) getHeader(jobID string) ([]byte, error) {
+	data, err := r.Client.Get(ctx, jobID).Bytes()
+	return data, notFound(err)
+}
+
+func (r *RedisClient) setHeader(jobID string, data []byte, expiration time.Duration) error {
+	return r.setJobKey(jobID, data, expiration)
+}
+
+// legacyErrors loads the discrepancies of a result stored before chunking.
+func (r *RedisClient) legacyErrors(jobID string, stored *storedResult) ([]models.ErrorDetail, error) {
+	// Streamed results kept their errors in a separate list
+	if stored.Streamed {
+		entries, err := r.Client.LRange(ctx, jobID+":errors", 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		stored.Errors = make([]storedError, len(entries))
+		for i, entry := range entries {
+			if err := decodeJSON([]byte(entry), &stored.Errors[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	records, err := r.loadRecords(jobID, recordRefs(stored.Errors))
+	if err != nil {
+		return nil, err
+	}
+	return restoreErrors(stored.Errors, records), nil
+}
+
+// writeChunks stores a batch of chunks with their index entries and records in one transaction.
+func (r *RedisClient) writeChunks(jobID string, batch *chunkBatch, expiration time.Duration) error {
+	pipe := r.Client.TxPipeline()
+	keys := []string{chunkDirKey(jobID)}
+	lengths := make([]interface{}, len(batch.lengths))
+	for i, chunk := range batch.chunks {
+		pipe.Set(ctx, chunkKey(jobID, batch.first+i), chunk, expiration)
+		keys = append(keys, chunkKey(jobID, batch.first+i))
+		lengths[i] = batch.lengths[i]
+	}
+	pipe.RPush(ctx, chunkDirKey(jobID), lengths...)
+	expire(pipe, chunkDirKey(jobID), expiration)
+	for name, positions := range batch.indexes {
+		values := make([]interface{}, len(positions))
+		for i, p := range positions {
+			values[i] = p
+		}
+		pipe.RPush(ctx, indexKey(jobID, name), values...)
+		expire(pipe, indexKey(jobID, name), expiration)
+		keys = append(keys, indexKey(jobID, name))
+	}
+	if len(batch.records) > 0 {
+		pipe.HSet(ctx, recordsKey(jobID), map[string]interface{}(batch.records))
+		expire(pipe, recordsKey(jobID), expiration)
+		keys = append(keys, recordsKey(jobID))
+	}
+	trackKeys(pipe, expiration, keys...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// expire queues the expiration of a key. EXPIRE with 0 would delete the key, so an
+// expiration of 0 removes it instead.
+func expire(pipe redis.Pipeliner, key string, expiration time.Duration) {
+	if expiration <= 0 {
+		pipe.Persist(ctx, key)
+	} else {
+		pipe.Expire(ctx, key, expiration)
+	}
+}
+
+func (r *RedisClient) chunkLengths(jobID string) ([]int, error) {
+	return r.intList(chunkDirKey(jobID), 0, -1)
+}
+
+func (r *RedisClient) readChunks(jobID string, numbers []int) ([][]byte, error) {
+	chunks := make([][]byte, 0, len(numbers))
+	for start := 0; start < len(numbers); start += redisBatchSize {
+		batch := numbers[start:min(start+redisBatchSize, len(numbers))]
+		keys := make([]string, len(batch))
+		for i, n := range batch {
+			keys[i] = chunkKey(jobID, n)
+		}
+		values, err := r.Client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			data, _ := value.(string)
+			if data == "" {
+				chunks = append(chunks, nil)
+				continue
+			}
+			chunks = append(chunks, []byte(data))
+		}
+	}
+	return chunks, nil
+}
+
+func (r *RedisClient) indexLen(jobID, name string) (int, error) {
+	n, err := r.Client.LLen(ctx, indexKey(jobID, name)).Result()
+	return int(n), err
+}
+
+func (r *RedisClient) indexRange(jobID, name string, start, stop int) ([]int, error) {
+	return r.intList(indexKey(jobID, name), start, stop)
+}
+
+func (r *RedisClient) indexBatch() int {
+	return scanBatch
+}
+
+// intList reads a range of a list of integers.
+func (r *RedisClient) intList(key string, start, stop int) ([]int, error) {
+	values, err := r.Client.LRange(ctx, key, int64(start), int64(stop)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int, len(values))
+	for i, value := range values {
+		if ints[i], err = strconv.Atoi(value); err != nil {
+			return nil, err
+		}
+	}
+	return ints, nil
+}
+
+// decodeJSON decodes numbers as json.Number so amounts such as 19.90 are exported exactly as stored.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// GetJobSource retrieves the uploaded CSV of a job stored before uploads were kept in the
+// blob store.
+func (r *RedisClient) GetJobSource(jobID string) ([]byte, error) {
+	data, err := r.Client.Get(ctx, jobID+":source").Bytes()
+	return data, notFound(err)
+}
+
+// SaveJobAPIProducts keeps the API products a job was compared against.
+func (r *RedisClient) SaveJobAPIProducts(jobID string, products []models.Product, expiration time.Duration) error {
+	data, err := json.Marshal(products)
 	if err != nil {
 		return err
 	}
-	return r.Client.Set(ctx, jobID, data, expiration).Err()
+	return r.setJobKey(jobID+":api", data, expiration)
 }
 
-// GetResult retrieves a comparison result from Redis by job ID.
-func (r *RedisClient) GetResult(jobID string) (*models.ComparisonResult, error) {
-	data, err := r.Client.Get(ctx, jobID).Bytes()
+// GetJobAPIProducts retrieves the API products a job was compared against.
+// A job reusing the result of another one uses its API snapshot.
+func (r *RedisClient) GetJobAPIProducts(jobID string) ([]models.Product, error) {
+	data, err := r.Client.Get(ctx, jobID+":api").Bytes()
+	if err == redis.Nil {
+		if link, _ := resultLink(r, jobID); link != "" {
+			data, err = r.Client.Get(ctx, link+":api").Bytes()
+		}
+	}
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	var products []models.Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// NewErrorWriter returns an ErrorWriter appending to the chunks of the given job.
+func (r *RedisClient) NewErrorWriter(jobID string, expiration time.Duration) ErrorWriter {
+	return &chunkWriter{b: r, jobID: jobID, expiration: expiration}
+}
+
+// SaveJobMeta creates or updates the metadata of a job and its entries in the job index,
+// in one transaction.
+func (r *RedisClient) SaveJobMeta(meta *models.JobMeta, expiration time.Duration) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return queueJobMeta(r.Client, pipe, meta, expiration)
+	})
+	return err
+}
+
+// metaUpdateAttempts is the number of times UpdateJobMeta reads the metadata of a job again
+// after another update got in first.
+const metaUpdateAttempts = 10
+
+// UpdateJobMeta applies update to the metadata of a job and saves it in a transaction
+// watching the metadata, retried when another client changed it meanwhile.
+func (r *RedisClient) UpdateJobMeta(jobID string, update JobUpdate) error {
+	key := jobMetaKey(jobID)
+	for attempt := 0; attempt < metaUpdateAttempts; attempt++ {
+		err := r.Client.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err != nil {
+				return notFound(err)
+			}
+			var meta models.JobMeta
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return err
+			}
+			expiration, err := update(&meta)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				return queueJobMeta(tx, pipe, &meta, expiration)
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("metadata of job %s kept changing", jobID)
+}
+
+// queueJobMeta queues the metadata of a job and its entries in the job index on pipe,
+// reading the filename the job was indexed with through c.
+func queueJobMeta(c redis.Cmdable, pipe redis.Pipeliner, meta *models.JobMeta, expiration time.Duration) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	filename, err := c.HGet(ctx, jobNamesKey, meta.ID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe.Set(ctx, jobMetaKey(meta.ID), data, expiration)
+	trackKeys(pipe, expiration, jobMetaKey(meta.ID))
+	unindexJob(pipe, meta.ID, filename)
+	indexJob(pipe, newJobEntry(meta, expiration))
+	return nil
+}
+
+// GetJobMeta retrieves the metadata of a job.
+func (r *RedisClient) GetJobMeta(jobID string) (*models.JobMeta, error) {
+	data, err := r.Client.Get(ctx, jobMetaKey(jobID)).Bytes()
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	var meta models.JobMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// SetFingerprint records the job that ran the comparison with a given fingerprint.
+func (r *RedisClient) SetFingerprint(fingerprint, jobID string, expiration time.Duration) error {
+	return r.Client.Set(ctx, fingerprintKey(fingerprint), jobID, expiration).Err()
+}
+
+// GetFingerprint retrieves the job that ran the comparison with a given fingerprint.
+func (r *RedisClient) GetFingerprint(fingerprint string) (string, error) {
+	jobID, err := r.Client.Get(ctx, fingerprintKey(fingerprint)).Result()
+	return jobID, notFound(err)
+}
+
+// redisBatchSize is the number of keys or hash fields read per MGET or HMGET.
+const redisBatchSize = 500
+
+// The job index is a set of sorted sets of job IDs, one per sort field (see jobIndexKey),
+// each for every job and for the jobs in each state. The filename sets are ordered
+// lexicographically on "<filename>\x00<job>" members. jobNamesKey keeps the filename
+// each job was indexed with, and jobExpiresKey the expiration date of expiring jobs.
+const (
+	jobNamesKey    = "jobs:names"
+	jobExpiresKey  = "jobs:expires"
+	jobIndexedKey  = "jobs:indexed" // Set once the sorted sets of jobs indexed before them are built
+	filenameMarker = "\x00"
+)
+
+// jobIndexKey returns the sorted set ordering the jobs in a state, or every job when
+// status is empty, by a sort field. Every job by creation time is jobsKey itself.
+func jobIndexKey(field, status string) string {
+	if field == "created_at" && status == "" {
+		return jobsKey
+	}
+	key := jobsKey + ":" + field
+	if status != "" {
+		key += ":" + status
+	}
+	return key
+}
+
+// indexJob queues the addition of a job to the sorted sets of its state and of every job.
+func indexJob(pipe redis.Pipeliner, entry jobEntry) {
+	scopes := []string{""}
+	if entry.Status != "" {
+		scopes = append(scopes, entry.Status)
+	}
+	for _, status := range scopes {
+		for _, field := range JobSortFields {
+			key := jobIndexKey(field, status)
+			if field == "filename" {
+				pipe.ZAdd(ctx, key, &redis.Z{Member: entry.Filename + filenameMarker + entry.ID})
+			} else {
+				pipe.ZAdd(ctx, key, &redis.Z{Score: entry.score(field), Member: entry.ID})
+			}
+		}
+	}
+	pipe.HSet(ctx, jobNamesKey, entry.ID, entry.Filename)
+	if entry.ExpiresAt != 0 {
+		pipe.ZAdd(ctx, jobExpiresKey, &redis.Z{Score: float64(entry.ExpiresAt), Member: entry.ID})
+	} else {
+		pipe.ZRem(ctx, jobExpiresKey, entry.ID)
+	}
+}
+
+// unindexJob queues the removal of a job from every sorted set of the index. filename is
+// the one the job was indexed with.
+func unindexJob(pipe redis.Pipeliner, jobID, filename string) {
+	for _, status := range append([]string{""}, jobStatuses...) {
+		for _, field := range JobSortFields {
+			if field == "filename" {
+				pipe.ZRem(ctx, jobIndexKey(field, status), filename+filenameMarker+jobID)
+			} else {
+				pipe.ZRem(ctx, jobIndexKey(field, status), jobID)
+			}
+		}
+	}
+	pipe.HDel(ctx, jobNamesKey, jobID)
+	pipe.ZRem(ctx, jobExpiresKey, jobID)
+}
+
+// indexedFilenames returns the filenames the given jobs were indexed with, by job.
+func (r *RedisClient) indexedFilenames(jobIDs []string) (map[string]string, error) {
+	filenames := make(map[string]string, len(jobIDs))
+	if len(jobIDs) == 0 {
+		return filenames, nil
+	}
+	values, err := r.Client.HMGet(ctx, jobNamesKey, jobIDs...).Result()
 	if err != nil {
 		return nil, err
 	}
+	for i, value := range values {
+		if name, ok := value.(string); ok {
+			filenames[jobIDs[i]] = name
+		}
+	}
+	return filenames, nil
+}
+
+// dropJobs removes jobs from the job index in one transaction.
+func (r *RedisClient) dropJobs(jobIDs []string) error {
+	filenames, err := r.indexedFilenames(jobIDs)
+	if err != nil {
+		return err
+	}
+	pipe := r.Client.TxPipeline()
+	for _, id := range jobIDs {
+		unindexJob(pipe, id, filenames[id])
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// dropExpiredJobs removes the jobs whose metadata expired from the job index.
+func (r *RedisClient) dropExpiredJobs() error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for {
+		ids, err := r.Client.ZRangeByScore(ctx, jobExpiresKey, &redis.ZRangeBy{Min: "-inf", Max: now, Count: redisBatchSize}).Result()
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := r.dropJobs(ids); err != nil {
+			return err
+		}
+	}
+}
+
+// buildJobIndex builds the sorted sets of the jobs indexed by creation time alone, before
+// the index kept them, from their metadata. It runs once per Redis database.
+func (r *RedisClient) buildJobIndex() error {
+	if r.jobsIndexed.Load() {
+		return nil
+	}
+	n, err := r.Client.Exists(ctx, jobIndexedKey).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		ids, err := r.Client.ZRange(ctx, jobsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		metas, missing, err := r.jobMetas(ids)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		pipe := r.Client.TxPipeline()
+		for i := range metas {
+			indexJob(pipe, newJobEntry(&metas[i], metaExpiration(&metas[i], now)))
+		}
+		for _, id := range missing {
+			unindexJob(pipe, id, "")
+		}
+		pipe.Set(ctx, jobIndexedKey, "1", 0)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	r.jobsIndexed.Store(true)
+	return nil
+}
+
+// jobMetas reads the metadata of jobs, in order, and returns the jobs without any.
+func (r *RedisClient) jobMetas(jobIDs []string) ([]models.JobMeta, []string, error) {
+	jobs := make([]models.JobMeta, 0, len(jobIDs))
+	var missing []string
+	for start := 0; start < len(jobIDs); start += redisBatchSize {
+		batch := jobIDs[start:min(start+redisBatchSize, len(jobIDs))]
+		keys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = jobMetaKey(id)
+		}
+		values, err := r.Client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				missing = append(missing, batch[i])
+				continue
+			}
+			var meta models.JobMeta
+			if err := json.Unmarshal([]byte(data), &meta); err != nil {
+				return nil, nil, err
+			}
+			jobs = append(jobs, meta)
+		}
+	}
+	return jobs, missing, nil
+}
+
+// ListJobs returns a page of the job index and the number of matching jobs. The page is
+// read from the sorted set of the query's state and sort field with a LIMIT, and only its
+// metadata is read. Expired jobs are dropped from the index on the way.
+func (r *RedisClient) ListJobs(q JobQuery) ([]models.JobMeta, int, error) {
+	if err := r.buildJobIndex(); err != nil {
+		return nil, 0, err
+	}
+	for {
+		if err := r.dropExpiredJobs(); err != nil {
+			return nil, 0, err
+		}
+		ids, total, err := r.selectJobIDs(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs, missing, err := r.jobMetas(ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(missing) == 0 {
+			return jobs, total, nil
+		}
+		// Deleted without going through the index; select the page again without them
+		if err := r.dropJobs(missing); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// selectJobIDs returns the IDs of a page of the job index and the number of matching jobs.
+// Ties are ordered by ID.
+func (r *RedisClient) selectJobIDs(q JobQuery) ([]string, int, error) {
+	field := q.Sort
+	if field == "" {
+		field = "created_at"
+	}
+	key := jobIndexKey(field, q.Status)
+	byCreation := jobIndexKey("created_at", q.Status)
+	lo, hi := "-inf", "+inf"
+	if q.From != 0 {
+		lo = strconv.FormatInt(q.From, 10)
+	}
+	if q.To != 0 {
+		hi = strconv.FormatInt(q.To, 10)
+	}
+	dated := q.From != 0 || q.To != 0
+	count := int64(-1)
+	if q.Limit > 0 {
+		count = int64(q.Limit)
+	}
+
+	var total int64
+	var err error
+	if dated {
+		total, err = r.Client.ZCount(ctx, byCreation, lo, hi).Result()
+	} else {
+		total, err = r.Client.ZCard(ctx, key).Result()
+	}
+	if err != nil || int64(q.Offset) >= total {
+		return []string{}, int(total), err
+	}
+
+	var ids []string
+	switch {
+	case field == "created_at":
+		by := &redis.ZRangeBy{Min: lo, Max: hi, Offset: int64(q.Offset), Count: count}
+		if q.Desc {
+			ids, err = r.Client.ZRevRangeByScore(ctx, key, by).Result()
+		} else {
+			ids, err = r.Client.ZRangeByScore(ctx, key, by).Result()
+		}
+	case dated:
+		ids, err = r.scanJobIndex(key, q, lo, hi)
+	default:
+		ids, err = r.jobIndexRange(key, q.Desc, int64(q.Offset), count)
+	}
+	return ids, int(total), err
+}
 
-	var result models.ComparisonResult
-	if err := json.Unmarshal(data, &result); err != nil {
+// jobIndexRange returns the jobs of a sorted set of the index from rank start, at most
+// count of them, or all when count is negative.
+func (r *RedisClient) jobIndexRange(key string, desc bool, start, count int64) ([]string, error) {
+	stop := int64(-1)
+	if count >= 0 {
+		stop = start + count - 1
+	}
+	var members []string
+	var err error
+	if desc {
+		members, err = r.Client.ZRevRange(ctx, key, start, stop).Result()
+	} else {
+		members, err = r.Client.ZRange(ctx, key, start, stop).Result()
+	}
+	if err != nil {
 		return nil, err
 	}
-	return &result, nil
+	for i, member := range members {
+		if _, id, ok := strings.Cut(member, filenameMarker); ok {
+			members[i] = id
+		}
+	}
+	return members, nil
 }
 
-// GetAllJobIDs retrieves all job IDs (keys) from Redis.
-func (r *RedisClient) GetAllJobIDs() ([]string, error) {
-	return r.Client.Keys(ctx, "*").Result()
+// scanJobIndex walks a sorted set of the index in order, a batch at a time, keeping the
+// jobs created between lo and hi, until the page of the query is complete. Only IDs and
+// creation times are read.
+func (r *RedisClient) scanJobIndex(key string, q JobQuery, lo, hi string) ([]string, error) {
+	from, to := math.Inf(-1), math.Inf(1)
+	if q.From != 0 {
+		from = float64(q.From)
+	}
+	if q.To != 0 {
+		to = float64(q.To)
+	}
+
+	var page []string
+	skip := q.Offset
+	for start := int64(0); ; start += redisBatchSize {
+		ids, err := r.jobIndexRange(key, q.Desc, start, redisBatchSize)
+		if err != nil || len(ids) == 0 {
+			return page, err
+		}
+		pipe := r.Client.Pipeline()
+		scores := make([]*redis.FloatCmd, len(ids))
+		for i, id := range ids {
+			scores[i] = pipe.ZScore(ctx, jobsKey, id)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			createdAt, err := scores[i].Result()
+			if err != nil || createdAt < from || createdAt > to {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			page = append(page, id)
+			if q.Limit > 0 && len(page) == q.Limit {
+				return page, nil
+			}
+		}
+	}
 }
 
 // GetJobStatus retrieves the current status of a job from Redis.
@@ -68,7 +698,7 @@ func (r *RedisClient) GetJobStatus(jobID string) (string, error) {
 	}
 
 	// If no status key, check if job has results (completed)
-	_, err = r.GetResult(jobID)
+	_, err = r.getHeader(jobID)
 	if err == nil {
 		return "Processamento finalizado", nil
 	}
@@ -82,7 +712,7 @@ func (r *RedisClient) GetJobProgress(jobID string) (int, error) {
 	progress, err := r.Client.Get(ctx, jobID+":progress").Result()
 	if err != nil {
 		// If no progress key, check if job is completed
-		_, err = r.GetResult(jobID)
+		_, err = r.getHeader(jobID)
 		if err == nil {
 			return 100, nil // Job completed
 		}
@@ -101,7 +731,7 @@ func (r *RedisClient) GetJobProgress(jobID string) (int, error) {
 
 // HasJobResults checks if a job has completed results.
 func (r *RedisClient) HasJobResults(jobID string) (bool, error) {
-	_, err := r.GetResult(jobID)
+	_, err := r.getHeader(jobID)
 	if err != nil {
 		return false, nil // Job not found or no results
 	}
@@ -109,48 +739,362 @@ func (r *RedisClient) HasJobResults(jobID string) (bool, error) {
 }
 
 // SetJobStatus sets the current status of a job in Redis.
-func (r *RedisClient) SetJobStatus(jobID, status string) error {
-	return r.Client.Set(ctx, jobID+":status", status, time.Hour*24).Err()
+func (r *RedisClient) SetJobStatus(jobID, status string, expiration time.Duration) error {
+	return r.setJobKey(jobID+":status", status, expiration)
 }
 
 // SetJobProgress sets the current progress of a job in Redis.
-func (r *RedisClient) SetJobProgress(jobID string, progress int) error {
-	return r.Client.Set(ctx, jobID+":progress", fmt.Sprintf("%d", progress), time.Hour*24).Err()
+func (r *RedisClient) SetJobProgress(jobID string, progress int, expiration time.Duration) error {
+	return r.setJobKey(jobID+":progress", fmt.Sprintf("%d", progress), expiration)
 }
 
-// SaveAPIProducts saves the API products to Redis with a 5-minute TTL
+// scanKeys returns the keys matching a pattern, with SCAN so Redis is not blocked. Only the
+// sweeper and jobs written before they kept a key set need it.
+func (r *RedisClient) scanKeys(pattern string) ([]string, error) {
+	var keys []string
+	iter := r.Client.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
 
-func (r *RedisClient) SaveAPIProducts(products []models.Product) error {
+// jobKeysKey returns the Redis set naming every key of a job. Each writer adds its keys
+// to it in the same transaction, so the keys of a job are found without scanning.
+func jobKeysKey(jobID string) string {
+	return jobID + ":keys"
+}
 
-	data, err := json.Marshal(products)
+// trackKeysScript adds keys (ARGV[2:]) to the key set of a job (KEYS[1]) and extends the
+// expiration of the set to ARGV[1] milliseconds, 0 keeping it until deleted. The set
+// never expires before the keys it names.
+var trackKeysScript = redis.NewScript(`
+local fresh = redis.call('EXISTS', KEYS[1]) == 0
+for i = 2, #ARGV do
+	redis.call('SADD', KEYS[1], ARGV[i])
+end
+local ms = tonumber(ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ms <= 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif fresh or (ttl >= 0 and ttl < ms) then
+	redis.call('PEXPIRE', KEYS[1], ms)
+end
+return 0
+`)
 
-	if err != nil {
+// expireKeysScript sets the expiration of every key named by the key set of a job
+// (KEYS[1]) and of the set to ARGV[1] milliseconds, 0 keeping them until deleted, and
+// records the expiration date ARGV[2] of the job ARGV[3] in jobExpiresKey (KEYS[2]).
+// Names of keys gone are dropped from the set. It returns the number of keys left.
+var expireKeysScript = redis.NewScript(`
+local ms = tonumber(ARGV[1])
+local live = 0
+for _, key in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	if redis.call('EXISTS', key) == 1 then
+		live = live + 1
+		if ms > 0 then
+			redis.call('PEXPIRE', key, ms)
+		else
+			redis.call('PERSIST', key)
+		end
+	else
+		redis.call('SREM', KEYS[1], key)
+	end
+end
+if live == 0 then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+if ms > 0 then
+	redis.call('PEXPIRE', KEYS[1], ms)
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[3])
+else
+	redis.call('PERSIST', KEYS[1])
+	redis.call('ZREM', KEYS[2], ARGV[3])
+end
+return live
+`)
+
+// deleteKeysScript removes every key named by the key set of a job (KEYS[1]) and the set.
+// It returns the number of keys removed.
+var deleteKeysScript = redis.NewScript(`
+local removed = 0
+for _, key in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	removed = removed + redis.call('DEL', key)
+end
+redis.call('DEL', KEYS[1])
+return removed
+`)
 
+// trackKeys queues the addition of keys, all of the same job, to its key set.
+func trackKeys(pipe redis.Pipeliner, expiration time.Duration, keys ...string) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, max(expiration.Milliseconds(), 0))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	trackKeysScript.Eval(ctx, pipe, []string{jobKeysKey(ownerJob(keys[0]))}, args...)
+}
+
+// setJobKey sets a key of a job and records it in the key set of the job, in one transaction.
+func (r *RedisClient) setJobKey(key string, value interface{}, expiration time.Duration) error {
+	pipe := r.Client.TxPipeline()
+	pipe.Set(ctx, key, value, expiration)
+	trackKeys(pipe, expiration, key)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// trackLegacyKeys builds the key set of a job written before jobs kept one, by scanning
+// for its keys once. Jobs without a set nor any of their main keys are left alone.
+func (r *RedisClient) trackLegacyKeys(jobID string) error {
+	n, err := r.Client.Exists(ctx, jobKeysKey(jobID)).Result()
+	if err != nil || n > 0 {
 		return err
+	}
+	n, err = r.Client.Exists(ctx, jobID, jobMetaKey(jobID), jobID+":status", jobID+":progress").Result()
+	if err != nil || n == 0 {
+		return err
+	}
 
+	scanned, err := r.scanKeys(jobID + "*")
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, key := range scanned {
+		if isJobKey(jobID, key) && key != jobKeysKey(jobID) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
 	}
 
-	return r.Client.Set(ctx, "api_products_cache", data, 5*time.Minute).Err()
+	// The set lasts as long as the longest-lived key
+	pipe := r.Client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	var expiration time.Duration
+	for _, ttl := range ttls {
+		if ttl.Val() < 0 {
+			expiration = 0
+			break
+		}
+		expiration = max(expiration, ttl.Val())
+	}
 
+	pipe = r.Client.TxPipeline()
+	trackKeys(pipe, expiration, keys...)
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
-// GetAPIProducts retrieves cached API products from Redis
+// SetJobExpiration sets the expiration of every key of a job, named by its key set, in
+// one script, 0 to keep the job until it is deleted. It returns ErrNotFound when the job
+// has no keys.
+func (r *RedisClient) SetJobExpiration(jobID string, expiration time.Duration) error {
+	if err := r.trackLegacyKeys(jobID); err != nil {
+		return err
+	}
+	expiresAt := int64(0)
+	if expiration > 0 {
+		expiresAt = time.Now().Add(expiration).Unix()
+	}
+	live, err := expireKeysScript.Run(ctx, r.Client, []string{jobKeysKey(jobID), jobExpiresKey},
+		max(expiration.Milliseconds(), 0), expiresAt, jobID).Int()
+	if err != nil {
+		return err
+	}
+	if live == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
-func (r *RedisClient) GetAPIProducts() ([]models.Product, error) {
+// DeleteJob removes every key of a job, named by its key set, and its entry in the job
+// index in one transaction. It returns ErrNotFound when the job has no keys.
+func (r *RedisClient) DeleteJob(jobID string) error {
+	if err := r.trackLegacyKeys(jobID); err != nil {
+		return err
+	}
+	filenames, err := r.indexedFilenames([]string{jobID})
+	if err != nil {
+		return err
+	}
 
-	data, err := r.Client.Get(ctx, "api_products_cache").Bytes()
+	pipe := r.Client.TxPipeline()
+	removed := deleteKeysScript.Eval(ctx, pipe, []string{jobKeysKey(jobID)})
+	unindexJob(pipe, jobID, filenames[jobID])
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if n, _ := removed.Int(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
+// ClearJobResult removes the result of a job, complete or partial, in one transaction so
+// the job can run again. The rest of the job is kept.
+func (r *RedisClient) ClearJobResult(jobID string) error {
+	if err := r.trackLegacyKeys(jobID); err != nil {
+		return err
+	}
+	keys, err := r.Client.SMembers(ctx, jobKeysKey(jobID)).Result()
 	if err != nil {
+		return err
+	}
+	var resultKeys []interface{}
+	for _, key := range keys {
+		if isResultKey(jobID, key) {
+			resultKeys = append(resultKeys, key)
+		}
+	}
+	if len(resultKeys) == 0 {
+		return nil
+	}
 
-		return nil, err
+	pipe := r.Client.TxPipeline()
+	for _, key := range resultKeys {
+		pipe.Del(ctx, key.(string))
+	}
+	pipe.SRem(ctx, jobKeysKey(jobID), resultKeys...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SweepOrphans removes the status and progress keys of jobs whose result never landed and
+// that are not running with a heartbeat within heartbeatTimeout, and returns those jobs.
+func (r *RedisClient) SweepOrphans(heartbeatTimeout time.Duration) ([]string, error) {
+	var keys []string
+	for _, pattern := range []string{"*:status", "*:progress"} {
+		matched, err := r.scanKeys(pattern)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, matched...)
+	}
+	return sweepOrphans(r, statusJobIDs(keys), heartbeatTimeout, func(keys ...string) error {
+		return r.Client.Del(ctx, keys...).Err()
+	})
+}
+
+// SaveAPIProducts saves the API products and their version to Redis with a 5-minute TTL,
+// and returns the version
+func (r *RedisClient) SaveAPIProducts(products []models.Product) (string, error) {
+	data, err := json.Marshal(products)
+	if err != nil {
+		return "", err
+	}
+	version := snapshotVersion(data)
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, apiProductsKey, data, 5*time.Minute)
+		pipe.Set(ctx, apiProductsVersionKey, version, 5*time.Minute)
+		return nil
+	})
+	return version, err
+}
 
+// GetAPIProducts retrieves cached API products and their version from Redis, read at once
+// so they match
+func (r *RedisClient) GetAPIProducts() ([]models.Product, string, error) {
+	values, err := r.Client.MGet(ctx, apiProductsKey, apiProductsVersionKey).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	data, _ := values[0].(string)
+	version, _ := values[1].(string)
+	if values[0] == nil || values[1] == nil {
+		return nil, "", ErrNotFound
 	}
 
 	var products []models.Product
+	if err := json.Unmarshal([]byte(data), &products); err != nil {
+		return nil, "", err
+	}
+	return products, version, nil
+}
 
-	if err := json.Unmarshal(data, &products); err != nil {
+// GetAPIProductsVersion retrieves the SnapshotVersion of the cached API products.
+func (r *RedisClient) GetAPIProductsVersion() (string, error) {
+	version, err := r.Client.Get(ctx, apiProductsVersionKey).Result()
+	if err != nil {
+		return "", notFound(err)
+	}
+	return version, nil
+}
+
+// ignoreRulesKey is the Redis hash holding every ignore rule by ID.
+const ignoreRulesKey = "ignore_rules"
+
+// SaveIgnoreRule creates or replaces an ignore rule. Rules are kept until deleted;
+// their expiry date only stops them from being applied.
+func (r *RedisClient) SaveIgnoreRule(rule *models.IgnoreRule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	return r.Client.HSet(ctx, ignoreRulesKey, rule.ID, data).Err()
+}
+
+// GetIgnoreRule retrieves an ignore rule by ID.
+func (r *RedisClient) GetIgnoreRule(id string) (*models.IgnoreRule, error) {
+	data, err := r.Client.HGet(ctx, ignoreRulesKey, id).Bytes()
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	var rule models.IgnoreRule
+	if err := json.Unmarshal(data, &rule); err != nil {
 		return nil, err
 	}
+	return &rule, nil
+}
 
-	return products, nil
+// GetIgnoreRules retrieves every ignore rule, ordered by creation time.
+func (r *RedisClient) GetIgnoreRules() ([]models.IgnoreRule, error) {
+	entries, err := r.Client.HGetAll(ctx, ignoreRulesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]models.IgnoreRule, 0, len(entries))
+	for _, data := range entries {
+		var rule models.IgnoreRule
+		if err := json.Unmarshal([]byte(data), &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	sortIgnoreRules(rules)
+	return rules, nil
+}
+
+// sortIgnoreRules orders ignore rules by creation time, then ID.
+func sortIgnoreRules(rules []models.IgnoreRule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].CreatedAt != rules[j].CreatedAt {
+			return rules[i].CreatedAt < rules[j].CreatedAt
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+// DeleteIgnoreRule removes an ignore rule. It returns ErrNotFound when the rule does not exist.
+func (r *RedisClient) DeleteIgnoreRule(id string) error {
+	removed, err := r.Client.HDel(ctx, ignoreRulesKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
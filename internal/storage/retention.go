@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/models"
+)
+
+// Every key of a job is the job ID itself (the result header) or starts with the job ID
+// and a colon. Job IDs are UUIDs, so they never contain a colon.
+
+// isJobKey reports whether a key belongs to a job.
+func isJobKey(jobID, key string) bool {
+	return key == jobID || strings.HasPrefix(key, jobID+":")
+}
+
+// ownerJob returns the job a key belongs to.
+func ownerJob(key string) string {
+	jobID, _, _ := strings.Cut(key, ":")
+	return jobID
+}
+
+// keyJobID returns the job of a key with the given suffix, e.g. ":status".
+func keyJobID(key, suffix string) (string, bool) {
+	jobID, ok := strings.CutSuffix(key, suffix)
+	if !ok || jobID == "" || strings.Contains(jobID, ":") {
+		return "", false
+	}
+	return jobID, true
+}
+
+// statusJobIDs returns the distinct jobs having a status or progress key among keys.
+func statusJobIDs(keys []string) []string {
+	var jobIDs []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		for _, suffix := range []string{":status", ":progress"} {
+			if jobID, ok := keyJobID(key, suffix); ok && !seen[jobID] {
+				seen[jobID] = true
+				jobIDs = append(jobIDs, jobID)
+			}
+		}
+	}
+	return jobIDs
+}
+
+// AbandonedJob is the error recorded on jobs the sweeper finds running without progress.
+const AbandonedJob = "abandoned"
+
+// errJobUnchanged aborts the update of a job that changed since it was found abandoned.
+var errJobUnchanged = errors.New("job unchanged")
+
+// sweepOrphans finds the jobs among jobIDs whose status or progress keys outlived them:
+// jobs without a result that are neither failed, queued nor running with a heartbeat
+// within heartbeatTimeout.
+// Their status and progress keys are removed with del, and abandoned running jobs are
+// marked failed in the index. It returns the swept jobs.
+func sweepOrphans(s Store, jobIDs []string, heartbeatTimeout time.Duration, del func(keys ...string) error) ([]string, error) {
+	now := time.Now()
+	var swept []string
+	for _, jobID := range jobIDs {
+		hasResult, err := s.HasJobResults(jobID)
+		if err != nil {
+			return swept, err
+		}
+		if hasResult {
+			continue
+		}
+
+		meta, err := s.GetJobMeta(jobID)
+		if err != nil && err != ErrNotFound {
+			return swept, err
+		}
+		if meta != nil {
+			if meta.Status == models.JobFailed {
+				continue // The status holds the failed step until the job expires
+			}
+			if meta.Status == models.JobQueued {
+				continue // The queue runs the job or dead-letters it, failing it
+			}
+			if meta.Status == models.JobRunning && now.Sub(time.Unix(lastHeartbeat(meta), 0)) < heartbeatTimeout {
+				continue
+			}
+		}
+
+		if err := del(jobID+":status", jobID+":progress"); err != nil {
+			return swept, err
+		}
+		swept = append(swept, jobID)
+
+		if meta != nil && meta.Status == models.JobRunning {
+			err := s.UpdateJobMeta(jobID, func(meta *models.JobMeta) (time.Duration, error) {
+				expiration, ok := remaining(meta, now)
+				if meta.Status != models.JobRunning || !ok || now.Sub(time.Unix(lastHeartbeat(meta), 0)) < heartbeatTimeout {
+					return 0, errJobUnchanged
+				}
+				meta.Status = models.JobFailed
+				meta.Error = AbandonedJob
+				meta.FinishedAt = now.Unix()
+				return expiration, nil
+			})
+			if err != nil && err != errJobUnchanged && err != ErrNotFound {
+				return swept, err
+			}
+		}
+	}
+	return swept, nil
+}
+
+// lastHeartbeat returns when the worker running a job last reported it alive, or when the
+// job started for jobs stored before heartbeats.
+func lastHeartbeat(meta *models.JobMeta) int64 {
+	switch {
+	case meta.HeartbeatAt != 0:
+		return meta.HeartbeatAt
+	case meta.StartedAt != 0:
+		return meta.StartedAt
+	default:
+		return meta.CreatedAt
+	}
+}
+
+// remaining returns the expiration left to a job, zero when pinned. It is unknown for
+// jobs indexed before expirations were recorded.
+func remaining(meta *models.JobMeta, now time.Time) (time.Duration, bool) {
+	if meta.Pinned {
+		return 0, true
+	}
+	if meta.ExpiresAt == 0 {
+		return 0, false
+	}
+	return max(time.Unix(meta.ExpiresAt, 0).Sub(now), time.Second), true
+}
+
+// sweepBlobs removes the blobs no job refers to anymore, once put at least minAge ago so
+// uploads not indexed yet are kept. It returns the removed blobs.
+func sweepBlobs(s Store, blobs blob.Store, minAge time.Duration) ([]string, error) {
+	jobs, _, err := s.ListJobs(JobQuery{})
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for _, job := range jobs {
+		used[job.SourceHash] = true
+		used[job.BaselineHash] = true
+	}
+
+	stored, err := blobs.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, b := range stored {
+		if used[b.Hash] || time.Since(b.StoredAt) < minAge {
+			continue
+		}
+		if err := blobs.Delete(b.Hash); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b.Hash)
+	}
+	return removed, nil
+}
+
+// uploadMinAge is how long an upload is kept before the sweeper removes it unused, so
+// uploads whose job is not indexed yet are kept.
+const uploadMinAge = 2 * time.Hour
+
+// RunSweeper removes the status and progress keys of orphaned jobs (see
+// Store.SweepOrphans) and the uploads of expired or deleted jobs every interval. Running
+// jobs without a heartbeat for heartbeatTimeout are failed. It never returns.
+func RunSweeper(s Store, blobs blob.Store, interval, heartbeatTimeout time.Duration) {
+	for range time.Tick(interval) {
+		swept, err := s.SweepOrphans(heartbeatTimeout)
+		if err != nil {
+			fmt.Printf("Warning: Failed to sweep orphaned jobs: %v\n", err)
+		}
+		if len(swept) > 0 {
+			fmt.Printf("Swept %d orphaned jobs\n", len(swept))
+		}
+
+		removed, err := sweepBlobs(s, blobs, uploadMinAge)
+		if err != nil {
+			fmt.Printf("Warning: Failed to sweep uploads: %v\n", err)
+		}
+		if len(removed) > 0 {
+			fmt.Printf("Removed %d uploads of expired jobs\n", len(removed))
+		}
+	}
+}
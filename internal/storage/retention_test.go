@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/models"
+)
+
+func TestSweepOrphans(t *testing.T) {
+	now := time.Now().Unix()
+	stale := time.Now().Add(-3 * time.Hour).Unix()
+	tests := []struct {
+		name      string
+		meta      *models.JobMeta // Nil for a job without metadata
+		result    bool
+		swept     bool
+		newStatus string // Status in the index after the sweep
+	}{
+		{"without metadata", nil, false, true, ""},
+		{"completed", &models.JobMeta{Status: models.JobCompleted}, true, false, models.JobCompleted},
+		{"completed without result", &models.JobMeta{Status: models.JobCompleted}, false, true, models.JobCompleted},
+		{"failed", &models.JobMeta{Status: models.JobFailed}, false, false, models.JobFailed},
+		{"queued", &models.JobMeta{Status: models.JobQueued, CreatedAt: stale}, false, false, models.JobQueued},
+		{"running", &models.JobMeta{Status: models.JobRunning, CreatedAt: stale, StartedAt: now}, false, false, models.JobRunning},
+		{"running long", &models.JobMeta{Status: models.JobRunning, CreatedAt: stale, StartedAt: stale, HeartbeatAt: now}, false, false, models.JobRunning},
+		{"abandoned", &models.JobMeta{Status: models.JobRunning, CreatedAt: stale, StartedAt: stale, HeartbeatAt: stale, ExpiresAt: now + 3600}, false, true, models.JobFailed},
+		{"abandoned before heartbeats", &models.JobMeta{Status: models.JobRunning, CreatedAt: stale, StartedAt: stale, ExpiresAt: now + 3600}, false, true, models.JobFailed},
+	}
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var want []string
+			for _, tt := range tests {
+				jobID := strings.ReplaceAll(tt.name, " ", "-")
+				if tt.meta != nil {
+					meta := *tt.meta
+					meta.ID = jobID
+					if err := s.SaveJobMeta(&meta, time.Hour); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tt.result {
+					if err := s.SaveResult(jobID, testResult(), time.Hour); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := s.SetJobStatus(jobID, "Comparando", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+				if tt.swept {
+					want = append(want, jobID)
+				}
+			}
+
+			swept, err := s.SweepOrphans(2 * time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(swept)
+			sort.Strings(want)
+			if !reflect.DeepEqual(swept, want) {
+				t.Errorf("SweepOrphans = %v, want %v", swept, want)
+			}
+
+			for _, tt := range tests {
+				jobID := strings.ReplaceAll(tt.name, " ", "-")
+				status, _ := s.GetJobStatus(jobID)
+				if tt.swept && status == "Comparando" {
+					t.Errorf("%s: status kept after the sweep", tt.name)
+				}
+				if !tt.swept && status == "Job criado" {
+					t.Errorf("%s: status removed by the sweep", tt.name)
+				}
+				if tt.meta == nil {
+					continue
+				}
+				meta, err := s.GetJobMeta(jobID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if meta.Status != tt.newStatus {
+					t.Errorf("%s: status %q after the sweep, want %q", tt.name, meta.Status, tt.newStatus)
+				}
+				if tt.newStatus == models.JobFailed && tt.meta.Status == models.JobRunning && meta.Error != AbandonedJob {
+					t.Errorf("%s: error %q, want %q", tt.name, meta.Error, AbandonedJob)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepBlobs(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := blob.NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(content string, age time.Duration) string {
+		hash, _, err := blobs.Put(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		storedAt := time.Now().Add(-age)
+		if err := os.Chtimes(filepath.Join(dir, hash[:2], hash), storedAt, storedAt); err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	source := put("source", time.Hour)
+	baseline := put("baseline", time.Hour)
+	orphan := put("orphan", time.Hour)
+	recent := put("recent", 0)
+
+	s := NewMemoryStore()
+	if err := s.SaveJobMeta(&models.JobMeta{ID: "job", SourceHash: source, BaselineHash: baseline}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := sweepBlobs(s, blobs, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{orphan}) {
+		t.Errorf("sweepBlobs removed %v, want only the orphan", removed)
+	}
+	for _, hash := range []string{source, baseline, recent} {
+		r, err := blobs.Open(hash)
+		if err != nil {
+			t.Errorf("blob %s removed: %v", hash, err)
+			continue
+		}
+		r.Close()
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		meta  models.JobMeta
+		want  time.Duration
+		known bool
+	}{
+		{"pinned", models.JobMeta{Pinned: true, ExpiresAt: 2000}, 0, true},
+		{"expiring", models.JobMeta{ExpiresAt: 1060}, time.Minute, true},
+		{"past its expiration", models.JobMeta{ExpiresAt: 900}, time.Second, true},
+		{"indexed before expirations", models.JobMeta{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known := remaining(&tt.meta, now)
+			if got != tt.want || known != tt.known {
+				t.Errorf("remaining = %v, %v, want %v, %v", got, known, tt.want, tt.known)
+			}
+		})
+	}
+}
+
+func TestJobKeys(t *testing.T) {
+	tests := []struct {
+		key      string
+		jobID    string
+		owner    string
+		jobKey   bool
+		resultOf bool
+	}{
+		{"job", "job", "job", true, true},
+		{"job:chunk:3", "job", "job", true, true},
+		{"job:threeway:chunk:0", "job", "job", true, true},
+		{"job:status", "job", "job", true, false},
+		{"job:meta", "job", "job", true, false},
+		{"jobs", "job", "jobs", false, false},
+		{"other:status", "job", "other", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := ownerJob(tt.key); got != tt.owner {
+				t.Errorf("ownerJob = %q, want %q", got, tt.owner)
+			}
+			if got := isJobKey(tt.jobID, tt.key); got != tt.jobKey {
+				t.Errorf("isJobKey = %v, want %v", got, tt.jobKey)
+			}
+			if got := isResultKey(tt.jobID, tt.key); got != tt.resultOf {
+				t.Errorf("isResultKey = %v, want %v", got, tt.resultOf)
+			}
+		})
+	}
+}
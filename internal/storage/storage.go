@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+// ErrNotFound is returned when a result, job input, cache entry or ignore rule does not
+// exist or has expired.
+var ErrNotFound = errors.New("not found")
+
+// Store persists comparison results, job status and progress, job inputs, the API product
+// cache and ignore rules. Uploaded files are kept in a blob store. An expiration of 0 keeps a key until it is deleted.
+type Store interface {
+	SaveResult(jobID string, result *models.ComparisonResult, expiration time.Duration) error
+	GetResult(jobID string) (*models.ComparisonResult, error)
+	GetResultSummary(jobID string) (*models.ComparisonResult, error)
+	GetErrors(jobID string, q ErrorQuery, offset, limit int) ([]models.ErrorDetail, int, error)
+	ReadErrors(jobID string, q ErrorQuery) (*ErrorIterator, error)
+	GetThreeWay(jobID string, q ThreeWayQuery, offset, limit int) (*models.ThreeWayResult, int, error)
+	LinkResult(jobID, targetID string, expiration time.Duration) error
+	NewErrorWriter(jobID string, expiration time.Duration) ErrorWriter
+	EncodingStats() EncodingStats
+
+	GetJobSource(jobID string) ([]byte, error)
+	SaveJobAPIProducts(jobID string, products []models.Product, expiration time.Duration) error
+	GetJobAPIProducts(jobID string) ([]models.Product, error)
+
+	SaveJobMeta(meta *models.JobMeta, expiration time.Duration) error
+	GetJobMeta(jobID string) (*models.JobMeta, error)
+	UpdateJobMeta(jobID string, update JobUpdate) error
+	ListJobs(q JobQuery) ([]models.JobMeta, int, error)
+	SetFingerprint(fingerprint, jobID string, expiration time.Duration) error
+	GetFingerprint(fingerprint string) (string, error)
+	GetJobStatus(jobID string) (string, error)
+	GetJobProgress(jobID string) (int, error)
+	HasJobResults(jobID string) (bool, error)
+	SetJobStatus(jobID, status string, expiration time.Duration) error
+	SetJobProgress(jobID string, progress int, expiration time.Duration) error
+
+	SetJobExpiration(jobID string, expiration time.Duration) error
+	DeleteJob(jobID string) error
+	ClearJobResult(jobID string) error
+	SweepOrphans(heartbeatTimeout time.Duration) ([]string, error)
+
+	SaveAPIProducts(products []models.Product) (string, error)
+	GetAPIProducts() ([]models.Product, string, error)
+	GetAPIProductsVersion() (string, error)
+
+	SaveIgnoreRule(rule *models.IgnoreRule) error
+	GetIgnoreRule(id string) (*models.IgnoreRule, error)
+	GetIgnoreRules() ([]models.IgnoreRule, error)
+	DeleteIgnoreRule(id string) error
+}
+
+// JobUpdate changes the metadata of a job and returns the expiration to save it with. An
+// error leaves the metadata unchanged and is returned by Store.UpdateJobMeta, which
+// applies the update atomically and may call it again when another update got in first.
+// It returns ErrNotFound when the job has no metadata.
+type JobUpdate func(meta *models.JobMeta) (time.Duration, error)
+
+// API products cache keys: the cached products and their SnapshotVersion, computed once
+// when they are cached.
+const (
+	apiProductsKey        = "api_products_cache"
+	apiProductsVersionKey = "api_products_cache:version"
+)
+
+// SnapshotVersion identifies the content of an API snapshot: the hex SHA-256 of its JSON.
+func SnapshotVersion(products []models.Product) string {
+	data, _ := json.Marshal(products)
+	return snapshotVersion(data)
+}
+
+func snapshotVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrorWriter appends discrepancies of a streaming comparison to a job's error list.
+type ErrorWriter interface {
+	WriteErrors(errors []models.ErrorDetail) error
+}
+
+// Storage backends.
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendFS     = "fs"
+)
+
+// Config selects and configures a storage backend.
+type Config struct {
+	Backend   string // redis (default), memory or fs
+	RedisAddr string // Address of the Redis server, for the redis backend
+	Dir       string // Directory holding the files, for the fs backend
+
+	Format      string // Format of stored results: json (default) or binary
+	Compression string // Compression of stored results: gzip (default) or none
+}
+
+// New returns the storage backend selected by cfg, writing results in the configured
+// format and compression.
+func New(cfg Config) (Store, error) {
+	codec, err := newPayloadCodec(cfg.Format, cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Backend {
+	case "", BackendRedis:
+		r, err := NewRedisClient(cfg.RedisAddr)
+		if err != nil {
+			return nil, err
+		}
+		r.codec = codec
+		return r, nil
+	case BackendMemory:
+		s := NewMemoryStore().(*kvStore)
+		s.codec = codec
+		return s, nil
+	case BackendFS:
+		s, err := NewFSStore(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		s.(*kvStore).codec = codec
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hackathon-go/internal/models"
+)
+
+// testStores returns a store of each backend that runs without a server.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	fsStore, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{BackendMemory: NewMemoryStore(), BackendFS: fsStore}
+}
+
+func testResult() *models.ComparisonResult {
+	return &models.ComparisonResult{
+		Summary: models.Summary{TotalAPIItems: 3, TotalCSVItems: 3, Matched: 1, Mismatched: 1, MissingInAPI: 1},
+		Errors: []models.ErrorDetail{
+			{Type: "mismatch", APIID: 1, CSVLine: 2, Nome: "Arroz", Fields: map[string]models.MismatchDetail{"preco": {APIValue: 10.0, CSVValue: 12.5}}},
+			{Type: "missing_in_api", APIID: 3, CSVLine: 4, Nome: "Sal"},
+		},
+		StartedAt:   1700000000,
+		CompletedAt: 1700000001,
+		DurationMs:  1000,
+	}
+}
+
+func TestStoreResult(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.GetResult("job"); err != ErrNotFound {
+				t.Fatalf("GetResult of a missing job: %v, want ErrNotFound", err)
+			}
+
+			want := testResult()
+			if err := s.SaveResult("job", want, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.GetResult("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Errors) != len(want.Errors) || !reflect.DeepEqual(got.Summary, want.Summary) || got.DurationMs != want.DurationMs {
+				t.Errorf("GetResult = %+v, want %+v", got, want)
+			}
+			for i := range got.Errors {
+				if got.Errors[i].Type != want.Errors[i].Type || got.Errors[i].APIID != want.Errors[i].APIID {
+					t.Errorf("error %d = %+v, want %+v", i, got.Errors[i], want.Errors[i])
+				}
+			}
+
+			summary, err := s.GetResultSummary("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Errors != nil || !reflect.DeepEqual(summary.Summary, want.Summary) {
+				t.Errorf("GetResultSummary = %+v", summary)
+			}
+			if ok, _ := s.HasJobResults("job"); !ok {
+				t.Error("HasJobResults = false after SaveResult")
+			}
+		})
+	}
+}
+
+func TestStoreStatusAndProgress(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if status, _ := s.GetJobStatus("job"); status != "Job criado" {
+				t.Errorf("status of a new job = %q", status)
+			}
+			if _, err := s.GetJobProgress("job"); err != ErrNotFound {
+				t.Errorf("progress of a new job: %v, want ErrNotFound", err)
+			}
+
+			if err := s.SetJobStatus("job", "Comparando", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetJobProgress("job", 42, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := s.GetJobStatus("job"); status != "Comparando" {
+				t.Errorf("status = %q, want Comparando", status)
+			}
+			if progress, _ := s.GetJobProgress("job"); progress != 42 {
+				t.Errorf("progress = %d, want 42", progress)
+			}
+
+			// A job with a result and no progress key is complete
+			if err := s.SaveResult("done", testResult(), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if progress, _ := s.GetJobProgress("done"); progress != 100 {
+				t.Errorf("progress of a completed job = %d, want 100", progress)
+			}
+			if status, _ := s.GetJobStatus("done"); status != "Processamento finalizado" {
+				t.Errorf("status of a completed job = %q", status)
+			}
+		})
+	}
+}
+
+func TestStoreExpiration(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.SetJobStatus("job", "Comparando", time.Nanosecond); err != nil {
+				t.Fatal(err)
+			}
+			// The fs backend records expirations to the second
+			time.Sleep(1100 * time.Millisecond)
+			if status, _ := s.GetJobStatus("job"); status != "Job criado" {
+				t.Errorf("status after expiration = %q", status)
+			}
+		})
+	}
+}
+
+func TestStoreAPIProducts(t *testing.T) {
+	products := []models.Product{{ID: 1, Nome: "Arroz"}, {ID: 2, Nome: "Sal"}}
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := s.GetAPIProducts(); err != ErrNotFound {
+				t.Errorf("GetAPIProducts of an empty cache: %v, want ErrNotFound", err)
+			}
+			if _, err := s.GetAPIProductsVersion(); err != ErrNotFound {
+				t.Errorf("GetAPIProductsVersion of an empty cache: %v, want ErrNotFound", err)
+			}
+			saved, err := s.SaveAPIProducts(products)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := SnapshotVersion(products); saved != want {
+				t.Errorf("SaveAPIProducts version = %q, want %q", saved, want)
+			}
+			got, version, err := s.GetAPIProducts()
+			if err != nil || !reflect.DeepEqual(got, products) || version != saved {
+				t.Errorf("GetAPIProducts = %+v, %q, %v", got, version, err)
+			}
+			if version, err := s.GetAPIProductsVersion(); err != nil || version != saved {
+				t.Errorf("GetAPIProductsVersion = %q, %v, want %q", version, err, saved)
+			}
+
+			if err := s.SaveJobAPIProducts("job", products[:1], time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			got, err = s.GetJobAPIProducts("job")
+			if err != nil || !reflect.DeepEqual(got, products[:1]) {
+				t.Errorf("GetJobAPIProducts = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestStoreIgnoreRules(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			rules := []models.IgnoreRule{
+				{ID: "b", Field: "preco", CreatedAt: 2},
+				{ID: "a", Field: "nome", CreatedAt: 2},
+				{ID: "c", Field: "estoque", CreatedAt: 1},
+			}
+			for i := range rules {
+				if err := s.SaveIgnoreRule(&rules[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.GetIgnoreRules()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, rule := range got {
+				ids = append(ids, rule.ID)
+			}
+			if !reflect.DeepEqual(ids, []string{"c", "a", "b"}) {
+				t.Errorf("rules in order %v, want [c a b]", ids)
+			}
+
+			if rule, err := s.GetIgnoreRule("a"); err != nil || rule.Field != "nome" {
+				t.Errorf("GetIgnoreRule(a) = %+v, %v", rule, err)
+			}
+			if err := s.DeleteIgnoreRule("a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.DeleteIgnoreRule("a"); err != ErrNotFound {
+				t.Errorf("second DeleteIgnoreRule: %v, want ErrNotFound", err)
+			}
+			if _, err := s.GetIgnoreRule("a"); err != ErrNotFound {
+				t.Errorf("GetIgnoreRule of a deleted rule: %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFSStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveResult("job", testResult(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetJobStatus("gone", "Comparando", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	reopened, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.GetResult("job")
+	if err != nil || len(got.Errors) != 2 {
+		t.Errorf("GetResult after reopening = %+v, %v", got, err)
+	}
+	if status, _ := reopened.GetJobStatus("gone"); status != "Job criado" {
+		t.Errorf("expired status after reopening = %q", status)
+	}
+}
+
+func TestNewRejectsUnknownBackend(t *testing.T) {
+	if _, err := New(Config{Backend: "sqlite"}); err == nil {
+		t.Error("New accepted an unknown backend")
+	}
+	if _, err := New(Config{Backend: BackendFS}); err == nil {
+		t.Error("New accepted the fs backend without a directory")
+	}
+	if _, err := New(Config{Backend: BackendMemory, Format: "xml"}); err == nil {
+		t.Error("New accepted an unknown format")
+	}
+}
+
+func TestFSStoreExpiryFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Expirations recorded in a single file before each key had its own
+	legacy := map[string]int64{"gone:status": 1, "kept:status": time.Now().Add(time.Hour).Unix()}
+	data, _ := json.Marshal(legacy)
+	for key := range legacy {
+		f := &fsKV{dir: dir, expires: map[string]int64{}}
+		if err := f.set(key, []byte("Comparando"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, fsExpiresFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fsExpiresFile)); !os.IsNotExist(err) {
+		t.Errorf("%s kept after opening: %v", fsExpiresFile, err)
+	}
+	if status, _ := s.GetJobStatus("gone"); status != "Job criado" {
+		t.Errorf("status of an expired job = %q", status)
+	}
+	if status, _ := s.GetJobStatus("kept"); status != "Comparando" {
+		t.Errorf("status of a live job = %q", status)
+	}
+
+	// Keeping a key until deleted removes its expiry file
+	if err := s.SetJobExpiration("kept", 0); err != nil {
+		t.Fatal(err)
+	}
+	f := s.(*kvStore).kv.(*fsKV)
+	if _, err := os.Stat(f.expiryPath("kept:status")); !os.IsNotExist(err) {
+		t.Errorf("expiry file kept for a key without expiration: %v", err)
+	}
+	if err := s.SetJobExpiration("kept", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.(*kvStore).kv.(*fsKV).expires["kept:status"]; got < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("expiration after reopening = %d", got)
+	}
+
+	if err := reopened.DeleteJob("kept"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "kept") {
+			t.Errorf("%s left after deleting the job", entry.Name())
+		}
+	}
+}
+
+func TestFSKVStoresPayloadsOnce(t *testing.T) {
+	dir := t.TempDir()
+	f := &fsKV{dir: dir, expires: make(map[string]int64)}
+	payload, err := defaultPayloadCodec().encode(testResult())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Codec payloads are written as they are, other values gzipped
+	if err := f.set("payload", payload, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(f.path("payload")); err != nil || !bytes.Equal(data, payload) {
+		t.Errorf("payload file = %x, %v, want the payload itself", data, err)
+	}
+	if err := f.set("json", []byte(`{"a":1}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(f.path("json")); err != nil || len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Errorf("JSON file = %x, %v, want gzip", data, err)
+	}
+
+	// Payloads gzipped by earlier versions stay readable
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(payload)
+	gz.Close()
+	if err := os.WriteFile(f.path("old"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"payload", "json", "old"} {
+		if _, err := f.get(key); err != nil {
+			t.Errorf("get %s: %v", key, err)
+		}
+	}
+	if got, _ := f.get("old"); !bytes.Equal(got, payload) {
+		t.Errorf("old payload = %x, want %x", got, payload)
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hackathon-go/internal/patch"
+	"hackathon-go/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetCorrected returns the uploaded CSV of a job with API values applied to the
+// selected discrepancies, or the patch describing those changes.
+// Query params:
+// - fields: comma-separated fields to correct in every mismatched row (e.g. preco,estoque)
+// - types: comma-separated discrepancy types to correct in full (missing_in_csv appends rows, missing_in_api drops them)
+// - include_suppressed: true to also correct discrepancies suppressed by ignore rules
+// - format: "csv" (default) for the corrected file or "patch" for the JSON change list
+//
+// Examples:
+// - GET /results/123/corrected?fields=preco - Fix every price
+// - GET /results/123/corrected?types=missing_in_csv,missing_in_api&format=patch - Rows that would be added and dropped
+func (h *ResultsHandler) HandleGetCorrected(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if jobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_id is required"})
+		return
+	}
+
+	sel := patch.Selection{
+		Fields:            splitList(c.Query("fields")),
+		Types:             splitList(c.Query("types")),
+		IncludeSuppressed: c.Query("include_suppressed") == "true",
+	}
+	if err := sel.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "patch" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or patch"})
+		return
+	}
+
+	result, err := h.Store.GetResult(jobID)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
+
+	source, err := jobUpload(h.Store, h.Blobs, jobID, false)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusConflict, gin.H{"error": "the uploaded file of this job was not kept"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve uploaded file"})
+		return
+	}
+	defer source.Close()
+	apiProducts, err := h.Store.GetJobAPIProducts(jobID)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusConflict, gin.H{"error": "the API snapshot of this job was not kept"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve API snapshot"})
+		return
+	}
+
+	var corrected bytes.Buffer
+	changes, err := patch.Apply(source, &corrected, result.Errors, apiProducts, sel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to correct file: " + err.Error()})
+		return
+	}
+
+	if format == "patch" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"patch-%s.json\"", jobID))
+		c.JSON(http.StatusOK, changes)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"corrected-%s.csv\"", jobID))
+	c.Header("X-Changes-Replaced", strconv.Itoa(changes.Replaced))
+	c.Header("X-Changes-Added", strconv.Itoa(changes.Added))
+	c.Header("X-Changes-Removed", strconv.Itoa(changes.Removed))
+	c.Data(http.StatusOK, "text/csv", corrected.Bytes())
+}
+
+// splitList splits a comma-separated query parameter, ignoring empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/patch"
+	"hackathon-go/internal/storage"
+)
+
+const correctedSource = `id,nome,categoria,preco,estoque,fornecedor
+1,Caneta,Papelaria,2.50,10,Bic
+2,Lapis,Papelaria,1.00,5,Faber
+`
+
+// correctedJob stores a completed job whose upload has a price mismatch on its first row,
+// keeping the uploaded file and the API snapshot as asked.
+func correctedJob(t *testing.T, store storage.Store, blobs blob.Store, jobID string, keepSource, keepSnapshot bool) {
+	t.Helper()
+	meta := &models.JobMeta{ID: jobID, Status: models.JobCompleted}
+	if keepSource {
+		hash, _, err := blobs.Put(strings.NewReader(correctedSource))
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta.SourceHash = hash
+	} else {
+		meta.SourceHash = strings.Repeat("0", 64)
+	}
+	if err := store.SaveJobMeta(meta, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	result := &models.ComparisonResult{Errors: []models.ErrorDetail{{
+		Type: "mismatch", CSVLine: 2, APIID: 1, CSVID: 1,
+		Fields: map[string]models.MismatchDetail{"preco": {APIValue: 3.0, CSVValue: 2.5}},
+	}}}
+	if err := store.SaveResult(jobID, result, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if keepSnapshot {
+		products := []models.Product{
+			{ID: 1, Nome: "Caneta", Categoria: "Papelaria", Preco: 300, Estoque: 10, Fornecedor: "Bic"},
+			{ID: 2, Nome: "Lapis", Categoria: "Papelaria", Preco: 100, Estoque: 5, Fornecedor: "Faber"},
+		}
+		if err := store.SaveJobAPIProducts(jobID, products, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func correctedRouter(t *testing.T) (*gin.Engine, storage.Store, blob.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	blobs, err := blob.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStore()
+	h := &ResultsHandler{Store: store, Blobs: blobs}
+	router := gin.New()
+	router.GET("/results/:job_id/corrected", h.HandleGetCorrected)
+	return router, store, blobs
+}
+
+func TestGetCorrected(t *testing.T) {
+	router, store, blobs := correctedRouter(t)
+	correctedJob(t, store, blobs, "job", true, true)
+
+	w := serve(router, http.MethodGet, "/results/job/corrected?fields=preco", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("corrected = %d %s, want 200", w.Code, w.Body.String())
+	}
+	want := strings.Replace(correctedSource, "2.50", "3.00", 1)
+	if w.Body.String() != want {
+		t.Errorf("corrected csv:\n%s\nwant:\n%s", w.Body.String(), want)
+	}
+	if got := w.Header().Get("X-Changes-Replaced"); got != "1" {
+		t.Errorf("X-Changes-Replaced = %q, want 1", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "corrected-job.csv") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	w = serve(router, http.MethodGet, "/results/job/corrected?types=mismatch&format=patch", "")
+	var changes patch.Patch
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || changes.Replaced != 1 || len(changes.Changes) != 1 || changes.Changes[0].To != "3.00" {
+		t.Errorf("patch = %d %s, want the price replaced", w.Code, w.Body.String())
+	}
+}
+
+func TestGetCorrectedErrors(t *testing.T) {
+	router, store, blobs := correctedRouter(t)
+	correctedJob(t, store, blobs, "job", true, true)
+	correctedJob(t, store, blobs, "no-source", false, true)
+	correctedJob(t, store, blobs, "no-snapshot", true, false)
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		want   string
+	}{
+		{"no selection", "/results/job/corrected", http.StatusBadRequest, "select at least one"},
+		{"unknown field", "/results/job/corrected?fields=prco", http.StatusBadRequest, "unknown field"},
+		{"unknown type", "/results/job/corrected?types=typo", http.StatusBadRequest, "unknown discrepancy type"},
+		{"rule violations", "/results/job/corrected?types=rule_violation", http.StatusBadRequest, "no API value"},
+		{"format", "/results/job/corrected?fields=preco&format=xlsx", http.StatusBadRequest, "format must be csv or patch"},
+		{"unknown job", "/results/missing/corrected?fields=preco", http.StatusNotFound, "job not found or expired"},
+		{"upload not kept", "/results/no-source/corrected?fields=preco", http.StatusConflict, "uploaded file of this job was not kept"},
+		{"snapshot not kept", "/results/no-snapshot/corrected?fields=preco", http.StatusConflict, "API snapshot of this job was not kept"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("GET %s = %d %s, want %d mentioning %q", tt.target, w.Code, w.Body.String(), tt.code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+	"time"
+)
+
+// comparisonInputs is everything a comparison result depends on besides the API snapshot.
+// Two uploads with the same inputs compared against the same snapshot give the same result.
+// The options hold the ignore rules in effect at upload, see withIgnoreRules.
+type comparisonInputs struct {
+	SourceHash   string             `json:"source_hash"`
+	BaselineHash string             `json:"baseline_hash,omitempty"`
+	Mode         string             `json:"mode,omitempty"`
+	Streaming    bool               `json:"streaming,omitempty"`
+	Options      comparison.Options `json:"options"`
+}
+
+// fingerprint identifies the comparison of the inputs against an API snapshot, given by
+// its storage.SnapshotVersion.
+func (in comparisonInputs) fingerprint(snapshot string) string {
+	// The number of workers changes how fast the result is computed, not the result
+	in.Options.Workers = 0
+	data, _ := json.Marshal(struct {
+		Inputs   comparisonInputs `json:"inputs"`
+		Snapshot string           `json:"snapshot"`
+	}{in, snapshot})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedSnapshot returns the version of the cached API snapshot, empty when none is
+// cached. Uploads are not held up fetching the API to look for an identical job.
+func (h *UploadHandler) cachedSnapshot() string {
+	version, err := h.Store.GetAPIProductsVersion()
+	if err != nil {
+		return ""
+	}
+	return version
+}
+
+// identicalJob returns the completed job that compared the same inputs against an API
+// snapshot of the given version, nil when there is none or no snapshot is given. The
+// content of the snapshot decides, not when it was fetched: a job compared against an
+// earlier fetch returning the same products is reused.
+func (h *UploadHandler) identicalJob(inputs comparisonInputs, snapshot string) *models.JobMeta {
+	if snapshot == "" {
+		return nil
+	}
+	jobID, err := h.Store.GetFingerprint(inputs.fingerprint(snapshot))
+	if err != nil {
+		return nil
+	}
+	meta, err := h.Store.GetJobMeta(jobID)
+	if err != nil || meta.Status != models.JobCompleted {
+		return nil
+	}
+	if hasResults, err := h.Store.HasJobResults(jobID); err != nil || !hasResults {
+		return nil
+	}
+	return meta
+}
+
+// linkMargin is how much longer than a job reusing its result the original is kept, as
+// the keys of the new job are written after the original is extended.
+const linkMargin = time.Minute
+
+// errNotReusable is returned when the job whose result would be reused is no longer complete.
+var errNotReusable = errors.New("job is no longer complete")
+
+// linkJob completes a job with the result of the identical job original instead of
+// running the comparison again. The original records the link first, so it is not deleted
+// while its result is reused, and is kept at least as long as the new job.
+func (h *UploadHandler) linkJob(jobID string, original *models.JobMeta) error {
+	extend, extended := false, time.Duration(0)
+	err := h.Store.UpdateJobMeta(original.ID, func(meta *models.JobMeta) (time.Duration, error) {
+		if meta.Status != models.JobCompleted {
+			return 0, errNotReusable
+		}
+		meta.LinkedBy = append(withoutJob(meta.LinkedBy, jobID), jobID)
+		expiration := storedExpiration(meta)
+		extend = expiration > 0 && (h.Retention <= 0 || expiration < h.Retention+linkMargin)
+		if extend {
+			expiration = 0
+			if h.Retention > 0 {
+				expiration = h.Retention + linkMargin
+			}
+			extended = expiration
+			meta.ExpiresAt = expiresAt(expiration)
+		}
+		return expiration, nil
+	})
+	if err != nil {
+		return err
+	}
+	if extend {
+		if err := h.Store.SetJobExpiration(original.ID, extended); err != nil {
+			fmt.Printf("Warning: Failed to extend the retention of job %s: %v\n", original.ID, err)
+		}
+		if err := h.Store.SetFingerprint(original.Fingerprint, original.ID, extended); err != nil {
+			fmt.Printf("Warning: Failed to record fingerprint of job %s: %v\n", original.ID, err)
+		}
+	}
+
+	if err := h.Store.LinkResult(jobID, original.ID, h.Retention); err != nil {
+		return err
+	}
+	h.updateJob(jobID, func(meta *models.JobMeta) {
+		meta.Status = models.JobCompleted
+		meta.FinishedAt = time.Now().Unix()
+		meta.CSVRows = original.CSVRows
+		meta.APIRows = original.APIRows
+		meta.Counts = original.Counts
+		meta.Fingerprint = original.Fingerprint
+		meta.CachedFrom = original.ID
+	})
+	h.sendProgress(jobID, "finished", 100.0)
+	return nil
+}
+
+// liveLinks returns the jobs still reusing the result of a job, or about to as they are
+// still queued. Links of jobs that expired or were deleted are skipped.
+func liveLinks(store storage.Store, meta *models.JobMeta) []*models.JobMeta {
+	var links []*models.JobMeta
+	for _, id := range meta.LinkedBy {
+		link, err := store.GetJobMeta(id)
+		if err == nil && (link.CachedFrom == meta.ID || link.CachedFrom == "" && unfinished(link)) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// withoutJob returns ids without jobID.
+func withoutJob(ids []string, jobID string) []string {
+	kept := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != jobID {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+)
+
+func TestFingerprint(t *testing.T) {
+	snapshot := storage.SnapshotVersion([]models.Product{{ID: 1, Nome: "Arroz", Preco: 1990}})
+	base := comparisonInputs{SourceHash: "abc", Options: comparison.DefaultOptions()}
+	want := base.fingerprint(snapshot)
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name     string
+		change   func(in *comparisonInputs)
+		snapshot string
+		same     bool
+	}{
+		{"same inputs", func(in *comparisonInputs) {}, snapshot, true},
+		{"same snapshot content", func(in *comparisonInputs) {}, storage.SnapshotVersion([]models.Product{{ID: 1, Nome: "Arroz", Preco: 1990}}), true},
+		{"worker count", func(in *comparisonInputs) { in.Options.Workers = 8 }, snapshot, true},
+		{"other upload", func(in *comparisonInputs) { in.SourceHash = "def" }, snapshot, false},
+		{"baseline", func(in *comparisonInputs) { in.BaselineHash = "abc" }, snapshot, false},
+		{"mode", func(in *comparisonInputs) { in.Mode = "three_way" }, snapshot, false},
+		{"streaming", func(in *comparisonInputs) { in.Streaming = true }, snapshot, false},
+		{"ignore rule", func(in *comparisonInputs) {
+			in.Options.IgnoreRules = []models.IgnoreRule{{ID: "r", Type: "mismatch"}}
+		}, snapshot, false},
+		{"expired ignore rule", func(in *comparisonInputs) {
+			past := time.Now().Add(-time.Hour).Unix()
+			in.Options.IgnoreRules = comparison.ActiveIgnoreRules([]models.IgnoreRule{{ID: "r", Type: "mismatch", ExpiresAt: &past}}, time.Now())
+		}, snapshot, true},
+		{"other snapshot", func(in *comparisonInputs) {}, storage.SnapshotVersion([]models.Product{{ID: 1, Nome: "Arroz", Preco: 2090}}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := base
+			in.Options.IgnoreRules = nil
+			tt.change(&in)
+			if got := in.fingerprint(tt.snapshot); (got == want) != tt.same {
+				t.Errorf("fingerprint equal to the base one: %v, want %v", got == want, tt.same)
+			}
+		})
+	}
+
+	// Rules in effect with different expiry dates give the same result
+	rule := func(expiresAt int64) []models.IgnoreRule {
+		return []models.IgnoreRule{{ID: "r", Type: "mismatch", ExpiresAt: &expiresAt}}
+	}
+	a, b := base, base
+	a.Options.IgnoreRules = comparison.ActiveIgnoreRules(rule(expiry), time.Now())
+	b.Options.IgnoreRules = comparison.ActiveIgnoreRules(rule(expiry+3600), time.Now())
+	if a.fingerprint(snapshot) != b.fingerprint(snapshot) {
+		t.Error("rules in effect with different expiry dates give different fingerprints")
+	}
+}
+
+func TestWithIgnoreRules(t *testing.T) {
+	store := storage.NewMemoryStore()
+	now := time.Now()
+	past, future := now.Add(-time.Minute).Unix(), now.Add(time.Minute).Unix()
+	for _, rule := range []models.IgnoreRule{
+		{ID: "expired", Type: "mismatch", ExpiresAt: &past, CreatedAt: 1},
+		{ID: "expiring", Type: "mismatch", ExpiresAt: &future, CreatedAt: 2},
+	} {
+		if err := store.SaveIgnoreRule(&rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &UploadHandler{Store: store}
+
+	opts := comparison.DefaultOptions()
+	opts.IgnoreRules = []models.IgnoreRule{{ID: "upload", Field: "preco"}}
+	got := h.withIgnoreRules(opts, now).IgnoreRules
+	if len(got) != 2 || got[0].ID != "upload" || got[1].ID != "expiring" || got[1].ExpiresAt != nil {
+		t.Errorf("rules in effect = %+v, want the upload's and the expiring one without expiry", got)
+	}
+}
+
+// completedJob stores a completed job with a result and the fingerprint of its inputs.
+func completedJob(t *testing.T, store storage.Store, jobID, fingerprint string, expiration time.Duration) *models.JobMeta {
+	t.Helper()
+	meta := &models.JobMeta{ID: jobID, Status: models.JobCompleted, Fingerprint: fingerprint, ExpiresAt: expiresAt(expiration)}
+	if err := store.SaveJobMeta(meta, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveResult(jobID, &models.ComparisonResult{}, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetFingerprint(fingerprint, jobID, expiration); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestIdenticalJob(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := &UploadHandler{Store: store, Retention: time.Hour}
+	snapshot, err := store.SaveAPIProducts([]models.Product{{ID: 1, Nome: "Arroz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := comparisonInputs{SourceHash: "abc", Options: comparison.DefaultOptions()}
+	completedJob(t, store, "original", inputs.fingerprint(snapshot), time.Hour)
+
+	// Uploads read the version cached with the snapshot
+	if got := h.identicalJob(inputs, h.cachedSnapshot()); got == nil || got.ID != "original" {
+		t.Errorf("identicalJob against the cached snapshot = %+v, want the original job", got)
+	}
+
+	if got := h.identicalJob(inputs, snapshot); got == nil || got.ID != "original" {
+		t.Errorf("identicalJob = %+v, want the original job", got)
+	}
+	if got := h.identicalJob(inputs, ""); got != nil {
+		t.Errorf("identicalJob without a snapshot = %+v, want none", got)
+	}
+	if got := h.identicalJob(inputs, storage.SnapshotVersion([]models.Product{{ID: 1, Nome: "Feijão"}})); got != nil {
+		t.Errorf("identicalJob against another snapshot = %+v, want none", got)
+	}
+	other := inputs
+	other.SourceHash = "def"
+	if got := h.identicalJob(other, snapshot); got != nil {
+		t.Errorf("identicalJob of another upload = %+v, want none", got)
+	}
+
+	// A job whose result is gone is not reused
+	if err := store.ClearJobResult("original"); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.identicalJob(inputs, snapshot); got != nil {
+		t.Errorf("identicalJob without a result = %+v, want none", got)
+	}
+}
+
+func TestLinkJobKeepsTheOriginal(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := &UploadHandler{Store: store, Retention: time.Hour}
+	original := completedJob(t, store, "original", "fp", time.Minute)
+	if err := store.SaveJobMeta(&models.JobMeta{ID: "copy", Status: models.JobQueued}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.linkJob("copy", original); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := store.GetJobMeta("original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.LinkedBy) != 1 || meta.LinkedBy[0] != "copy" {
+		t.Errorf("LinkedBy = %v, want [copy]", meta.LinkedBy)
+	}
+	if left := storedExpiration(meta); left < h.Retention {
+		t.Errorf("original kept for %v, want at least the retention of the copy", left)
+	}
+	if links := liveLinks(store, meta); len(links) != 1 {
+		t.Errorf("liveLinks = %+v, want the copy", links)
+	}
+
+	copied, err := store.GetJobMeta("copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Status != models.JobCompleted || copied.CachedFrom != "original" {
+		t.Errorf("copy = %+v, want completed from the original", copied)
+	}
+
+	// A pinned original stays pinned
+	if err := store.UpdateJobMeta("original", func(meta *models.JobMeta) (time.Duration, error) {
+		meta.Pinned, meta.ExpiresAt = true, 0
+		return 0, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveJobMeta(&models.JobMeta{ID: "second", Status: models.JobQueued}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.linkJob("second", original); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := store.GetJobMeta("original"); !meta.Pinned || meta.ExpiresAt != 0 || len(meta.LinkedBy) != 2 {
+		t.Errorf("pinned original after a link = %+v", meta)
+	}
+}
+
+func TestLinkJobRefusesIncompleteOriginal(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := &UploadHandler{Store: store, Retention: time.Hour}
+	original := completedJob(t, store, "original", "fp", time.Hour)
+	if err := store.UpdateJobMeta("original", func(meta *models.JobMeta) (time.Duration, error) {
+		meta.Status = models.JobRunning
+		return time.Hour, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.linkJob("copy", original); err != errNotReusable {
+		t.Errorf("linkJob = %v, want errNotReusable", err)
+	}
+}
+
+func TestLiveLinks(t *testing.T) {
+	store := storage.NewMemoryStore()
+	original := &models.JobMeta{ID: "original", LinkedBy: []string{"linked", "queued", "ran", "deleted"}}
+	for _, meta := range []*models.JobMeta{
+		{ID: "linked", Status: models.JobCompleted, CachedFrom: "original"},
+		{ID: "queued", Status: models.JobQueued},
+		{ID: "ran", Status: models.JobCompleted},
+	} {
+		if err := store.SaveJobMeta(meta, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := liveLinks(store, original)
+	if ids := linkIDs(links); len(ids) != 2 || ids[0] != "linked" || ids[1] != "queued" {
+		t.Errorf("liveLinks = %v, want [linked queued]", ids)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// IgnoreRulesHandler handles the CRUD endpoints of the ignore rules applied to comparisons.
+type IgnoreRulesHandler struct {
+	Store storage.Store
+}
+
+// HandleListIgnoreRules returns every ignore rule, including expired ones.
+func (h *IgnoreRulesHandler) HandleListIgnoreRules(c *gin.Context) {
+	rules, err := h.Store.GetIgnoreRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve ignore rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// HandleGetIgnoreRule returns a single ignore rule.
+func (h *IgnoreRulesHandler) HandleGetIgnoreRule(c *gin.Context) {
+	rule, err := h.Store.GetIgnoreRule(c.Param("rule_id"))
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ignore rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve ignore rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// HandleCreateIgnoreRule validates and stores a new ignore rule.
+func (h *IgnoreRulesHandler) HandleCreateIgnoreRule(c *gin.Context) {
+	var rule models.IgnoreRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ignore rule: " + err.Error()})
+		return
+	}
+
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = time.Now().Unix()
+	h.saveRule(c, &rule, http.StatusCreated)
+}
+
+// HandleUpdateIgnoreRule replaces an existing ignore rule, keeping its ID and creation time.
+func (h *IgnoreRulesHandler) HandleUpdateIgnoreRule(c *gin.Context) {
+	existing, err := h.Store.GetIgnoreRule(c.Param("rule_id"))
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ignore rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve ignore rule"})
+		return
+	}
+
+	var rule models.IgnoreRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ignore rule: " + err.Error()})
+		return
+	}
+
+	rule.ID = existing.ID
+	rule.CreatedAt = existing.CreatedAt
+	h.saveRule(c, &rule, http.StatusOK)
+}
+
+// HandleDeleteIgnoreRule removes an ignore rule.
+func (h *IgnoreRulesHandler) HandleDeleteIgnoreRule(c *gin.Context) {
+	err := h.Store.DeleteIgnoreRule(c.Param("rule_id"))
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ignore rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete ignore rule"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// saveRule validates a rule, stores it and writes it back with the given status.
+func (h *IgnoreRulesHandler) saveRule(c *gin.Context, rule *models.IgnoreRule, status int) {
+	if rule.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	if err := comparison.ValidateIgnoreRule(*rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Store.SaveIgnoreRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save ignore rule"})
+		return
+	}
+	c.JSON(status, rule)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+)
+
+// serve sends a request with an optional JSON body to router and returns the response.
+func serve(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func ignoreRulesRouter(store storage.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &IgnoreRulesHandler{Store: store}
+	router := gin.New()
+	router.GET("/ignore-rules", h.HandleListIgnoreRules)
+	router.POST("/ignore-rules", h.HandleCreateIgnoreRule)
+	router.GET("/ignore-rules/:rule_id", h.HandleGetIgnoreRule)
+	router.PUT("/ignore-rules/:rule_id", h.HandleUpdateIgnoreRule)
+	router.DELETE("/ignore-rules/:rule_id", h.HandleDeleteIgnoreRule)
+	return router
+}
+
+func TestIgnoreRulesLifecycle(t *testing.T) {
+	router := ignoreRulesRouter(storage.NewMemoryStore())
+
+	w := serve(router, http.MethodPost, "/ignore-rules", `{"field": "preco", "max_delta": 0.05, "reason": "rounding"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var created models.IgnoreRule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.CreatedAt == 0 || created.Field != "preco" {
+		t.Errorf("created rule = %+v, want an ID, a creation time and the field", created)
+	}
+
+	w = serve(router, http.MethodPut, "/ignore-rules/"+created.ID, `{"field": "estoque", "reason": "counted weekly"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var updated models.IgnoreRule
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || updated.CreatedAt != created.CreatedAt || updated.Field != "estoque" || updated.MaxDelta != nil {
+		t.Errorf("updated rule = %+v, want the new criteria with the ID and creation time kept", updated)
+	}
+
+	w = serve(router, http.MethodGet, "/ignore-rules", "")
+	var list struct {
+		Rules []models.IgnoreRule `json:"rules"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(list.Rules) != 1 || list.Rules[0].Field != "estoque" {
+		t.Errorf("list = %d %s, want the updated rule", w.Code, w.Body.String())
+	}
+
+	if w := serve(router, http.MethodDelete, "/ignore-rules/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d %s, want 204", w.Code, w.Body.String())
+	}
+	if w := serve(router, http.MethodGet, "/ignore-rules/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete = %d %s, want 404", w.Code, w.Body.String())
+	}
+}
+
+func TestIgnoreRulesErrors(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.SaveIgnoreRule(&models.IgnoreRule{ID: "rule", Type: "mismatch", Reason: "known"}); err != nil {
+		t.Fatal(err)
+	}
+	router := ignoreRulesRouter(store)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+		want   string
+	}{
+		{"malformed body", http.MethodPost, "/ignore-rules", `{"field": `, http.StatusBadRequest, "invalid ignore rule"},
+		{"no reason", http.MethodPost, "/ignore-rules", `{"type": "mismatch"}`, http.StatusBadRequest, "reason is required"},
+		{"no criterion", http.MethodPost, "/ignore-rules", `{"reason": "all"}`, http.StatusBadRequest, "at least one criterion"},
+		{"unknown field", http.MethodPost, "/ignore-rules", `{"field": "prco", "reason": "typo"}`, http.StatusBadRequest, "unknown field"},
+		{"delta without field", http.MethodPost, "/ignore-rules", `{"max_delta": 1, "reason": "small"}`, http.StatusBadRequest, "require a field"},
+		{"invalid pattern", http.MethodPost, "/ignore-rules", `{"field": "nome", "value_pattern": "(", "reason": "bad"}`, http.StatusBadRequest, "invalid value_pattern"},
+		{"reversed deltas", http.MethodPost, "/ignore-rules", `{"field": "preco", "min_delta": 2, "max_delta": 1, "reason": "bad"}`, http.StatusBadRequest, "min_delta"},
+		{"invalid update", http.MethodPut, "/ignore-rules/rule", `{"reason": "all"}`, http.StatusBadRequest, "at least one criterion"},
+		{"get unknown", http.MethodGet, "/ignore-rules/missing", "", http.StatusNotFound, "ignore rule not found"},
+		{"update unknown", http.MethodPut, "/ignore-rules/missing", `{"type": "mismatch", "reason": "known"}`, http.StatusNotFound, "ignore rule not found"},
+		{"delete unknown", http.MethodDelete, "/ignore-rules/missing", "", http.StatusNotFound, "ignore rule not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("%s %s = %d %s, want %d mentioning %q", tt.method, tt.target, w.Code, w.Body.String(), tt.code, tt.want)
+			}
+		})
+	}
+
+	// A rejected update leaves the rule unchanged
+	if rule, err := store.GetIgnoreRule("rule"); err != nil || rule.Type != "mismatch" || rule.Reason != "known" {
+		t.Errorf("rule after a rejected update = %+v, %v", rule, err)
+	}
+}
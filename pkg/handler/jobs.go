@@ -1,31 +1,126 @@
 package handler
 
 import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/models"
 	"hackathon-go/internal/storage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// JobsHandler handles requests for job listings.
+// JobsHandler handles requests for job listings, retention and deletion.
 type JobsHandler struct {
-	Redis *storage.RedisClient
+	Store     storage.Store
+	Blobs     blob.Store    // Keeps the uploaded files
+	Retention time.Duration // Default time to live of jobs (0 keeps them until deleted)
 }
 
-// HandleGetJobs retrieves all job IDs and returns them as a JSON response.
+// JobList is a page of the job index.
+type JobList struct {
+	Jobs       []models.JobMeta `json:"jobs"`
+	JobIDs     []string         `json:"job_ids"` // IDs of Jobs, for older clients
+	Pagination PaginationInfo   `json:"pagination"`
+}
+
+// HandleGetJobs lists the jobs of the job index with their metadata, newest first.
+// Query params:
+// - page: page number for pagination (default: 1)
+// - limit: number of jobs per page (default: 20)
+// - status: only jobs in this state (queued, running, completed, failed)
+// - from: only jobs created at or after this time (Unix seconds, RFC 3339 or YYYY-MM-DD)
+// - to: only jobs created at or before this time; a date includes the whole day
+// - sort: created_at (default), finished_at, filename, size, csv_rows or discrepancies
+// - order: desc (default) or asc
 func (h *JobsHandler) HandleGetJobs(c *gin.Context) {
-	jobIDs, err := h.Redis.GetAllJobIDs()
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+
+	q := storage.JobQuery{
+		Status: c.Query("status"),
+		Sort:   c.Query("sort"),
+		Desc:   c.DefaultQuery("order", "desc") != "asc",
+		Offset: (page - 1) * pageSize,
+		Limit:  pageSize,
+	}
+	switch q.Status {
+	case "", models.JobQueued, models.JobRunning, models.JobCompleted, models.JobFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be queued, running, completed or failed"})
+		return
+	}
+	if err := q.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if q.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+
+	jobs, total, err := h.Store.ListJobs(q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve job IDs"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve jobs"})
 		return
 	}
 
-	if jobIDs == nil {
-		jobIDs = []string{}
+	jobIDs := make([]string, len(jobs))
+	for i, job := range jobs {
+		jobIDs[i] = job.ID
 	}
+	c.JSON(http.StatusOK, JobList{
+		Jobs:   jobs,
+		JobIDs: jobIDs,
+		Pagination: PaginationInfo{
+			CurrentPage: page,
+			PageSize:    pageSize,
+			TotalPages:  int(math.Ceil(float64(total) / float64(pageSize))),
+			TotalItems:  total,
+		},
+	})
+}
 
-	c.JSON(http.StatusOK, gin.H{"job_ids": jobIDs})
+// parseTimeParam parses a time query parameter given as Unix seconds, RFC 3339 or a
+// YYYY-MM-DD date, returning Unix seconds (0 when empty). A date stands for its first
+// second, or its last one when endOfDay is set.
+func parseTimeParam(raw string, endOfDay bool) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	if unix, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return unix, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.Unix(), nil
+	}
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return 0, fmt.Errorf("expected Unix seconds, RFC 3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		return day.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+	return day.Unix(), nil
 }
 
 // HandleGetJobStatus retrieves the current status of a specific job.
@@ -36,27 +131,338 @@ func (h *JobsHandler) HandleGetJobStatus(c *gin.Context) {
 		return
 	}
 
-	// Get job status from Redis
-	status, err := h.Redis.GetJobStatus(jobID)
+	// Get job status from storage
+	status, err := h.Store.GetJobStatus(jobID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
 		return
 	}
 
-	// Get job progress from Redis
-	progress, err := h.Redis.GetJobProgress(jobID)
+	// Get job progress from storage
+	progress, err := h.Store.GetJobProgress(jobID)
 	if err != nil {
 		progress = 0 // Default to 0 if progress not found
 	}
 
 	// Check if job has results (completed)
-	hasResults, _ := h.Redis.HasJobResults(jobID)
+	hasResults, _ := h.Store.HasJobResults(jobID)
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"job_id":       jobID,
 		"status":       status,
 		"progress":     progress,
 		"has_results":  hasResults,
 		"is_completed": hasResults,
+	}
+	if meta, err := h.Store.GetJobMeta(jobID); err == nil {
+		response["job"] = meta
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// JobRetention is the retention of a job: pinned jobs are kept until deleted, others
+// expire after a time to live.
+type JobRetention struct {
+	Pinned    bool   `json:"pinned"`
+	TTL       string `json:"ttl,omitempty"`        // Time to live from now, e.g. "72h"; the default retention when empty
+	ExpiresAt int64  `json:"expires_at,omitempty"` // When the job expires, in responses
+}
+
+// HandleSetJobRetention pins a job, so it is kept until deleted, or sets its time to live
+// from now, which extends or shortens it. Every key of the job gets the new expiration.
+func (h *JobsHandler) HandleSetJobRetention(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if _, err := uuid.Parse(jobID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job_id"})
+		return
+	}
+
+	var retention JobRetention
+	if err := c.ShouldBindJSON(&retention); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid retention: " + err.Error()})
+		return
+	}
+	expiration := h.Retention
+	switch {
+	case retention.Pinned:
+		expiration = 0
+	case retention.TTL != "":
+		ttl, err := time.ParseDuration(retention.TTL)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive duration, e.g. 72h"})
+			return
+		}
+		expiration = ttl
+	}
+
+	// A running job would reset the expiration of its keys as it writes them
+	meta, err := h.Store.GetJobMeta(jobID)
+	if err == nil && unfinished(meta) {
+		c.JSON(http.StatusConflict, gin.H{"error": "job is still " + meta.Status})
+		return
+	}
+	// The result must outlive the jobs reusing it
+	if meta != nil && expiration > 0 {
+		links := liveLinks(h.Store, meta)
+		for _, link := range links {
+			if kept := storedExpiration(link); kept == 0 || kept > expiration {
+				c.JSON(http.StatusConflict, gin.H{"error": "job result is reused by jobs kept longer", "linked_by": linkIDs(links)})
+				return
+			}
+		}
+	}
+
+	err = h.Store.SetJobExpiration(jobID, expiration)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update job retention"})
+		return
+	}
+
+	if meta != nil {
+		err := h.Store.UpdateJobMeta(jobID, func(meta *models.JobMeta) (time.Duration, error) {
+			meta.Pinned = retention.Pinned
+			meta.ExpiresAt = expiresAt(expiration)
+			return expiration, nil
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to update job %s in the index: %v\n", jobID, err)
+		}
+		if meta.CachedFrom != "" {
+			h.keepOriginal(meta.CachedFrom, expiration)
+		}
+	}
+	c.JSON(http.StatusOK, JobRetention{Pinned: retention.Pinned, ExpiresAt: expiresAt(expiration)})
+}
+
+// keepOriginal extends the retention of the job whose result a job reuses, so it is kept
+// at least for the given expiration.
+func (h *JobsHandler) keepOriginal(originalID string, expiration time.Duration) {
+	if expiration > 0 {
+		expiration += linkMargin
+	}
+	extended := false
+	err := h.Store.UpdateJobMeta(originalID, func(meta *models.JobMeta) (time.Duration, error) {
+		kept := storedExpiration(meta)
+		extended = kept > 0 && (expiration <= 0 || kept < expiration)
+		if !extended {
+			return kept, nil
+		}
+		meta.ExpiresAt = expiresAt(expiration)
+		return expiration, nil
+	})
+	if err == nil && extended {
+		err = h.Store.SetJobExpiration(originalID, expiration)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to extend the retention of job %s: %v\n", originalID, err)
+	}
+}
+
+// HandleDeleteJob removes a job: its result, status, progress, inputs and metadata.
+func (h *JobsHandler) HandleDeleteJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if _, err := uuid.Parse(jobID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job_id"})
+		return
+	}
+
+	// A running job would write its keys again, and jobs reusing the result need it
+	meta, err := h.Store.GetJobMeta(jobID)
+	if err == nil && unfinished(meta) {
+		c.JSON(http.StatusConflict, gin.H{"error": "job is still " + meta.Status})
+		return
+	}
+	if meta != nil {
+		if links := liveLinks(h.Store, meta); len(links) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "job result is reused by other jobs", "linked_by": linkIDs(links)})
+			return
+		}
+	}
+
+	err = h.Store.DeleteJob(jobID)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete job"})
+		return
+	}
+
+	// The original no longer has to be kept for this job
+	if meta != nil && meta.CachedFrom != "" {
+		err := h.Store.UpdateJobMeta(meta.CachedFrom, func(original *models.JobMeta) (time.Duration, error) {
+			original.LinkedBy = withoutJob(original.LinkedBy, jobID)
+			return storedExpiration(original), nil
+		})
+		if err != nil && err != storage.ErrNotFound {
+			fmt.Printf("Warning: Failed to unlink job %s from job %s: %v\n", jobID, meta.CachedFrom, err)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// linkIDs returns the IDs of jobs.
+func linkIDs(links []*models.JobMeta) []string {
+	ids := make([]string, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	return ids
+}
+
+// unfinished reports whether a job is queued or running.
+func unfinished(meta *models.JobMeta) bool {
+	return meta.Status == models.JobQueued || meta.Status == models.JobRunning
+}
+
+// expiresAt returns when a job written now with the given expiration expires, 0 when it
+// is kept until deleted.
+func expiresAt(expiration time.Duration) int64 {
+	if expiration <= 0 {
+		return 0
+	}
+	return time.Now().Add(expiration).Unix()
+}
+
+// storedExpiration returns the expiration left to a job, 0 when it is kept until deleted.
+func storedExpiration(meta *models.JobMeta) time.Duration {
+	if meta.Pinned || meta.ExpiresAt == 0 {
+		return 0
+	}
+	return max(time.Until(time.Unix(meta.ExpiresAt, 0)), time.Second)
+}
+
+// keptFor returns the expiration of a job updated now with the given default retention.
+// Pinned jobs stay kept until deleted, and a longer time to live set on the job is kept.
+func keptFor(meta *models.JobMeta, retention time.Duration) time.Duration {
+	if meta.Pinned || retention <= 0 {
+		return 0
+	}
+	if meta.ExpiresAt != 0 {
+		if left := time.Until(time.Unix(meta.ExpiresAt, 0)); left > retention {
+			return left
+		}
+	}
+	return retention
+}
+
+// HandleGetJobDiff compares the discrepancies of two completed jobs, typically a run before
+// and after fixing data, and reports which were resolved, are new, persist or changed value.
+// Query params:
+// - status: only entries with this status (resolved, new, persisting, changed)
+// - format: "json" (default) or "csv"
+func (h *JobsHandler) HandleGetJobDiff(c *gin.Context) {
+	jobID := c.Param("job_id")
+	otherID := c.Param("other")
+
+	status := c.Query("status")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	// Both results are read in their canonical order, a batch at a time
+	iterators := make([]*storage.ErrorIterator, 2)
+	for i, id := range []string{jobID, otherID} {
+		it, err := h.Store.ReadErrors(id, storage.ErrorQuery{})
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job " + id + " not found or expired"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+			return
+		}
+		iterators[i] = it
+	}
+
+	var err error
+	if format == "json" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = writeDiffJSON(c.Writer, jobID, otherID, status, iterators)
+	} else {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"diff-%s-%s.csv\"", jobID, otherID))
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		err = writeDiffCSV(c.Writer, status, iterators)
+	}
+	// Once the body is started a failure can only cut it short
+	if err != nil {
+		fmt.Printf("Warning: diff of jobs %s and %s stopped: %v\n", jobID, otherID, err)
+	}
+}
+
+// writeDiffJSON writes the diff of two jobs as a models.JobDiff, with the summary after
+// the entries since it is known once they are all compared.
+func writeDiffJSON(w io.Writer, jobID, otherID, status string, iterators []*storage.ErrorIterator) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"job_id":`)
+	writeJSON(bw, jobID)
+	bw.WriteString(`,"other_id":`)
+	writeJSON(bw, otherID)
+	bw.WriteString(`,"entries":[`)
+	n := 0
+	summary, err := comparison.DiffStream(iterators[0].Next, iterators[1].Next, func(entry models.JobDiffEntry) error {
+		if status != "" && entry.Status != status {
+			return nil
+		}
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		n++
+		return writeJSON(bw, entry)
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString(`],"summary":`)
+	if err := writeJSON(bw, summary); err != nil {
+		return err
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// writeDiffCSV writes a row per entry of the diff of two jobs.
+func writeDiffCSV(w io.Writer, status string, iterators []*storage.ErrorIterator) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{
+		"status", "api_id", "type", "field", "rule", "check", "side", "nome", "categoria", "fornecedor",
+		"api_value_before", "csv_value_before", "api_value_after", "csv_value_after",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	values := func(detail *models.MismatchDetail) (string, string) {
+		if detail == nil {
+			return "", ""
+		}
+		return fmt.Sprint(detail.APIValue), fmt.Sprint(detail.CSVValue)
+	}
+	_, err := comparison.DiffStream(iterators[0].Next, iterators[1].Next, func(entry models.JobDiffEntry) error {
+		if status != "" && entry.Status != status {
+			return nil
+		}
+		apiBefore, csvBefore := values(entry.Before)
+		apiAfter, csvAfter := values(entry.After)
+		return writer.Write([]string{
+			entry.Status, fmt.Sprint(entry.APIID), entry.Type, entry.Field, entry.Rule, entry.Check, entry.Side,
+			entry.Nome, entry.Categoria, entry.Fornecedor,
+			apiBefore, csvBefore, apiAfter, csvAfter,
+		})
 	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
 }
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+)
+
+func jobsRouter(store storage.Store, retention time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &JobsHandler{Store: store, Retention: retention}
+	router := gin.New()
+	router.GET("/jobs", h.HandleGetJobs)
+	router.PUT("/jobs/:job_id/retention", h.HandleSetJobRetention)
+	router.DELETE("/jobs/:job_id", h.HandleDeleteJob)
+	router.GET("/jobs/:job_id/diff/:other", h.HandleGetJobDiff)
+	return router
+}
+
+// priceMismatch is a price discrepancy of a product.
+func priceMismatch(id int, api, csv float64) models.ErrorDetail {
+	return models.ErrorDetail{
+		Type: "mismatch", APIID: id, CSVID: id, CSVLine: id + 1,
+		Fields: map[string]models.MismatchDetail{"preco": {APIValue: api, CSVValue: csv}},
+	}
+}
+
+func TestGetJobDiff(t *testing.T) {
+	store := storage.NewMemoryStore()
+	before := &models.ComparisonResult{Errors: []models.ErrorDetail{priceMismatch(1, 3, 2), priceMismatch(2, 5, 4), priceMismatch(3, 1, 2)}}
+	after := &models.ComparisonResult{Errors: []models.ErrorDetail{priceMismatch(2, 5, 4), priceMismatch(3, 1, 1.5), priceMismatch(4, 2, 1)}}
+	if err := store.SaveResult("before", before, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveResult("after", after, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	router := jobsRouter(store, time.Hour)
+
+	w := serve(router, http.MethodGet, "/jobs/before/diff/after", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var diff models.JobDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("diff body %s: %v", w.Body.String(), err)
+	}
+	want := models.JobDiffSummary{Resolved: 1, New: 1, Persisting: 1, Changed: 1}
+	if diff.JobID != "before" || diff.OtherID != "after" || diff.Summary != want || len(diff.Entries) != 4 {
+		t.Errorf("diff = %+v, want one entry per status", diff)
+	}
+
+	w = serve(router, http.MethodGet, "/jobs/before/diff/after?status=resolved&format=csv", "")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 2 || !strings.HasPrefix(lines[1], "resolved,1,mismatch,preco") {
+		t.Errorf("resolved csv = %d %s, want the header and the resolved price", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		target string
+		code   int
+		want   string
+	}{
+		{"/jobs/before/diff/after?format=xml", http.StatusBadRequest, "format must be json or csv"},
+		{"/jobs/missing/diff/after", http.StatusNotFound, "job missing not found or expired"},
+		{"/jobs/before/diff/missing", http.StatusNotFound, "job missing not found or expired"},
+	}
+	for _, tt := range tests {
+		if w := serve(router, http.MethodGet, tt.target, ""); w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET %s = %d %s, want %d mentioning %q", tt.target, w.Code, w.Body.String(), tt.code, tt.want)
+		}
+	}
+}
+
+func TestGetJobs(t *testing.T) {
+	store := storage.NewMemoryStore()
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC).Unix()
+	for _, meta := range []*models.JobMeta{
+		{ID: "old", Status: models.JobCompleted, CreatedAt: day - 3600, Filename: "b.csv"},
+		{ID: "morning", Status: models.JobFailed, CreatedAt: day + 3600, Filename: "c.csv"},
+		{ID: "evening", Status: models.JobCompleted, CreatedAt: day + 20*3600, Filename: "a.csv"},
+		{ID: "queued", Status: models.JobQueued, CreatedAt: day + 30*3600, Filename: "d.csv"},
+	} {
+		if err := store.SaveJobMeta(meta, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := jobsRouter(store, time.Hour)
+
+	tests := []struct {
+		query string
+		ids   []string
+		total int
+	}{
+		{"", []string{"queued", "evening", "morning", "old"}, 4},
+		{"?status=completed", []string{"evening", "old"}, 2},
+		{"?status=queued", []string{"queued"}, 1},
+		{"?from=2024-03-10&to=2024-03-10", []string{"evening", "morning"}, 2},
+		{"?sort=filename&order=asc", []string{"evening", "old", "morning", "queued"}, 4},
+		{"?limit=2&page=2", []string{"morning", "old"}, 4},
+		{"?limit=0&page=-1", []string{"queued", "evening", "morning", "old"}, 4}, // Invalid paging falls back to the defaults
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/jobs"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("jobs = %d %s, want 200", w.Code, w.Body.String())
+			}
+			var list JobList
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(list.JobIDs, tt.ids) || list.Pagination.TotalItems != tt.total || len(list.Jobs) != len(tt.ids) {
+				t.Errorf("jobs %v of %d, want %v of %d", list.JobIDs, list.Pagination.TotalItems, tt.ids, tt.total)
+			}
+		})
+	}
+
+	invalid := []struct {
+		query string
+		want  string
+	}{
+		{"?status=done", "status must be"},
+		{"?sort=name", "sort must be one of"},
+		{"?from=yesterday", "invalid from"},
+		{"?to=2024-13-01", "invalid to"},
+	}
+	for _, tt := range invalid {
+		if w := serve(router, http.MethodGet, "/jobs"+tt.query, ""); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET /jobs%s = %d %s, want 400 mentioning %q", tt.query, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestSetJobRetention(t *testing.T) {
+	store := storage.NewMemoryStore()
+	router := jobsRouter(store, time.Hour)
+	done, running := uuid.NewString(), uuid.NewString()
+	completedJob(t, store, done, "fp", time.Hour)
+	if err := store.SaveJobMeta(&models.JobMeta{ID: running, Status: models.JobRunning}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(router, http.MethodPut, "/jobs/"+done+"/retention", `{"pinned": true}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pinned":true`) {
+		t.Fatalf("pin = %d %s, want 200", w.Code, w.Body.String())
+	}
+	if meta, err := store.GetJobMeta(done); err != nil || !meta.Pinned || meta.ExpiresAt != 0 {
+		t.Errorf("pinned job = %+v, %v, want it kept until deleted", meta, err)
+	}
+
+	w = serve(router, http.MethodPut, "/jobs/"+done+"/retention", `{"ttl": "72h"}`)
+	var retention JobRetention
+	if err := json.Unmarshal(w.Body.Bytes(), &retention); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || retention.Pinned || retention.ExpiresAt < time.Now().Add(71*time.Hour).Unix() {
+		t.Errorf("ttl = %d %s, want the job unpinned and kept for 72h", w.Code, w.Body.String())
+	}
+	if meta, err := store.GetJobMeta(done); err != nil || meta.Pinned || meta.ExpiresAt != retention.ExpiresAt {
+		t.Errorf("job after a ttl = %+v, %v, want the new expiry", meta, err)
+	}
+
+	tests := []struct {
+		name  string
+		jobID string
+		body  string
+		code  int
+		want  string
+	}{
+		{"invalid job_id", "job", `{"pinned": true}`, http.StatusBadRequest, "invalid job_id"},
+		{"malformed body", done, `{"pinned": `, http.StatusBadRequest, "invalid retention"},
+		{"invalid ttl", done, `{"ttl": "3 days"}`, http.StatusBadRequest, "ttl must be a positive duration"},
+		{"negative ttl", done, `{"ttl": "-1h"}`, http.StatusBadRequest, "ttl must be a positive duration"},
+		{"running job", running, `{"pinned": true}`, http.StatusConflict, "job is still running"},
+		{"unknown job", uuid.NewString(), `{"pinned": true}`, http.StatusNotFound, "job not found or expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPut, "/jobs/"+tt.jobID+"/retention", tt.body)
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("retention = %d %s, want %d mentioning %q", w.Code, w.Body.String(), tt.code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteJob(t *testing.T) {
+	store := storage.NewMemoryStore()
+	router := jobsRouter(store, time.Hour)
+	done, queued := uuid.NewString(), uuid.NewString()
+	completedJob(t, store, done, "fp", time.Hour)
+	if err := store.SaveJobMeta(&models.JobMeta{ID: queued, Status: models.JobQueued}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(router, http.MethodDelete, "/jobs/"+done, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d %s, want 204", w.Code, w.Body.String())
+	}
+	if _, err := store.GetResult(done); err != storage.ErrNotFound {
+		t.Errorf("result after delete: %v, want ErrNotFound", err)
+	}
+	if _, err := store.GetJobMeta(done); err != storage.ErrNotFound {
+		t.Errorf("metadata after delete: %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		name  string
+		jobID string
+		code  int
+		want  string
+	}{
+		{"invalid job_id", "job", http.StatusBadRequest, "invalid job_id"},
+		{"queued job", queued, http.StatusConflict, "job is still queued"},
+		{"deleted job", done, http.StatusNotFound, "job not found or expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodDelete, "/jobs/"+tt.jobID, "")
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("delete = %d %s, want %d mentioning %q", w.Code, w.Body.String(), tt.code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkedJobsKeepTheOriginal(t *testing.T) {
+	store := storage.NewMemoryStore()
+	router := jobsRouter(store, time.Hour)
+	originalID, copyID := uuid.NewString(), uuid.NewString()
+	original := completedJob(t, store, originalID, "fp", time.Hour)
+	if err := store.SaveJobMeta(&models.JobMeta{ID: copyID, Status: models.JobQueued}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	uploads := &UploadHandler{Store: store, Retention: time.Hour}
+	if err := uploads.linkJob(copyID, original); err != nil {
+		t.Fatal(err)
+	}
+
+	// The original can't expire before the copy
+	w := serve(router, http.MethodPut, "/jobs/"+originalID+"/retention", `{"ttl": "30m"}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "reused by jobs kept longer") || !strings.Contains(w.Body.String(), copyID) {
+		t.Errorf("shorter ttl of the original = %d %s, want 409 naming the copy", w.Code, w.Body.String())
+	}
+
+	// Pinning the copy keeps the original until deleted too
+	if w := serve(router, http.MethodPut, "/jobs/"+copyID+"/retention", `{"pinned": true}`); w.Code != http.StatusOK {
+		t.Fatalf("pin of the copy = %d %s, want 200", w.Code, w.Body.String())
+	}
+	if meta, err := store.GetJobMeta(originalID); err != nil || storedExpiration(meta) != 0 {
+		t.Errorf("original after pinning the copy = %+v, %v, want it kept until deleted", meta, err)
+	}
+	if w := serve(router, http.MethodPut, "/jobs/"+originalID+"/retention", `{"ttl": "2h"}`); w.Code != http.StatusConflict {
+		t.Errorf("ttl of the original of a pinned copy = %d %s, want 409", w.Code, w.Body.String())
+	}
+	if w := serve(router, http.MethodPut, "/jobs/"+originalID+"/retention", `{"pinned": true}`); w.Code != http.StatusOK {
+		t.Errorf("pin of the original = %d %s, want 200", w.Code, w.Body.String())
+	}
+
+	// The original is deleted once no job reuses its result
+	w = serve(router, http.MethodDelete, "/jobs/"+originalID, "")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "reused by other jobs") || !strings.Contains(w.Body.String(), copyID) {
+		t.Errorf("delete of the original = %d %s, want 409 naming the copy", w.Code, w.Body.String())
+	}
+	if w := serve(router, http.MethodDelete, "/jobs/"+copyID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete of the copy = %d %s, want 204", w.Code, w.Body.String())
+	}
+	if meta, err := store.GetJobMeta(originalID); err != nil || len(meta.LinkedBy) != 0 {
+		t.Errorf("original after deleting the copy = %+v, %v, want it unlinked", meta, err)
+	}
+	if w := serve(router, http.MethodDelete, "/jobs/"+originalID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete of the unlinked original = %d %s, want 204", w.Code, w.Body.String())
+	}
+}
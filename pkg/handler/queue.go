@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"hackathon-go/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueueHandler handles requests about the job queue.
+type QueueHandler struct {
+	Queue queue.Queue
+}
+
+// HandleGetStats returns the number of ready, in-flight and dead-lettered tasks.
+func (h *QueueHandler) HandleGetStats(c *gin.Context) {
+	stats, err := h.Queue.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read queue stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// HandleGetDeadLetters returns the tasks that failed every attempt, with their last error.
+func (h *QueueHandler) HandleGetDeadLetters(c *gin.Context) {
+	tasks, err := h.Queue.DeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read dead letters"})
+		return
+	}
+	if tasks == nil {
+		tasks = []queue.Task{}
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
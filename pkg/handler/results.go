@@ -1,23 +1,29 @@
 package handler
 
 import (
+	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/comparison"
+	productcsv "hackathon-go/internal/csv"
 	"hackathon-go/internal/models"
 	"hackathon-go/internal/storage"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 )
 
 // ResultsHandler handles the retrieval of comparison results.
 type ResultsHandler struct {
-	Redis *storage.RedisClient
+	Store storage.Store
+	Blobs blob.Store // Keeps the uploaded files
 }
 
 // PaginatedResults represents the paginated results response.
@@ -36,6 +42,13 @@ type PaginationInfo struct {
 	TotalItems  int `json:"total_items"`
 }
 
+// FacetResults represents the breakdowns of a (filtered) set of discrepancies.
+type FacetResults struct {
+	TotalItems   int                              `json:"total_items"`
+	ByCategoria  map[string]models.GroupBreakdown `json:"by_categoria"`
+	ByFornecedor map[string]models.GroupBreakdown `json:"by_fornecedor"`
+}
+
 // TimingInfo represents the timing details of the processing.
 type TimingInfo struct {
 	StartedAt   int64 `json:"started_at"`   // Unix timestamp when processing started
@@ -48,13 +61,19 @@ type TimingInfo struct {
 // - page: page number for pagination (default: 1)
 // - limit: number of items per page (default: 100)
 // - filter: filter by specific field (nome, categoria, preco, estoque, fornecedor)
-// - type: filter by error type (mismatch, missing_in_api, missing_in_csv)
+// - type: filter by error type (mismatch, near_match, id_changed, missing_in_api, missing_in_csv, rule_violation, consistency)
 // - value: filter by specific value in the field (case-insensitive substring match)
+// - severity: filter by severity level (critical, high, medium, low)
+// - suppressed: true for discrepancies suppressed by ignore rules, false for the others
+// - sort: order by api_id, type, csv_line, field, price_delta or severity (default: canonical order)
+// - order: asc (default) or desc
 //
 // Examples:
 // - GET /results/123?filter=nome - Get all mismatches in the nome field
 // - GET /results/123?filter=categoria&value=electronics - Get categoria mismatches containing "electronics"
 // - GET /results/123?type=mismatch&filter=preco - Get only mismatches in the preco field
+// - GET /results/123?filter=preco&sort=price_delta&order=desc - Largest price differences first
+// - GET /results/123?severity=critical&sort=severity&order=desc - Most severe discrepancies first
 func (h *ResultsHandler) HandleGetResult(c *gin.Context) {
 	jobID := c.Param("job_id")
 	if jobID == "" {
@@ -73,12 +92,26 @@ func (h *ResultsHandler) HandleGetResult(c *gin.Context) {
 	}
 
 	// Get filter parameters
-	filterField := c.Query("filter") // Filter by specific field (nome, categoria, preco, estoque, fornecedor)
-	filterType := c.Query("type")    // Filter by error type (mismatch, missing_in_api, missing_in_csv)
-	filterValue := c.Query("value")  // Filter by specific value in the field
+	filters := parseResultFilters(c)
+
+	sortKey := c.Query("sort")
+	order := c.DefaultQuery("order", "asc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	q := filters.errorQuery()
+	if sortKey != "" {
+		if _, err := comparison.ErrorLess(sortKey, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q.Sort, q.Desc = sortKey, order == "desc"
+	}
 
-	result, err := h.Redis.GetResult(jobID)
-	if err == redis.Nil {
+	result, err := h.Store.GetResultSummary(jobID)
+	if err == storage.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
 		return
 	}
@@ -87,28 +120,17 @@ func (h *ResultsHandler) HandleGetResult(c *gin.Context) {
 		return
 	}
 
-	// Apply filter if specified
-	var filteredErrors []models.ErrorDetail
-	if filterField != "" || filterType != "" || filterValue != "" {
-		filteredErrors = h.applyFilters(result.Errors, filterField, filterType, filterValue)
-	} else {
-		filteredErrors = result.Errors
-	}
-
-	totalItems := len(filteredErrors)
-	totalPages := int(math.Ceil(float64(totalItems) / float64(pageSize)))
-
-	start := (page - 1) * pageSize
-	end := start + pageSize
-
-	if start > totalItems {
-		start = totalItems
+	// The stored result serves the page: filters through its indexes, a value filter and
+	// another order while reading it, keeping the page, or up to its end for another order
+	paginatedErrors, totalItems, err := h.Store.GetErrors(jobID, q, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
 	}
-	if end > totalItems {
-		end = totalItems
+	if paginatedErrors == nil {
+		paginatedErrors = []models.ErrorDetail{}
 	}
-
-	paginatedErrors := filteredErrors[start:end]
+	totalPages := int(math.Ceil(float64(totalItems) / float64(pageSize)))
 
 	c.JSON(http.StatusOK, PaginatedResults{
 		Summary: result.Summary,
@@ -127,54 +149,146 @@ func (h *ResultsHandler) HandleGetResult(c *gin.Context) {
 	})
 }
 
-// applyFilters applies multiple filters to the errors list
-func (h *ResultsHandler) applyFilters(errors []models.ErrorDetail, filterField, filterType, filterValue string) []models.ErrorDetail {
-	var filtered []models.ErrorDetail
+// resultFilters holds the filter query parameters shared by the results endpoints.
+type resultFilters struct {
+	Field      string // Filter by specific field (nome, categoria, preco, estoque, fornecedor)
+	Type       string // Filter by error type (mismatch, near_match, id_changed, missing_in_api, missing_in_csv)
+	Value      string // Filter by specific value in the field
+	Severity   string // Filter by severity level
+	Suppressed string // Filter by suppression by ignore rules (true or false)
+}
 
-	for _, err := range errors {
-		// Check if this error passes all filters
-		if h.matchesFilters(err, filterField, filterType, filterValue) {
-			filtered = append(filtered, err)
-		}
+// parseResultFilters reads the filter query parameters of a request.
+func parseResultFilters(c *gin.Context) resultFilters {
+	return resultFilters{
+		Field:      c.Query("filter"),
+		Type:       c.Query("type"),
+		Value:      c.Query("value"),
+		Severity:   c.Query("severity"),
+		Suppressed: c.Query("suppressed"),
 	}
+}
 
-	return filtered
+// isEmpty reports whether no filter is set.
+func (f resultFilters) isEmpty() bool {
+	return f == resultFilters{}
 }
 
-// matchesFilters checks if an error matches all the specified filters
-func (h *ResultsHandler) matchesFilters(err models.ErrorDetail, filterField, filterType, filterValue string) bool {
-	// Filter by error type
-	if filterType != "" && err.Type != filterType {
-		return false
+// errorQuery returns the query selecting the filtered discrepancies of a stored result.
+func (f resultFilters) errorQuery() storage.ErrorQuery {
+	return storage.ErrorQuery{
+		Type:       f.Type,
+		Field:      f.Field,
+		Value:      f.Value,
+		Severity:   f.Severity,
+		Suppressed: f.Suppressed,
 	}
+}
 
-	// Filter by specific field
-	if filterField != "" {
-		if err.Fields == nil {
-			return false // No fields means no mismatches
-		}
-		if _, exists := err.Fields[filterField]; !exists {
-			return false // Field doesn't exist in this error
-		}
+// ResultSummary is the response of the summary endpoint.
+type ResultSummary struct {
+	Summary models.Summary `json:"summary"`
+	Timing  TimingInfo     `json:"timing"`
+}
 
-		// If we also have a value filter, check the field values
-		if filterValue != "" {
-			field := err.Fields[filterField]
-			apiValue := fmt.Sprint(field.APIValue)
-			csvValue := fmt.Sprint(field.CSVValue)
+// HandleGetSummary returns the summary and timing of a job's results without reading any
+// discrepancy.
+func (h *ResultsHandler) HandleGetSummary(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if jobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_id is required"})
+		return
+	}
 
-			// Check if either API value or CSV value contains the filter value (case-insensitive)
-			if !strings.Contains(strings.ToLower(apiValue), strings.ToLower(filterValue)) &&
-				!strings.Contains(strings.ToLower(csvValue), strings.ToLower(filterValue)) {
-				return false
-			}
+	result, err := h.Store.GetResultSummary(jobID)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ResultSummary{
+		Summary: result.Summary,
+		Timing: TimingInfo{
+			StartedAt:   result.StartedAt,
+			CompletedAt: result.CompletedAt,
+			DurationMs:  result.DurationMs,
+		},
+	})
+}
+
+// HandleGetFacets returns the per-categoria and per-fornecedor breakdowns of a job's results.
+// It accepts the same filter parameters as HandleGetResult (filter, type, value, severity, suppressed).
+// Without filters the breakdowns of the summary are returned, including matched products;
+// with filters only the selected discrepancies are counted.
+func (h *ResultsHandler) HandleGetFacets(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if jobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_id is required"})
+		return
+	}
+
+	filters := parseResultFilters(c)
+
+	result, err := h.Store.GetResultSummary(jobID)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
+
+	if filters.isEmpty() {
+		// Only the number of discrepancies is read
+		_, totalItems, err := h.Store.GetErrors(jobID, filters.errorQuery(), 0, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+			return
 		}
+		c.JSON(http.StatusOK, FacetResults{
+			TotalItems:   totalItems,
+			ByCategoria:  result.Summary.ByCategoria,
+			ByFornecedor: result.Summary.ByFornecedor,
+		})
+		return
 	}
 
-	return true
+	// The selected discrepancies are counted a batch at a time
+	it, err := h.Store.ReadErrors(jobID, filters.errorQuery())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
+	breakdown := comparison.NewBreakdown()
+	totalItems := 0
+	for {
+		batch, err := it.Next()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, e := range batch {
+			breakdown.AddError(e)
+		}
+		totalItems += len(batch)
+	}
+	c.JSON(http.StatusOK, FacetResults{
+		TotalItems:   totalItems,
+		ByCategoria:  breakdown.ByCategoria,
+		ByFornecedor: breakdown.ByFornecedor,
+	})
 }
 
-// HandleExportResult exports the full comparison result stored in Redis as JSON or CSV.
+// HandleExportResult exports the full stored comparison result as JSON or CSV. The
+// discrepancies and three-way products are streamed a batch at a time.
 // Query params:
 // - format: "json" (default) or "csv"
 func (h *ResultsHandler) HandleExportResult(c *gin.Context) {
@@ -186,8 +300,8 @@ func (h *ResultsHandler) HandleExportResult(c *gin.Context) {
 
 	format := c.DefaultQuery("format", "json")
 
-	result, err := h.Redis.GetResult(jobID)
-	if err == redis.Nil {
+	result, err := h.Store.GetResultSummary(jobID)
+	if err == storage.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
 		return
 	}
@@ -195,92 +309,235 @@ func (h *ResultsHandler) HandleExportResult(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
 		return
 	}
+	it, err := h.Store.ReadErrors(jobID, storage.ErrorQuery{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
 
+	// Once the body is started a failure can only cut it short
 	switch format {
 	case "csv":
 		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"result-%s.csv\"", jobID))
 		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		err = writeExportCSV(c.Writer, result, it)
+
+	case "json":
+		fallthrough
+	default:
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"result-%s.json\"", jobID))
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = h.writeExportJSON(c.Writer, jobID, result, it)
+	}
+	if err != nil {
+		fmt.Printf("Warning: export of job %s stopped: %v\n", jobID, err)
+	}
+}
+
+// exportHeader is a result without its discrepancies and three-way products, which
+// writeExportJSON streams after it.
+type exportHeader struct {
+	*models.ComparisonResult
+	Errors   json.RawMessage `json:"errors,omitempty"`
+	ThreeWay json.RawMessage `json:"three_way,omitempty"`
+}
 
-		writer := csv.NewWriter(c.Writer)
-		defer writer.Flush()
-
-		// Header
-		header := []string{
-			"type", "api_id", "csv_line", "nome",
-			"nome_api", "nome_csv",
-			"categoria_api", "categoria_csv",
-			"preco_api", "preco_csv",
-			"estoque_api", "estoque_csv",
-			"fornecedor_api", "fornecedor_csv",
-			"started_at", "completed_at", "duration_ms",
+// exportPage is the number of three-way products read at once by an export.
+const exportPage = 5000
+
+// writeExportJSON writes a result as the JSON object the results endpoints return.
+func (h *ResultsHandler) writeExportJSON(w io.Writer, jobID string, result *models.ComparisonResult, it *storage.ErrorIterator) error {
+	header, err := json.Marshal(exportHeader{ComparisonResult: result})
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(header[:len(header)-1])
+
+	bw.WriteString(`,"errors":[`)
+	for n := 0; ; {
+		batch, err := it.Next()
+		if err != nil {
+			return err
 		}
-		if err := writer.Write(header); err != nil {
-			c.Status(http.StatusInternalServerError)
-			return
+		if len(batch) == 0 {
+			break
+		}
+		for _, e := range batch {
+			if n > 0 {
+				bw.WriteByte(',')
+			}
+			if err := writeJSON(bw, e); err != nil {
+				return err
+			}
+			n++
 		}
+	}
+	bw.WriteString("]")
 
-		// Rows for each error
-		for _, e := range result.Errors {
-			// Default values
-			var (
-				nomeAPI, nomeCSV             string
-				categoriaAPI, categoriaCSV   string
-				precoAPI, precoCSV           string
-				estoqueAPI, estoqueCSV       string
-				fornecedorAPI, fornecedorCSV string
-			)
-
-			if e.Fields != nil {
-				if d, ok := e.Fields["nome"]; ok {
-					nomeAPI = fmt.Sprint(d.APIValue)
-					nomeCSV = fmt.Sprint(d.CSVValue)
-				}
-				if d, ok := e.Fields["categoria"]; ok {
-					categoriaAPI = fmt.Sprint(d.APIValue)
-					categoriaCSV = fmt.Sprint(d.CSVValue)
-				}
-				if d, ok := e.Fields["preco"]; ok {
-					precoAPI = fmt.Sprint(d.APIValue)
-					precoCSV = fmt.Sprint(d.CSVValue)
-				}
-				if d, ok := e.Fields["estoque"]; ok {
-					estoqueAPI = fmt.Sprint(d.APIValue)
-					estoqueCSV = fmt.Sprint(d.CSVValue)
+	if result.ThreeWay != nil {
+		summary, err := json.Marshal(result.ThreeWay.Summary)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(`,"three_way":{"summary":`)
+		bw.Write(summary)
+		bw.WriteString(`,"products":[`)
+		for offset := 0; ; {
+			page, total, err := h.Store.GetThreeWay(jobID, storage.ThreeWayQuery{}, offset, exportPage)
+			if err != nil {
+				return err
+			}
+			if page == nil {
+				break
+			}
+			for _, p := range page.Products {
+				if offset > 0 {
+					bw.WriteByte(',')
 				}
-				if d, ok := e.Fields["fornecedor"]; ok {
-					fornecedorAPI = fmt.Sprint(d.APIValue)
-					fornecedorCSV = fmt.Sprint(d.CSVValue)
+				if err := writeJSON(bw, p); err != nil {
+					return err
 				}
+				offset++
 			}
-
-			row := []string{
-				e.Type,
-				fmt.Sprint(e.APIID),
-				fmt.Sprint(e.CSVLine),
-				e.Nome,
-				nomeAPI, nomeCSV,
-				categoriaAPI, categoriaCSV,
-				precoAPI, precoCSV,
-				estoqueAPI, estoqueCSV,
-				fornecedorAPI, fornecedorCSV,
-				fmt.Sprint(result.StartedAt),
-				fmt.Sprint(result.CompletedAt),
-				fmt.Sprint(result.DurationMs),
+			if len(page.Products) == 0 || offset >= total {
+				break
 			}
-			if err := writer.Write(row); err != nil {
-				c.Status(http.StatusInternalServerError)
-				return
+		}
+		bw.WriteString("]}")
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// writeJSON writes a value as compact JSON.
+func writeJSON(w *bufio.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeExportCSV writes a row per discrepancy of a result.
+func writeExportCSV(w io.Writer, result *models.ComparisonResult, it *storage.ErrorIterator) error {
+	writer := csv.NewWriter(w)
+
+	// Header
+	header := []string{
+		"type", "api_id", "csv_id", "csv_line", "nome",
+		"severity", "severity_score",
+		"suppressed", "suppressed_by",
+		"rule", "side", "check", "ids",
+		"nome_api", "nome_csv",
+		"categoria_api", "categoria_csv",
+		"preco_api", "preco_csv",
+		"estoque_api", "estoque_csv",
+		"fornecedor_api", "fornecedor_csv",
+		"started_at", "completed_at", "duration_ms",
+	}
+	// Full records, filled in when the job embedded them
+	for _, side := range []string{"api", "csv"} {
+		for _, column := range productcsv.Columns {
+			header = append(header, side+"_record_"+column)
+		}
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for {
+		batch, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, e := range batch {
+			if err := writer.Write(exportRow(e, result)); err != nil {
+				return err
 			}
 		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
 
-		c.Status(http.StatusOK)
-		return
+// exportRow returns the CSV row of a discrepancy.
+func exportRow(e models.ErrorDetail, result *models.ComparisonResult) []string {
+	// Default values
+	var (
+		nomeAPI, nomeCSV             string
+		categoriaAPI, categoriaCSV   string
+		precoAPI, precoCSV           string
+		estoqueAPI, estoqueCSV       string
+		fornecedorAPI, fornecedorCSV string
+	)
+
+	if e.Fields != nil {
+		if d, ok := e.Fields["nome"]; ok {
+			nomeAPI = fmt.Sprint(d.APIValue)
+			nomeCSV = fmt.Sprint(d.CSVValue)
+		}
+		if d, ok := e.Fields["categoria"]; ok {
+			categoriaAPI = fmt.Sprint(d.APIValue)
+			categoriaCSV = fmt.Sprint(d.CSVValue)
+		}
+		if d, ok := e.Fields["preco"]; ok {
+			precoAPI = fmt.Sprint(d.APIValue)
+			precoCSV = fmt.Sprint(d.CSVValue)
+		}
+		if d, ok := e.Fields["estoque"]; ok {
+			estoqueAPI = fmt.Sprint(d.APIValue)
+			estoqueCSV = fmt.Sprint(d.CSVValue)
+		}
+		if d, ok := e.Fields["fornecedor"]; ok {
+			fornecedorAPI = fmt.Sprint(d.APIValue)
+			fornecedorCSV = fmt.Sprint(d.CSVValue)
+		}
+	}
 
-	case "json":
-		fallthrough
-	default:
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"result-%s.json\"", jobID))
-		c.JSON(http.StatusOK, result)
-		return
+	row := []string{
+		e.Type,
+		fmt.Sprint(e.APIID),
+		fmt.Sprint(e.CSVID),
+		fmt.Sprint(e.CSVLine),
+		e.Nome,
+		e.Severity,
+		fmt.Sprint(e.SeverityScore),
+		strconv.FormatBool(e.Suppressed),
+		strings.Join(e.SuppressedBy, ";"),
+		e.Rule, e.Side, e.Check, joinIDs(e.IDs),
+		nomeAPI, nomeCSV,
+		categoriaAPI, categoriaCSV,
+		precoAPI, precoCSV,
+		estoqueAPI, estoqueCSV,
+		fornecedorAPI, fornecedorCSV,
+		fmt.Sprint(result.StartedAt),
+		fmt.Sprint(result.CompletedAt),
+		fmt.Sprint(result.DurationMs),
+	}
+	row = append(row, recordColumns(e.APIRecord)...)
+	return append(row, recordColumns(e.CSVRecord)...)
+}
+
+// recordColumns returns the CSV columns of an embedded record, empty when there is none.
+func recordColumns(p *models.Product) []string {
+	if p == nil {
+		return make([]string, len(productcsv.Columns))
+	}
+	return productcsv.FormatRecord(*p)
+}
+
+// joinIDs returns the product IDs of a consistency finding as a single CSV column.
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
 	}
+	return strings.Join(parts, ";")
 }
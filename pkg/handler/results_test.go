@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+)
+
+// resultsRouter serves the results endpoints of a store holding the result of job "job":
+// four discrepancies in two categorias, one of them suppressed, and a three-way product.
+func resultsRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	result := &models.ComparisonResult{
+		Summary: models.Summary{
+			ByCategoria: map[string]models.GroupBreakdown{"Papelaria": {Total: 10, Matched: 8, Mismatched: 2}},
+		},
+		Errors: []models.ErrorDetail{
+			{Type: "mismatch", APIID: 1, CSVLine: 2, Categoria: "Papelaria", Severity: "high",
+				Fields: map[string]models.MismatchDetail{"preco": {APIValue: 3.0, CSVValue: 2.5}}},
+			{Type: "mismatch", APIID: 2, CSVLine: 3, Categoria: "Papelaria", Severity: "low",
+				Fields: map[string]models.MismatchDetail{"nome": {APIValue: "Lápis", CSVValue: "Lapis"}}},
+			{Type: "missing_in_csv", APIID: 3, Categoria: "Escritorio", Severity: "medium"},
+			{Type: "mismatch", APIID: 4, CSVLine: 4, Categoria: "Escritorio", Severity: "low", Suppressed: true, SuppressedBy: []string{"rule"},
+				Fields: map[string]models.MismatchDetail{"preco": {APIValue: 1.0, CSVValue: 1.01, SuppressedBy: "rule"}}},
+		},
+		StartedAt:   100,
+		CompletedAt: 101,
+		DurationMs:  1000,
+		ThreeWay: &models.ThreeWayResult{
+			Summary:  models.ThreeWaySummary{ChangedLocally: 1},
+			Products: []models.ThreeWayProduct{{ID: 1, Status: "changed_locally"}},
+		},
+	}
+	if err := store.SaveResult("job", result, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ResultsHandler{Store: store}
+	router := gin.New()
+	router.GET("/results/:job_id", h.HandleGetResult)
+	router.GET("/results/:job_id/export", h.HandleExportResult)
+	router.GET("/results/:job_id/facets", h.HandleGetFacets)
+	router.GET("/results/:job_id/summary", h.HandleGetSummary)
+	return router
+}
+
+func TestGetResult(t *testing.T) {
+	router := resultsRouter(t)
+
+	tests := []struct {
+		query string
+		ids   []int
+		total int
+	}{
+		{"", []int{1, 2, 3, 4}, 4},
+		{"?type=mismatch", []int{1, 2, 4}, 3},
+		{"?filter=preco", []int{1, 4}, 2},
+		{"?filter=nome&value=lápis", []int{2}, 1},
+		{"?severity=low", []int{2, 4}, 2},
+		{"?suppressed=false&type=mismatch", []int{1, 2}, 2},
+		{"?sort=api_id&order=desc", []int{4, 3, 2, 1}, 4},
+		{"?sort=api_id&order=desc&limit=2&page=2", []int{2, 1}, 4},
+		{"?limit=3&page=2", []int{4}, 4},
+		{"?limit=abc&page=0", []int{1, 2, 3, 4}, 4}, // Invalid paging falls back to the defaults
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/results/job"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("results = %d %s, want 200", w.Code, w.Body.String())
+			}
+			var got PaginatedResults
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, e := range got.Errors {
+				ids = append(ids, e.APIID)
+			}
+			if !slices.Equal(ids, tt.ids) || got.Pagination.TotalItems != tt.total {
+				t.Errorf("discrepancies %v of %d, want %v of %d", ids, got.Pagination.TotalItems, tt.ids, tt.total)
+			}
+			if got.Timing.DurationMs != 1000 {
+				t.Errorf("timing = %+v, want the stored one", got.Timing)
+			}
+		})
+	}
+}
+
+func TestResultsErrors(t *testing.T) {
+	router := resultsRouter(t)
+
+	tests := []struct {
+		target string
+		code   int
+		want   string
+	}{
+		{"/results/job?order=up", http.StatusBadRequest, "order must be asc or desc"},
+		{"/results/job?sort=name", http.StatusBadRequest, "unknown sort key"},
+		{"/results/missing", http.StatusNotFound, "job not found or expired"},
+		{"/results/missing/summary", http.StatusNotFound, "job not found or expired"},
+		{"/results/missing/facets?type=mismatch", http.StatusNotFound, "job not found or expired"},
+		{"/results/missing/export", http.StatusNotFound, "job not found or expired"},
+	}
+	for _, tt := range tests {
+		if w := serve(router, http.MethodGet, tt.target, ""); w.Code != tt.code || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET %s = %d %s, want %d mentioning %q", tt.target, w.Code, w.Body.String(), tt.code, tt.want)
+		}
+	}
+}
+
+func TestGetSummaryAndFacets(t *testing.T) {
+	router := resultsRouter(t)
+
+	w := serve(router, http.MethodGet, "/results/job/summary", "")
+	var summary ResultSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || summary.Summary.ByCategoria["Papelaria"].Matched != 8 || summary.Timing.StartedAt != 100 {
+		t.Errorf("summary = %d %s", w.Code, w.Body.String())
+	}
+
+	// Without filters the breakdowns of the summary are returned
+	w = serve(router, http.MethodGet, "/results/job/facets", "")
+	var facets FacetResults
+	if err := json.Unmarshal(w.Body.Bytes(), &facets); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || facets.TotalItems != 4 || facets.ByCategoria["Papelaria"].Total != 10 {
+		t.Errorf("facets = %d %s, want the breakdowns of the summary", w.Code, w.Body.String())
+	}
+
+	// With filters only the selected discrepancies are counted
+	w = serve(router, http.MethodGet, "/results/job/facets?severity=low", "")
+	facets = FacetResults{}
+	if err := json.Unmarshal(w.Body.Bytes(), &facets); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || facets.TotalItems != 2 || len(facets.ByCategoria) != 2 ||
+		facets.ByCategoria["Papelaria"].Mismatched != 1 || facets.ByCategoria["Escritorio"].Suppressed != 1 {
+		t.Errorf("filtered facets = %d %s, want the two low severity discrepancies", w.Code, w.Body.String())
+	}
+}
+
+func TestExportResult(t *testing.T) {
+	router := resultsRouter(t)
+
+	w := serve(router, http.MethodGet, "/results/job/export", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("json export = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var exported models.ComparisonResult
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("json export %s: %v", w.Body.String(), err)
+	}
+	if len(exported.Errors) != 4 || exported.Errors[3].APIID != 4 || exported.DurationMs != 1000 {
+		t.Errorf("exported result = %+v, want every discrepancy and the timing", exported)
+	}
+	if exported.ThreeWay == nil || exported.ThreeWay.Summary.ChangedLocally != 1 || len(exported.ThreeWay.Products) != 1 {
+		t.Errorf("exported three-way result = %+v, want its summary and product", exported.ThreeWay)
+	}
+
+	w = serve(router, http.MethodGet, "/results/job/export?format=csv", "")
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(rows) != 5 || rows[0][0] != "type" || rows[1][1] != "1" {
+		t.Errorf("csv export = %d with %d rows, want the header and a row per discrepancy", w.Code, len(rows))
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "result-job.csv") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobUpload opens the uploaded CSV of a job, or its baseline for a three-way job, from the
+// blob store. Jobs uploaded before the blob store kept their CSV in storage. It returns
+// storage.ErrNotFound when the file was not kept.
+func jobUpload(store storage.Store, blobs blob.Store, jobID string, baseline bool) (io.ReadCloser, error) {
+	meta, err := store.GetJobMeta(jobID)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	hash := ""
+	if meta != nil {
+		hash = meta.SourceHash
+		if baseline {
+			hash = meta.BaselineHash
+		}
+	}
+	if hash == "" {
+		if baseline {
+			return nil, storage.ErrNotFound
+		}
+		source, err := store.GetJobSource(jobID)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(source)), nil
+	}
+
+	r, err := blobs.Open(hash)
+	if err == blob.ErrNotFound {
+		return nil, storage.ErrNotFound
+	}
+	return r, err
+}
+
+// HandleGetJobSource downloads the exact file uploaded for a job.
+// Query params:
+// - file: "source" (default) for the uploaded CSV, or "baseline" for the baseline of a three-way job
+func (h *JobsHandler) HandleGetJobSource(c *gin.Context) {
+	jobID := c.Param("job_id")
+	file := c.DefaultQuery("file", "source")
+	if file != "source" && file != "baseline" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file must be source or baseline"})
+		return
+	}
+
+	r, err := jobUpload(h.Store, h.Blobs, jobID, file == "baseline")
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "the " + file + " file of this job was not kept or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve uploaded file"})
+		return
+	}
+	defer r.Close()
+
+	filename := file + "-" + jobID + ".csv"
+	extra := map[string]string{}
+	if meta, err := h.Store.GetJobMeta(jobID); err == nil {
+		hash := meta.SourceHash
+		if file == "source" {
+			filename = meta.Filename
+		} else {
+			hash = meta.BaselineHash
+		}
+		extra["ETag"] = `"` + hash + `"`
+	}
+	extra["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	c.DataFromReader(http.StatusOK, -1, "text/csv", r, extra)
+}
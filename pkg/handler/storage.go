@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"hackathon-go/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StorageHandler handles requests about the storage backend.
+type StorageHandler struct {
+	Store storage.Store
+}
+
+// HandleGetStats returns the format and compression of stored results, and the bytes
+// saved on the results written since the server started.
+func (h *StorageHandler) HandleGetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"encoding": h.Store.EncodingStats()})
+}
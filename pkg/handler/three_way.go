@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ThreeWayResults represents the paginated three-way classification of a job.
+type ThreeWayResults struct {
+	Summary    models.ThreeWaySummary   `json:"summary"`
+	Products   []models.ThreeWayProduct `json:"products"`
+	Pagination PaginationInfo           `json:"pagination"`
+}
+
+// HandleGetThreeWay returns the three-way classification of a job uploaded with a baseline CSV.
+// Unchanged products are only counted in the summary.
+//
+// Query parameters:
+// - page: page number for pagination (default: 1)
+// - limit: number of items per page (default: 100)
+// - status: changed_locally, changed_upstream or changed_both
+// - conflict: true for conflicting products only
+// - field: products with a change in this field (nome, categoria, preco, estoque, fornecedor)
+//
+// Examples:
+// - GET /results/123/three-way?conflict=true - Products both sides changed incompatibly
+// - GET /results/123/three-way?status=changed_upstream&field=preco - Prices changed in the API only
+func (h *ResultsHandler) HandleGetThreeWay(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if jobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_id is required"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || pageSize < 1 {
+		pageSize = 100
+	}
+
+	q := storage.ThreeWayQuery{
+		Status:   c.Query("status"),
+		Conflict: c.Query("conflict") == "true",
+		Field:    c.Query("field"),
+	}
+
+	threeWay, totalItems, err := h.Store.GetThreeWay(jobID, q, (page-1)*pageSize, pageSize)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve results"})
+		return
+	}
+	if threeWay == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job was not uploaded in three_way mode"})
+		return
+	}
+	totalPages := int(math.Ceil(float64(totalItems) / float64(pageSize)))
+
+	c.JSON(http.StatusOK, ThreeWayResults{
+		Summary:  threeWay.Summary,
+		Products: threeWay.Products,
+		Pagination: PaginationInfo{
+			CurrentPage: page,
+			PageSize:    pageSize,
+			TotalPages:  totalPages,
+			TotalItems:  totalItems,
+		},
+	})
+}
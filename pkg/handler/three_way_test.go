@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/storage"
+)
+
+func TestGetThreeWay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	h := &ResultsHandler{Store: store}
+	router := gin.New()
+	router.GET("/results/:job_id/three-way", h.HandleGetThreeWay)
+
+	price := map[string]models.ThreeWayField{"preco": {Base: 1.0, Local: 2.0, Upstream: 3.0, Changed: "both", Conflict: true}}
+	stock := map[string]models.ThreeWayField{"estoque": {Base: 1, Local: 1, Upstream: 2, Changed: "upstream"}}
+	threeWay := &models.ThreeWayResult{
+		Summary: models.ThreeWaySummary{Unchanged: 4, ChangedUpstream: 2, ChangedBoth: 1, Conflicts: 1},
+		Products: []models.ThreeWayProduct{
+			{ID: 1, Status: "changed_both", Conflict: true, Fields: price},
+			{ID: 2, Status: "changed_upstream", Fields: stock},
+			{ID: 3, Status: "changed_upstream", Fields: stock},
+		},
+	}
+	if err := store.SaveResult("three-way", &models.ComparisonResult{ThreeWay: threeWay}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveResult("two-way", &models.ComparisonResult{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		ids   []int
+		total int
+	}{
+		{"", []int{1, 2, 3}, 3},
+		{"?conflict=true", []int{1}, 1},
+		{"?status=changed_upstream", []int{2, 3}, 2},
+		{"?field=estoque&limit=1&page=2", []int{3}, 2},
+		{"?status=changed_locally", nil, 0},
+		{"?limit=x&page=0", []int{1, 2, 3}, 3}, // Invalid paging falls back to the defaults
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/results/three-way/three-way"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("three-way = %d %s, want 200", w.Code, w.Body.String())
+			}
+			var got ThreeWayResults
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, p := range got.Products {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.ids) || got.Pagination.TotalItems != tt.total {
+				t.Errorf("products %v of %d, want %v of %d", ids, got.Pagination.TotalItems, tt.ids, tt.total)
+			}
+			if got.Summary.Unchanged != 4 || got.Summary.Conflicts != 1 {
+				t.Errorf("summary = %+v, want the whole classification", got.Summary)
+			}
+		})
+	}
+
+	for target, want := range map[string]string{
+		"/results/missing/three-way": "job not found or expired",
+		"/results/two-way/three-way": "not uploaded in three_way mode",
+	} {
+		if w := serve(router, http.MethodGet, target, ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("GET %s = %d %s, want 404 mentioning %q", target, w.Code, w.Body.String(), want)
+		}
+	}
+}
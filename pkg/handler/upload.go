@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"hackathon-go/internal/api"
+	"hackathon-go/internal/blob"
 	"hackathon-go/internal/comparison"
 	"hackathon-go/internal/csv"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/queue"
 	"hackathon-go/internal/storage"
 	"hackathon-go/internal/ws"
 	"net/http"
@@ -17,7 +20,13 @@ import (
 
 // UploadHandler handles the CSV upload and comparison initiation.
 type UploadHandler struct {
-	Redis *storage.RedisClient
+	Store              storage.Store
+	Blobs              blob.Store         // Keeps the uploaded files
+	Queue              queue.Queue        // Holds the comparisons to run, see RunJob
+	Options            comparison.Options // Default comparison options, overridable per upload
+	StreamingThreshold int64              // Uploads larger than this many bytes are compared out of core (0 disables)
+	SpillDir           string             // Directory for the sorted runs of streaming comparisons
+	Retention          time.Duration      // How long jobs are kept (0 keeps them until deleted)
 }
 
 // sendProgress sends both status and progress updates via WebSocket
@@ -32,9 +41,9 @@ func (h *UploadHandler) sendProgress(jobID, status string, progressPercent float
 		ws.HubInstance.Send(jobID, string(progressJSON))
 	}
 
-	// Store progress in Redis for API calls
-	h.Redis.SetJobStatus(jobID, status)
-	h.Redis.SetJobProgress(jobID, int(progressPercent))
+	// Store progress for API calls
+	h.Store.SetJobStatus(jobID, status, h.Retention)
+	h.Store.SetJobProgress(jobID, int(progressPercent), h.Retention)
 }
 
 // HandleUpload is the Gin handler function for the upload endpoint.
@@ -45,6 +54,16 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		return
 	}
 
+	// Per-upload overrides of the comparison options, given as a JSON document
+	opts := h.Options
+	if raw := c.PostForm("options"); raw != "" {
+		opts, err = h.Options.WithOverrides([]byte(raw))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	f, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not open file"})
@@ -54,70 +73,288 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 
 	// Generate job ID early so we can stream progress immediately
 	jobID := uuid.New().String()
-	c.JSON(http.StatusOK, gin.H{"job_id": jobID})
 
-	// Capture start time for processing
-	startTime := time.Now()
+	mode := c.PostForm("mode")
+	uploader := c.PostForm("uploader")
+	if uploader == "" {
+		uploader = c.ClientIP()
+	}
+	h.createJob(&models.JobMeta{
+		ID:        jobID,
+		Filename:  file.Filename,
+		Size:      file.Size,
+		Mode:      mode,
+		Uploader:  uploader,
+		Status:    models.JobQueued,
+		CreatedAt: time.Now().Unix(),
+	})
 
 	// Inform websocket clients that job has been created
 	h.sendProgress(jobID, "job_created", 11.11)
-	h.sendProgress(jobID, "parsing_csv", 22.22)
 
-	csvProducts, err := csv.ParseProducts(f)
+	// The upload is kept with the job for audit, corrected copies and re-runs, and the job
+	// processes the stored copy
+	sourceHash, _, err := h.Blobs.Put(f)
 	if err != nil {
-		h.sendProgress(jobID, "error_parsing_csv", 0)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse CSV: " + err.Error()})
+		fmt.Printf("Warning: Failed to store uploaded file of job %s: %v\n", jobID, err)
+		h.failJob(jobID, "error_storing_upload")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not store file"})
 		return
 	}
-	h.sendProgress(jobID, "csv_parsed", 33.33)
+	h.updateJob(jobID, func(meta *models.JobMeta) { meta.SourceHash = sourceHash })
 
-	// Run comparison in a goroutine to not block the request
-	go func() {
-		// Step 1: Try to get API products from cache first
-		h.sendProgress(jobID, "checking_cache", 44.44)
+	// Three-way jobs also compare the upload against a baseline CSV, kept alongside it
+	var baselineHash string
+	if mode == "three_way" {
+		baselineHash, err = h.storeBaseline(c)
+		if err != nil {
+			h.failJob(jobID, "error_parsing_csv")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.updateJob(jobID, func(meta *models.JobMeta) { meta.BaselineHash = baselineHash })
+	}
 
-		apiProducts, err := h.Redis.GetAPIProducts()
-		if err != nil || len(apiProducts) == 0 {
-			// Cache is empty or expired, fetch from API
-			h.sendProgress(jobID, "fetching_api_products", 44.44)
+	opts = h.withIgnoreRules(opts, time.Now())
+	streaming := mode == "streaming" || (mode != "three_way" && h.StreamingThreshold > 0 && file.Size > h.StreamingThreshold)
+	inputs := comparisonInputs{
+		SourceHash:   sourceHash,
+		BaselineHash: baselineHash,
+		Mode:         mode,
+		Streaming:    streaming,
+		Options:      opts,
+	}
 
-			apiProducts, err = api.FetchProducts(jobID)
-			if err != nil {
-				h.sendProgress(jobID, "error_fetching_api_products", 0)
+	// An identical comparison against the cached API snapshot is reused unless forced
+	if c.PostForm("force") != "true" {
+		if original := h.identicalJob(inputs, h.cachedSnapshot()); original != nil {
+			if err := h.linkJob(jobID, original); err == nil {
+				c.JSON(http.StatusOK, gin.H{"job_id": jobID, "cached": true, "cached_from": original.ID})
 				return
 			}
+			fmt.Printf("Warning: Failed to reuse the result of job %s for job %s: %v\n", original.ID, jobID, err)
+		}
+	}
 
-			// Save the fetched products to cache with 5-minute TTL
-			if cacheErr := h.Redis.SaveAPIProducts(apiProducts); cacheErr != nil {
-				fmt.Printf("Warning: Failed to save API products to cache: %v\n", cacheErr)
-			}
+	// Files compared in memory are parsed now so a bad file is reported to the uploader;
+	// large files are only parsed by the worker
+	if !streaming {
+		csvRows, err := h.validateUpload(sourceHash, baselineHash)
+		if err != nil {
+			h.failJob(jobID, "error_parsing_csv")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.updateJob(jobID, func(meta *models.JobMeta) { meta.CSVRows = csvRows })
+	}
+
+	// The comparison runs on a worker, possibly in another process
+	h.sendProgress(jobID, "job_queued", 11.11)
+	if err := h.enqueueJob(jobID, inputs); err != nil {
+		fmt.Printf("Warning: Failed to queue job %s: %v\n", jobID, err)
+		h.failJob(jobID, "error_queueing_job")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not queue comparison"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID, "cached": false})
+}
+
+// storeBaseline stores the baseline CSV of a three-way upload in the blob store and
+// returns its hash.
+func (h *UploadHandler) storeBaseline(c *gin.Context) (string, error) {
+	file, err := c.FormFile("baseline")
+	if err != nil {
+		return "", fmt.Errorf("three_way mode requires a baseline file")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("could not open baseline file")
+	}
+	defer f.Close()
+
+	hash, _, err := h.Blobs.Put(f)
+	if err != nil {
+		return "", fmt.Errorf("could not store baseline file")
+	}
+	return hash, nil
+}
 
-			h.sendProgress(jobID, "api_products_fetched_and_cached", 55.55)
-		} else {
-			// Use cached products
-			h.sendProgress(jobID, "using_cached_api_products", 55.55)
+// validateUpload parses a stored upload, and the baseline of three-way uploads, and
+// returns the number of products of the upload.
+func (h *UploadHandler) validateUpload(sourceHash, baselineHash string) (int, error) {
+	products, err := h.parseSource(sourceHash)
+	if err != nil {
+		return 0, err
+	}
+	if baselineHash != "" {
+		if _, err := h.parseBaseline(baselineHash); err != nil {
+			return 0, err
 		}
+	}
+	return len(products), nil
+}
 
-		// Step 2: Compare products
-		h.sendProgress(jobID, "comparing_products", 66.66)
-		result := comparison.CompareProducts(apiProducts, csvProducts)
+// parseSource parses the stored CSV of an upload.
+func (h *UploadHandler) parseSource(hash string) ([]models.Product, error) {
+	stored, err := h.Blobs.Open(hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not read stored file")
+	}
+	defer stored.Close()
 
-		// Calculate processing duration
-		endTime := time.Now()
-		duration := endTime.Sub(startTime)
+	products, err := csv.ParseProducts(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return products, nil
+}
 
-		// Add timing information to result
-		result.StartedAt = startTime.Unix()
-		result.CompletedAt = endTime.Unix()
-		result.DurationMs = duration.Milliseconds()
+// parseBaseline parses the stored baseline CSV of a three-way upload.
+func (h *UploadHandler) parseBaseline(hash string) ([]models.Product, error) {
+	stored, err := h.Blobs.Open(hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not read stored baseline file")
+	}
+	defer stored.Close()
 
-		h.sendProgress(jobID, "comparison_done", 77.77)
+	products, err := csv.ParseProducts(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse baseline CSV: %w", err)
+	}
+	if products == nil {
+		products = []models.Product{}
+	}
+	return products, nil
+}
+
+// withIgnoreRules adds the stored ignore rules to the comparison options and keeps those
+// in effect now. The job is compared and fingerprinted with that set, so a rule expiring
+// before a worker runs the job still applies, as it did when the upload was checked for
+// an identical job.
+func (h *UploadHandler) withIgnoreRules(opts comparison.Options, now time.Time) comparison.Options {
+	rules, err := h.Store.GetIgnoreRules()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load ignore rules: %v\n", err)
+		rules = nil
+	}
+	opts.IgnoreRules = comparison.ActiveIgnoreRules(append(append([]models.IgnoreRule{}, opts.IgnoreRules...), rules...), now)
+	return opts
+}
 
-		// Step 3: Store results
-		h.Redis.SaveResult(jobID, &result, time.Hour*24)
-		h.sendProgress(jobID, "saved_results", 88.88)
-		h.sendProgress(jobID, "finished", 100.0)
+// loadAPIProducts returns the API products from the cache, fetching and caching them when
+// the cache is empty, with their storage.SnapshotVersion.
+func (h *UploadHandler) loadAPIProducts(jobID string) ([]models.Product, string, error) {
+	// Step 1: Try to get API products from cache first
+	h.sendProgress(jobID, "checking_cache", 44.44)
+
+	apiProducts, version, err := h.Store.GetAPIProducts()
+	if err == nil && len(apiProducts) > 0 {
+		// Use cached products
+		h.sendProgress(jobID, "using_cached_api_products", 55.55)
+		return apiProducts, version, nil
+	}
+
+	// Cache is empty or expired, fetch from API
+	h.sendProgress(jobID, "fetching_api_products", 44.44)
+
+	apiProducts, err = api.FetchProducts(jobID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Save the fetched products to cache with 5-minute TTL
+	version, cacheErr := h.Store.SaveAPIProducts(apiProducts)
+	if cacheErr != nil {
+		fmt.Printf("Warning: Failed to save API products to cache: %v\n", cacheErr)
+	}
+	if version == "" {
+		version = storage.SnapshotVersion(apiProducts)
+	}
+
+	h.sendProgress(jobID, "api_products_fetched_and_cached", 55.55)
+	return apiProducts, version, nil
+}
 
-		fmt.Printf("Comparison done in %v\n", duration)
-	}()
+// finishJob stamps the timing information on the result and stores it, recording its
+// fingerprint so identical comparisons can reuse it.
+func (h *UploadHandler) finishJob(jobID string, result *models.ComparisonResult, startTime time.Time, fingerprint string) error {
+	// Calculate processing duration
+	endTime := time.Now()
+	duration := endTime.Sub(startTime)
+
+	// Add timing information to result
+	result.StartedAt = startTime.Unix()
+	result.CompletedAt = endTime.Unix()
+	result.DurationMs = duration.Milliseconds()
+
+	h.sendProgress(jobID, "comparison_done", 77.77)
+
+	// Step 3: Store results
+	if err := h.Store.SaveResult(jobID, result, h.Retention); err != nil {
+		return &stepError{status: "error_saving_results", err: err}
+	}
+	if err := h.Store.SetFingerprint(fingerprint, jobID, h.Retention); err != nil {
+		fmt.Printf("Warning: Failed to record fingerprint of job %s: %v\n", jobID, err)
+	}
+	h.updateJob(jobID, func(meta *models.JobMeta) {
+		meta.Status = models.JobCompleted
+		meta.Fingerprint = fingerprint
+		meta.FinishedAt = endTime.Unix()
+		meta.CSVRows = result.Summary.TotalCSVItems
+		meta.APIRows = result.Summary.TotalAPIItems
+		meta.Counts = jobCounts(result.Summary)
+	})
+	h.sendProgress(jobID, "saved_results", 88.88)
+	h.sendProgress(jobID, "finished", 100.0)
+
+	fmt.Printf("Comparison done in %v\n", duration)
+	return nil
+}
+
+// createJob adds a new job to the job index.
+func (h *UploadHandler) createJob(meta *models.JobMeta) {
+	meta.ExpiresAt = expiresAt(h.Retention)
+	if err := h.Store.SaveJobMeta(meta, h.Retention); err != nil {
+		fmt.Printf("Warning: Failed to index job %s: %v\n", meta.ID, err)
+	}
+}
+
+// updateJob applies update to the indexed metadata of a job atomically. The job keeps its
+// retention, see keptFor.
+func (h *UploadHandler) updateJob(jobID string, update func(meta *models.JobMeta)) {
+	err := h.Store.UpdateJobMeta(jobID, func(meta *models.JobMeta) (time.Duration, error) {
+		update(meta)
+		expiration := keptFor(meta, h.Retention)
+		meta.ExpiresAt = expiresAt(expiration)
+		return expiration, nil
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to update job %s in the index: %v\n", jobID, err)
+	}
+}
+
+// failJob reports a failed step and marks the job failed in the index.
+func (h *UploadHandler) failJob(jobID, status string) {
+	h.sendProgress(jobID, status, 0)
+	h.updateJob(jobID, func(meta *models.JobMeta) {
+		meta.Status = models.JobFailed
+		meta.Error = status
+		meta.FinishedAt = time.Now().Unix()
+	})
+}
+
+// jobCounts extracts the counts of a summary kept in the job index.
+func jobCounts(s models.Summary) *models.JobCounts {
+	return &models.JobCounts{
+		Matched:        s.Matched,
+		NearMatched:    s.NearMatched,
+		Mismatched:     s.Mismatched,
+		MissingInCSV:   s.MissingInCSV,
+		MissingInAPI:   s.MissingInAPI,
+		IDChanged:      s.IDChanged,
+		Suppressed:     s.Suppressed,
+		RuleViolations: s.RuleViolations,
+		Consistency:    s.Consistency,
+		Discrepancies:  s.NearMatched + s.Mismatched + s.MissingInCSV + s.MissingInAPI + s.IDChanged,
+	}
 }
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/storage"
+)
+
+func TestUploadRejectsInvalidOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &UploadHandler{Store: storage.NewMemoryStore(), Options: comparison.DefaultOptions()}
+	router := gin.New()
+	router.POST("/upload", h.HandleUpload)
+
+	tests := []struct {
+		name    string
+		options string
+		want    string
+	}{
+		{"unknown numeric field", `{"numeric": {"prco": {"abs_tolerance": 1}}}`, "prco"},
+		{"unknown similarity field", `{"similarity": {"preco": {"algorithm": "levenshtein", "threshold": 0.9}}}`, `not \"preco\"`},
+		{"negative tolerance", `{"numeric": {"preco": {"abs_tolerance": -1}}}`, "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, err := form.CreateFormFile("file", "produtos.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte("id,nome,categoria,preco,estoque,fornecedor\n"))
+			form.WriteField("options", tt.options)
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("upload = %d %s, want 400 mentioning %s", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
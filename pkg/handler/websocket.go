@@ -9,11 +9,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
+	"hackathon-go/internal/storage"
 	"hackathon-go/internal/ws"
 )
 
-// WebSocketHandler manages websocket connections for job progress updates.
-type WebSocketHandler struct{}
+// defaultPollInterval is how often the status and progress of a job are read from the store.
+const defaultPollInterval = 500 * time.Millisecond
+
+// WebSocketHandler manages websocket connections for job progress updates. Workers of
+// any process record the status and progress of their jobs in Store, which the handler
+// polls; workers running in this process also send them right away through ws.HubInstance.
+type WebSocketHandler struct {
+	Store        storage.Store
+	PollInterval time.Duration // defaultPollInterval when 0
+}
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
@@ -51,9 +60,69 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		time.Now().Format("15:04:05.000"), jobID, initialMsg)
 	_ = conn.WriteJSON(initialMsg)
 
+	// The client sends nothing; reading notices when it goes away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	interval := h.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The last status and progress sent, and the last ones read from the store. A stored
+	// value is sent once, unless the hub already sent it.
+	var sentStatus, storedStatus string
+	sentProgress, storedProgress := -1, -1
+	poll := func() error {
+		if h.Store == nil {
+			return nil
+		}
+		if status, err := h.Store.GetJobStatus(jobID); err == nil && status != storedStatus {
+			storedStatus = status
+			if status != sentStatus {
+				sentStatus = status
+				if err := conn.WriteJSON(gin.H{"type": "status", "status": status}); err != nil {
+					return err
+				}
+			}
+		}
+		if progress, err := h.Store.GetJobProgress(jobID); err == nil && progress != storedProgress {
+			storedProgress = progress
+			if progress != sentProgress {
+				sentProgress = progress
+				if err := conn.WriteJSON(gin.H{"type": "progress", "progress": float64(progress)}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := poll(); err != nil {
+		return
+	}
+
 	// Listen until the channel is closed or websocket errors.
 	for {
 		select {
+		case <-closed:
+			fmt.Printf("[DEBUG] [%s] WebSocket handler: Connection closed for job %s\n",
+				time.Now().Format("15:04:05.000"), jobID)
+			return
+		case <-ticker.C:
+			if err := poll(); err != nil {
+				fmt.Printf("[ERROR] [%s] WebSocket handler: Failed to send stored progress to frontend for job %s: %v\n",
+					time.Now().Format("15:04:05.000"), jobID, err)
+				return
+			}
 		case msg, ok := <-progressCh:
 			if !ok {
 				// channel closed – job finished or server shutting down
@@ -70,6 +139,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			var progressPayload map[string]float64
 			if err := json.Unmarshal([]byte(msg), &progressPayload); err == nil {
 				if progress, ok := progressPayload["progress"]; ok {
+					sentProgress = int(progress)
 					progressMsg := gin.H{"type": "progress", "progress": progress}
 					fmt.Printf("[DEBUG] [%s] WebSocket handler: Sending progress update to frontend for job %s: %.4f\n",
 						time.Now().Format("15:04:05.000"), jobID, progress)
@@ -83,6 +153,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			}
 
 			// Fallback: treat as plain status string.
+			sentStatus = msg
 			statusMsg := gin.H{"type": "status", "status": msg}
 			fmt.Printf("[DEBUG] [%s] WebSocket handler: Sending status message to frontend for job %s: %s\n",
 				time.Now().Format("15:04:05.000"), jobID, msg)
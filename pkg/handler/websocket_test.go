@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"hackathon-go/internal/storage"
+)
+
+func TestWebSocketStreamsStoredProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	h := &WebSocketHandler{Store: store, PollInterval: 10 * time.Millisecond}
+	router := gin.New()
+	router.GET("/ws/:job_id", h.HandleWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/job", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A worker of another process records the progress of the job in the store
+	if err := store.SetJobStatus("job", "comparing_products", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetJobProgress("job", 66, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var gotStatus, gotProgress bool
+	for !gotStatus || !gotProgress {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading messages: %v (status seen: %v, progress seen: %v)", err, gotStatus, gotProgress)
+		}
+		switch {
+		case msg["type"] == "status" && msg["status"] == "comparing_products":
+			gotStatus = true
+		case msg["type"] == "progress" && msg["progress"] == 66.0:
+			gotProgress = true
+		}
+	}
+}
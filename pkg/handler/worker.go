@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hackathon-go/internal/blob"
+	"hackathon-go/internal/comparison"
+	"hackathon-go/internal/csv"
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/queue"
+	"hackathon-go/internal/storage"
+	"io"
+	"time"
+)
+
+// stepError is a failed step of a job that may succeed when the job runs again.
+type stepError struct {
+	status string // Step reported to clients, e.g. error_fetching_api_products
+	err    error
+}
+
+func (e *stepError) Error() string {
+	return e.status + ": " + e.err.Error()
+}
+
+func (e *stepError) Unwrap() error {
+	return e.err
+}
+
+// enqueueJob queues the comparison of a job. The task carries the comparison inputs.
+func (h *UploadHandler) enqueueJob(jobID string, inputs comparisonInputs) error {
+	payload, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	return h.Queue.Enqueue(&queue.Task{JobID: jobID, Payload: payload})
+}
+
+// RunJob runs the comparison of a queued job. Failures of the job itself, such as an
+// invalid CSV, fail the job; transient failures, such as an unreachable API, are returned
+// so the job is retried.
+func (h *UploadHandler) RunJob(task *queue.Task) error {
+	jobID := task.JobID
+	var inputs comparisonInputs
+	if err := json.Unmarshal(task.Payload, &inputs); err != nil {
+		fmt.Printf("Warning: Unreadable task %s of job %s: %v\n", task.ID, jobID, err)
+		h.failJob(jobID, "error_reading_job")
+		return nil
+	}
+
+	// Jobs deleted or expired while queued are dropped
+	if _, err := h.Store.GetJobMeta(jobID); err == storage.ErrNotFound {
+		fmt.Printf("Warning: Dropping task %s of job %s, which no longer exists\n", task.ID, jobID)
+		return nil
+	}
+
+	startTime := time.Now()
+	h.updateJob(jobID, func(meta *models.JobMeta) {
+		meta.Status = models.JobRunning
+		meta.StartedAt = startTime.Unix()
+		meta.HeartbeatAt = startTime.Unix()
+		meta.Attempts = task.Attempts
+	})
+	if task.Attempts > 1 {
+		// An earlier attempt may have stored part of the result
+		if err := h.Store.ClearJobResult(jobID); err != nil {
+			return &stepError{status: "error_saving_results", err: err}
+		}
+	}
+
+	h.sendProgress(jobID, "parsing_csv", 22.22)
+	stored, err := h.Blobs.Open(inputs.SourceHash)
+	if err == blob.ErrNotFound {
+		h.failJob(jobID, "error_reading_upload")
+		return nil
+	}
+	if err != nil {
+		return &stepError{status: "error_reading_upload", err: err}
+	}
+	defer stored.Close()
+
+	// Large files are compared out of core: both sides are spilled to disk sorted by ID
+	if inputs.Streaming {
+		return h.runStreamingJob(jobID, stored, inputs, startTime)
+	}
+
+	csvProducts, err := csv.ParseProducts(stored)
+	if err != nil {
+		h.failJob(jobID, "error_parsing_csv")
+		return nil
+	}
+	var baseline []models.Product
+	if inputs.BaselineHash != "" {
+		if baseline, err = h.parseBaseline(inputs.BaselineHash); err != nil {
+			h.failJob(jobID, "error_parsing_csv")
+			return nil
+		}
+	}
+	h.updateJob(jobID, func(meta *models.JobMeta) { meta.CSVRows = len(csvProducts) })
+	h.sendProgress(jobID, "csv_parsed", 33.33)
+
+	apiProducts, snapshot, err := h.loadAPIProducts(jobID)
+	if err != nil {
+		return &stepError{status: "error_fetching_api_products", err: err}
+	}
+	if err := h.Store.SaveJobAPIProducts(jobID, apiProducts, h.Retention); err != nil {
+		fmt.Printf("Warning: Failed to save API snapshot of job %s: %v\n", jobID, err)
+	}
+
+	// Step 2: Compare products
+	h.sendProgress(jobID, "comparing_products", 66.66)
+	result := comparison.CompareProducts(apiProducts, csvProducts, inputs.Options)
+	if baseline != nil {
+		threeWay := comparison.CompareThreeWay(baseline, csvProducts, apiProducts, inputs.Options)
+		result.ThreeWay = &threeWay
+	}
+	return h.finishJob(jobID, &result, startTime, inputs.fingerprint(snapshot))
+}
+
+// runStreamingJob spills the uploaded CSV and the API products to sorted runs on disk, then
+// merge-joins them, appending discrepancies to storage as they are found.
+func (h *UploadHandler) runStreamingJob(jobID string, f io.Reader, inputs comparisonInputs, startTime time.Time) error {
+	csvSorter := comparison.NewSpillSorter(h.SpillDir, 0)
+	defer csvSorter.Close()
+	if err := csv.StreamProducts(f, csvSorter.Add); err != nil {
+		h.failJob(jobID, "error_parsing_csv")
+		return nil
+	}
+	h.sendProgress(jobID, "csv_parsed", 33.33)
+
+	apiSorter := comparison.NewSpillSorter(h.SpillDir, 0)
+	defer apiSorter.Close()
+
+	apiProducts, snapshot, err := h.loadAPIProducts(jobID)
+	if err != nil {
+		return &stepError{status: "error_fetching_api_products", err: err}
+	}
+	fingerprint := inputs.fingerprint(snapshot)
+	for _, p := range apiProducts {
+		if err := apiSorter.Add(p); err != nil {
+			return &stepError{status: "error_comparing_products", err: err}
+		}
+	}
+	apiProducts = nil
+
+	h.sendProgress(jobID, "comparing_products", 66.66)
+	apiIter, err := apiSorter.Sorted()
+	if err != nil {
+		return &stepError{status: "error_comparing_products", err: err}
+	}
+	defer apiIter.Close()
+	csvIter, err := csvSorter.Sorted()
+	if err != nil {
+		return &stepError{status: "error_comparing_products", err: err}
+	}
+	defer csvIter.Close()
+
+	sink := h.Store.NewErrorWriter(jobID, h.Retention)
+	summary, err := comparison.CompareSorted(apiIter, csvIter, inputs.Options, sink)
+	if err != nil {
+		fmt.Printf("Streaming comparison failed for job %s: %v\n", jobID, err)
+		return &stepError{status: "error_comparing_products", err: err}
+	}
+
+	result := models.ComparisonResult{Summary: summary, Errors: []models.ErrorDetail{}, Streamed: true}
+	return h.finishJob(jobID, &result, startTime, fingerprint)
+}
+
+// errJobNotRunning aborts the heartbeat of a job that is no longer running.
+var errJobNotRunning = errors.New("job is not running")
+
+// JobHeartbeat records that the worker running a job is alive, each time it extends the
+// task, so the sweeper does not fail long jobs. The retention of the job is unchanged.
+func (h *UploadHandler) JobHeartbeat(task *queue.Task) {
+	err := h.Store.UpdateJobMeta(task.JobID, func(meta *models.JobMeta) (time.Duration, error) {
+		if meta.Status != models.JobRunning {
+			return 0, errJobNotRunning
+		}
+		meta.HeartbeatAt = time.Now().Unix()
+		return storedExpiration(meta), nil
+	})
+	if err != nil && err != errJobNotRunning && err != storage.ErrNotFound {
+		fmt.Printf("Warning: Failed to record the heartbeat of job %s: %v\n", task.JobID, err)
+	}
+}
+
+// JobFailed records a failed attempt at a job: the job is queued again, or failed with
+// the step that failed once its task is dead-lettered.
+func (h *UploadHandler) JobFailed(task *queue.Task, err error, dead bool) {
+	if !dead {
+		h.sendProgress(task.JobID, "job_requeued", 11.11)
+		h.updateJob(task.JobID, func(meta *models.JobMeta) { meta.Status = models.JobQueued })
+		return
+	}
+
+	status := "error_processing_job"
+	var step *stepError
+	if errors.As(err, &step) {
+		status = step.status
+	} else if errors.Is(err, queue.ErrTimedOut) {
+		status = "error_timed_out"
+	}
+	h.failJob(task.JobID, status)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"hackathon-go/internal/models"
+	"hackathon-go/internal/queue"
+	"hackathon-go/internal/storage"
+)
+
+func TestJobHeartbeat(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := &UploadHandler{Store: store, Retention: time.Hour}
+	stale := time.Now().Add(-time.Hour).Unix()
+	expires := time.Now().Add(10 * time.Minute).Unix()
+	for _, meta := range []*models.JobMeta{
+		{ID: "running", Status: models.JobRunning, StartedAt: stale, HeartbeatAt: stale, ExpiresAt: expires},
+		{ID: "failed", Status: models.JobFailed, HeartbeatAt: stale, ExpiresAt: expires},
+	} {
+		if err := store.SaveJobMeta(meta, 10*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, jobID := range []string{"running", "failed", "missing"} {
+		h.JobHeartbeat(&queue.Task{JobID: jobID})
+	}
+
+	running, err := store.GetJobMeta("running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(time.Unix(running.HeartbeatAt, 0)) > time.Minute {
+		t.Errorf("heartbeat of the running job at %d, want now", running.HeartbeatAt)
+	}
+	if running.ExpiresAt != expires || running.StartedAt != stale {
+		t.Errorf("running job after a heartbeat = %+v, want its expiry and start kept", running)
+	}
+	if failed, _ := store.GetJobMeta("failed"); failed.HeartbeatAt != stale || failed.Status != models.JobFailed {
+		t.Errorf("failed job after a heartbeat = %+v, want it unchanged", failed)
+	}
+	if _, err := store.GetJobMeta("missing"); err != storage.ErrNotFound {
+		t.Errorf("heartbeat of a missing job created it: %v", err)
+	}
+
+	// A job reporting heartbeats is not swept however long it runs
+	if err := store.SetJobStatus("running", "comparing_products", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	swept, err := store.SweepOrphans(5 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swept) != 0 {
+		t.Errorf("SweepOrphans = %v, want the running job kept", swept)
+	}
+}